@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	bolt "go.etcd.io/bbolt"
+)
+
+/*
+Persistent key-value cache of expensive lookups, shared by all collectors and kept across runs:
+checksums of artifacts, HEAD results and GitHub API responses.
+
+Entries expire after their TTLs. The cache is a bbolt database in the cache dir, each bucket a bolt bucket,
+each value json with its expiry. Writes are committed at once, expired entries are dropped on Close.
+Without Open, or after Close, the cache is off: Get misses and Set does nothing.
+*/
+
+const (
+	DirName  string = "cache"
+	FileName string = "cache.db"
+
+	BucketSums   string = "sums"   // sum file url, or "<sum type> <artifact url>" -> sum.
+	BucketHead   string = "head"   // url -> HEAD result.
+	BucketGithub string = "github" // api url -> response body.
+
+	// Artifacts never change under the same url, their sums are kept long.
+	SumsTtl = 30 * 24 * time.Hour
+
+	// bbolt locks the file, other processes wait for it this long.
+	OpenTimeout = 3 * time.Second
+)
+
+type entry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires int64           `json:"expires"` // unix seconds.
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.Expires < now
+}
+
+type Store struct {
+	db *bolt.DB
+}
+
+var (
+	storeLock = &sync.Mutex{}
+	store     *Store
+)
+
+// Opens the cache in dir for this run, a cache that can not be opened is off.
+func Open(dir string) {
+	s, err := OpenStore(dir)
+	if err != nil {
+		logs.Warning("Open cache failed, cache is off: %+v", err)
+		return
+	}
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	store = s
+}
+
+// Prunes and closes the cache.
+func Close() {
+	storeLock.Lock()
+	s := store
+	store = nil
+	storeLock.Unlock()
+	if s == nil {
+		return
+	}
+	if err := s.Close(); err != nil {
+		logs.Warning("Close cache failed: %+v", err)
+	}
+}
+
+func current() *Store {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	return store
+}
+
+// Decodes the value of key into v, false when it is missing or expired.
+func Get(bucketName, key string, v any) bool {
+	if s := current(); s != nil {
+		return s.Get(bucketName, key, v)
+	}
+	return false
+}
+
+func Set(bucketName, key string, v any, ttl time.Duration) {
+	if s := current(); s != nil {
+		s.Set(bucketName, key, v, ttl)
+	}
+}
+
+func dbPath(dir string) string {
+	return filepath.Join(dir, FileName)
+}
+
+// Opens the database in dir, read-only ones must exist.
+func openDb(dir string, readOnly bool) (*bolt.DB, error) {
+	fPath := dbPath(dir)
+	if readOnly {
+		if _, err := os.Stat(fPath); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return bolt.Open(fPath, 0o600, &bolt.Options{Timeout: OpenTimeout, ReadOnly: readOnly})
+}
+
+// Opens the database in dir, buckets of older versions, json files, are moved into it.
+func OpenStore(dir string) (*Store, error) {
+	db, err := openDb(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err = s.importLegacy(dir); err != nil {
+		logs.Warning("Import old cache failed: %+v", err)
+	}
+	return s, nil
+}
+
+// Drops expired entries and closes the database.
+func (s *Store) Close() error {
+	_, _, err := prune(s.db, false)
+	if cErr := s.db.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+func (s *Store) Get(bucketName, key string, v any) (ok bool) {
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+		content := b.Get([]byte(key))
+		if content == nil {
+			return nil
+		}
+		// content is only valid in the transaction.
+		e := &entry{}
+		if json.Unmarshal(content, e) != nil || e.expired(time.Now().Unix()) {
+			return nil
+		}
+		ok = json.Unmarshal(e.Value, v) == nil
+		return nil
+	})
+	return
+}
+
+func (s *Store) Set(bucketName, key string, v any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	content, _ := json.Marshal(&entry{Value: value, Expires: time.Now().Add(ttl).Unix()})
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), content)
+	})
+	if err != nil {
+		logs.Warning("Cache %s failed: %+v", bucketName, err)
+	}
+}
+
+// Moves the live entries of json buckets in dir into the database, and removes the files.
+func (s *Store) importLegacy(dir string) error {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	now := time.Now().Unix()
+	for _, fPath := range matches {
+		entries := map[string]*entry{}
+		if content, err := os.ReadFile(fPath); err == nil && json.Unmarshal(content, &entries) == nil {
+			name := strings.TrimSuffix(filepath.Base(fPath), ".json")
+			err = s.db.Update(func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+				for k, e := range entries {
+					if e == nil || e.expired(now) {
+						continue
+					}
+					content, _ := json.Marshal(e)
+					if err := b.Put([]byte(k), content); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(fPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type BucketInfo struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	Expired int    `json:"expired"`
+	Size    int64  `json:"size"` // bytes of keys and values.
+}
+
+// Buckets in dir, for pxy cache.
+func List(dir string) (r []*BucketInfo) {
+	db, err := openDb(dir, true)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logs.Warning("Open cache failed: %+v", err)
+		}
+		return
+	}
+	defer db.Close()
+	now := time.Now().Unix()
+	db.View(func(tx *bolt.Tx) error {
+		// buckets are sorted by name.
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			info := &BucketInfo{Name: string(name)}
+			b.ForEach(func(k, v []byte) error {
+				info.Entries++
+				info.Size += int64(len(k) + len(v))
+				e := &entry{}
+				if json.Unmarshal(v, e) != nil || e.expired(now) {
+					info.Expired++
+				}
+				return nil
+			})
+			r = append(r, info)
+			return nil
+		})
+	})
+	return
+}
+
+// Removes buckets in dir, all buckets when names are empty.
+func Clear(dir string, names ...string) error {
+	if len(names) == 0 {
+		return os.RemoveAll(dir)
+	}
+	if _, err := os.Stat(dbPath(dir)); os.IsNotExist(err) {
+		return nil
+	}
+	db, err := openDb(dir, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Drops expired entries of all buckets in dir, and buckets left empty, for pxy clean.
+Returns the entries dropped and the bytes of their keys and values. bbolt reuses the freed pages,
+the file itself does not shrink.
+*/
+func Prune(dir string, dryRun bool) (removed int, freed int64, err error) {
+	db, err := openDb(dir, dryRun)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer db.Close()
+	return prune(db, dryRun)
+}
+
+func prune(db *bolt.DB, dryRun bool) (removed int, freed int64, err error) {
+	now := time.Now().Unix()
+	pruneTx := func(tx *bolt.Tx) error {
+		var empty [][]byte
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var expired [][]byte
+			left := 0
+			b.ForEach(func(k, v []byte) error {
+				e := &entry{}
+				// broken entries never hit, they go with the expired ones.
+				if json.Unmarshal(v, e) != nil || e.expired(now) {
+					expired = append(expired, append([]byte{}, k...))
+					freed += int64(len(k) + len(v))
+				} else {
+					left++
+				}
+				return nil
+			})
+			removed += len(expired)
+			if left == 0 {
+				empty = append(empty, append([]byte{}, name...))
+			}
+			if dryRun {
+				return nil
+			}
+			// deleting while iterating with ForEach is not allowed.
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil || dryRun {
+			return err
+		}
+		for _, name := range empty {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if dryRun {
+		err = db.View(pruneTx)
+	} else {
+		err = db.Update(pruneTx)
+	}
+	return
+}
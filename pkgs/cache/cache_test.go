@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Puts an entry that expired an hour ago.
+func putExpired(t *testing.T, s *Store, bucketName, key string) {
+	t.Helper()
+	content, _ := json.Marshal(&entry{Value: json.RawMessage(`"old"`), Expires: time.Now().Add(-time.Hour).Unix()})
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	s.Set(BucketSums, "a", "sum-a", time.Hour)
+	s.Set(BucketSums, "zero", "sum", 0)
+	putExpired(t, s, BucketSums, "expired")
+
+	tests := []struct {
+		bucket string
+		key    string
+		ok     bool
+		want   string
+	}{
+		{BucketSums, "a", true, "sum-a"},
+		{BucketSums, "zero", false, ""},
+		{BucketSums, "expired", false, ""},
+		{BucketSums, "missing", false, ""},
+		{BucketHead, "a", false, ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if ok := s.Get(tt.bucket, tt.key, &got); ok != tt.ok || got != tt.want {
+			t.Errorf("Get(%s, %s) = %v %q, want %v %q", tt.bucket, tt.key, ok, got, tt.ok, tt.want)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// kept across runs, expired entries are dropped on Close.
+	s = openTestStore(t, dir)
+	defer s.Close()
+	var got string
+	if !s.Get(BucketSums, "a", &got) || got != "sum-a" {
+		t.Errorf("Get after reopen = %q", got)
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(BucketSums)).Get([]byte("expired")); v != nil {
+			t.Errorf("expired entry kept after Close: %s", v)
+		}
+		return nil
+	})
+}
+
+func TestOpenClose(t *testing.T) {
+	dir := t.TempDir()
+	var got string
+	Set(BucketHead, "a", "x", time.Hour)
+	if Get(BucketHead, "a", &got) {
+		t.Error("Get hits without Open")
+	}
+	Open(dir)
+	Set(BucketHead, "a", "x", time.Hour)
+	if !Get(BucketHead, "a", &got) || got != "x" {
+		t.Errorf("Get = %q, want x", got)
+	}
+	Close()
+	if Get(BucketHead, "a", &got) {
+		t.Error("Get hits after Close")
+	}
+}
+
+func TestListPruneClear(t *testing.T) {
+	dir := t.TempDir()
+	if r := List(dir); len(r) != 0 {
+		t.Errorf("List of no cache = %v", r)
+	}
+	if removed, _, err := Prune(dir, false); err != nil || removed != 0 {
+		t.Errorf("Prune of no cache = %d %v", removed, err)
+	}
+	s := openTestStore(t, dir)
+	s.Set(BucketSums, "a", "sum-a", time.Hour)
+	putExpired(t, s, BucketSums, "b")
+	putExpired(t, s, BucketHead, "c")
+	s.db.Close()
+
+	r := List(dir)
+	if len(r) != 2 || r[0].Name != BucketHead || r[1].Name != BucketSums {
+		t.Fatalf("List = %v", r)
+	}
+	if r[1].Entries != 2 || r[1].Expired != 1 || r[1].Size == 0 {
+		t.Errorf("List sums = %+v", r[1])
+	}
+
+	// a dry run changes nothing.
+	removed, freed, err := Prune(dir, true)
+	if err != nil || removed != 2 || freed == 0 {
+		t.Errorf("Prune dry run = %d %d %v", removed, freed, err)
+	}
+	if r = List(dir); len(r) != 2 {
+		t.Errorf("List after dry run = %v", r)
+	}
+	if removed, _, err = Prune(dir, false); err != nil || removed != 2 {
+		t.Errorf("Prune = %d %v", removed, err)
+	}
+	// head is left empty and goes.
+	if r = List(dir); len(r) != 1 || r[0].Name != BucketSums || r[0].Entries != 1 {
+		t.Errorf("List after Prune = %v", r)
+	}
+
+	if err = Clear(dir, BucketSums, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if r = List(dir); len(r) != 0 {
+		t.Errorf("List after Clear = %v", r)
+	}
+	if err = Clear(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cache dir kept after Clear: %v", err)
+	}
+}
+
+// Json buckets of older versions are moved into the database.
+func TestImportLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy := map[string]*entry{
+		"a":       {Value: json.RawMessage(`"sum-a"`), Expires: time.Now().Add(time.Hour).Unix()},
+		"expired": {Value: json.RawMessage(`"old"`), Expires: time.Now().Add(-time.Hour).Unix()},
+	}
+	content, _ := json.Marshal(legacy)
+	fPath := filepath.Join(dir, BucketSums+".json")
+	if err := os.WriteFile(fPath, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, BucketHead+".json"), []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := openTestStore(t, dir)
+	defer s.Close()
+	var got string
+	if !s.Get(BucketSums, "a", &got) || got != "sum-a" {
+		t.Errorf("Get imported = %q", got)
+	}
+	if s.Get(BucketSums, "expired", &got) {
+		t.Error("expired entry imported")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(matches) != 0 {
+		t.Errorf("json buckets kept: %v", matches)
+	}
+}
@@ -0,0 +1,154 @@
+package clean
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/cache"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/history"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Cleanup of the work dir, see pxy clean. Long running installs otherwise grow without bound:
+
+	logs       run logs older than RetainLogDays.
+	outputs    dry-run and debug-http outputs older than RetainLogDays.
+	cache      expired entries of the cache, and buckets left empty.
+	history    nodes and versions in history.json older than RetainHistoryDays.
+	temp       temp files of interrupted writes, older than TempMaxAge.
+	uploads    progress of resumable uploads older than ResumeMaxAge, storages drop their parts by then.
+
+Snapshots are pruned by SnapshotKeep after each publish, pending uploads are kept until they are published.
+*/
+
+const (
+	KindLogs    string = "logs"
+	KindOutputs string = "outputs"
+	KindCache   string = "cache"
+	KindHistory string = "history"
+	KindTemp    string = "temp"
+	KindUploads string = "uploads"
+
+	TempMaxAge   = time.Hour
+	ResumeMaxAge = 7 * 24 * time.Hour
+	// utils.WriteFile writes to "<name>.tmp-<random>" before renaming.
+	tempMark string = ".tmp-"
+)
+
+type Item struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path,omitempty"`
+	Count int    `json:"count"` // files, cache entries or history entries.
+	Size  int64  `json:"size"`  // bytes freed.
+}
+
+type Report struct {
+	DryRun bool    `json:"dry_run,omitempty"`
+	Items  []*Item `json:"items"`
+	Freed  int64   `json:"freed"` // bytes.
+}
+
+func (r *Report) add(item *Item) {
+	if item.Count == 0 {
+		return
+	}
+	r.Items = append(r.Items, item)
+	r.Freed += item.Size
+}
+
+// Size of a file, or of all files in a dir.
+func sizeOf(fPath string) (size int64) {
+	filepath.Walk(fPath, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
+
+func (r *Report) remove(kind, fPath string) {
+	item := &Item{Kind: kind, Path: fPath, Count: 1, Size: sizeOf(fPath)}
+	if !r.DryRun {
+		if err := os.RemoveAll(fPath); err != nil {
+			logs.Warning("Remove %s failed: %+v", fPath, err)
+			return
+		}
+	}
+	r.add(item)
+}
+
+// Removes entries of dir modified before oldest, match filters them by name.
+func (r *Report) removeOld(kind, dir string, oldest time.Time, match func(name string) bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(oldest) || (match != nil && !match(e.Name())) {
+			continue
+		}
+		r.remove(kind, filepath.Join(dir, e.Name()))
+	}
+}
+
+/*
+Cleans the work dir by the retention in config, nothing is removed in a dry run.
+Runs should not be in progress, pxy clean holds the lock of the work dir.
+*/
+func Run(cnf *confs.CollectorConf, dryRun bool) *Report {
+	r := &Report{DryRun: dryRun, Items: []*Item{}}
+	now := time.Now()
+	workDir := cnf.DirPath()
+
+	logOldest := now.Add(-cnf.LogRetention())
+	r.removeOld(KindLogs, filepath.Join(workDir, logs.LogDirName), logOldest, func(name string) bool {
+		return strings.HasSuffix(name, ".log")
+	})
+	for _, dir := range []string{cnf.DryRunPath(), filepath.Join(workDir, fetch.DebugHttpDirName)} {
+		if info, err := os.Stat(dir); err == nil && info.ModTime().Before(logOldest) {
+			r.remove(KindOutputs, dir)
+		}
+	}
+
+	if removed, freed, err := cache.Prune(cnf.CachePath(), dryRun); err != nil {
+		logs.Warning("Prune cache failed: %+v", err)
+	} else {
+		r.add(&Item{Kind: KindCache, Path: cnf.CachePath(), Count: removed, Size: freed})
+	}
+
+	if nodes, days, err := history.Prune(cnf.HistoryPath(), cnf.HistoryRetention(), dryRun); err != nil {
+		logs.Warning("Prune history failed: %+v", err)
+	} else {
+		r.add(&Item{Kind: KindHistory, Path: cnf.HistoryPath(), Count: nodes + days})
+	}
+
+	tempOldest := now.Add(-TempMaxAge)
+	filepath.WalkDir(workDir, func(fPath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.Contains(d.Name(), tempMark) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(tempOldest) {
+			r.remove(KindTemp, fPath)
+		}
+		return nil
+	})
+
+	r.removeOld(KindUploads, cnf.ResumeDir(), now.Add(-ResumeMaxAge), nil)
+	return r
+}
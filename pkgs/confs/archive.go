@@ -0,0 +1,203 @@
+package confs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	// passphrase for export/import archives, asked for in a terminal when not set.
+	ArchivePassphraseEnvName string = "PXY_ARCHIVE_PASSPHRASE"
+	archiveMagic             string = "PXYARCHIVE1\n"
+	archiveConfigDir         string = "config"
+	archiveDataDir           string = "data"
+	archiveSecretsFile       string = "secrets.json"
+)
+
+// Data dirs that are not exported: the git clone, upload progress and the cache can be recreated, profiles are exported on their own.
+var archiveSkippedDirs = []string{GitRepoDirName, ResumeDirName, CacheDirName, DryRunDirName, ProfileDirName}
+
+/*
+Exports the whole collector state into one encrypted archive:
+config file, secrets(from whichever secret store is used), lists, manifest and snapshots.
+
+The archive is a tar.gz, encrypted with AES-GCM and a key derived from the passphrase.
+*/
+func (c *CollectorConf) Export(archivePath string) error {
+	passphrase := readPassphrase(ArchivePassphraseEnvName, "Please enter a passphrase for the archive: ")
+	if passphrase == "" {
+		return fmt.Errorf("a passphrase is needed, set %s", ArchivePassphraseEnvName)
+	}
+	RegisterSecrets(passphrase)
+	c.Load()
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	confPath := FindConfigFile(c.confDir)
+	if err := addArchiveFile(tw, confPath, path.Join(archiveConfigDir, filepath.Base(confPath))); err != nil {
+		return err
+	}
+	secrets := map[string]string{}
+	for name, field := range c.secretFields() {
+		secrets[name] = field.get()
+	}
+	secretsContent, _ := json.Marshal(secrets)
+	if err := addArchiveContent(tw, archiveSecretsFile, secretsContent); err != nil {
+		return err
+	}
+
+	err := filepath.Walk(c.dirpath, func(fPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(c.dirpath, fPath)
+		if info.IsDir() {
+			for _, skipped := range archiveSkippedDirs {
+				if rel == skipped {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		// config files are already added when config and data share a dir.
+		for _, name := range append([]string{SecretFileName}, ConfigFileNames...) {
+			if rel == name {
+				return nil
+			}
+		}
+		return addArchiveFile(tw, fPath, path.Join(archiveDataDir, filepath.ToSlash(rel)))
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+
+	fc, err := sealWithPassphrase(passphrase, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(fc)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFile(archivePath, append([]byte(archiveMagic), content...), 0600)
+}
+
+func addArchiveFile(tw *tar.Writer, fPath, name string) error {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return err
+	}
+	return addArchiveContent(tw, name, content)
+}
+
+func addArchiveContent(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+/*
+Imports an archive created by Export.
+Existing config files are kept as .bak, secrets are saved into the secret store of this machine.
+*/
+func (c *CollectorConf) Import(archivePath string) error {
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(content, []byte(archiveMagic)) {
+		return errors.New("not an archive exported by pxy")
+	}
+	fc := &secretFileContent{}
+	if err = json.Unmarshal(content[len(archiveMagic):], fc); err != nil {
+		return err
+	}
+	passphrase := readPassphrase(ArchivePassphraseEnvName, "Please enter the passphrase of the archive: ")
+	RegisterSecrets(passphrase)
+	plain, err := fc.open(passphrase)
+	if err != nil {
+		return errors.New("wrong passphrase or broken archive")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	secrets := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if strings.HasPrefix(name, "..") || path.IsAbs(name) {
+			return fmt.Errorf("invalid file in archive: %s", hdr.Name)
+		}
+		switch {
+		case name == archiveSecretsFile:
+			json.Unmarshal(data, &secrets)
+		case strings.HasPrefix(name, archiveConfigDir+"/"):
+			// only one config file should be left, others are backed up.
+			for _, cName := range ConfigFileNames {
+				old := filepath.Join(c.confDir, cName)
+				if _, err := os.Stat(old); err == nil {
+					os.Rename(old, old+".bak")
+				}
+			}
+			if err = utils.WriteFile(filepath.Join(c.confDir, path.Base(name)), data, 0o644); err != nil {
+				return err
+			}
+		case strings.HasPrefix(name, archiveDataDir+"/"):
+			dst := filepath.Join(c.dirpath, filepath.FromSlash(strings.TrimPrefix(name, archiveDataDir+"/")))
+			os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+			if err = utils.WriteFile(dst, data, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.k, _ = newConfFile(FindConfigFile(c.confDir))
+	if err = c.Load(); err != nil {
+		return err
+	}
+	for name, field := range c.secretFields() {
+		if v := secrets[name]; v != "" {
+			field.set(v)
+		}
+	}
+	if err = c.Save(); err != nil {
+		return err
+	}
+	logs.Success("Imported %s into %s and %s.", archivePath, c.confDir, c.dirpath)
+	return nil
+}
@@ -0,0 +1,188 @@
+package confs
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Release channels for CollectorOptions.Channels.
+const (
+	ChannelStable   string = "stable"
+	ChannelUnstable string = "unstable" // rc, beta, alpha, preview...
+)
+
+/*
+CollectorOptions for a version collector.
+
+Example for config.json:
+
+	"Collectors": {
+	    "golang": {"Channels": ["stable"], "Depth": 20},
+	    "julia": {"Enabled": false},
+	    "github": {"AssetFilters": ["linux", "!musl"]},
+	    "nodejs": {"Minors": 30, "PatchesPerMinor": 3, "Prereleases": "none"}
+	}
+
+AssetFilters are regular expressions matched against download urls,
+an url must match one of the filters and none of the "!" prefixed ones.
+*/
+type CollectorOptions struct {
+	Enabled      *bool    `json,koanf:"enabled"` // enabled by default.
+	Channels     []string `json,koanf:"channels"`
+	Depth        int      `json,koanf:"depth"` // number of newest versions to keep, 0 for all.
+	AssetFilters []string `json,koanf:"asset_filters"`
+	Workers      int      `json,koanf:"workers"` // concurrent page fetches for large collectors, 8 by default.
+	Merge        *bool    `json,koanf:"merge"`   // merges with the published version file, true by default.
+	// Depth policies, applied after Channels and before Depth, 0 for unlimited.
+	Majors          int    `json,koanf:"majors"`            // keeps the newest N major lines, like 22.x.
+	Minors          int    `json,koanf:"minors"`            // keeps the newest N minor lines, like 22.1.x.
+	PatchesPerMinor int    `json,koanf:"patches_per_minor"` // keeps the newest N versions of each minor line.
+	Prereleases     string `json,koanf:"prereleases"`       // "all" by default, "none", or "latest" for those newer than the newest release.
+	// "api" skips scraping html for collectors that have an api fallback.
+	Source string `json,koanf:"source"`
+}
+
+// Options for a collector, never nil.
+func (c *CollectorConf) CollectorOptions(name string) *CollectorOptions {
+	if opts, ok := c.remoteCollectors[name]; ok && opts != nil {
+		return opts
+	}
+	if opts, ok := c.Collectors[name]; ok && opts != nil {
+		return opts
+	}
+	return &CollectorOptions{}
+}
+
+func (o *CollectorOptions) IsEnabled(defaultOn bool) bool {
+	if o.Enabled == nil {
+		return defaultOn
+	}
+	return *o.Enabled
+}
+
+const (
+	CollectorSourceHtml string = "html" // scrapes html, falls back to the api, the default.
+	CollectorSourceApi  string = "api"
+)
+
+const (
+	PrereleasesAll    string = "all"
+	PrereleasesNone   string = "none"
+	PrereleasesLatest string = "latest"
+)
+
+// Versions the source site no longer lists are kept unless Merge is false.
+func (o *CollectorOptions) MergeWithPublished() bool {
+	return o.Merge == nil || *o.Merge
+}
+
+// Checks if a version name belongs to the configured channels.
+func (o *CollectorOptions) AllowVersion(vName string) bool {
+	if len(o.Channels) == 0 {
+		return true
+	}
+	channel := ChannelStable
+	if IsUnstableVersion(vName) {
+		channel = ChannelUnstable
+	}
+	for _, ch := range o.Channels {
+		if strings.EqualFold(ch, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks a download url against AssetFilters.
+func (o *CollectorOptions) AllowAsset(dUrl string) bool {
+	hasInclude, included := false, false
+	for _, f := range o.AssetFilters {
+		exclude := strings.HasPrefix(f, "!")
+		re, err := regexp.Compile(strings.TrimPrefix(f, "!"))
+		if err != nil {
+			continue
+		}
+		matched := re.MatchString(dUrl)
+		if exclude {
+			if matched {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		included = included || matched
+	}
+	return !hasInclude || included
+}
+
+var unstablePattern = regexp.MustCompile(`(?i)(\d(a|b|rc)\d+$|[.\-_+]?(rc|beta|alpha|preview|pre|dev|snapshot|nightly|ea)([.\-_]?\d+)?$|-m\d+$)`)
+
+func IsUnstableVersion(vName string) bool {
+	return unstablePattern.MatchString(vName)
+}
+
+// Collector names found in local and remote config.
+func (c *CollectorConf) CollectorOptionNames() (r []string) {
+	for name := range c.Collectors {
+		r = append(r, name)
+	}
+	for name := range c.remoteCollectors {
+		if _, ok := c.Collectors[name]; !ok {
+			r = append(r, name)
+		}
+	}
+	return
+}
+
+/*
+Kinds of VSCode assets, an asset has one or more of them by its url:
+
+	system, user    windows system and user installers(.exe).
+	zip             windows archives.
+	darwin          macOS archives.
+	deb, rpm        linux packages.
+	tar.gz          linux archives.
+	cli             builds of the code cli.
+	arm32           linux builds for armhf and armv7hl.
+
+An asset is collected when one of its kinds is listed, and none of the "!" prefixed ones.
+*/
+const (
+	VSCodeSystem string = "system"
+	VSCodeUser   string = "user"
+	VSCodeZip    string = "zip"
+	VSCodeDarwin string = "darwin"
+	VSCodeDeb    string = "deb"
+	VSCodeRpm    string = "rpm"
+	VSCodeTarGz  string = "tar.gz"
+	VSCodeCli    string = "cli"
+	VSCodeArm32  string = "arm32"
+)
+
+var DefaultVSCodeAssets = []string{VSCodeSystem, VSCodeDarwin, VSCodeDeb, VSCodeRpm, "!" + VSCodeCli, "!" + VSCodeArm32}
+
+func (c *CollectorConf) VSCodeAssetKinds() []string {
+	if len(c.VSCodeAssets) == 0 {
+		return DefaultVSCodeAssets
+	}
+	return c.VSCodeAssets
+}
+
+// Checks the kinds of an asset against the listed kinds.
+func AllowKinds(listed, kinds []string) bool {
+	included := false
+	for _, l := range listed {
+		exclude := strings.HasPrefix(l, "!")
+		l = strings.ToLower(strings.TrimPrefix(l, "!"))
+		for _, k := range kinds {
+			if k != l {
+				continue
+			}
+			if exclude {
+				return false
+			}
+			included = true
+		}
+	}
+	return included
+}
@@ -1,16 +1,19 @@
 package confs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/gutils"
-	"github.com/gvcgo/goutils/pkgs/koanfer"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -27,11 +30,40 @@ func EnableProxyOrNot() bool {
 	return gconv.Bool(os.Getenv(ToEnableProxyEnvName))
 }
 
+const (
+	// upload mode
+	UploadModeEnvName string = "PXY_UPLOAD_MODE"
+	// prints what would be pushed with diffs against the remote, writes nothing remotely.
+	UploadModeDryRun string = "dry-run"
+	// keeps outputs in the work dir only, never talks to the remote storage.
+	UploadModeLocal string = "local"
+)
+
+func UploadMode() string {
+	switch m := strings.ToLower(os.Getenv(UploadModeEnvName)); m {
+	case UploadModeDryRun, UploadModeLocal:
+		return m
+	default:
+		return ""
+	}
+}
+
+/*
+Dry runs fetch and process everything like real runs, but upload nothing and keep local state:
+outputs go to the dry-run dir instead of the work dir, and stores like dead_links.json are not saved.
+*/
+func DryRun() bool {
+	return UploadMode() == UploadModeDryRun
+}
+
 type StorageType int
 
 const (
 	StorageGithub          StorageType = 1
 	StorageGitee           StorageType = 2
+	StorageGit             StorageType = 3 // any git remote, pushed over ssh.
+	StorageAzure           StorageType = 4 // azure blob storage.
+	StorageGCS             StorageType = 5 // google cloud storage.
 	ConfigFileName         string      = "config.json"
 	VPNFileName            string      = "conf.txt"
 	SubscriberFileName     string      = "subscribers.txt"
@@ -40,58 +72,216 @@ const (
 	CloudflareIPV6FileName string      = "cloudflare_ipv6.txt"
 	RawDomainFileName      string      = "raw_domains.txt"
 	GithubVersionRepoFile  string      = "github_repo_version.txt"
+	ManifestFileName       string      = "manifest.json"
+	SnapshotDirName        string      = "snapshots"
+	GitRepoDirName         string      = "git-repo"
+	ResumeDirName          string      = "uploads"
+	RulesDirName           string      = "rules"
+	PluginsDirName         string      = "plugins"
+	CacheDirName           string      = "cache"
+	DryRunDirName          string      = "dry-run"      // outputs of dry runs.
+	ProxyListFileName      string      = "proxies.json" // proxies of the last run, for diffs in the run report.
+	HistoryFileName        string      = "history.json" // nodes and new versions of past runs, see pkgs/history.
+	LockFileName           string      = "pxy.lock"     // held by a run, see lock.go.
 	WorkDirName            string      = ".pxycollector"
+
+	DefaultHeadCacheTtl      = 24 * time.Hour
+	DefaultGithubCacheTtl    = time.Hour
+	DefaultRetainLogDays     = 30
+	DefaultRetainHistoryDays = 180
+)
+
+// Modes of GateDuplicates and GateSumConflicts.
+const (
+	GateWarn  string = "warn"
+	GateBlock string = "block"
+	GateOff   string = "off"
 )
 
 type CollectorConf struct {
-	Type      StorageType `json,koanf:"type"`
-	UserName  string      `json,koanf:"username"` // username for github or gitee.
-	Token     string      `json,koanf:"token"`
-	Repo      string      `json,koanf:"repo"`
-	CryptoKey string      `json,koanf:"crypto_key"`
-	ProxyURI  string      `json,koanf:"proxy_uri"`
-	dirpath   string
-	k         *koanfer.JsonKoanfer
+	ConfigVersion int         `json,koanf:"config_version"` // schema version, see migrate.go.
+	Type          StorageType `json,koanf:"type"`
+	UserName      string      `json,koanf:"username"` // username for github or gitee.
+	Token         string      `json,koanf:"token"`
+	Repo          string      `json,koanf:"repo"`
+	CryptoKey     string      `json,koanf:"crypto_key"`
+	ProxyURI      string      `json,koanf:"proxy_uri"`
+	// Key rotation, see keys.go.
+	OldCryptoKey string `json,koanf:"old_crypto_key"`
+	KeyRotatedAt string `json,koanf:"key_rotated_at"`
+	KeyOverlap   string `json,koanf:"key_overlap"` // like "72h", 7 days by default.
+	// Compress publishes compressed copies of large json files: "gzip", "zstd" or "gzip,zstd".
+	Compress     string `json,koanf:"compress"`
+	CompressSize int64  `json,koanf:"compress_size"` // minimum file size in bytes to compress.
+	// RemotePaths maps an artifact category to a remote path template, like "versions/{name}.version.json".
+	RemotePaths map[string]string `json,koanf:"remote_paths"`
+	ChunkSize   int64             `json,koanf:"chunk_size"` // max file size for gitee, larger files are split into chunks.
+	// Github app auth, used instead of Token when GithubAppID is set.
+	GithubAppID             string `json,koanf:"github_app_id"`
+	GithubAppInstallationID string `json,koanf:"github_app_installation_id"`
+	GithubAppPrivateKey     string `json,koanf:"github_app_private_key"` // path to the PEM private key.
+	UploadWorkers           int    `json,koanf:"upload_workers"`         // max concurrent uploads, 4 by default.
+	SnapshotKeep            int    `json,koanf:"snapshot_keep"`          // number of published snapshots to keep, 3 by default.
+	// Sanity gates before upload.
+	GateDisabled    bool              `json,koanf:"gate_disabled"`
+	GateMinVersions int               `json,koanf:"gate_min_versions"` // min versions in a version file, 1 by default.
+	GateMinNodes    int               `json,koanf:"gate_min_nodes"`    // min proxy nodes in conf.txt, 10 by default.
+	GateSchemas     map[string]string `json,koanf:"gate_schemas"`      // category -> json schema file path.
+	// Checks of version files, "warn"(default), "block" or "off", see pkgs/versions/conflicts.go.
+	GateDuplicates   string `json,koanf:"gate_duplicates"`    // files for the same os and arch under one version.
+	GateSumConflicts string `json,koanf:"gate_sum_conflicts"` // urls published before with a different sum.
+	// Git backend, commits outputs into a local clone and pushes to GitRemote.
+	GitRemote string `json,koanf:"git_remote"` // like git@git.example.com:owner/repo.git
+	GitBranch string `json,koanf:"git_branch"` // "main" by default.
+	GitSSHKey string `json,koanf:"git_ssh_key"`
+	GitEmail  string `json,koanf:"git_email"` // committer email.
+	// Azure blob storage, authorized by a SAS token.
+	AzureAccount   string `json,koanf:"azure_account"`
+	AzureContainer string `json,koanf:"azure_container"`
+	AzureSAS       string `json,koanf:"azure_sas"`
+	// Google cloud storage, authorized by a service account key file.
+	GCSBucket      string `json,koanf:"gcs_bucket"`
+	GCSCredentials string `json,koanf:"gcs_credentials"` // path to the service account json key.
+	// Where secrets like Token and CryptoKey are kept: "keyring", "file" or "plain".
+	SecretBackend string `json,koanf:"secret_backend"`
+	// Webhooks called after each publish, "slack+", "discord+" or "telegram+" prefix forces a payload template.
+	Webhooks []string `json,koanf:"webhooks"`
+	// Go templates of webhook messages by webhook type or "default", text or a .tmpl file, see pkgs/notify/template.go.
+	NotifyTemplates map[string]string `json,koanf:"notify_templates"`
+	// Uploads report.json and report.txt of each run with the published files.
+	UploadReport bool `json,koanf:"upload_report"`
+	// Failure alerts of runs, sent when collectors fail, errors are logged or nothing is published, see pkgs/notify/alert.go.
+	AlertPush    []string `json,koanf:"alert_push"`  // bark or ntfy urls, like "bark+https://api.day.app/<key>" or "https://ntfy.sh/<topic>".
+	AlertEmail   []string `json,koanf:"alert_email"` // recipients, mailed through SmtpHost.
+	SmtpHost     string   `json,koanf:"smtp_host"`   // like "smtp.example.com:587", STARTTLS is used when the server offers it.
+	SmtpUser     string   `json,koanf:"smtp_user"`
+	SmtpPassword string   `json,koanf:"smtp_password"`
+	SmtpFrom     string   `json,koanf:"smtp_from"` // SmtpUser by default.
+	// Global upload limits, 0 for unlimited.
+	UploadRateLimit int   `json,koanf:"upload_rate_limit"` // storage calls per minute.
+	UploadBandwidth int64 `json,koanf:"upload_bandwidth"`  // bytes per second.
+	// Resumable uploads for azure and gcs.
+	ResumableSize int64 `json,koanf:"resumable_size"` // 8MB by default.
+	PartSize      int64 `json,koanf:"part_size"`      // 4MB by default, a multiple of 256KB.
+	// Per-collector options for version-fetch, keyed by collector name.
+	Collectors   map[string]*CollectorOptions `json,koanf:"collectors"`
+	FetchWorkers int                          `json,koanf:"fetch_workers"` // collectors fetching at the same time, 4 by default.
+	// Kinds of VSCode assets to collect, "!" excludes, see collectors.go.
+	VSCodeAssets []string `json,koanf:"vscode_assets"`
+	// Releases of miniconda installers to collect per python version, 0 for the latest installers only.
+	MinicondaDepth int `json,koanf:"miniconda_depth"`
+	// Formats for other version managers published next to version files, "asdf", "scoop" or "aqua", see pkgs/versions/export.go.
+	ExportFormats []string `json,koanf:"export_formats"`
+	// Timeout, retries, backoff and rate limit of fetchers by host, see fetch_policy.go.
+	FetchPolicies    []*FetchPolicy `json,koanf:"fetch_policies"`
+	FetchRetryBudget int            `json,koanf:"fetch_retry_budget"` // retries allowed in a run, 50 by default.
+	// Subscribers, rawDomains and collector options fetched on each run, an url or a path in the storage repo.
+	RemoteConfig string `json,koanf:"remote_config"`
+	// Shared http transport of fetches, see pkgs/fetch/transport.go.
+	HttpMaxConnsPerHost int    `json,koanf:"http_max_conns_per_host"` // 16 by default.
+	HttpMaxIdleConns    int    `json,koanf:"http_max_idle_conns"`     // idle keep-alive connections of all hosts, 100 by default.
+	HttpIdleTimeout     string `json,koanf:"http_idle_timeout"`       // like "90s"(default), idle connections are closed after it.
+	HttpDisableHttp2    bool   `json,koanf:"http_disable_http2"`      // HTTP/1.1 only.
+	// Locale of scraped pages, like "en"(default), sent as Accept-Language, and as hl= to Google pages, see pkgs/fetch/locale.go.
+	PageLocale string `json,koanf:"page_locale"`
+	// Bytes of a subscription payload, 20MB by default, larger payloads are dropped.
+	SubscriberMaxSize int64 `json,koanf:"subscriber_max_size"`
+	// Checksums of artifacts, downloaded and hashed after collecting, 0 to disable.
+	ChecksumCompute int   `json,koanf:"checksum_compute"`  // artifacts without sums to hash per collector and run.
+	ChecksumSample  int   `json,koanf:"checksum_sample"`   // published sums to spot-check per collector and run.
+	ChecksumMaxSize int64 `json,koanf:"checksum_max_size"` // larger artifacts are skipped, 512MB by default.
+	// Pinned keys of upstreams that sign artifacts or checksum files, see signature.go.
+	Signatures map[string]*SignatureConf `json,koanf:"signatures"`
+	// Bytes to download per run, 0 for unlimited. Artifacts are no longer downloaded after it, see pkgs/fetch/bandwidth.go.
+	BandwidthQuota      int64 `json,koanf:"bandwidth_quota"`
+	BandwidthQuotaAbort bool  `json,koanf:"bandwidth_quota_abort"` // cancels the run instead.
+	// Persistent cache of checksums, HEAD results and GitHub API responses, see pkgs/cache.
+	CacheDisabled  bool   `json,koanf:"cache_disabled"`
+	CacheHeadTtl   string `json,koanf:"cache_head_ttl"`   // like "24h"(default), "0s" disables caching of HEAD results.
+	CacheGithubTtl string `json,koanf:"cache_github_ttl"` // like "1h"(default), "0s" disables caching of GitHub API responses.
+	// Files of new versions to download and extract per version file before publishing, 0 to disable, see pkgs/versions/canary.go.
+	CanarySample int `json,koanf:"canary_sample"`
+	// Files to check by HEAD requests per collector and run, for sizes and dead links, 0 to disable.
+	HeadCheck    int `json,koanf:"head_check"`
+	DeadLinkDrop int `json,koanf:"dead_link_drop"` // dead answers in a row before a quarantined file is dropped, 3 by default.
+	// Adds a "latest" key with the newest release to version files, clients must skip it when decoding versions.
+	VersionLatest bool `json,koanf:"version_latest"`
+	// Rule files of declarative collectors, "rules" in the work dir by default.
+	RulesDir string `json,koanf:"rules_dir"`
+	// Collector plugins, "plugins" in the work dir by default.
+	PluginsDir string `json,koanf:"plugins_dir"`
+	// Runs native executables in PluginsDir, unsandboxed with the rights of pxy. Only .wasm plugins run otherwise.
+	NativePlugins bool `json,koanf:"native_plugins"`
+	// Releases of pxy in the storage repo, see pkgs/upload/release.go.
+	ReleaseSigningKey string `json,koanf:"release_signing_key"` // path to the ed25519 private key signing published releases.
+	ReleasePublicKey  string `json,koanf:"release_public_key"`  // base64 ed25519 public key, self-update requires valid signatures when set.
+	// Logging, see pkgs/logs.
+	LogLevel  string `json,koanf:"log_level"`  // "debug", "info"(default), "warning" or "error".
+	LogFormat string `json,koanf:"log_format"` // console output, "pretty"(default) or "json".
+	LogFiles  int    `json,koanf:"log_files"`  // run logs kept in the work dir per command, 20 by default, -1 disables them.
+	// Retention of pxy clean in days, see pkgs/clean.
+	RetainLogDays     int `json,koanf:"retain_log_days"`     // run logs, dry-run and debug-http outputs, 30 by default.
+	RetainHistoryDays int `json,koanf:"retain_history_days"` // nodes and versions in history.json, also pruned by runs, 180 by default.
+	// OpenTelemetry tracing, OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS by default.
+	OtlpEndpoint     string `json,koanf:"otlp_endpoint"` // OTLP/HTTP endpoint, like http://localhost:4318, tracing is off when empty.
+	OtlpHeaders      string `json,koanf:"otlp_headers"`  // like "authorization=Bearer xxx,key=value".
+	remoteCollectors map[string]*CollectorOptions
+	ctx              context.Context
+	cancel           context.CancelFunc
+	secrets          SecretStore
+	secretsChecked   bool
+	storedSecrets    map[string]bool // secrets known to be in the store, deleted when cleared.
+	envOrigins       map[int]reflect.Value
+	profile          string
+	proxyDetected    string
+	confDir          string // config.json and secrets.
+	dirpath          string // lists and outputs.
+	k                confFile
 }
 
 func NewCollectorConf() (cc *CollectorConf) {
-	homeDir, _ := os.UserHomeDir()
 	cc = &CollectorConf{
-		dirpath: filepath.Join(homeDir, WorkDirName),
+		profile: CurrentProfile(),
+	}
+	cc.confDir, cc.dirpath = RootDirs()
+	if cc.profile != "" {
+		cc.confDir, cc.dirpath = profileDirs(cc.confDir, cc.dirpath, cc.profile)
 	}
 	cc.initiate()
 	return
 }
 
 func (c *CollectorConf) initiate() {
-	if ok, _ := gutils.PathIsExist(c.dirpath); !ok {
-		os.MkdirAll(c.dirpath, os.ModePerm)
+	for _, dir := range []string{c.confDir, c.dirpath} {
+		if ok, _ := gutils.PathIsExist(dir); !ok {
+			os.MkdirAll(dir, os.ModePerm)
+		}
 	}
-	confPath := filepath.Join(c.dirpath, ConfigFileName)
-	c.k, _ = koanfer.NewKoanfer(confPath)
+	confPath := FindConfigFile(c.confDir)
+	c.k, _ = newConfFile(confPath)
 	if ok, _ := gutils.PathIsExist(confPath); !ok {
+		c.ConfigVersion = CurrentConfigVersion
 		if err := c.Save(); err != nil {
-			gprint.PrintError("%+v", err)
+			logs.Error("%+v", err)
 			return
 		}
 	}
 
-	subPath := c.subPath()
-	if ok, _ := gutils.PathIsExist(subPath); !ok {
-		// To save default subscriber list.
-		os.WriteFile(subPath, []byte(SubscribedUrls), os.ModePerm)
+	if ok, _ := gutils.PathIsExist(c.subListPath()); !ok {
+		// To save default subscriber list, or convert the legacy one.
+		c.GetSubscribers()
 	}
 
 	rawDomainPath := c.RawDomainPath()
 	if ok, _ := gutils.PathIsExist(rawDomainPath); !ok {
 		// To save default domain list.
-		os.WriteFile(rawDomainPath, []byte(RawEdDomains), os.ModePerm)
+		utils.WriteFile(rawDomainPath, []byte(RawEdDomains), os.ModePerm)
 	}
 
 	githubRepoFPath := c.GithubRepoFilePath()
 	if ok, _ := gutils.PathIsExist(githubRepoFPath); !ok {
 		// To save default github repo list.
-		os.WriteFile(githubRepoFPath, []byte(ProjectsFromGithub), os.ModePerm)
+		utils.WriteFile(githubRepoFPath, []byte(ProjectsFromGithub), os.ModePerm)
 	}
 
 	c.Load()
@@ -107,36 +297,164 @@ func (c *CollectorConf) DirPath() string {
 	return c.dirpath
 }
 
+func (c *CollectorConf) ConfDir() string {
+	return c.confDir
+}
+
+func (c *CollectorConf) RulesPath() string {
+	if c.RulesDir != "" {
+		return c.RulesDir
+	}
+	return filepath.Join(c.dirpath, RulesDirName)
+}
+
+func (c *CollectorConf) PluginsPath() string {
+	if c.PluginsDir != "" {
+		return c.PluginsDir
+	}
+	return filepath.Join(c.dirpath, PluginsDirName)
+}
+
+// Cache dir, "cache" in the work dir.
+func (c *CollectorConf) CachePath() string {
+	return filepath.Join(c.dirpath, CacheDirName)
+}
+
+func cacheTtl(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	return def
+}
+
+func (c *CollectorConf) HeadCacheTtl() time.Duration {
+	return cacheTtl(c.CacheHeadTtl, DefaultHeadCacheTtl)
+}
+
+func (c *CollectorConf) GithubCacheTtl() time.Duration {
+	return cacheTtl(c.CacheGithubTtl, DefaultGithubCacheTtl)
+}
+
+func (c *CollectorConf) LogRetention() time.Duration {
+	return retention(c.RetainLogDays, DefaultRetainLogDays)
+}
+
+func (c *CollectorConf) HistoryRetention() time.Duration {
+	return retention(c.RetainHistoryDays, DefaultRetainHistoryDays)
+}
+
+func retention(days, def int) time.Duration {
+	if days <= 0 {
+		days = def
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Dir of dry run outputs, "dry-run" in the work dir.
+func (c *CollectorConf) DryRunPath() string {
+	return filepath.Join(c.dirpath, DryRunDirName)
+}
+
+// Path of an output file to publish, in the dry-run dir for dry runs.
+func (c *CollectorConf) OutputPath(fileName string) string {
+	if DryRun() {
+		return filepath.Join(c.DryRunPath(), fileName)
+	}
+	return filepath.Join(c.dirpath, fileName)
+}
+
 func (c *CollectorConf) DomainPath() string {
-	return filepath.Join(c.dirpath, DomainFileName)
+	return c.OutputPath(DomainFileName)
 }
 
 func (c *CollectorConf) RawDomainPath() string {
 	return filepath.Join(c.dirpath, RawDomainFileName)
 }
 
+// Raw domain list to publish, a copy in the dry-run dir for dry runs, see AddRawDomains.
+func (c *CollectorConf) RawDomainOutputPath() string {
+	return c.OutputPath(RawDomainFileName)
+}
+
 func (c *CollectorConf) VPNFilePath() string {
-	return filepath.Join(c.dirpath, VPNFileName)
+	return c.OutputPath(VPNFileName)
 }
 
 func (c *CollectorConf) GithubRepoFilePath() string {
 	return filepath.Join(c.dirpath, GithubVersionRepoFile)
 }
 
+func (c *CollectorConf) ManifestPath() string {
+	return filepath.Join(c.dirpath, ManifestFileName)
+}
+
+func (c *CollectorConf) ProxyListPath() string {
+	return filepath.Join(c.dirpath, ProxyListFileName)
+}
+
+func (c *CollectorConf) LockPath() string {
+	return filepath.Join(c.dirpath, LockFileName)
+}
+
+func (c *CollectorConf) HistoryPath() string {
+	return filepath.Join(c.dirpath, HistoryFileName)
+}
+
+func (c *CollectorConf) SnapshotDir() string {
+	return filepath.Join(c.dirpath, SnapshotDirName)
+}
+
+func (c *CollectorConf) GitRepoDir() string {
+	return filepath.Join(c.dirpath, GitRepoDirName)
+}
+
+// Progress of resumable uploads.
+func (c *CollectorConf) ResumeDir() string {
+	return filepath.Join(c.dirpath, ResumeDirName)
+}
+
 func (c *CollectorConf) setup() {
-	if c.Token == "" || c.Repo == "" {
-		fmt.Println("Please choose storage type: ")
-		fmt.Println("1. Github. (default)")
-		fmt.Println("2. Gitee.")
-		var sType string
-		fmt.Scanln(&sType)
-		switch sType {
-		case "2":
-			c.Type = StorageGitee
-		default:
-			c.Type = StorageGithub
+	missing := c.Missing()
+	if len(missing) == 0 {
+		return
+	}
+	if !Interactive() {
+		// Scanln would block forever without a terminal, like in cron jobs and CI.
+		logs.Warning("Config is incomplete, missing: %s. Stdin is not a terminal, so nothing is asked. Set %s, or run: pxy config init",
+			strings.Join(missing, ", "), MissingHint(missing))
+		return
+	}
+	fmt.Println("Please choose storage type: ")
+	fmt.Println("1. Github. (default)")
+	fmt.Println("2. Gitee.")
+	fmt.Println("3. Git remote over ssh.")
+	var sType string
+	fmt.Scanln(&sType)
+	switch sType {
+	case "2":
+		c.Type = StorageGitee
+	case "3":
+		c.Type = StorageGit
+		fmt.Println("Please enter your git remote url: ")
+		var remote string
+		fmt.Scanln(&remote)
+		if remote != "" {
+			c.GitRemote = remote
 		}
+		fmt.Println("Please enter your ssh private key path(optional): ")
+		var key string
+		fmt.Scanln(&key)
+		if key != "" {
+			c.GitSSHKey = key
+		}
+	default:
+		c.Type = StorageGithub
+	}
 
+	if c.Type != StorageGit {
 		fmt.Println("Please enter your github/gitee username: ")
 		var username string
 		fmt.Scanln(&username)
@@ -156,115 +474,180 @@ func (c *CollectorConf) setup() {
 		if repo != "" {
 			c.Repo = repo
 		}
-		c.Save()
-
-		// To reset the Crypto Key or not.
-		fmt.Println("Do you want to reset the Crypto Key? (y/n)")
-		var ok string
-		fmt.Scanln(&ok)
-		switch ok {
-		case "y", "Y", "yes", "Yes":
-			c.ResetCryptoKey()
-		default:
-			gprint.PrintWarning("Invalid input.")
-		}
+	}
+	c.Save()
+
+	// To reset the Crypto Key or not.
+	fmt.Println("Do you want to reset the Crypto Key? (y/n)")
+	var ok string
+	fmt.Scanln(&ok)
+	switch ok {
+	case "y", "Y", "yes", "Yes":
+		c.ResetCryptoKey()
+	default:
+		logs.Warning("Invalid input.")
 	}
 }
 
 func (c *CollectorConf) Load() error {
-	return c.k.Load(c)
+	// values from env are applied again after loading.
+	c.swapEnvOrigins()
+	c.envOrigins = nil
+	// secrets found after loading are plaintext ones in config.json.
+	for _, field := range c.secretFields() {
+		field.set("")
+	}
+	if err := c.k.Load(c); err != nil {
+		return err
+	}
+	c.loadSecrets()
+	c.migrate()
+	c.applyEnv()
+	c.registerSecrets()
+	return nil
 }
 
 func (c *CollectorConf) Save() error {
-	return c.k.Save(c)
+	c.swapEnvOrigins()
+	defer c.swapEnvOrigins()
+	return c.saveWithSecrets()
 }
 
 func (c *CollectorConf) ResetCryptoKey() {
-	c.Load()
-	c.CryptoKey = gutils.RandomString(16)
-	gprint.PrintInfo("CryptoKey: %s", c.CryptoKey)
-	c.Save()
+	if err := c.RotateCryptoKey(true); err != nil {
+		logs.Error("%+v", err)
+		Fail(FailConfig)
+	}
 }
 
 func (c *CollectorConf) ShowCryptoKey() {
 	c.Load()
-	gprint.PrintInfo("CryptoKey: %s", c.CryptoKey)
+	// printed unredacted, the user asked for it.
+	fmt.Fprintln(RawStdout(), gprint.CyanStr("CryptoKey: %s", c.CryptoKey))
+	if c.RotationActive(time.Now()) {
+		fmt.Fprintln(RawStdout(), gprint.CyanStr("OldCryptoKey: %s, used for conf.txt until the rotation is done.", c.OldCryptoKey))
+	}
 }
 
 // Domains for cloudflare edgetunnels.
+func (c *CollectorConf) RawDomainStore() *ListStore[string] {
+	return NewLineStore(c.RawDomainPath(), RawEdDomains)
+}
+
 func (c *CollectorConf) ShowRawDomains() {
-	dPath := c.RawDomainPath()
-	if ok, _ := gutils.PathIsExist(dPath); ok {
-		content, _ := os.ReadFile(dPath)
-		gprint.PrintInfo("RawDomain list for cloudflare edgetunnels: ")
-		fmt.Println(gprint.YellowStr(string(content)))
-	} else {
-		gprint.PrintError("No rawDomain list for edgetunnels available.")
+	domains := c.GetRawDomains()
+	if len(domains) == 0 {
+		logs.Error("No rawDomain list for edgetunnels available.")
+		return
 	}
+	logs.Info("RawDomain list for cloudflare edgetunnels: ")
+	fmt.Println(gprint.YellowStr(strings.Join(domains, "\n")))
 }
 
 func (c *CollectorConf) GetRawDomains() (r []string) {
-	dPath := c.RawDomainPath()
-	if ok, _ := gutils.PathIsExist(dPath); ok {
-		content, _ := os.ReadFile(dPath)
-		r = strings.Split(string(content), "\n")
-	} else {
-		os.WriteFile(dPath, []byte(RawEdDomains), os.ModePerm)
-		r = strings.Split(RawEdDomains, "\n")
+	r, err := c.RawDomainStore().List()
+	if err != nil {
+		logs.Error("%+v", err)
 	}
 	return r
 }
 
+// Dry runs keep the list, the list with domains added goes to RawDomainOutputPath.
 func (c *CollectorConf) AddRawDomains(domains ...string) {
-	dPath := c.RawDomainPath()
-	if ok, _ := gutils.PathIsExist(dPath); ok {
-		content, _ := os.ReadFile(dPath)
-		s := string(content)
-		toSaveList := []string{}
-		for _, d := range domains {
-			if !strings.Contains(s, d) {
-				toSaveList = append(toSaveList, d)
-			}
-		}
-		os.WriteFile(dPath, []byte(s+strings.Join(toSaveList, "\n")), os.ModePerm)
+	store := c.RawDomainStore()
+	domains = splitLines(strings.Join(domains, "\n"))
+	var (
+		added int
+		err   error
+	)
+	if DryRun() {
+		added, err = store.AddTo(c.RawDomainOutputPath(), domains...)
 	} else {
-		os.WriteFile(dPath, []byte(RawEdDomains+strings.Join(domains, "\n")), os.ModePerm)
+		added, err = store.Add(domains...)
+	}
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	logs.Info("%d rawDomains added.", added)
+}
+
+func (c *CollectorConf) RemoveRawDomains(domains ...string) {
+	removed, err := c.RawDomainStore().Remove(domains...)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
 	}
+	logs.Info("%d rawDomains removed.", removed)
 }
 
 // Subscriber list.
 func (c *CollectorConf) ShowSubs() {
-	subPath := c.subPath()
-	if ok, _ := gutils.PathIsExist(subPath); ok {
-		content, _ := os.ReadFile(subPath)
-		gprint.PrintInfo("Subscribed urls: ")
-		fmt.Println(gprint.YellowStr(string(content)))
-	} else {
-		gprint.PrintError("No subscribed urls available.")
+	subs := c.GetSubscribers()
+	if len(subs) == 0 {
+		logs.Error("No subscribed urls available.")
+		return
+	}
+	logs.Info("Subscribed urls: ")
+	for _, s := range subs {
+		line := s.Url
+		if s.Format != "" {
+			line += fmt.Sprintf(" [%s]", s.Format)
+		}
+		if len(s.Tags) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(s.Tags, ","))
+		}
+		if s.Enabled {
+			fmt.Println(gprint.YellowStr(line))
+		} else {
+			fmt.Println(gprint.CyanStr("# " + line))
+		}
 	}
 }
 
+// Urls of enabled subscribers.
 func (c *CollectorConf) GetSubs() (r []string) {
-	subPath := c.subPath()
-	if ok, _ := gutils.PathIsExist(subPath); ok {
-		content, _ := os.ReadFile(subPath)
-		r = strings.Split(string(content), "\n")
-	} else {
-		os.WriteFile(subPath, []byte(SubscribedUrls), os.ModePerm)
-		r = strings.Split(SubscribedUrls, "\n")
+	for _, s := range c.GetSubscribers() {
+		if s.Enabled && s.Validate() == nil {
+			r = append(r, s.Url)
+		}
 	}
 	return r
 }
 
 func (c *CollectorConf) AddSubs(subs ...string) {
-	subPath := c.DomainPath()
-	newStr := strings.Join(subs, "\n")
-	if ok, _ := gutils.PathIsExist(subPath); ok {
-		content, _ := os.ReadFile(subPath)
-		s := string(content) + newStr
-		os.WriteFile(subPath, []byte(s), os.ModePerm)
+	toAdd := []*Subscriber{}
+	for _, sUrl := range splitLines(strings.Join(subs, "\n")) {
+		toAdd = append(toAdd, &Subscriber{Url: sUrl, Enabled: true})
+	}
+	added, err := c.SubStore().Add(toAdd...)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	logs.Info("%d subscribed urls added.", added)
+}
+
+func (c *CollectorConf) RemoveSubs(subs ...string) {
+	removed, err := c.SubStore().Remove(subs...)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	logs.Info("%d subscribed urls removed.", removed)
+}
+
+// Removes duplicated items in subscriber and rawDomain lists.
+func (c *CollectorConf) DedupLists() {
+	if removed, err := c.SubStore().Dedup(); err != nil {
+		logs.Error("%+v", err)
+	} else {
+		logs.Info("%d duplicated subscribed urls removed.", removed)
+	}
+	if removed, err := c.RawDomainStore().Dedup(); err != nil {
+		logs.Error("%+v", err)
 	} else {
-		os.WriteFile(subPath, []byte(RawEdDomains+newStr), os.ModePerm)
+		logs.Info("%d duplicated rawDomains removed.", removed)
 	}
 }
 
@@ -290,7 +673,7 @@ func (c *CollectorConf) GetCloudflareIPV4RangeList() (r []string) {
 	f.Timeout = 30 * time.Second
 	f.SetUrl(CloudflareIPV4RangeUrl)
 	if respStr, sCode := f.GetString(); sCode == 200 {
-		os.WriteFile(fPath, []byte(respStr), os.ModePerm)
+		utils.WriteFile(fPath, []byte(respStr), os.ModePerm)
 		r = strings.Split(respStr, "\n")
 	}
 	return
@@ -301,7 +684,7 @@ func (c *CollectorConf) AddGithubRepo(repo ...string) {
 	fPath := c.GithubRepoFilePath()
 	data, _ := os.ReadFile(fPath)
 	s := string(data) + "\n" + strings.Join(repo, "\n")
-	os.WriteFile(fPath, []byte(s), os.ModePerm)
+	utils.WriteFileWithBackup(fPath, []byte(s), os.ModePerm)
 }
 
 // Read github repos for version list.
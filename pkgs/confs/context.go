@@ -0,0 +1,67 @@
+package confs
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+// Context of the run, collectors, fetchers and uploaders stop when it is canceled.
+func (c *CollectorConf) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c *CollectorConf) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Context of a run that CancelRun cancels, call the returned func when the run ends.
+func (c *CollectorConf) StartCancelable() (end func()) {
+	parent := c.Context()
+	ctx, cancel := context.WithCancel(parent)
+	c.ctx, c.cancel = ctx, cancel
+	return func() {
+		cancel()
+		c.ctx, c.cancel = parent, nil
+	}
+}
+
+// Cancels the run like Ctrl-C, finished results are still published.
+func (c *CollectorConf) CancelRun() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *CollectorConf) Canceled() bool {
+	return c.Context().Err() != nil
+}
+
+/*
+Returns a context canceled by the first Ctrl-C or SIGTERM,
+the run stops fetching and publishes what is finished. A second signal exits immediately.
+*/
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+		case <-ctx.Done():
+			signal.Stop(sigs)
+			return
+		}
+		logs.Warning("Canceling, finished results are still published. Press Ctrl-C again to exit immediately.")
+		cancel()
+		<-sigs
+		exit(CanceledExitCode)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,201 @@
+package confs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Every field of CollectorConf can be set by an env var or by the repeatable --set flag,
+named after its koanf key:
+
+	token      -> env PXY_TOKEN,      flag --set token=xxx
+	proxy_uri  -> env PXY_PROXY_URI,  flag --set proxy_uri=xxx
+
+Precedence: flag > env > config.json.
+Lists are comma separated, maps are like "versions=v/{file},proxy=p/{file}".
+Values from env and flags are never written back into config.json.
+The --cfg-* flags of older releases, like --cfg-proxy-uri, still work but are hidden and deprecated.
+*/
+const (
+	ConfEnvPrefix  string = "PXY_"
+	ConfFlagPrefix string = "cfg-"
+	ConfSetFlag    string = "set"
+)
+
+type ConfField struct {
+	Name  string // koanf key.
+	Env   string
+	Flag  string // deprecated, see ConfSetFlag.
+	index int
+}
+
+// Like "--set token=<value>".
+func (f ConfField) SetHint() string {
+	return fmt.Sprintf("--%s %s=<value>", ConfSetFlag, f.Name)
+}
+
+func ConfFields() (r []ConfField) {
+	t := reflect.TypeOf(CollectorConf{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("json,koanf")
+		if name == "" {
+			continue
+		}
+		r = append(r, ConfField{
+			Name:  name,
+			Env:   ConfEnvPrefix + strings.ToUpper(name),
+			Flag:  ConfFlagPrefix + strings.ReplaceAll(name, "_", "-"),
+			index: i,
+		})
+	}
+	return
+}
+
+// Value of a config field, for pxy config show.
+func (c *CollectorConf) FieldValue(f ConfField) any {
+	return reflect.ValueOf(c).Elem().Field(f.index).Interface()
+}
+
+/*
+Moves config flags into env vars, so they apply before config.json is loaded,
+even before the interactive setup. Keys of --set may use dashes, like proxy-uri.
+Returns the keys of --set that are no config fields.
+*/
+func ConfArgsToEnv(args []string) (unknown []string) {
+	fields := ConfFields()
+	flags := map[string]string{"--profile": ProfileEnvName, "--work-dir": WorkDirEnvName}
+	keys := map[string]string{}
+	for _, f := range fields {
+		flags["--"+f.Flag] = f.Env
+		keys[f.Name] = f.Env
+	}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		envName, ok := flags[name]
+		if !ok && name != "--"+ConfSetFlag {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		if name == "--"+ConfSetFlag {
+			key, v, _ := strings.Cut(value, "=")
+			key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+			if envName, ok = keys[key]; !ok {
+				unknown = append(unknown, key)
+				continue
+			}
+			value = v
+		}
+		os.Setenv(envName, value)
+	}
+	return
+}
+
+func setField(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			l := reflect.New(v.Type())
+			if err := json.Unmarshal([]byte(value), l.Interface()); err != nil {
+				return err
+			}
+			v.Set(l.Elem())
+			return nil
+		}
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s needs a json array", v.Type())
+		}
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		if strings.HasPrefix(strings.TrimSpace(value), "{") {
+			m := reflect.New(v.Type())
+			if err := json.Unmarshal([]byte(value), m.Interface()); err != nil {
+				return err
+			}
+			v.Set(m.Elem())
+			return nil
+		}
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s needs a json object", v.Type())
+		}
+		m := map[string]string{}
+		for _, s := range strings.Split(value, ",") {
+			if key, val, ok := strings.Cut(s, "="); ok {
+				m[strings.TrimSpace(key)] = strings.TrimSpace(val)
+			}
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type: %s", v.Type())
+	}
+	return nil
+}
+
+// Applies env vars over values from config.json, and keeps the originals for Save.
+func (c *CollectorConf) applyEnv() {
+	c.envOrigins = map[int]reflect.Value{}
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range ConfFields() {
+		value, ok := os.LookupEnv(f.Env)
+		if !ok {
+			continue
+		}
+		field := v.Field(f.index)
+		origin := reflect.New(field.Type()).Elem()
+		origin.Set(field)
+		if err := setField(field, value); err != nil {
+			field.Set(origin)
+			logs.Warning("invalid value for %s: %v", f.Env, err)
+			continue
+		}
+		c.envOrigins[f.index] = origin
+	}
+}
+
+// Swaps values from env with the original ones, called around Save.
+func (c *CollectorConf) swapEnvOrigins() {
+	v := reflect.ValueOf(c).Elem()
+	for idx, origin := range c.envOrigins {
+		field := v.Field(idx)
+		current := reflect.New(field.Type()).Elem()
+		current.Set(field)
+		field.Set(origin)
+		c.envOrigins[idx] = current
+	}
+}
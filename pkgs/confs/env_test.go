@@ -0,0 +1,41 @@
+package confs
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfArgsToEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		unknown []string
+	}{
+		{"set", []string{"vf", "--set", "proxy_uri=http://127.0.0.1:7890"}, map[string]string{"PXY_PROXY_URI": "http://127.0.0.1:7890"}, nil},
+		{"set with equals", []string{"--set=token=a=b"}, map[string]string{"PXY_TOKEN": "a=b"}, nil},
+		{"set with dashes", []string{"--set", "Log-Level=debug"}, map[string]string{"PXY_LOG_LEVEL": "debug"}, nil},
+		{"set repeated", []string{"--set", "repo=a", "--set", "repo=b"}, map[string]string{"PXY_REPO": "b"}, nil},
+		{"deprecated flag", []string{"--cfg-proxy-uri", "http://127.0.0.1:7891"}, map[string]string{"PXY_PROXY_URI": "http://127.0.0.1:7891"}, nil},
+		{"unknown key", []string{"--set", "no_such_key=1"}, nil, []string{"no_such_key"}},
+		{"no value", []string{"--set"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, f := range ConfFields() {
+				t.Setenv(f.Env, "")
+				os.Unsetenv(f.Env)
+			}
+			unknown := ConfArgsToEnv(tt.args)
+			if !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("unknown = %v, want %v", unknown, tt.unknown)
+			}
+			for name, want := range tt.env {
+				if got := os.Getenv(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
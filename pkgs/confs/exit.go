@@ -0,0 +1,110 @@
+package confs
+
+import (
+	"sync"
+)
+
+/*
+Exit codes of runs, so that wrapper scripts and CI jobs can tell "retry later" from "fix your config":
+
+	0    ok.
+	1    failed checks and usage errors, like pxy verify, pxy doctor and unknown tools of pxy list.
+	2    config error, fix the config: storage not initialized, invalid proxy.
+	3    collectors panicked or exited, other collectors are still published.
+	4    network error, retry later: fetches failed after all retries.
+	5    upload failed, retry later or run pxy upload retry.
+	6    blocked by a validation gate, check the outputs.
+	7    busy, another run holds the lock of the work dir, see lock.go.
+	130  canceled by Ctrl-C.
+
+A run failing in several ways exits with the class that needs attention first, see failureOrder.
+*/
+
+type FailureClass string
+
+const (
+	FailConfig    FailureClass = "config"
+	FailGate      FailureClass = "gate"
+	FailUpload    FailureClass = "upload"
+	FailNetwork   FailureClass = "network"
+	FailCollector FailureClass = "collector"
+	FailCanceled  FailureClass = "canceled"
+)
+
+const (
+	// exit code after Ctrl-C.
+	CanceledExitCode int = 130
+	// exit code of invalid or incomplete configs.
+	ConfigErrorExitCode int = 2
+	// exit code when collectors panicked or exited(other collectors are still published).
+	CollectorFailedExitCode int = 3
+	// exit code when fetches failed after all retries.
+	NetworkErrorExitCode int = 4
+	// exit code when uploads failed, they are retried by the next run or pxy upload retry.
+	UploadFailedExitCode int = 5
+	// exit code when a validation gate or the shrink check blocked an upload.
+	GateBlockedExitCode int = 6
+	// exit code when another run holds the lock of the work dir, nothing was done.
+	BusyExitCode int = 7
+)
+
+var exitCodes = map[FailureClass]int{
+	FailConfig:    ConfigErrorExitCode,
+	FailGate:      GateBlockedExitCode,
+	FailUpload:    UploadFailedExitCode,
+	FailNetwork:   NetworkErrorExitCode,
+	FailCollector: CollectorFailedExitCode,
+	FailCanceled:  CanceledExitCode,
+}
+
+// Fixing the config comes first, network errors and failed collectors often go away by themselves.
+var failureOrder = []FailureClass{FailConfig, FailGate, FailUpload, FailNetwork, FailCollector}
+
+var (
+	failures     = map[FailureClass]int{}
+	failuresLock = &sync.Mutex{}
+)
+
+// Records a failure of the current run.
+func Fail(class FailureClass) {
+	failuresLock.Lock()
+	failures[class]++
+	failuresLock.Unlock()
+}
+
+// Forgets failures of the previous run, called when a run starts.
+func ResetFailures() {
+	failuresLock.Lock()
+	failures = map[FailureClass]int{}
+	failuresLock.Unlock()
+}
+
+// Failures of the current run by class.
+func Failures() map[FailureClass]int {
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	r := make(map[FailureClass]int, len(failures))
+	for class, n := range failures {
+		r[class] = n
+	}
+	return r
+}
+
+/*
+The failure class and exit code of the current run, "" and 0 when nothing failed.
+Canceled runs are reported by the caller, the context is not known here.
+*/
+func Failure() (class FailureClass, code int) {
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	for _, class := range failureOrder {
+		if failures[class] > 0 {
+			return class, exitCodes[class]
+		}
+	}
+	return "", 0
+}
+
+func ExitCodeOf(class FailureClass) int {
+	return exitCodes[class]
+}
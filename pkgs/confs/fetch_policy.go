@@ -0,0 +1,133 @@
+package confs
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFetchTimeout     = 30 * time.Second
+	DefaultFetchBackoff     = 2 * time.Second
+	DefaultFetchRetries     = 2
+	DefaultFetchRetryBudget = 50
+	MaxFetchBackoff         = 2 * time.Minute
+	DefaultPageLocale       = "en"
+)
+
+/*
+FetchPolicy for requests to a host.
+
+Example for config.json:
+
+	"FetchPolicies": [
+	    {"Host": "dl.google.com", "Timeout": "120s", "Retries": 2},
+	    {"Host": "*.sourceforge.net", "Retries": 5, "Backoff": "5s"},
+	    {"Host": "repo.anaconda.com", "Delay": "3s", "Concurrency": 1, "Robots": true},
+	    {"Host": "*", "Timeout": "60s"}
+	]
+
+Hosts are matched exactly first, then by "*." suffix patterns, then "*".
+A list instead of a map, since koanf splits map keys by dots.
+Backoff doubles after each retry, with jitter.
+Delay, Concurrency and Robots keep fragile vendor sites from banning the collector, see pkgs/fetch/polite.go.
+*/
+type FetchPolicy struct {
+	Host      string `json,koanf:"host"`
+	Timeout   string `json,koanf:"timeout"`    // like "60s", 30s by default.
+	Retries   *int   `json,koanf:"retries"`    // retries after the first attempt, 2 by default.
+	Backoff   string `json,koanf:"backoff"`    // wait before the first retry, 2s by default.
+	RateLimit int    `json,koanf:"rate_limit"` // requests per minute to the host, 0 for unlimited.
+	// Politeness.
+	Delay       string `json,koanf:"delay"`       // minimum wait between requests to the host, like "2s".
+	Concurrency int    `json,koanf:"concurrency"` // requests to the host at the same time, 0 for unlimited, 1 for fragile sites.
+	Robots      bool   `json,koanf:"robots"`      // skips urls disallowed by robots.txt of the host, and follows its Crawl-delay.
+	// Bytes to download from the host per run, 0 for unlimited, see pkgs/fetch/bandwidth.go.
+	Quota int64 `json,koanf:"quota"`
+}
+
+// Policy for an url, never nil.
+func (c *CollectorConf) FetchPolicy(rawUrl string) *FetchPolicy {
+	host := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	host = strings.ToLower(host)
+	var exact, suffixed, fallback *FetchPolicy
+	longest := 0 // the longest matching suffix wins.
+	for _, p := range c.FetchPolicies {
+		if p == nil {
+			continue
+		}
+		pattern := strings.ToLower(p.Host)
+		switch {
+		case pattern == host:
+			exact = p
+		case pattern == "*":
+			fallback = p
+		case strings.HasPrefix(pattern, "*."):
+			suffix := strings.TrimPrefix(pattern, "*.")
+			if len(suffix) > longest && (host == suffix || strings.HasSuffix(host, "."+suffix)) {
+				suffixed, longest = p, len(suffix)
+			}
+		}
+	}
+	for _, p := range []*FetchPolicy{exact, suffixed, fallback} {
+		if p != nil {
+			return p
+		}
+	}
+	return &FetchPolicy{}
+}
+
+func (p *FetchPolicy) RetryCount() int {
+	if p.Retries == nil || *p.Retries < 0 {
+		return DefaultFetchRetries
+	}
+	return *p.Retries
+}
+
+func (p *FetchPolicy) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(p.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultFetchTimeout
+}
+
+func (p *FetchPolicy) DelayDuration() time.Duration {
+	if d, err := time.ParseDuration(p.Delay); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Wait before the given retry, starting from 1.
+func (p *FetchPolicy) BackoffDuration(retry int) time.Duration {
+	d := DefaultFetchBackoff
+	if b, err := time.ParseDuration(p.Backoff); err == nil && b > 0 {
+		d = b
+	}
+	for i := 1; i < retry && d < MaxFetchBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxFetchBackoff {
+		d = MaxFetchBackoff
+	}
+	return d
+}
+
+// Retries allowed in a run across all hosts, so that an outage does not stall the run.
+func (c *CollectorConf) RetryBudget() int {
+	if c.FetchRetryBudget > 0 {
+		return c.FetchRetryBudget
+	}
+	return DefaultFetchRetryBudget
+}
+
+// Locale of scraped pages, parsers of localized pages expect it.
+func (c *CollectorConf) Locale() string {
+	if c.PageLocale != "" {
+		return c.PageLocale
+	}
+	return DefaultPageLocale
+}
@@ -0,0 +1,157 @@
+package confs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/koanfer"
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/providers/structs"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Config file names, detected by extension.
+config.json is created when none exists, rename it to config.yaml or config.toml to switch formats.
+*/
+var ConfigFileNames = []string{ConfigFileName, "config.yaml", "config.yml", "config.toml"}
+
+type confFile interface {
+	Load(obj interface{}) error
+	Save(obj interface{}) error
+}
+
+// Finds the config file in dir, config.json if none exists.
+func FindConfigFile(dir string) string {
+	found := []string{}
+	for _, name := range ConfigFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	if len(found) == 0 {
+		return filepath.Join(dir, ConfigFileName)
+	}
+	if len(found) > 1 {
+		logs.Warning("Found %s in %s, %s is used.", strings.Join(found, ", "), dir, found[0])
+	}
+	return filepath.Join(dir, found[0])
+}
+
+func newConfFile(fPath string) (confFile, error) {
+	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &fileKoanfer{k: koanf.New("."), parser: configParser(fPath), fPath: fPath}, nil
+}
+
+func configParser(fPath string) koanf.Parser {
+	switch strings.ToLower(filepath.Ext(fPath)) {
+	case ".yaml", ".yml":
+		return yamlParser{}
+	case ".toml":
+		return tomlParser{}
+	default:
+		return koanfer.NewJsonParser()
+	}
+}
+
+// Like koanfer.JsonKoanfer, for all formats.
+type fileKoanfer struct {
+	k      *koanf.Koanf
+	parser koanf.Parser
+	fPath  string
+}
+
+func (f *fileKoanfer) Save(obj interface{}) error {
+	f.k.Load(structs.Provider(obj, "koanf"), nil)
+	b, err := f.k.Marshal(f.parser)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithBackup(f.fPath, b, 0666)
+}
+
+func (f *fileKoanfer) Load(obj interface{}) error {
+	if err := f.k.Load(file.Provider(f.fPath), f.parser); err != nil {
+		return err
+	}
+	return f.k.UnmarshalWithConf("", obj, koanf.UnmarshalConf{Tag: "koanf"})
+}
+
+type yamlParser struct{}
+
+func (yamlParser) Unmarshal(b []byte) (out map[string]interface{}, err error) {
+	err = yaml.Unmarshal(b, &out)
+	return
+}
+
+func (yamlParser) Marshal(o map[string]interface{}) ([]byte, error) {
+	return yaml.Marshal(o)
+}
+
+type tomlParser struct{}
+
+func (tomlParser) Unmarshal(b []byte) (out map[string]interface{}, err error) {
+	err = toml.Unmarshal(b, &out)
+	return
+}
+
+// toml has no null, so nil values are left out.
+func (tomlParser) Marshal(o map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := toml.NewEncoder(buf).Encode(dropNil(o))
+	return buf.Bytes(), err
+}
+
+func dropNil(m map[string]interface{}) map[string]interface{} {
+	r := map[string]interface{}{}
+	for k, v := range m {
+		if v == nil {
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Pointer, reflect.Interface:
+			if rv.IsNil() {
+				continue
+			}
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			v = dropNil(sub)
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// Reads a config file of any format into a map.
+func readConfigMap(fPath string) (m map[string]any, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return map[string]any{}, err
+	}
+	if m, err = configParser(fPath).Unmarshal(content); err != nil {
+		return map[string]any{}, fmt.Errorf("parse %s failed: %w", fPath, err)
+	}
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m, nil
+}
+
+func writeConfigMap(fPath string, m map[string]any) error {
+	content, err := configParser(fPath).Marshal(m)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithBackup(fPath, content, 0666)
+}
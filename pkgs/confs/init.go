@@ -0,0 +1,121 @@
+package confs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"golang.org/x/term"
+)
+
+const (
+	// disables the interactive setup.
+	NonInteractiveEnvName string = "PXY_NON_INTERACTIVE"
+	// set by CI services like GitHub Actions and GitLab CI, which may attach a pseudo terminal nobody types into.
+	CIEnvName string = "CI"
+)
+
+var storageTypeNames = map[string]StorageType{
+	"github": StorageGithub,
+	"gitee":  StorageGitee,
+	"git":    StorageGit,
+	"azure":  StorageAzure,
+	"gcs":    StorageGCS,
+}
+
+// Parses a storage type from its name or number.
+func ParseStorageType(s string) (StorageType, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if t, ok := storageTypeNames[s]; ok {
+		return t, nil
+	}
+	for _, t := range storageTypeNames {
+		if s == fmt.Sprintf("%d", t) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown storage type: %s", s)
+}
+
+// Prompts are only shown in a terminal, never in CI, cron jobs or services.
+func Interactive() bool {
+	if gconv.Bool(os.Getenv(NonInteractiveEnvName)) || gconv.Bool(os.Getenv(CIEnvName)) {
+		return false
+	}
+	return term.IsTerminal(int(syscall.Stdin))
+}
+
+// How to set missing fields without prompts, like "PXY_TOKEN or --set token=<value>".
+func MissingHint(missing []string) string {
+	fields := map[string]ConfField{}
+	for _, f := range ConfFields() {
+		fields[f.Name] = f
+	}
+	hints := []string{}
+	for _, name := range missing {
+		if f, ok := fields[name]; ok {
+			hints = append(hints, fmt.Sprintf("%s or %s", f.Env, f.SetHint()))
+		}
+	}
+	return strings.Join(hints, ", ")
+}
+
+// Missing returns the required fields that are not set for the storage type.
+func (c *CollectorConf) Missing() (r []string) {
+	required := map[string]string{}
+	switch c.Type {
+	case StorageGithub:
+		required = map[string]string{"username": c.UserName, "repo": c.Repo}
+		if c.GithubAppID != "" {
+			required["github_app_installation_id"] = c.GithubAppInstallationID
+			required["github_app_private_key"] = c.GithubAppPrivateKey
+		} else {
+			required["token"] = c.Token
+		}
+	case StorageGitee:
+		required = map[string]string{"username": c.UserName, "token": c.Token, "repo": c.Repo}
+	case StorageGit:
+		required = map[string]string{"git_remote": c.GitRemote}
+	case StorageAzure:
+		required = map[string]string{"azure_account": c.AzureAccount, "azure_container": c.AzureContainer, "azure_sas": c.AzureSAS}
+	case StorageGCS:
+		required = map[string]string{"gcs_bucket": c.GCSBucket, "gcs_credentials": c.GCSCredentials}
+	default:
+		return []string{"type"}
+	}
+	for _, f := range ConfFields() {
+		if v, ok := required[f.Name]; ok && v == "" {
+			r = append(r, f.Name)
+		}
+	}
+	return
+}
+
+/*
+Init sets up the config without prompts.
+Values from env vars and --set flags are saved too, secrets go to the secret store.
+*/
+func (c *CollectorConf) Init(sType StorageType, username, token, repo string) error {
+	c.Type = sType
+	if username != "" {
+		c.UserName = username
+	}
+	if token != "" {
+		c.Token = token
+	}
+	if repo != "" {
+		c.Repo = repo
+	}
+	if c.CryptoKey == "" {
+		c.CryptoKey = gutils.RandomString(16)
+	}
+	if missing := c.Missing(); len(missing) > 0 {
+		return fmt.Errorf("missing required config: %s", strings.Join(missing, ", "))
+	}
+	// persists values from env and flags.
+	c.envOrigins = nil
+	return c.Save()
+}
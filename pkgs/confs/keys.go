@@ -0,0 +1,104 @@
+package confs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+const (
+	VPNNewFileName    string        = "conf.new.txt"
+	DefaultKeyOverlap time.Duration = 7 * 24 * time.Hour
+)
+
+/*
+Crypto key rotation.
+
+After a rotation, conf.txt is still encrypted with the old key for KeyOverlap,
+while conf.new.txt is encrypted with the new key, so consumers can switch keys at any time in the window.
+Then the old key is retired and conf.txt is encrypted with the new key.
+conf.new.txt is kept for another KeyOverlap, for consumers that switched to it.
+*/
+func (c *CollectorConf) KeyOverlapDuration() time.Duration {
+	if d, err := time.ParseDuration(c.KeyOverlap); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultKeyOverlap
+}
+
+func (c *CollectorConf) keyRotatedAt() (t time.Time, ok bool) {
+	return utils.ParseTime(c.KeyRotatedAt)
+}
+
+// Checks if conf.txt should still be encrypted with the old key.
+func (c *CollectorConf) RotationActive(now time.Time) bool {
+	rotatedAt, ok := c.keyRotatedAt()
+	return c.OldCryptoKey != "" && ok && now.Before(rotatedAt.Add(c.KeyOverlapDuration()))
+}
+
+// Retires the old key when the overlap period is over, not in dry runs.
+func (c *CollectorConf) RetireOldKey(now time.Time) {
+	if c.OldCryptoKey == "" || c.RotationActive(now) || DryRun() {
+		return
+	}
+	c.OldCryptoKey = ""
+	if err := c.Save(); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	logs.Info("Old crypto key is retired, conf.txt is encrypted with the new key from now on.")
+}
+
+/*
+Keys for publishing proxies:
+confKey for conf.txt, newKey for conf.new.txt, an empty newKey means conf.new.txt is not published.
+*/
+func (c *CollectorConf) PublishKeys(now time.Time) (confKey, newKey string) {
+	rotatedAt, ok := c.keyRotatedAt()
+	if !ok || now.After(rotatedAt.Add(2*c.KeyOverlapDuration())) {
+		return c.CryptoKey, ""
+	}
+	if c.RotationActive(now) {
+		return c.OldCryptoKey, c.CryptoKey
+	}
+	return c.CryptoKey, c.CryptoKey
+}
+
+func (c *CollectorConf) VPNNewFilePath() string {
+	return c.OutputPath(VPNNewFileName)
+}
+
+var ErrRotationInProgress = errors.New("a key rotation is in progress")
+
+/*
+Rotates the crypto key, the old key keeps encrypting conf.txt for the overlap period when overlap is true.
+Another overlapped rotation is refused until the old key is retired,
+otherwise consumers that already switched to conf.new.txt would lose their key.
+*/
+func (c *CollectorConf) RotateCryptoKey(overlap bool) error {
+	c.Load()
+	if c.CryptoKey != "" && overlap {
+		if c.OldCryptoKey != "" {
+			rotatedAt, _ := c.keyRotatedAt()
+			return fmt.Errorf("%w, the old key is retired after %s, or rotate with --no-overlap",
+				ErrRotationInProgress, utils.FormatTime(rotatedAt.Add(c.KeyOverlapDuration())))
+		}
+		c.OldCryptoKey = c.CryptoKey
+		c.KeyRotatedAt = utils.Now()
+	} else {
+		c.OldCryptoKey = ""
+		c.KeyRotatedAt = ""
+	}
+	c.CryptoKey = gutils.RandomString(16)
+	fmt.Fprintln(RawStdout(), gprint.CyanStr("CryptoKey: %s", c.CryptoKey))
+	if c.OldCryptoKey != "" {
+		logs.Info("conf.txt is encrypted with the old key until %s, conf.new.txt with the new key.",
+			utils.FormatTime(time.Now().Add(c.KeyOverlapDuration())))
+	}
+	return c.Save()
+}
@@ -0,0 +1,192 @@
+package confs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+// Guards read-modify-write of list files, keyed by file path.
+var listLocks = &sync.Map{}
+
+func listLock(fPath string) *sync.Mutex {
+	l, _ := listLocks.LoadOrStore(fPath, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+/*
+ListStore manages a list file, like subscribers.json or raw_domains.txt.
+
+Items are identified by Key, so Add skips existing items and Remove/Dedup work on keys.
+The file is created from Defaults when it does not exist, and always written atomically.
+*/
+type ListStore[T any] struct {
+	Path     string
+	Key      func(T) string
+	Decode   func([]byte) ([]T, error)
+	Encode   func([]T) ([]byte, error)
+	Defaults func() []T
+}
+
+// A list of lines, empty lines are ignored.
+func NewLineStore(fPath, defaults string) *ListStore[string] {
+	return &ListStore[string]{
+		Path: fPath,
+		Key:  func(s string) string { return s },
+		Decode: func(content []byte) ([]string, error) {
+			return splitLines(string(content)), nil
+		},
+		Encode: func(items []string) ([]byte, error) {
+			return []byte(strings.Join(items, "\n") + "\n"), nil
+		},
+		Defaults: func() []string { return splitLines(defaults) },
+	}
+}
+
+func splitLines(content string) (r []string) {
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			r = append(r, line)
+		}
+	}
+	return
+}
+
+func (l *ListStore[T]) load() ([]T, error) {
+	if ok, _ := gutils.PathIsExist(l.Path); !ok {
+		var items []T
+		if l.Defaults != nil {
+			items = l.Defaults()
+		}
+		return items, l.save(items)
+	}
+	content, err := os.ReadFile(l.Path)
+	if err != nil {
+		return nil, err
+	}
+	items, err := l.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", l.Path, err)
+	}
+	return items, nil
+}
+
+// Dry runs keep lists as they are.
+func (l *ListStore[T]) save(items []T) error {
+	if DryRun() {
+		return nil
+	}
+	content, err := l.Encode(items)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithBackup(l.Path, content, 0o644)
+}
+
+func (l *ListStore[T]) List() ([]T, error) {
+	lock := listLock(l.Path)
+	lock.Lock()
+	defer lock.Unlock()
+	return l.load()
+}
+
+// Loads, modifies and saves the list while holding the lock.
+func (l *ListStore[T]) Update(f func([]T) []T) error {
+	lock := listLock(l.Path)
+	lock.Lock()
+	defer lock.Unlock()
+	items, err := l.load()
+	if err != nil {
+		return err
+	}
+	return l.save(f(items))
+}
+
+// Appends items that are not in the list yet.
+func (l *ListStore[T]) Add(items ...T) (added int, err error) {
+	err = l.Update(func(list []T) []T {
+		list, added = l.merge(list, items)
+		return list
+	})
+	return
+}
+
+// Writes the list with items appended to fPath and keeps the list as it is, for dry runs.
+func (l *ListStore[T]) AddTo(fPath string, items ...T) (added int, err error) {
+	list, err := l.List()
+	if err != nil {
+		return
+	}
+	list, added = l.merge(list, items)
+	content, err := l.Encode(list)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
+		return
+	}
+	err = utils.WriteFile(fPath, content, 0o644)
+	return
+}
+
+func (l *ListStore[T]) merge(list, items []T) ([]T, int) {
+	added := 0
+	seen := map[string]bool{}
+	for _, item := range list {
+		seen[l.Key(item)] = true
+	}
+	for _, item := range items {
+		key := l.Key(item)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, item)
+		added++
+	}
+	return list, added
+}
+
+// Removes items by key.
+func (l *ListStore[T]) Remove(keys ...string) (removed int, err error) {
+	toRemove := map[string]bool{}
+	for _, key := range keys {
+		toRemove[key] = true
+	}
+	err = l.Update(func(list []T) []T {
+		kept := list[:0]
+		for _, item := range list {
+			if toRemove[l.Key(item)] {
+				removed++
+				continue
+			}
+			kept = append(kept, item)
+		}
+		return kept
+	})
+	return
+}
+
+// Removes duplicated items, the first one is kept.
+func (l *ListStore[T]) Dedup() (removed int, err error) {
+	err = l.Update(func(list []T) []T {
+		seen := map[string]bool{}
+		kept := list[:0]
+		for _, item := range list {
+			key := l.Key(item)
+			if seen[key] {
+				removed++
+				continue
+			}
+			seen[key] = true
+			kept = append(kept, item)
+		}
+		return kept
+	})
+	return
+}
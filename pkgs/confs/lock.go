@@ -0,0 +1,211 @@
+package confs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Lock of the work dir, so that overlapping runs, like a cron job and pxy serve, do not write
+conf.txt, history.json and the manifest at the same time, or interleave uploads.
+
+The lock file records who holds it. It is stale when its process is gone on this host,
+or when it is older than StaleLockAge, for work dirs shared by several hosts, and is taken over then.
+A lock file that can not be parsed is held until it is older than BrokenLockAge.
+The lock is reentrant in a process, a run of pxy serve holds it for the command it runs.
+*/
+
+const (
+	StaleLockAge  = 24 * time.Hour
+	BrokenLockAge = time.Minute
+)
+
+type LockHolder struct {
+	Pid       int    `json:"pid"`
+	Host      string `json:"host"`
+	Command   string `json:"command"`
+	StartedAt string `json:"started_at"`
+	modTime   time.Time
+	broken    bool
+}
+
+type LockedError struct {
+	Path   string
+	Holder *LockHolder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("work dir is locked by pxy %s(pid %d on %s) since %s, remove %s if no run is in progress",
+		e.Holder.Command, e.Holder.Pid, e.Holder.Host, e.Holder.StartedAt, e.Path)
+}
+
+var (
+	heldLock  = &sync.Mutex{}
+	heldCount int
+	heldPath  string
+)
+
+func (h *LockHolder) stale() bool {
+	if h.broken {
+		return time.Since(h.modTime) > BrokenLockAge
+	}
+	started, ok := utils.ParseTime(h.StartedAt)
+	if !ok || time.Since(started) > StaleLockAge {
+		return true
+	}
+	host, _ := os.Hostname()
+	return h.Host == host && !processAlive(h.Pid)
+}
+
+func readLock(fPath string) (*LockHolder, error) {
+	info, err := os.Stat(fPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+	h := &LockHolder{}
+	if err := json.Unmarshal(content, h); err != nil {
+		h = &LockHolder{broken: true}
+	}
+	h.modTime = info.ModTime()
+	return h, nil
+}
+
+/*
+Creates the lock file with its content at once: the content goes to a temp file,
+which is hard linked to the lock path, the link fails like O_EXCL when the lock exists.
+File systems without hard links get an O_EXCL create.
+*/
+func createLock(fPath, command string) error {
+	host, _ := os.Hostname()
+	content, _ := json.Marshal(&LockHolder{
+		Pid:       os.Getpid(),
+		Host:      host,
+		Command:   command,
+		StartedAt: utils.Now(),
+	})
+	tmpPath := fmt.Sprintf("%s.%d.tmp", fPath, os.Getpid())
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	err := os.Link(tmpPath, fPath)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(fPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(fPath)
+	}
+	return err
+}
+
+/*
+Replaces a stale lock. Only the process that creates the takeover file with O_EXCL does it,
+and it checks the lock again, as another process may have taken it over in the meantime.
+*/
+func takeOverLock(fPath, command string, stale *LockHolder) error {
+	guardPath := fPath + ".takeover"
+	guard, err := os.OpenFile(guardPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		if info, sErr := os.Stat(guardPath); sErr == nil && time.Since(info.ModTime()) > BrokenLockAge {
+			// left by a process that died while taking over.
+			os.Remove(guardPath)
+		}
+		return &LockedError{Path: fPath, Holder: stale}
+	}
+	if err != nil {
+		return err
+	}
+	guard.Close()
+	defer os.Remove(guardPath)
+
+	h, err := readLock(fPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case !h.stale():
+		return &LockedError{Path: fPath, Holder: h}
+	default:
+		if h.Pid != 0 {
+			logs.Warning("Took over the stale lock of pxy %s(pid %d on %s) since %s.", h.Command, h.Pid, h.Host, h.StartedAt)
+		}
+		if err := os.Remove(fPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return createLock(fPath, command)
+}
+
+/*
+Locks the work dir for a run of command, call unlock when the run ends.
+Returns a *LockedError when another run holds the lock.
+*/
+func (c *CollectorConf) LockWorkDir(command string) (unlock func(), err error) {
+	heldLock.Lock()
+	defer heldLock.Unlock()
+	fPath := c.LockPath()
+	if heldCount == 0 {
+		if err = os.MkdirAll(c.dirpath, os.ModePerm); err != nil {
+			return nil, err
+		}
+		err = createLock(fPath, command)
+		if errors.Is(err, os.ErrExist) {
+			h, rErr := readLock(fPath)
+			if rErr != nil {
+				return nil, rErr
+			}
+			if !h.stale() {
+				return nil, &LockedError{Path: fPath, Holder: h}
+			}
+			err = takeOverLock(fPath, command, h)
+		}
+		if err != nil {
+			return nil, err
+		}
+		heldPath = fPath
+	}
+	heldCount++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			heldLock.Lock()
+			defer heldLock.Unlock()
+			if heldCount > 0 {
+				if heldCount--; heldCount == 0 {
+					os.Remove(fPath)
+					heldPath = ""
+				}
+			}
+		})
+	}, nil
+}
+
+// Removes the lock when the process exits in the middle of a run.
+func releaseWorkDirLock() {
+	heldLock.Lock()
+	defer heldLock.Unlock()
+	if heldPath != "" {
+		os.Remove(heldPath)
+		heldPath, heldCount = "", 0
+	}
+}
@@ -0,0 +1,73 @@
+package confs
+
+import (
+	"os"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+/*
+ConfigVersion in config.json records the schema version of the work dir.
+Configs without it are version 1, new configs start at CurrentConfigVersion.
+*/
+const CurrentConfigVersion int = 3
+
+type migration struct {
+	version int // version after this step.
+	name    string
+	run     func(c *CollectorConf) error
+}
+
+// Migration steps, in order. Append a step when the schema changes.
+var migrations = []migration{
+	{
+		version: 2,
+		name:    "move plaintext secrets to the secret store",
+		// secrets are written to the secret store by Save.
+		run: func(c *CollectorConf) error { return nil },
+	},
+	{
+		version: 3,
+		name:    "convert subscribers.txt to subscribers.json",
+		run:     migrateSubscribers,
+	},
+}
+
+func migrateSubscribers(c *CollectorConf) error {
+	legacy := c.subPath()
+	if ok, _ := gutils.PathIsExist(legacy); !ok {
+		return nil
+	}
+	if _, err := c.SubStore().List(); err != nil {
+		return err
+	}
+	return os.Rename(legacy, legacy+".bak")
+}
+
+// Runs migration steps newer than ConfigVersion, and saves the config after each step.
+func (c *CollectorConf) migrate() {
+	if c.ConfigVersion > CurrentConfigVersion {
+		logs.Warning("%s is version %d, newer than supported version %d, unknown fields will be lost when saving.",
+			ConfigFileName, c.ConfigVersion, CurrentConfigVersion)
+		return
+	}
+	if c.ConfigVersion == 0 {
+		c.ConfigVersion = 1
+	}
+	for _, m := range migrations {
+		if m.version <= c.ConfigVersion {
+			continue
+		}
+		if err := m.run(c); err != nil {
+			logs.Error("Migrate config to version %d(%s) failed: %+v", m.version, m.name, err)
+			return
+		}
+		c.ConfigVersion = m.version
+		if err := c.Save(); err != nil {
+			logs.Error("%+v", err)
+			return
+		}
+		logs.Info("Config migrated to version %d: %s.", m.version, m.name)
+	}
+}
@@ -0,0 +1,73 @@
+package confs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// selects a profile, also set by --profile.
+	ProfileEnvName string = "PXY_PROFILE"
+	ProfileDirName string = "profiles"
+)
+
+/*
+Profiles let one machine maintain several collections, like "public" and "private" repos with different crypto keys.
+Each profile has its own work dir with its own config.json, lists and outputs.
+Profiles in the root config.json map a profile name to its work dir,
+an empty dir means <root dir>/profiles/<name>.
+*/
+func CurrentProfile() string {
+	return os.Getenv(ProfileEnvName)
+}
+
+func readRootConfig(rootDir string) (m map[string]any) {
+	m, _ = readConfigMap(FindConfigFile(rootDir))
+	return
+}
+
+/*
+Finds the config and data dirs of a profile, and registers the profile in the root config.json.
+A custom dir in Profiles keeps both config and data.
+*/
+func profileDirs(rootConfDir, rootDataDir, profile string) (confDir, dataDir string) {
+	m := readRootConfig(rootConfDir)
+	profiles, _ := m["Profiles"].(map[string]any)
+	if profiles == nil {
+		profiles = map[string]any{}
+	}
+	if dir, _ := profiles[profile].(string); dir != "" {
+		return dir, dir
+	}
+	if _, ok := profiles[profile]; !ok {
+		profiles[profile] = ""
+		m["Profiles"] = profiles
+		os.MkdirAll(rootConfDir, os.ModePerm)
+		writeConfigMap(FindConfigFile(rootConfDir), m)
+	}
+	return filepath.Join(rootConfDir, ProfileDirName, profile), filepath.Join(rootDataDir, ProfileDirName, profile)
+}
+
+// Lists profiles in the root config.json.
+func ListProfiles() (r []string) {
+	confDir, _ := RootDirs()
+	profiles, _ := readRootConfig(confDir)["Profiles"].(map[string]any)
+	for name := range profiles {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return
+}
+
+func (c *CollectorConf) Profile() string {
+	return c.profile
+}
+
+// Secret names in the keyring are prefixed by the profile.
+func (c *CollectorConf) secretName(name string) string {
+	if c.profile == "" {
+		return name
+	}
+	return c.profile + "/" + name
+}
@@ -0,0 +1,184 @@
+package confs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+// Proxy env vars, in order of preference.
+var ProxyEnvNames = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"}
+
+/*
+Proxy used by fetchers when ENABLE_PROXY is set:
+1. ProxyURI in config;
+2. proxy env vars, see ProxyEnvNames;
+3. system proxy settings(macOS network settings, windows internet settings, gnome proxy settings);
+4. DefaultProxy.
+*/
+func (c *CollectorConf) Proxy() string {
+	if c.ProxyURI != "" {
+		return c.ProxyURI
+	}
+	if c.proxyDetected == "" {
+		pxy, source := DetectProxy()
+		if pxy == "" {
+			logs.Warning("No proxy configured or detected, falling back to %s.", DefaultProxy)
+			pxy = DefaultProxy
+		} else {
+			logs.Info("Using proxy %s from %s.", RedactURL(pxy), source)
+		}
+		c.proxyDetected = pxy
+	}
+	return c.proxyDetected
+}
+
+// Finds a proxy from env vars or system settings.
+func DetectProxy() (pxy, source string) {
+	for _, name := range ProxyEnvNames {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			return normalizeProxy(v, "http"), "env " + name
+		}
+	}
+	if pxy = systemProxy(); pxy != "" {
+		return pxy, "system settings"
+	}
+	return "", ""
+}
+
+func normalizeProxy(pxy, scheme string) string {
+	if !strings.Contains(pxy, "://") {
+		return scheme + "://" + pxy
+	}
+	return pxy
+}
+
+func systemProxy() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return darwinProxy()
+	case "windows":
+		return windowsProxy()
+	case "linux":
+		return gnomeProxy()
+	default:
+		return ""
+	}
+}
+
+func commandOutput(name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+var scutilPattern = regexp.MustCompile(`(?m)^\s*(\w+)\s*:\s*(\S+)\s*$`)
+
+// Parses "scutil --proxy".
+func darwinProxy() string {
+	values := map[string]string{}
+	for _, m := range scutilPattern.FindAllStringSubmatch(commandOutput("scutil", "--proxy"), -1) {
+		values[m[1]] = m[2]
+	}
+	for _, p := range []struct{ prefix, scheme string }{{"HTTPS", "http"}, {"HTTP", "http"}, {"SOCKS", "socks5"}} {
+		if values[p.prefix+"Enable"] == "1" && values[p.prefix+"Proxy"] != "" {
+			return fmt.Sprintf("%s://%s:%s", p.scheme, values[p.prefix+"Proxy"], values[p.prefix+"Port"])
+		}
+	}
+	return ""
+}
+
+var regValuePattern = regexp.MustCompile(`(?m)^\s*(ProxyEnable|ProxyServer)\s+REG_\w+\s+(\S+)\s*$`)
+
+// Reads internet settings from the registry.
+func windowsProxy() string {
+	out := commandOutput("reg", "query", `HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings`)
+	values := map[string]string{}
+	for _, m := range regValuePattern.FindAllStringSubmatch(out, -1) {
+		values[m[1]] = m[2]
+	}
+	if values["ProxyEnable"] != "0x1" || values["ProxyServer"] == "" {
+		return ""
+	}
+	server := values["ProxyServer"]
+	if !strings.Contains(server, "=") {
+		return normalizeProxy(server, "http")
+	}
+	// like "http=127.0.0.1:7890;https=127.0.0.1:7890;socks=127.0.0.1:7891"
+	servers := map[string]string{}
+	for _, item := range strings.Split(server, ";") {
+		if k, v, ok := strings.Cut(item, "="); ok {
+			servers[strings.ToLower(k)] = v
+		}
+	}
+	for _, p := range []struct{ key, scheme string }{{"https", "http"}, {"http", "http"}, {"socks", "socks5"}} {
+		if servers[p.key] != "" {
+			return normalizeProxy(servers[p.key], p.scheme)
+		}
+	}
+	return ""
+}
+
+func gsettings(schema, key string) string {
+	return strings.Trim(strings.TrimSpace(commandOutput("gsettings", "get", schema, key)), "'")
+}
+
+// Reads gnome proxy settings.
+func gnomeProxy() string {
+	if gsettings("org.gnome.system.proxy", "mode") != "manual" {
+		return ""
+	}
+	for _, p := range []struct{ schema, scheme string }{{"https", "http"}, {"http", "http"}, {"socks", "socks5"}} {
+		schema := "org.gnome.system.proxy." + p.schema
+		host, port := gsettings(schema, "host"), gsettings(schema, "port")
+		if host != "" && port != "" && port != "0" {
+			return fmt.Sprintf("%s://%s:%s", p.scheme, host, port)
+		}
+	}
+	return ""
+}
+
+// Checks that the proxy accepts tcp connections.
+func CheckProxy(pxy string) error {
+	u, err := url.Parse(pxy)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy: %s", RedactURL(pxy))
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if strings.HasPrefix(u.Scheme, "socks") {
+			port = "1080"
+		} else if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("proxy %s is not reachable: %w", RedactURL(pxy), err)
+	}
+	conn.Close()
+	return nil
+}
+
+// Validates the proxy before a run, when proxy is enabled.
+func (c *CollectorConf) ValidateProxy() error {
+	if !EnableProxyOrNot() {
+		return nil
+	}
+	return CheckProxy(c.Proxy())
+}
@@ -0,0 +1,100 @@
+package confs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	RemoteConfigCacheFileName string = "remote_config.json"
+)
+
+/*
+RemoteConf is managed centrally for a fleet of collectors,
+it is fetched from RemoteConfig on each run and replaces the local lists.
+
+Example:
+
+	{
+	    "subscribers": [{"url": "https://example.com/sub", "enabled": true}],
+	    "raw_domains": ["example.com"],
+	    "collectors": {"golang": {"Depth": 20}, "julia": {"Enabled": false}}
+	}
+
+A missing section keeps the local one.
+*/
+type RemoteConf struct {
+	Subscribers []*Subscriber                `json:"subscribers,omitempty"`
+	RawDomains  []string                     `json:"raw_domains,omitempty"`
+	Collectors  map[string]*CollectorOptions `json:"collectors,omitempty"`
+}
+
+// RemoteConfig is an url, or a path in the storage repo.
+func (c *CollectorConf) RemoteConfigIsUrl() bool {
+	return strings.HasPrefix(c.RemoteConfig, "http://") || strings.HasPrefix(c.RemoteConfig, "https://")
+}
+
+// Last fetched remote config, used when fetching fails.
+func (c *CollectorConf) RemoteConfigCachePath() string {
+	return filepath.Join(c.dirpath, RemoteConfigCacheFileName)
+}
+
+/*
+Applies a fetched remote config, and caches it.
+Fetch times of subscribers are kept, collector options override the local ones for this run and are never saved.
+*/
+func (c *CollectorConf) ApplyRemoteConfig(content []byte) error {
+	rc := &RemoteConf{}
+	if err := json.Unmarshal(content, rc); err != nil {
+		return fmt.Errorf("parse remote config failed: %w", err)
+	}
+	for _, s := range rc.Subscribers {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("invalid subscriber in remote config: %w", err)
+		}
+	}
+
+	if rc.Subscribers != nil {
+		err := c.SubStore().Update(func(local []*Subscriber) []*Subscriber {
+			fetched := map[string]string{}
+			for _, s := range local {
+				fetched[s.Url] = s.LastFetched
+			}
+			for _, s := range rc.Subscribers {
+				s.LastFetched = fetched[s.Url]
+			}
+			return rc.Subscribers
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if rc.RawDomains != nil {
+		err := c.RawDomainStore().Update(func([]string) []string { return rc.RawDomains })
+		if err != nil {
+			return err
+		}
+	}
+	if rc.Collectors != nil {
+		c.remoteCollectors = rc.Collectors
+	}
+	logs.Info("Remote config applied: %d subscribers, %d rawDomains, %d collector options.",
+		len(rc.Subscribers), len(rc.RawDomains), len(rc.Collectors))
+	return utils.WriteFile(c.RemoteConfigCachePath(), content, 0o644)
+}
+
+// Applies the cached remote config when the remote one is not available.
+func (c *CollectorConf) ApplyCachedRemoteConfig() error {
+	content, err := os.ReadFile(c.RemoteConfigCachePath())
+	if err != nil {
+		return fmt.Errorf("no cached remote config: %w", err)
+	}
+	logs.Warning("Using cached remote config from %s.", c.RemoteConfigCachePath())
+	return c.ApplyRemoteConfig(content)
+}
@@ -0,0 +1,453 @@
+package confs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	SecretBackendKeyring string = "keyring" // macOS keychain or linux secret service.
+	SecretBackendFile    string = "file"    // secrets.enc, encrypted with a passphrase.
+	SecretBackendPlain   string = "plain"   // plaintext in config.json, the legacy behavior.
+	// passphrase for the encrypted file.
+	SecretPassphraseEnvName string = "PXY_SECRET_PASSPHRASE"
+	SecretFileName          string = "secrets.enc"
+	keyringService          string = "pxy-collector"
+)
+
+// SecretStore keeps tokens out of config.json.
+type SecretStore interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error // missing secrets are not an error.
+}
+
+/*
+Keyring uses the OS keyring through its command line tool:
+"security" on macOS and "secret-tool" (libsecret) on linux.
+*/
+type Keyring struct{}
+
+func NewKeyring() (k *Keyring) {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err != nil {
+			return nil
+		}
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil
+		}
+		// secret-tool prints errors when no secret service is running.
+		cmd := exec.Command("secret-tool", "lookup", "service", keyringService, "account", "probe")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		cmd.Run()
+		if stderr.Len() > 0 {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &Keyring{}
+}
+
+func (k *Keyring) Get(name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", name)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+/*
+Stores a secret, it is passed through stdin, so that it never shows up in ps.
+"security" only reads passwords from a terminal, so the command itself is sent to "security -i".
+*/
+func (k *Keyring) Set(name, value string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("secrets with line breaks are not supported by the keychain")
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(keyringService), securityQuote(name), securityQuote(value)))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%s %s", keyringService, name), "service", keyringService, "account", name)
+		cmd.Stdin = strings.NewReader(value)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if runtime.GOOS == "darwin" {
+		// "security -i" exits with 0 when a command fails.
+		if v, err := k.Get(name); err != nil || v != value {
+			return errors.New("keychain did not store the secret")
+		}
+	}
+	return nil
+}
+
+func (k *Keyring) Delete(name string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		if _, err := k.Get(name); err != nil {
+			return nil
+		}
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", name)
+	} else {
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", name)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Quotes an argument for the command line of "security -i".
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+type secretFileContent struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+/*
+SecretFile keeps secrets in an AES-GCM encrypted file,
+the key is derived from a passphrase with scrypt.
+*/
+type SecretFile struct {
+	fPath      string
+	passphrase string
+	secrets    map[string]string
+}
+
+func NewSecretFile(fPath, passphrase string) (s *SecretFile, err error) {
+	s = &SecretFile{
+		fPath:      fPath,
+		passphrase: passphrase,
+		secrets:    map[string]string{},
+	}
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	fc := &secretFileContent{}
+	if err = json.Unmarshal(content, fc); err != nil {
+		return nil, err
+	}
+	plain, err := fc.open(passphrase)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or broken secrets file")
+	}
+	err = json.Unmarshal(plain, &s.secrets)
+	return
+}
+
+// Encrypts data with a key derived from the passphrase.
+func sealWithPassphrase(passphrase string, plain []byte) (fc *secretFileContent, err error) {
+	fc = &secretFileContent{
+		Salt: make([]byte, 16),
+	}
+	if _, err = rand.Read(fc.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := passphraseCipher(passphrase, fc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	fc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(fc.Nonce); err != nil {
+		return nil, err
+	}
+	fc.Data = gcm.Seal(nil, fc.Nonce, plain, nil)
+	return
+}
+
+func (fc *secretFileContent) open(passphrase string) ([]byte, error) {
+	gcm, err := passphraseCipher(passphrase, fc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, fc.Nonce, fc.Data, nil)
+}
+
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *SecretFile) Get(name string) (string, error) {
+	if v, ok := s.secrets[name]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("secret %s not found", name)
+}
+
+func (s *SecretFile) Set(name, value string) error {
+	if v, ok := s.secrets[name]; ok && v == value {
+		return nil
+	}
+	s.secrets[name] = value
+	return s.save()
+}
+
+func (s *SecretFile) Delete(name string) error {
+	if _, ok := s.secrets[name]; !ok {
+		return nil
+	}
+	delete(s.secrets, name)
+	return s.save()
+}
+
+func (s *SecretFile) save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	fc, err := sealWithPassphrase(s.passphrase, plain)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(fc)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithBackup(s.fPath, content, 0600)
+}
+
+func secretPassphrase() string {
+	return readPassphrase(SecretPassphraseEnvName, "Please enter the passphrase for secrets: ")
+}
+
+// Gets passphrase from env, or asks for it in a terminal.
+func readPassphrase(envName, prompt string) string {
+	if p := os.Getenv(envName); p != "" {
+		return p
+	}
+	if !term.IsTerminal(int(syscall.Stdin)) {
+		return ""
+	}
+	fmt.Print(prompt)
+	p, _ := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	return string(p)
+}
+
+func (c *CollectorConf) secretFilePath() string {
+	return filepath.Join(c.confDir, SecretFileName)
+}
+
+/*
+Chooses the secret store, once per run.
+Without SecretBackend set, the keyring is preferred, then the encrypted file,
+then plaintext when there is no passphrase and no secrets file,
+the choice and the fallback from an unavailable keyring are saved to config.json by loadSecrets,
+so that the probing and its warnings are not repeated.
+Returns nil to keep secrets in plaintext.
+*/
+func (c *CollectorConf) secretStore() SecretStore {
+	if c.secretsChecked {
+		return c.secrets
+	}
+	c.secretsChecked = true
+
+	backend := c.SecretBackend
+	if backend == "" || backend == SecretBackendKeyring {
+		if k := NewKeyring(); k != nil {
+			c.SecretBackend = SecretBackendKeyring
+			c.secrets = k
+			return c.secrets
+		}
+		if backend == SecretBackendKeyring {
+			logs.Warning("OS keyring is not available, falls back to %s when a passphrase is set.", SecretFileName)
+		}
+		backend = SecretBackendFile
+	}
+	if backend == SecretBackendFile {
+		passphrase := secretPassphrase()
+		if passphrase == "" {
+			if ok, _ := gutils.PathIsExist(c.secretFilePath()); c.SecretBackend == "" && !ok {
+				c.SecretBackend = SecretBackendPlain
+				logs.Warning("No OS keyring and no passphrase, secrets are kept in %s. Set %s to %s and env %s to encrypt them.",
+					ConfigFileName, "SecretBackend", SecretBackendFile, SecretPassphraseEnvName)
+				return nil
+			}
+			logs.Warning("No passphrase for secrets, please set env %s.", SecretPassphraseEnvName)
+			return nil
+		}
+		s, err := NewSecretFile(c.secretFilePath(), passphrase)
+		if err != nil {
+			logs.Error("%+v", err)
+			return nil
+		}
+		c.SecretBackend = SecretBackendFile
+		c.secrets = s
+	}
+	return c.secrets
+}
+
+/*
+A secret field of the config.
+Lists, like webhook urls with tokens in their paths, are kept as json in the secret store.
+*/
+type secretField struct {
+	str  *string
+	list *[]string
+}
+
+func (f secretField) get() string {
+	if f.str != nil {
+		return *f.str
+	}
+	if len(*f.list) == 0 {
+		return ""
+	}
+	content, _ := json.Marshal(*f.list)
+	return string(content)
+}
+
+func (f secretField) set(v string) {
+	if f.str != nil {
+		*f.str = v
+		return
+	}
+	*f.list = nil
+	if v != "" && json.Unmarshal([]byte(v), f.list) != nil {
+		*f.list = []string{v}
+	}
+}
+
+// Values to redact.
+func (f secretField) values() []string {
+	if f.str != nil {
+		return []string{*f.str}
+	}
+	return *f.list
+}
+
+// Secrets that are never written into config.json.
+func (c *CollectorConf) secretFields() map[string]secretField {
+	return map[string]secretField{
+		"token":          {str: &c.Token},
+		"crypto_key":     {str: &c.CryptoKey},
+		"old_crypto_key": {str: &c.OldCryptoKey},
+		"azure_sas":      {str: &c.AzureSAS},
+		"otlp_headers":   {str: &c.OtlpHeaders},
+		"smtp_password":  {str: &c.SmtpPassword},
+		"webhooks":       {list: &c.Webhooks},  // slack, discord and telegram urls embed tokens.
+		"alert_push":     {list: &c.AlertPush}, // bark keys and ntfy topics.
+	}
+}
+
+/*
+Loads secrets from the secret store.
+Plaintext secrets found in config.json are migrated into the store.
+*/
+func (c *CollectorConf) loadSecrets() {
+	configured := c.SecretBackend
+	store := c.secretStore()
+	if store == nil {
+		if c.SecretBackend != configured {
+			c.Save()
+		}
+		return
+	}
+	if c.storedSecrets == nil {
+		c.storedSecrets = map[string]bool{}
+	}
+	migrate := false
+	for name, field := range c.secretFields() {
+		if field.get() != "" {
+			migrate = true
+			continue
+		}
+		if v, err := store.Get(c.secretName(name)); err == nil {
+			field.set(v)
+			c.storedSecrets[name] = true
+		}
+	}
+	if migrate {
+		if err := c.Save(); err == nil {
+			logs.Info("Secrets are moved from %s to %s.", ConfigFileName, c.SecretBackend)
+		}
+	} else if c.SecretBackend != configured {
+		c.Save()
+	}
+}
+
+// Saves config.json without secrets, which are kept in the secret store.
+func (c *CollectorConf) saveWithSecrets() error {
+	store := c.secretStore()
+	if store == nil {
+		return c.k.Save(c)
+	}
+	if c.storedSecrets == nil {
+		c.storedSecrets = map[string]bool{}
+	}
+	saved := map[string]string{}
+	for name, field := range c.secretFields() {
+		value := field.get()
+		if value != "" {
+			if err := store.Set(c.secretName(name), value); err != nil {
+				// keeps the plaintext rather than losing it.
+				logs.Error("Save secret %s failed: %+v", name, err)
+				continue
+			}
+			c.storedSecrets[name] = true
+		} else if c.storedSecrets[name] {
+			// cleared, like a retired OldCryptoKey, so that it is not loaded again.
+			if err := store.Delete(c.secretName(name)); err != nil {
+				logs.Error("Delete secret %s failed: %+v", name, err)
+			} else {
+				delete(c.storedSecrets, name)
+			}
+		}
+		saved[name] = value
+		field.set("")
+	}
+	err := c.k.Save(c)
+	for name, field := range c.secretFields() {
+		if v, ok := saved[name]; ok {
+			field.set(v)
+		}
+	}
+	return err
+}
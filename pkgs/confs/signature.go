@@ -0,0 +1,52 @@
+package confs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+/*
+SignatureConf pins the public key of an upstream, whose signatures are verified before its checksums are trusted,
+see pkgs/versions/signature.go.
+
+Example for config.json, keyed by collector name or version file name(without ".version.json"):
+
+	"Signatures": {
+	    "maven": {"Type": "gpg", "Key": "keys/maven-KEYS.asc"},
+	    "terraform": {"Type": "gpg", "Key": "keys/hashicorp.asc", "Sums": "{dir}/terraform_{version}_SHA256SUMS", "Sig": "{sums}.sig"},
+	    "caddy": {"Type": "cosign", "Key": "keys/fulcio.pem", "Sums": "{dir}/caddy_{version}_checksums.txt",
+	        "Cert": "{sums}.pem", "Identity": "^https://github.com/caddyserver/caddy/"},
+	    "zig": {"Type": "minisign", "Key": "keys/zig.pub"}
+	}
+
+Urls may use {url}(the artifact), {dir}(the artifact url without the file name), {name}(the file name),
+{version}(without a "v" prefix) and {sums}. With Sums, the checksum file is verified and sums of files must
+match it, otherwise artifacts are verified themselves, up to ChecksumSample per run.
+Keys are only read from the local config, never from RemoteConfig.
+*/
+type SignatureConf struct {
+	Type     string `json,koanf:"type"`     // "gpg", "minisign" or "cosign".
+	Key      string `json,koanf:"key"`      // path of the pinned key, relative to the config dir.
+	Sums     string `json,koanf:"sums"`     // url of a signed checksum file, empty when artifacts are signed.
+	Sig      string `json,koanf:"sig"`      // url of the signature, the signed url plus .asc, .minisig or .sig by Type by default.
+	Cert     string `json,koanf:"cert"`     // keyless cosign: url of the signing certificate.
+	Identity string `json,koanf:"identity"` // keyless cosign: regexp the identity of the certificate must match.
+}
+
+// Signature of a version file, by its name first, then by the collector, nil when none is pinned.
+func (c *CollectorConf) SignatureOf(collector, fileName string) *SignatureConf {
+	if s, ok := c.Signatures[strings.TrimSuffix(fileName, ".version.json")]; ok && s != nil {
+		return s
+	}
+	if s, ok := c.Signatures[collector]; ok && s != nil {
+		return s
+	}
+	return nil
+}
+
+func (c *CollectorConf) SignatureKeyPath(s *SignatureConf) string {
+	if filepath.IsAbs(s.Key) {
+		return s.Key
+	}
+	return filepath.Join(c.confDir, s.Key)
+}
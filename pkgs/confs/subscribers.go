@@ -0,0 +1,198 @@
+package confs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	SubscriberListFileName string = "subscribers.json"
+	DefaultSubMaxSize      int64  = 20 << 20
+)
+
+// Format hints for subscribed urls.
+const (
+	SubFormatAuto    string = ""        // guess from content.
+	SubFormatBase64  string = "base64"  // base64 encoded uri list.
+	SubFormatPlain   string = "plain"   // plain uri list.
+	SubFormatClash   string = "clash"   // clash yaml config.
+	SubFormatSingbox string = "singbox" // sing-box json config.
+)
+
+/*
+Subscriber is a subscribed url with its fetch options.
+
+Example for subscribers.json:
+
+	[
+	    {
+	        "url": "https://example.com/sub",
+	        "enabled": true,
+	        "format": "clash",
+	        "headers": {"User-Agent": "clash"},
+	        "interval": "6h",
+	        "tags": ["daily"],
+	        "max_size": 10485760
+	    }
+	]
+
+Interval is a duration like "30m" or "6h", an empty interval fetches on every run.
+*/
+type Subscriber struct {
+	Url         string            `json:"url"`
+	Enabled     bool              `json:"enabled"`
+	Format      string            `json:"format,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Interval    string            `json:"interval,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	MaxSize     int64             `json:"max_size,omitempty"` // bytes of a payload, SubMaxSize in config by default.
+	LastFetched string            `json:"last_fetched,omitempty"`
+}
+
+// Size limit of a payload, larger payloads are dropped.
+func (c *CollectorConf) SubMaxSize(s *Subscriber) int64 {
+	switch {
+	case s.MaxSize > 0:
+		return s.MaxSize
+	case c.SubscriberMaxSize > 0:
+		return c.SubscriberMaxSize
+	default:
+		return DefaultSubMaxSize
+	}
+}
+
+// Checks if the subscriber should be fetched now.
+func (s *Subscriber) Due(now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	if s.Interval == "" || s.LastFetched == "" {
+		return true
+	}
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return true
+	}
+	last, ok := utils.ParseTime(s.LastFetched)
+	if !ok {
+		return true
+	}
+	return now.Sub(last) >= interval
+}
+
+func (s *Subscriber) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscriber) Validate() error {
+	if s.Url == "" {
+		return fmt.Errorf("subscriber without url")
+	}
+	switch s.Format {
+	case SubFormatAuto, SubFormatBase64, SubFormatPlain, SubFormatClash, SubFormatSingbox:
+	default:
+		return fmt.Errorf("unknown format %q for %s", s.Format, s.Url)
+	}
+	if s.Interval != "" {
+		if _, err := time.ParseDuration(s.Interval); err != nil {
+			return fmt.Errorf("invalid interval %q for %s", s.Interval, s.Url)
+		}
+	}
+	return nil
+}
+
+/*
+Converts the legacy subscribers.txt into subscribers.
+Lines starting with "#" are kept as disabled subscribers.
+*/
+func ConvertLegacySubs(content string) (r []*Subscriber) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		enabled := true
+		if strings.HasPrefix(line, "#") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			enabled = false
+		}
+		if !strings.Contains(line, "://") {
+			continue
+		}
+		r = append(r, &Subscriber{Url: line, Enabled: enabled})
+	}
+	return
+}
+
+func (c *CollectorConf) subListPath() string {
+	return filepath.Join(c.dirpath, SubscriberListFileName)
+}
+
+/*
+Store for subscribers.json.
+The legacy subscribers.txt(or the default list) is converted when subscribers.json does not exist.
+*/
+func (c *CollectorConf) SubStore() *ListStore[*Subscriber] {
+	return &ListStore[*Subscriber]{
+		Path: c.subListPath(),
+		Key:  func(s *Subscriber) string { return s.Url },
+		Decode: func(content []byte) (r []*Subscriber, err error) {
+			err = json.Unmarshal(content, &r)
+			return
+		},
+		Encode: func(subs []*Subscriber) ([]byte, error) {
+			if subs == nil {
+				subs = []*Subscriber{}
+			}
+			return json.MarshalIndent(subs, "", "    ")
+		},
+		Defaults: func() []*Subscriber {
+			legacy := SubscribedUrls
+			if content, err := os.ReadFile(c.subPath()); err == nil && len(content) > 0 {
+				legacy = string(content)
+			}
+			return ConvertLegacySubs(legacy)
+		},
+	}
+}
+
+func (c *CollectorConf) GetSubscribers() (r []*Subscriber) {
+	r, err := c.SubStore().List()
+	if err != nil {
+		logs.Error("%+v", err)
+	}
+	return
+}
+
+func (c *CollectorConf) SaveSubscribers(subs []*Subscriber) error {
+	return c.SubStore().Update(func([]*Subscriber) []*Subscriber { return subs })
+}
+
+// Records fetch time for subscribers, so that fetch intervals are respected.
+func (c *CollectorConf) MarkSubsFetched(urls ...string) {
+	fetched := map[string]bool{}
+	for _, u := range urls {
+		fetched[u] = true
+	}
+	now := utils.Now()
+	err := c.SubStore().Update(func(subs []*Subscriber) []*Subscriber {
+		for _, s := range subs {
+			if fetched[s.Url] {
+				s.LastFetched = now
+			}
+		}
+		return subs
+	})
+	if err != nil {
+		logs.Error("%+v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package confs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+const (
+	// overrides the work dir, also set by --work-dir.
+	WorkDirEnvName string = "PXY_WORK_DIR"
+	XDGAppName     string = "pxycollector"
+)
+
+// Files kept in the config dir, others are data.
+var configFiles = append([]string{SecretFileName}, ConfigFileNames...)
+
+func legacyWorkDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, WorkDirName)
+}
+
+func xdgDir(envName, fallback string) string {
+	if dir := os.Getenv(envName); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, XDGAppName)
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, fallback, XDGAppName)
+}
+
+/*
+RootDirs finds where config and data are kept:
+1. env PXY_WORK_DIR, both in it;
+2. linux, $XDG_CONFIG_HOME/pxycollector and $XDG_DATA_HOME/pxycollector;
+3. otherwise ~/.pxycollector.
+*/
+func RootDirs() (confDir, dataDir string) {
+	if dir := os.Getenv(WorkDirEnvName); dir != "" {
+		return dir, dir
+	}
+	if runtime.GOOS != "linux" {
+		return legacyWorkDir(), legacyWorkDir()
+	}
+	confDir = xdgDir("XDG_CONFIG_HOME", ".config")
+	dataDir = xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	migrateLegacyWorkDir(confDir, dataDir)
+	return
+}
+
+// Moves files from ~/.pxycollector into the XDG dirs, once.
+func migrateLegacyWorkDir(confDir, dataDir string) {
+	legacy := legacyWorkDir()
+	if ok, _ := gutils.PathIsExist(legacy); !ok {
+		return
+	}
+	for _, name := range ConfigFileNames {
+		if ok, _ := gutils.PathIsExist(filepath.Join(confDir, name)); ok {
+			return
+		}
+	}
+	os.MkdirAll(confDir, os.ModePerm)
+	os.MkdirAll(dataDir, os.ModePerm)
+	isConfig := map[string]bool{}
+	for _, name := range configFiles {
+		isConfig[name] = true
+	}
+	dList, _ := os.ReadDir(legacy)
+	for _, d := range dList {
+		dst := filepath.Join(dataDir, d.Name())
+		if isConfig[d.Name()] {
+			dst = filepath.Join(confDir, d.Name())
+		}
+		if err := os.Rename(filepath.Join(legacy, d.Name()), dst); err != nil {
+			logs.Error("Migrate %s failed: %+v", d.Name(), err)
+			return
+		}
+	}
+	os.Remove(legacy)
+	logs.Info("Work dir is migrated from %s to %s and %s.", legacy, confDir, dataDir)
+}
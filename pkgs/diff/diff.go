@@ -0,0 +1,197 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+)
+
+/*
+Diffs of version files across runs, like golang.version.json of this run and of the previous snapshot.
+
+A changelog lists versions added and removed, and files of kept versions whose url or checksum changed.
+Files of a version are matched by os, arch, variant and extra, then by the file name in the url.
+*/
+
+const latestKey string = "latest"
+
+const (
+	FieldUrl string = "url"
+	FieldSum string = "sum"
+)
+
+// Keys are matched case insensitively, so both "url" and the old "Url" of version files are read.
+type file struct {
+	Url     string
+	Os      string
+	Arch    string
+	Sum     string
+	Extra   string
+	Variant string
+}
+
+func (f *file) platform() string {
+	return f.Os + "/" + f.Arch + "/" + f.Variant + "/" + f.Extra
+}
+
+func (f *file) name() string {
+	return path.Base(f.Url)
+}
+
+type FileChange struct {
+	Version string `json:"version"`
+	Os      string `json:"os,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+	Field   string `json:"field"`         // "url" or "sum".
+	Old     string `json:"old,omitempty"` // empty for a new file.
+	New     string `json:"new,omitempty"` // empty for a removed file.
+}
+
+func (f *FileChange) String() string {
+	platform := ""
+	if f.Os != "" || f.Arch != "" {
+		platform = " " + f.Os + "/" + f.Arch
+	}
+	switch {
+	case f.Old == "":
+		return fmt.Sprintf("%s%s new file: %s", f.Version, platform, f.New)
+	case f.New == "":
+		return fmt.Sprintf("%s%s removed file: %s", f.Version, platform, f.Old)
+	default:
+		return fmt.Sprintf("%s%s %s: %s -> %s", f.Version, platform, f.Field, f.Old, f.New)
+	}
+}
+
+type Changelog struct {
+	Tool    string        `json:"tool"`
+	Added   []string      `json:"added,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+	Changed []*FileChange `json:"changed,omitempty"`
+}
+
+func (c *Changelog) Empty() bool {
+	return c == nil || (len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0)
+}
+
+func parse(content []byte) (r map[string][]*file, err error) {
+	raw := map[string]json.RawMessage{}
+	r = map[string][]*file{}
+	if len(content) == 0 {
+		return
+	}
+	if err = json.Unmarshal(content, &raw); err != nil {
+		return
+	}
+	for vName, v := range raw {
+		if vName == latestKey {
+			continue
+		}
+		files := []*file{}
+		if err = json.Unmarshal(v, &files); err != nil {
+			return
+		}
+		r[vName] = files
+	}
+	return
+}
+
+/*
+Compares two version files of a tool, prev may be empty for a new file.
+Versions are sorted by name, changes by version and platform.
+*/
+func Versions(tool string, prev, cur []byte) (c *Changelog, err error) {
+	c = &Changelog{Tool: tool}
+	prevVersions, err := parse(prev)
+	if err != nil {
+		return
+	}
+	curVersions, err := parse(cur)
+	if err != nil {
+		return
+	}
+	for vName, files := range curVersions {
+		prevFiles, ok := prevVersions[vName]
+		if !ok {
+			c.Added = append(c.Added, vName)
+			continue
+		}
+		c.Changed = append(c.Changed, diffFiles(vName, prevFiles, files)...)
+	}
+	for vName := range prevVersions {
+		if _, ok := curVersions[vName]; !ok {
+			c.Removed = append(c.Removed, vName)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.SliceStable(c.Changed, func(i, j int) bool {
+		a, b := c.Changed[i], c.Changed[j]
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.Os != b.Os {
+			return a.Os < b.Os
+		}
+		return a.Arch < b.Arch
+	})
+	return
+}
+
+func groupByPlatform(files []*file) map[string][]*file {
+	r := map[string][]*file{}
+	for _, f := range files {
+		if f != nil {
+			r[f.platform()] = append(r[f.platform()], f)
+		}
+	}
+	return r
+}
+
+func diffFiles(vName string, prev, cur []*file) (r []*FileChange) {
+	prevGroups, curGroups := groupByPlatform(prev), groupByPlatform(cur)
+	change := func(f *file, field, oldValue, newValue string) {
+		r = append(r, &FileChange{Version: vName, Os: f.Os, Arch: f.Arch, Field: field, Old: oldValue, New: newValue})
+	}
+	compare := func(p, c *file) {
+		if p.Url != c.Url {
+			change(c, FieldUrl, p.Url, c.Url)
+		}
+		if p.Sum != c.Sum && p.Sum != "" && c.Sum != "" {
+			change(c, FieldSum, p.Sum, c.Sum)
+		}
+	}
+	for platform, curFiles := range curGroups {
+		prevFiles := prevGroups[platform]
+		// one file for the platform on both sides, a new file name is a changed url.
+		if len(prevFiles) == 1 && len(curFiles) == 1 {
+			compare(prevFiles[0], curFiles[0])
+			continue
+		}
+		byName := map[string]*file{}
+		for _, f := range prevFiles {
+			byName[f.name()] = f
+		}
+		for _, f := range curFiles {
+			if p, ok := byName[f.name()]; ok {
+				compare(p, f)
+				delete(byName, f.name())
+			} else {
+				change(f, FieldUrl, "", f.Url)
+			}
+		}
+		for _, p := range prevFiles {
+			if _, ok := byName[p.name()]; ok {
+				change(p, FieldUrl, p.Url, "")
+			}
+		}
+	}
+	for platform, prevFiles := range prevGroups {
+		if _, ok := curGroups[platform]; !ok {
+			for _, p := range prevFiles {
+				change(p, FieldUrl, p.Url, "")
+			}
+		}
+	}
+	return
+}
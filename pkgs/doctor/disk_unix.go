@@ -0,0 +1,14 @@
+//go:build !windows
+
+package doctor
+
+import "syscall"
+
+// Bytes available to the user in the file system of dir.
+func freeSpace(dir string) (int64, error) {
+	st := &syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
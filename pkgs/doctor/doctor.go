@@ -0,0 +1,172 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/upload"
+)
+
+/*
+Diagnostics for runs that fail for no obvious reason, see pxy doctor.
+
+Checks are independent, each says what is wrong and how to fix it:
+proxy, DNS, storage credentials, disk space in the work dir, clock skew and vendor endpoints.
+*/
+
+const (
+	MinFreeSpace int64 = 512 << 20 // bytes.
+	MaxClockSkew       = time.Minute
+)
+
+// Endpoints collectors depend on most, checked by HEAD requests.
+var VendorEndpoints = []string{
+	"https://api.github.com",
+	"https://go.dev/dl/",
+	"https://nodejs.org/dist/index.json",
+	"https://api.anaconda.org/package/conda-forge/python",
+	"https://dl.k8s.io/release/stable.txt",
+	"https://repo.maven.apache.org/maven2/",
+}
+
+type Result struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Runs all checks.
+func Run(cnf *confs.CollectorConf) (r []*Result) {
+	r = append(r, checkProxy(cnf))
+	r = append(r, checkDNS()...)
+	r = append(r, checkStorage(cnf)...)
+	r = append(r, checkDisk(cnf))
+	endpoints, skew := checkEndpoints(cnf)
+	r = append(r, endpoints...)
+	r = append(r, skew)
+	return
+}
+
+func checkProxy(cnf *confs.CollectorConf) *Result {
+	res := &Result{Name: "proxy"}
+	if !confs.EnableProxyOrNot() {
+		res.OK, res.Detail = true, "not enabled"
+		return res
+	}
+	pxy := cnf.Proxy()
+	if err := confs.CheckProxy(pxy); err != nil {
+		res.Detail = err.Error()
+		res.Fix = "start the proxy, or set ProxyURI(--set proxy_uri=...) to a working one, or run without --proxy"
+		return res
+	}
+	res.OK, res.Detail = true, confs.RedactURL(pxy)+" accepts connections"
+	return res
+}
+
+func checkDNS() (r []*Result) {
+	seen := map[string]bool{}
+	for _, endpoint := range VendorEndpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || seen[u.Hostname()] {
+			continue
+		}
+		host := u.Hostname()
+		seen[host] = true
+		res := &Result{Name: "dns " + host}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			res.Detail = err.Error()
+			res.Fix = "check /etc/resolv.conf or the DNS server of your network, requests through a proxy may still work"
+		} else {
+			res.OK, res.Detail = true, fmt.Sprintf("%d addresses", len(addrs))
+		}
+		r = append(r, res)
+	}
+	return
+}
+
+func checkStorage(cnf *confs.CollectorConf) (r []*Result) {
+	for _, c := range upload.ValidateConf(cnf) {
+		res := &Result{Name: "storage " + c.Name, OK: c.OK, Detail: c.Detail}
+		if !c.OK {
+			switch c.Name {
+			case "config":
+				res.Fix = "run pxy config init, or set the missing fields by --set key=value or PXY_KEY env vars"
+			case "token":
+				res.Fix = "create a new token with repo access and save it by pxy config init"
+			default:
+				res.Fix = "check Repo and the permissions of the token, see pxy config validate"
+			}
+		}
+		r = append(r, res)
+	}
+	return
+}
+
+func checkDisk(cnf *confs.CollectorConf) *Result {
+	res := &Result{Name: "disk"}
+	if err := os.MkdirAll(cnf.DirPath(), os.ModePerm); err != nil {
+		res.Detail = err.Error()
+		res.Fix = "make the work dir writable, or choose another one by --work-dir"
+		return res
+	}
+	free, err := freeSpace(cnf.DirPath())
+	switch {
+	case err != nil:
+		res.OK, res.Detail = true, "free space unknown: "+err.Error()
+	case free < MinFreeSpace:
+		res.Detail = fmt.Sprintf("%.1fMB free in %s", float64(free)/(1<<20), cnf.DirPath())
+		res.Fix = "free some space, pxy cache --clear and old snapshots are safe to remove"
+	default:
+		res.OK, res.Detail = true, fmt.Sprintf("%.1fGB free", float64(free)/(1<<30))
+	}
+	return res
+}
+
+// Sends HEAD requests to vendor endpoints, and measures clock skew from their Date headers.
+func checkEndpoints(cnf *confs.CollectorConf) (r []*Result, skew *Result) {
+	skew = &Result{Name: "clock", OK: true, Detail: "not measured, no endpoint answered"}
+	measured := false
+	for _, endpoint := range VendorEndpoints {
+		res := &Result{Name: "endpoint " + endpoint}
+		code, header, err := fetch.Head(cnf, endpoint)
+		switch {
+		case err != nil:
+			res.Detail = err.Error()
+			res.Fix = "check the network or the proxy(--proxy), the site may also be down or blocked in your region"
+		case code >= 500:
+			res.Detail = fmt.Sprintf("http %d", code)
+			res.Fix = "the site has problems, try again later"
+		default:
+			// 4xx answers to HEAD still prove the site is reachable.
+			res.OK, res.Detail = true, fmt.Sprintf("http %d", code)
+		}
+		r = append(r, res)
+		if err != nil || measured {
+			continue
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			measured = true
+			d := time.Since(date)
+			if d < 0 {
+				d = -d
+			}
+			skew.Detail = fmt.Sprintf("%s off %s", d.Round(time.Second), endpoint)
+			if d > MaxClockSkew {
+				skew.OK = false
+				skew.Fix = "sync the system clock(like timedatectl set-ntp true), tokens of github apps and gcs are rejected otherwise"
+			}
+		}
+	}
+	return
+}
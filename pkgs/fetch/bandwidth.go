@@ -0,0 +1,150 @@
+package fetch
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/notify"
+)
+
+/*
+Bandwidth accounting of runs, for metered connections.
+
+Bytes of response bodies are counted per host as they are read from the network, replayed fixtures are not counted.
+Quotas are checked before each request:
+  - Quota of a FetchPolicy: requests to the host are refused once it has sent that many bytes in the run;
+  - BandwidthQuota in config: artifact downloads(checksums, canaries) stop, pages and APIs are still fetched,
+    or the run is canceled with BandwidthQuotaAbort, finished results are still published.
+*/
+
+var ErrQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+var (
+	downloaded    = &atomic.Int64{}
+	hostBytesLock = &sync.Mutex{}
+	hostBytes     = map[string]*atomic.Int64{}
+	quotaWarned   = &sync.Map{} // host, or "" for the run -> true.
+)
+
+func init() {
+	notify.BandwidthUsage = func() (int64, map[string]int64) {
+		total, hosts := Downloaded()
+		r := map[string]int64{}
+		for _, h := range hosts {
+			r[h.Host] = h.Bytes
+		}
+		return total, r
+	}
+}
+
+func hostCounter(host string) *atomic.Int64 {
+	hostBytesLock.Lock()
+	defer hostBytesLock.Unlock()
+	c, ok := hostBytes[host]
+	if !ok {
+		c = &atomic.Int64{}
+		hostBytes[host] = c
+	}
+	return c
+}
+
+// Resets counters for a new run in the same process.
+func ResetBandwidth() {
+	downloaded.Store(0)
+	hostBytesLock.Lock()
+	hostBytes = map[string]*atomic.Int64{}
+	hostBytesLock.Unlock()
+	quotaWarned.Range(func(k, _ any) bool {
+		quotaWarned.Delete(k)
+		return true
+	})
+}
+
+type HostBytes struct {
+	Host  string `json:"host"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Bytes downloaded in the run, in total and per host, most bytes first.
+func Downloaded() (total int64, hosts []*HostBytes) {
+	hostBytesLock.Lock()
+	defer hostBytesLock.Unlock()
+	for host, c := range hostBytes {
+		if n := c.Load(); n > 0 {
+			hosts = append(hosts, &HostBytes{Host: host, Bytes: n})
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Bytes > hosts[j].Bytes })
+	return downloaded.Load(), hosts
+}
+
+func warnQuota(key, format string, args ...any) {
+	if _, loaded := quotaWarned.LoadOrStore(key, true); !loaded {
+		logs.Warning(format, args...)
+	}
+}
+
+/*
+Checks quotas before a request to the url, artifact is true for downloads of Stream.
+Cancels the run when BandwidthQuota is exceeded and BandwidthQuotaAbort is set.
+*/
+func checkQuota(cnf *confs.CollectorConf, policy *confs.FetchPolicy, rawUrl string, artifact bool) error {
+	host := hostOf(rawUrl)
+	if policy.Quota > 0 && hostCounter(host).Load() >= policy.Quota {
+		warnQuota(host, "Bandwidth quota of %s is used up(%d bytes), requests to it are skipped.", host, policy.Quota)
+		return ErrQuotaExceeded
+	}
+	if cnf.BandwidthQuota <= 0 || downloaded.Load() < cnf.BandwidthQuota {
+		return nil
+	}
+	if cnf.BandwidthQuotaAbort {
+		warnQuota("", "Bandwidth quota of the run is used up(%d bytes), canceling.", cnf.BandwidthQuota)
+		cnf.CancelRun()
+		return ErrQuotaExceeded
+	}
+	if artifact {
+		warnQuota("", "Bandwidth quota of the run is used up(%d bytes), artifacts are no longer downloaded.", cnf.BandwidthQuota)
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Counts bytes of response bodies from the network.
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, host: hostOf(req.URL.String())}
+	return resp, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	host    string
+	counter *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.counter == nil {
+			b.counter = hostCounter(b.host)
+		}
+		b.counter.Add(int64(n))
+		downloaded.Add(int64(n))
+		metrics.DownloadedBytes.Add(float64(n), b.host)
+	}
+	return
+}
@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Http debug mode of --debug-http: requests to chosen hosts are logged with their headers, status and timing,
+and their bodies are optionally saved into a dir, to find out why a page parses to nothing.
+At most DebugHttpRate requests are logged per second, the others are counted and reported with the next one.
+*/
+
+const (
+	DebugHttpRate    int    = 10
+	DebugHttpDirName string = "debug-http"
+)
+
+// Headers that are never logged.
+var debugHiddenHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+var (
+	debugLock    = &sync.Mutex{}
+	debugHosts   []string
+	debugBodyDir string
+	debugWindow  time.Time
+	debugLogged  int
+	debugDropped int
+	debugSeq     int
+)
+
+/*
+Logs requests to hosts and their subdomains, bodies are saved into bodyDir when it is not empty.
+No hosts turns the debug mode off.
+*/
+func SetDebugHttp(hosts []string, bodyDir string) {
+	debugLock.Lock()
+	defer debugLock.Unlock()
+	debugHosts = nil
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			debugHosts = append(debugHosts, host)
+		}
+	}
+	debugBodyDir = bodyDir
+}
+
+func debugMatch(host string) bool {
+	for _, h := range debugHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Whether a request to host is logged, and the number of requests dropped by the rate limit before it.
+seq numbers the saved bodies.
+*/
+func debugTake(host string) (ok bool, dropped, seq int) {
+	debugLock.Lock()
+	defer debugLock.Unlock()
+	if !debugMatch(host) {
+		return false, 0, 0
+	}
+	if now := time.Now(); now.Sub(debugWindow) >= time.Second {
+		debugWindow, debugLogged = now, 0
+	}
+	if debugLogged >= DebugHttpRate {
+		debugDropped++
+		return false, 0, 0
+	}
+	debugLogged++
+	debugSeq++
+	dropped, debugDropped = debugDropped, 0
+	return true, dropped, debugSeq
+}
+
+func debugHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.Join(h.Values(k), ", ")
+		if debugHiddenHeaders[http.CanonicalHeaderKey(k)] {
+			v = "***"
+		}
+		items = append(items, fmt.Sprintf("%s: %s", k, v))
+	}
+	return "{" + strings.Join(items, "; ") + "}"
+}
+
+// Wraps a transport by the debug mode, transports are not wrapped when it is off.
+func withDebug(t http.RoundTripper) http.RoundTripper {
+	debugLock.Lock()
+	defer debugLock.Unlock()
+	if len(debugHosts) == 0 {
+		return t
+	}
+	return &debugTransport{next: t, bodyDir: debugBodyDir}
+}
+
+type debugTransport struct {
+	next    http.RoundTripper
+	bodyDir string
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ok, dropped, seq := debugTake(hostOf(req.URL.String()))
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	if dropped > 0 {
+		logs.Info("[http] %d requests were not logged, over %d per second.", dropped, DebugHttpRate)
+	}
+	start := time.Now()
+	logs.Info("[http] %s %s, headers: %s", req.Method, req.URL, debugHeaders(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		logs.Info("[http] %s %s failed in %s: %v", req.Method, req.URL, elapsed, err)
+		return resp, err
+	}
+	logs.Info("[http] %s %s -> %d in %s, length: %d, headers: %s",
+		req.Method, req.URL, resp.StatusCode, elapsed, resp.ContentLength, debugHeaders(resp.Header))
+	if t.bodyDir != "" && resp.Body != nil && req.Method != http.MethodHead {
+		fPath := filepath.Join(t.bodyDir, fmt.Sprintf("%04d-%s.body", seq, hostOf(req.URL.String())))
+		if err := os.MkdirAll(t.bodyDir, os.ModePerm); err != nil {
+			logs.Warning("Save body of %s failed: %+v", req.URL, err)
+			return resp, nil
+		}
+		f, err := os.Create(fPath)
+		if err != nil {
+			logs.Warning("Save body of %s failed: %+v", req.URL, err)
+			return resp, nil
+		}
+		logs.Info("[http] body of %s goes to %s.", req.URL, fPath)
+		// the body is saved as it is read, large downloads are not held in memory.
+		resp.Body = &teeBody{Reader: io.TeeReader(resp.Body, f), body: resp.Body, file: f}
+	}
+	return resp, nil
+}
+
+type teeBody struct {
+	io.Reader
+	body io.Closer
+	file *os.File
+}
+
+func (b *teeBody) Close() error {
+	b.file.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,402 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/rate"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/goutils/pkgs/request"
+)
+
+/*
+Shared fetch helper for collectors.
+
+Requests follow FetchPolicies in config: timeout, rate limit per host and retries.
+Network errors, 408, 425, 429 and 5xx are retried with exponential backoff and jitter,
+Retry-After is respected. Retries of a run share one budget.
+*/
+
+var (
+	retriesUsed = &atomic.Int64{}
+)
+
+func hostOf(rawUrl string) string {
+	if u, err := url.Parse(rawUrl); err == nil && u.Hostname() != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	return strings.ToLower(rawUrl)
+}
+
+type result struct {
+	content    string
+	code       int
+	retryAfter time.Duration
+}
+
+func (r result) retryable() bool {
+	switch {
+	case r.code == 0, r.code == http.StatusRequestTimeout, r.code == http.StatusTooEarly, r.code == http.StatusTooManyRequests:
+		return true
+	default:
+		return r.code >= 500
+	}
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+/*
+One attempt with the settings of the fetcher on the shared transport, code is 0 for network errors.
+Returns at once when the run is canceled.
+*/
+func getOnce(cnf *confs.CollectorConf, fetcher *request.Fetcher, check CheckUrl) (r result) {
+	req, err := http.NewRequestWithContext(cnf.Context(), http.MethodGet, fetcher.Url, nil)
+	if err != nil {
+		return
+	}
+	for k, v := range fetcher.Headers {
+		req.Header.Set(k, v)
+	}
+	localize(cnf, req)
+	client := &http.Client{
+		Transport: transport(cnf, fetcherProxy(fetcher.Proxy)),
+		Timeout:   fetcher.Timeout,
+	}
+	if fetcher.NoRedirect {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else if check != nil {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if err := check(req.Context(), req.URL); err != nil {
+				return fmt.Errorf("%w: %v", ErrRejected, err)
+			}
+			return nil
+		}
+	}
+	resp, err := client.Do(req)
+	if errors.Is(err, ErrRejected) {
+		logs.Warning("Skipped %s, %v.", fetcher.Url, err)
+		r.code = http.StatusForbidden
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	r.content = string(content)
+	r.code = resp.StatusCode
+	r.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return
+}
+
+// Disallowed urls and hosts over their quotas get 403, so they are not retried.
+func getContext(cnf *confs.CollectorConf, fetcher *request.Fetcher, check CheckUrl) (r result) {
+	release, err := WaitHost(cnf, fetcher.Url)
+	if errors.Is(err, ErrDisallowed) || errors.Is(err, ErrQuotaExceeded) {
+		logs.Warning("Skipped %s, %v.", fetcher.Url, err)
+		r.code = http.StatusForbidden
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer release()
+	return getOnce(cnf, fetcher, check)
+}
+
+// Resets the retry budget for a new run in the same process, like runs of pxy serve.
+func ResetRetries() {
+	retriesUsed.Store(0)
+}
+
+func takeRetry(cnf *confs.CollectorConf) bool {
+	if retriesUsed.Add(1) > int64(cnf.RetryBudget()) {
+		retriesUsed.Add(-1)
+		return false
+	}
+	return true
+}
+
+// Backoff for a retry, with jitter in [d/2, d*3/2).
+func backoff(policy *confs.FetchPolicy, retry int, retryAfter time.Duration) time.Duration {
+	d := policy.BackoffDuration(retry)
+	d = d/2 + time.Duration(rand.Int63n(int64(d)))
+	if retryAfter > d {
+		d = retryAfter
+	}
+	if d > confs.MaxFetchBackoff {
+		d = confs.MaxFetchBackoff
+	}
+	return d
+}
+
+/*
+Gets the url of the fetcher as a string, with the policy of its host.
+The timeout of the policy overrides the timeout of the fetcher when it is set.
+*/
+func GetString(cnf *confs.CollectorConf, fetcher *request.Fetcher) (content string, code int) {
+	return GetStringChecked(cnf, fetcher, nil)
+}
+
+// Checks urls of redirects, see GetStringChecked.
+type CheckUrl func(ctx context.Context, u *url.URL) error
+
+// Same as net/http.
+const maxRedirects = 10
+
+var ErrRejected = errors.New("redirect is rejected")
+
+/*
+Like GetString, redirects are only followed to urls accepted by check.
+A rejected redirect gets 403 like disallowed urls, so it is not retried.
+*/
+func GetStringChecked(cnf *confs.CollectorConf, fetcher *request.Fetcher, check CheckUrl) (content string, code int) {
+	policy := cnf.FetchPolicy(fetcher.Url)
+	if policy.Timeout != "" || fetcher.Timeout <= 0 {
+		fetcher.Timeout = policy.TimeoutDuration()
+	}
+	_, span := trace.Start(cnf.Context(), "fetch", "url", fetcher.Url, "host", hostOf(fetcher.Url))
+	attempts := 0
+	defer func() {
+		span.Set("code", code, "attempts", attempts)
+		if code != http.StatusOK {
+			span.Fail(fmt.Errorf("status code: %d", code))
+		}
+		span.End()
+	}()
+	for retry := 1; ; retry++ {
+		attempts = retry
+		r := getContext(cnf, fetcher, check)
+		if !r.retryable() || cnf.Canceled() {
+			return r.content, r.code
+		}
+		if retry > policy.RetryCount() {
+			logs.Error("Fetch %s failed(%d) after %d retries.", fetcher.Url, r.code, retry-1)
+			confs.Fail(confs.FailNetwork)
+			return r.content, r.code
+		}
+		if !takeRetry(cnf) {
+			logs.Error("Fetch %s failed(%d), retry budget of this run is used up.", fetcher.Url, r.code)
+			confs.Fail(confs.FailNetwork)
+			return r.content, r.code
+		}
+		wait := backoff(policy, retry, r.retryAfter)
+		logs.Warning("Fetch %s failed(%d), retrying in %s.", fetcher.Url, r.code, wait.Round(time.Millisecond))
+		if rate.SleepContext(cnf.Context(), wait) != nil {
+			return r.content, r.code
+		}
+	}
+}
+
+// A fetcher with the same settings, fetchers are not safe for concurrent use.
+func Clone(f *request.Fetcher) (r *request.Fetcher) {
+	r = request.NewFetcher()
+	r.Proxy = f.Proxy
+	r.Timeout = f.Timeout
+	r.Headers = f.Headers
+	return
+}
+
+var ErrTooLarge = errors.New("file is too large")
+
+/*
+Streams the body of an url into w, at most maxSize bytes when maxSize > 0.
+For artifacts: the timeout of the host policy does not apply, the run context does.
+*/
+func Stream(cnf *confs.CollectorConf, rawUrl string, w io.Writer, maxSize int64) (n int64, err error) {
+	_, span := trace.Start(cnf.Context(), "fetch.stream", "url", rawUrl, "host", hostOf(rawUrl))
+	defer func() {
+		span.Set("bytes", n)
+		span.Fail(err)
+		span.End()
+	}()
+	if err = checkQuota(cnf, cnf.FetchPolicy(rawUrl), rawUrl, true); err != nil {
+		return
+	}
+	release, err := WaitHost(cnf, rawUrl)
+	if err != nil {
+		return
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(cnf.Context(), http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return
+	}
+	resp, err := httpClient(cnf).Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return 0, ErrTooLarge
+	}
+	var r io.Reader = resp.Body
+	if maxSize > 0 {
+		r = io.LimitReader(resp.Body, maxSize+1)
+	}
+	n, err = io.Copy(w, r)
+	if err == nil && maxSize > 0 && n > maxSize {
+		err = ErrTooLarge
+	}
+	return
+}
+
+// Body of Open, reading more than max bytes fails with ErrTooLarge.
+type limitedBody struct {
+	io.ReadCloser
+	n       int64
+	max     int64
+	release func()
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+func (b *limitedBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.max > 0 && b.n > b.max {
+		return n, ErrTooLarge
+	}
+	return
+}
+
+/*
+Opens the url of the fetcher for streaming, with its headers, the policy of its host and retries like GetString.
+The caller closes body. maxSize > 0 limits the body, larger bodies fail with ErrTooLarge.
+*/
+func Open(cnf *confs.CollectorConf, fetcher *request.Fetcher, maxSize int64) (body io.ReadCloser, code int, err error) {
+	policy := cnf.FetchPolicy(fetcher.Url)
+	_, span := trace.Start(cnf.Context(), "fetch", "url", fetcher.Url, "host", hostOf(fetcher.Url), "stream", true)
+	attempts := 0
+	defer func() {
+		span.Set("code", code, "attempts", attempts)
+		span.Fail(err)
+		span.End()
+	}()
+	client := httpClient(cnf)
+	client.Timeout = policy.TimeoutDuration()
+	for retry := 1; ; retry++ {
+		attempts = retry
+		release, wErr := WaitHost(cnf, fetcher.Url)
+		if wErr != nil {
+			return nil, 0, wErr
+		}
+		req, rErr := http.NewRequestWithContext(cnf.Context(), http.MethodGet, fetcher.Url, nil)
+		if rErr != nil {
+			release()
+			return nil, 0, rErr
+		}
+		for k, v := range fetcher.Headers {
+			req.Header.Set(k, v)
+		}
+		localize(cnf, req)
+		r := result{}
+		resp, dErr := client.Do(req)
+		if dErr == nil {
+			r.code = resp.StatusCode
+			r.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		code = r.code
+		if r.code == http.StatusOK {
+			if maxSize > 0 && resp.ContentLength > maxSize {
+				resp.Body.Close()
+				release()
+				return nil, code, ErrTooLarge
+			}
+			// the host is busy until the body is closed.
+			return &limitedBody{ReadCloser: resp.Body, max: maxSize, release: release}, code, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		release()
+		err = fmt.Errorf("status code: %d", r.code)
+		if dErr != nil {
+			err = dErr
+		}
+		if !r.retryable() || cnf.Canceled() {
+			return
+		}
+		if retry > policy.RetryCount() {
+			logs.Error("Fetch %s failed(%d) after %d retries.", fetcher.Url, r.code, retry-1)
+			confs.Fail(confs.FailNetwork)
+			return
+		}
+		if !takeRetry(cnf) {
+			logs.Error("Fetch %s failed(%d), retry budget of this run is used up.", fetcher.Url, r.code)
+			confs.Fail(confs.FailNetwork)
+			return
+		}
+		wait := backoff(policy, retry, r.retryAfter)
+		logs.Warning("Fetch %s failed(%d), retrying in %s.", fetcher.Url, r.code, wait.Round(time.Millisecond))
+		if rate.SleepContext(cnf.Context(), wait) != nil {
+			return
+		}
+	}
+}
+
+/*
+Sends a HEAD request with the timeout of the host policy, redirects are followed.
+Network errors are returned as err, http errors as code.
+*/
+func Head(cnf *confs.CollectorConf, rawUrl string) (code int, header http.Header, err error) {
+	_, span := trace.Start(cnf.Context(), "fetch.head", "url", rawUrl, "host", hostOf(rawUrl))
+	defer func() {
+		span.Set("code", code)
+		span.Fail(err)
+		span.End()
+	}()
+	release, err := WaitHost(cnf, rawUrl)
+	if err != nil {
+		return
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(cnf.Context(), http.MethodHead, rawUrl, nil)
+	if err != nil {
+		return
+	}
+	c := httpClient(cnf)
+	c.Timeout = cnf.FetchPolicy(rawUrl).TimeoutDuration()
+	resp, err := c.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header, nil
+}
@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Recorded responses for fixture tests of collectors, see versions.RunFixtures.
+
+In record mode, responses of all fetches are saved into the fixtures dir as they pass the transport.
+In replay mode, fetches are served from the saved responses by FixtureHandler, nothing goes to the network,
+urls without a fixture get 404. A response is kept in two files, named by a hash of its method and url:
+
+	<dir>/<host>/<hash>.json  url, status code and headers
+	<dir>/<host>/<hash>.body  the body as it was received
+*/
+
+const (
+	FixturesRecord string = "record"
+	FixturesReplay string = "replay"
+)
+
+var (
+	fixturesLock = &sync.Mutex{}
+	fixturesMode string
+	fixturesDir  string
+)
+
+// Headers kept in fixtures, others change on each request.
+var fixtureHeaders = []string{"Content-Type", "Content-Length", "Content-Disposition", "Last-Modified", "Location"}
+
+type fixtureMeta struct {
+	Method string              `json:"method"`
+	Url    string              `json:"url"`
+	Code   int                 `json:"code"`
+	Header map[string][]string `json:"header,omitempty"`
+}
+
+// Records or replays fetches with fixtures in dir, mode "" goes back to the network.
+func SetFixtures(mode, dir string) {
+	fixturesLock.Lock()
+	defer fixturesLock.Unlock()
+	fixturesMode, fixturesDir = mode, dir
+}
+
+func fixtures() (mode, dir string) {
+	fixturesLock.Lock()
+	defer fixturesLock.Unlock()
+	return fixturesMode, fixturesDir
+}
+
+func replaying() bool {
+	mode, _ := fixtures()
+	return mode == FixturesReplay
+}
+
+func fixturePath(dir, method, rawUrl string) string {
+	h := sha1.Sum([]byte(method + " " + rawUrl))
+	return filepath.Join(dir, hostOf(rawUrl), hex.EncodeToString(h[:])[:16])
+}
+
+func fixtureUrl(r *http.Request) string {
+	u := *r.URL
+	u.Fragment = ""
+	return u.String()
+}
+
+// Wraps a transport by the fixtures mode.
+func withFixtures(t http.RoundTripper) http.RoundTripper {
+	mode, dir := fixtures()
+	switch mode {
+	case FixturesRecord:
+		return &recordTransport{next: t, dir: dir}
+	case FixturesReplay:
+		return &replayTransport{handler: FixtureHandler(dir)}
+	default:
+		return t
+	}
+}
+
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	meta := &fixtureMeta{Method: req.Method, Url: fixtureUrl(req), Code: resp.StatusCode, Header: map[string][]string{}}
+	for _, k := range fixtureHeaders {
+		if v := resp.Header.Values(k); len(v) > 0 {
+			meta.Header[k] = v
+		}
+	}
+	fPath := fixturePath(t.dir, meta.Method, meta.Url)
+	content, _ := json.MarshalIndent(meta, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
+		logs.Error("Save fixture of %s failed: %+v", meta.Url, err)
+		return resp, nil
+	}
+	if err := utils.WriteFile(fPath+".body", body, 0o644); err != nil {
+		logs.Error("Save fixture of %s failed: %+v", meta.Url, err)
+	} else if err := utils.WriteFile(fPath+".json", content, 0o644); err != nil {
+		logs.Error("Save fixture of %s failed: %+v", meta.Url, err)
+	}
+	return resp, nil
+}
+
+type replayTransport struct {
+	handler http.Handler
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+/*
+Serves recorded responses from dir by the absolute urls of requests,
+as the replay transport or as a proxy of an httptest.Server for plain http urls.
+*/
+func FixtureHandler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawUrl := fixtureUrl(r)
+		fPath := fixturePath(dir, r.Method, rawUrl)
+		meta := &fixtureMeta{}
+		content, err := os.ReadFile(fPath + ".json")
+		if err == nil {
+			err = json.Unmarshal(content, meta)
+		}
+		var body []byte
+		if err == nil {
+			body, err = os.ReadFile(fPath + ".body")
+		}
+		if err != nil {
+			logs.Error("No fixture for %s %s: %+v", r.Method, rawUrl, err)
+			http.NotFound(w, r)
+			return
+		}
+		for k, v := range meta.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(meta.Code)
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package fetch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testReleases = `{"version":"1.0.0"}`
+
+// Records responses of a site, then serves them from a proxy made of FixtureHandler, with the site gone.
+func TestFixtureRecordReplay(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=1")
+		io.WriteString(w, testReleases)
+	}))
+	dir := t.TempDir()
+	recorder := &http.Client{Transport: &recordTransport{next: http.DefaultTransport, dir: dir}}
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/releases?page=1"},
+		{http.MethodHead, "/releases?page=1"},
+		{http.MethodGet, "/missing"},
+	} {
+		r, _ := http.NewRequest(req.method, site.URL+req.path, nil)
+		resp, err := recorder.Do(r)
+		if err != nil {
+			t.Fatalf("record %s %s: %v", req.method, req.path, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	siteUrl := site.URL
+	site.Close()
+
+	proxy := httptest.NewServer(FixtureHandler(dir))
+	defer proxy.Close()
+	proxyUrl, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyUrl)}}
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/releases?page=1", http.StatusOK, testReleases},
+		{http.MethodHead, "/releases?page=1", http.StatusOK, ""},
+		{http.MethodGet, "/missing", http.StatusNotFound, "404 page not found\n"},
+		// not recorded.
+		{http.MethodGet, "/releases?page=2", http.StatusNotFound, "404 page not found\n"},
+		{http.MethodPost, "/releases?page=1", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, siteUrl+tt.path, nil)
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatalf("replay %s %s: %v", tt.method, tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code || string(body) != tt.body {
+			t.Errorf("replay %s %s = %d %q, want %d %q", tt.method, tt.path, resp.StatusCode, body, tt.code, tt.body)
+		}
+		if tt.code == http.StatusOK {
+			if got := resp.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("replay %s %s: Content-Type = %q", tt.method, tt.path, got)
+			}
+			if got := resp.Header.Get("Set-Cookie"); got != "" {
+				t.Errorf("replay %s %s: Set-Cookie %q is kept", tt.method, tt.path, got)
+			}
+		}
+	}
+}
+
+// In replay mode the shared transport never goes to the network.
+func TestReplayTransport(t *testing.T) {
+	dir := t.TempDir()
+	SetFixtures(FixturesReplay, dir)
+	defer SetFixtures("", "")
+	client := &http.Client{Transport: withFixtures(http.DefaultTransport)}
+	resp, err := client.Get("https://example.com/not-recorded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("code = %d, want 404", resp.StatusCode)
+	}
+	if !replaying() {
+		t.Error("replaying() = false in replay mode")
+	}
+}
@@ -0,0 +1,41 @@
+package fetch
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+/*
+Pages are fetched in one locale, PageLocale in config, so that headings and platform names in tables
+do not change between runs. Hosts in localeParams pick their language by a query parameter,
+which wins over Accept-Language there, so the parameter is replaced too.
+*/
+
+var localeParams = map[string]string{
+	"developer.android.com":       "hl",
+	"developer.android.google.cn": "hl",
+	"developers.google.com":       "hl",
+	"developers.google.cn":        "hl",
+	"firebase.google.com":         "hl",
+	"cloud.google.com":            "hl",
+}
+
+// Sets the locale of a request, Accept-Language set by the fetcher is kept.
+func localize(cnf *confs.CollectorConf, req *http.Request) {
+	locale := cnf.Locale()
+	if req.Header.Get("Accept-Language") == "" {
+		req.Header.Set("Accept-Language", locale)
+	}
+	param, ok := localeParams[strings.ToLower(req.URL.Hostname())]
+	if !ok {
+		return
+	}
+	q := req.URL.Query()
+	if q.Get(param) == locale {
+		return
+	}
+	q.Set(param, locale)
+	req.URL.RawQuery = q.Encode()
+}
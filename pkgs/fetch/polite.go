@@ -0,0 +1,278 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/rate"
+)
+
+/*
+Politeness to hosts, by FetchPolicies: RateLimit, a minimum Delay between requests,
+Concurrency of requests at the same time, and robots.txt when Robots is set.
+Collectors run concurrently, requests to the same host share these limits.
+*/
+
+const (
+	// robots.txt groups for this user agent are used, "*" otherwise.
+	RobotsAgent        string = "proxy-collector"
+	robotsMaxSize      int64  = 512 << 10
+	robotsFetchTimeout        = 15 * time.Second
+)
+
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+type hostState struct {
+	limiter *rate.Limiter
+	lock    *sync.Mutex
+	next    time.Time     // earliest start of the next request by Delay.
+	slots   chan struct{} // nil for unlimited concurrency.
+	robots  *robotsRules
+	once    *sync.Once
+}
+
+var (
+	hostStatesLock = &sync.Mutex{}
+	hostStates     = map[string]*hostState{}
+)
+
+func getHostState(host string, policy *confs.FetchPolicy) *hostState {
+	hostStatesLock.Lock()
+	defer hostStatesLock.Unlock()
+	h, ok := hostStates[host]
+	if !ok {
+		h = &hostState{
+			limiter: rate.NewLimiter(policy.RateLimit, 0),
+			lock:    &sync.Mutex{},
+			once:    &sync.Once{},
+		}
+		if policy.Concurrency > 0 {
+			h.slots = make(chan struct{}, policy.Concurrency)
+		}
+		hostStates[host] = h
+	}
+	return h
+}
+
+// Reserves the start of a request after delay, returns how long to wait.
+func (h *hostState) reserve(delay time.Duration) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := time.Now()
+	if h.next.Before(now) {
+		h.next = now
+	}
+	wait := h.next.Sub(now)
+	h.next = h.next.Add(delay)
+	return wait
+}
+
+func noRelease() {}
+
+/*
+Waits until a request to the url is allowed by the policy of its host.
+release must be called when the request is done, it frees the Concurrency slot.
+Returns ErrDisallowed for urls disallowed by robots.txt,
+and the error of the run context when it is canceled.
+*/
+func WaitHost(cnf *confs.CollectorConf, rawUrl string) (release func(), err error) {
+	ctx := cnf.Context()
+	policy := cnf.FetchPolicy(rawUrl)
+	// replayed fixtures need no politeness.
+	if replaying() {
+		return noRelease, ctx.Err()
+	}
+	if err = checkQuota(cnf, policy, rawUrl, false); err != nil {
+		return noRelease, err
+	}
+	if policy.RateLimit <= 0 && policy.DelayDuration() <= 0 && policy.Concurrency <= 0 && !policy.Robots {
+		return noRelease, ctx.Err()
+	}
+	h := getHostState(hostOf(rawUrl), policy)
+	delay := policy.DelayDuration()
+	if policy.Robots {
+		rules := h.loadRobots(cnf, rawUrl)
+		if !rules.allowed(rawUrl) {
+			return noRelease, ErrDisallowed
+		}
+		if rules.crawlDelay > delay {
+			delay = rules.crawlDelay
+		}
+	}
+	release = noRelease
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+			var once sync.Once
+			release = func() { once.Do(func() { <-h.slots }) }
+		case <-ctx.Done():
+			return noRelease, ctx.Err()
+		}
+	}
+	if err = h.limiter.WaitCallContext(ctx); err != nil {
+		release()
+		return noRelease, err
+	}
+	if delay > 0 {
+		if err = rate.SleepContext(ctx, h.reserve(delay)); err != nil {
+			release()
+			return noRelease, err
+		}
+	}
+	return
+}
+
+/*
+Rules of robots.txt for RobotsAgent, or for "*".
+Paths are matched by prefix, with * and $ wildcards, the longest match wins and Allow wins ties.
+*/
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// Fetched once per host and process, a missing or broken robots.txt allows everything.
+func (h *hostState) loadRobots(cnf *confs.CollectorConf, rawUrl string) *robotsRules {
+	h.once.Do(func() {
+		h.robots = &robotsRules{}
+		u, err := url.Parse(rawUrl)
+		if err != nil || u.Host == "" {
+			return
+		}
+		robotsUrl := u.Scheme + "://" + u.Host + "/robots.txt"
+		ctx, cancel := context.WithTimeout(cnf.Context(), robotsFetchTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsUrl, nil)
+		if err != nil {
+			return
+		}
+		resp, err := httpClient(cnf).Do(req)
+		if err != nil {
+			logs.Debug("Get %s failed: %+v", robotsUrl, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		h.robots = parseRobots(io.LimitReader(resp.Body, robotsMaxSize), RobotsAgent)
+	})
+	return h.robots
+}
+
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	groups := map[string]*robotsRules{} // agent -> rules.
+	current := []string{}
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key == "user-agent" {
+			// agents listed together share the rules after them.
+			if inRules {
+				current, inRules = []string{}, false
+			}
+			current = append(current, strings.ToLower(value))
+			if _, ok := groups[current[len(current)-1]]; !ok {
+				groups[current[len(current)-1]] = &robotsRules{}
+			}
+			continue
+		}
+		inRules = true
+		for _, a := range current {
+			g := groups[a]
+			switch key {
+			case "allow":
+				if value != "" {
+					g.allow = append(g.allow, value)
+				}
+			case "disallow":
+				if value != "" {
+					g.disallow = append(g.disallow, value)
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					g.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	for name, g := range groups {
+		if name != "*" && strings.Contains(agent, name) {
+			return g
+		}
+	}
+	if g, ok := groups["*"]; ok {
+		return g
+	}
+	return &robotsRules{}
+}
+
+// Length of the match of a robots.txt path pattern, -1 when it does not match.
+func robotsMatch(pattern, p string) int {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	pos := 0
+	for i, part := range parts {
+		idx := strings.Index(p[pos:], part)
+		if idx < 0 || (i == 0 && idx != 0) {
+			return -1
+		}
+		pos += idx + len(part)
+	}
+	if anchored && pos != len(p) {
+		// the last part may match later in the path.
+		last := parts[len(parts)-1]
+		if len(parts) == 1 || !strings.HasSuffix(p, last) {
+			return -1
+		}
+	}
+	return len(pattern)
+}
+
+func (r *robotsRules) allowed(rawUrl string) bool {
+	if r == nil {
+		return true
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return true
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	allow, disallow := -1, -1
+	for _, pattern := range r.allow {
+		if n := robotsMatch(pattern, p); n > allow {
+			allow = n
+		}
+	}
+	for _, pattern := range r.disallow {
+		if n := robotsMatch(pattern, p); n > disallow {
+			disallow = n
+		}
+	}
+	return allow >= disallow
+}
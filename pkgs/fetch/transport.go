@@ -0,0 +1,107 @@
+package fetch
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Shared http transports of fetches, one for each proxy, so connections, keep-alives and TLS sessions
+are reused by all collectors and sites of a run, instead of a handshake for each page.
+Tuned by the Http* options in config, HTTP/2 is used when servers support it.
+*/
+
+const (
+	DefaultMaxConnsPerHost int = 16
+	DefaultMaxIdleConns    int = 100
+	DefaultIdleTimeout         = 90 * time.Second
+	// request.Fetcher falls back to this env var when it has no proxy.
+	fetcherProxyEnvName string = "GVC_DEFAULT_PROXY"
+)
+
+var (
+	transportsLock = &sync.Mutex{}
+	transports     = map[string]*http.Transport{}
+)
+
+func newTransport(cnf *confs.CollectorConf, proxy string) *http.Transport {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     !cnf.HttpDisableHttp2,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		MaxConnsPerHost:       DefaultMaxConnsPerHost,
+		MaxIdleConnsPerHost:   DefaultMaxConnsPerHost,
+		IdleConnTimeout:       DefaultIdleTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if proxy != "" {
+		// http, https and socks5 proxies.
+		if u, err := url.Parse(proxy); err == nil {
+			t.Proxy = http.ProxyURL(u)
+		} else {
+			logs.Error("Invalid proxy %s: %+v", proxy, err)
+		}
+	}
+	if cnf.HttpMaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cnf.HttpMaxConnsPerHost
+		t.MaxIdleConnsPerHost = cnf.HttpMaxConnsPerHost
+	}
+	if cnf.HttpMaxIdleConns > 0 {
+		t.MaxIdleConns = cnf.HttpMaxIdleConns
+	}
+	if cnf.HttpIdleTimeout != "" {
+		if d, err := time.ParseDuration(cnf.HttpIdleTimeout); err == nil {
+			t.IdleConnTimeout = d
+		}
+	}
+	return t
+}
+
+// The shared transport for a proxy, "" for direct connections, wrapped by the fixtures and http debug modes.
+func transport(cnf *confs.CollectorConf, proxy string) http.RoundTripper {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+	t, ok := transports[proxy]
+	if !ok {
+		t = newTransport(cnf, proxy)
+		transports[proxy] = t
+	}
+	return withDebug(withFixtures(&countingTransport{next: t}))
+}
+
+// Closes idle connections of all transports, at the end of a run.
+func CloseIdle() {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+	for _, t := range transports {
+		t.CloseIdleConnections()
+	}
+}
+
+// A client on the shared transport, proxied when the proxy is enabled.
+func httpClient(cnf *confs.CollectorConf) *http.Client {
+	proxy := ""
+	if confs.EnableProxyOrNot() {
+		proxy = cnf.Proxy()
+	}
+	return &http.Client{Transport: transport(cnf, proxy)}
+}
+
+func fetcherProxy(proxy string) string {
+	if proxy == "" {
+		return os.Getenv(fetcherProxyEnvName)
+	}
+	return proxy
+}
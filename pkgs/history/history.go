@@ -0,0 +1,274 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+History of runs in history.json of the work dir, for pxy stats.
+
+Proxy nodes are kept with where they were seen(the site type, like "subscribed" or "freefq"),
+their country(location) and when they were first and last seen, new versions are kept by tool and day.
+Nodes not seen for the retention(RetainHistoryDays in config) and older versions are dropped on each update.
+*/
+
+const (
+	UnknownCountry string = "unknown"
+	dayFormat      string = "2006-01-02"
+)
+
+// Where a node was seen in a run.
+type Seen struct {
+	Source  string
+	Country string
+}
+
+type Node struct {
+	Source    string `json:"source"`
+	Country   string `json:"country,omitempty"`
+	FirstSeen int64  `json:"first_seen"` // unix seconds.
+	LastSeen  int64  `json:"last_seen"`
+	Runs      int    `json:"runs"`
+}
+
+type DB struct {
+	Nodes      map[string]*Node          `json:"nodes"`       // proxy -> node.
+	SourceRuns map[string]int64          `json:"source_runs"` // source -> unix seconds of its last run.
+	Versions   map[string]map[string]int `json:"versions"`    // tool -> day -> versions added.
+}
+
+func newDB() *DB {
+	return &DB{Nodes: map[string]*Node{}, SourceRuns: map[string]int64{}, Versions: map[string]map[string]int{}}
+}
+
+// Loads the history, an empty one when fPath does not exist.
+func Load(fPath string) (*DB, error) {
+	db := newDB()
+	content, err := os.ReadFile(fPath)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, db); err != nil {
+		return nil, fmt.Errorf("invalid history %s: %w", fPath, err)
+	}
+	if db.Nodes == nil {
+		db.Nodes = map[string]*Node{}
+	}
+	if db.SourceRuns == nil {
+		db.SourceRuns = map[string]int64{}
+	}
+	if db.Versions == nil {
+		db.Versions = map[string]map[string]int{}
+	}
+	return db, nil
+}
+
+// Loads the history, applies f, drops entries older than retention and saves it.
+func Update(fPath string, retention time.Duration, f func(db *DB)) error {
+	db, err := Load(fPath)
+	if err != nil {
+		return err
+	}
+	f(db)
+	db.prune(time.Now(), retention)
+	content, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFile(fPath, content, os.ModePerm)
+}
+
+func (db *DB) prune(now time.Time, retention time.Duration) {
+	oldest := now.Add(-retention)
+	for key, n := range db.Nodes {
+		if n.LastSeen < oldest.Unix() {
+			delete(db.Nodes, key)
+		}
+	}
+	for tool, days := range db.Versions {
+		for day := range days {
+			if day < oldest.UTC().Format(dayFormat) {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(db.Versions, tool)
+		}
+	}
+}
+
+/*
+Drops entries older than retention, like runs do, for pxy clean.
+Returns the number of nodes and tool days dropped.
+*/
+func Prune(fPath string, retention time.Duration, dryRun bool) (nodes, days int, err error) {
+	if _, err = os.Stat(fPath); os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	db, err := Load(fPath)
+	if err != nil {
+		return
+	}
+	nodes, days = len(db.Nodes), db.days()
+	db.prune(time.Now(), retention)
+	nodes, days = nodes-len(db.Nodes), days-db.days()
+	if dryRun || nodes+days == 0 {
+		return
+	}
+	content, err := json.Marshal(db)
+	if err != nil {
+		return
+	}
+	err = utils.WriteFile(fPath, content, os.ModePerm)
+	return
+}
+
+func (db *DB) days() (n int) {
+	for _, days := range db.Versions {
+		n += len(days)
+	}
+	return
+}
+
+// Records nodes seen in a run, sources of the run are marked as run at at.
+func (db *DB) RecordNodes(seen map[string]Seen, at time.Time) {
+	for key, s := range seen {
+		n, ok := db.Nodes[key]
+		if !ok {
+			n = &Node{FirstSeen: at.Unix()}
+			db.Nodes[key] = n
+		}
+		n.Source, n.LastSeen = s.Source, at.Unix()
+		if s.Country != "" {
+			n.Country = s.Country
+		}
+		n.Runs++
+		db.SourceRuns[s.Source] = at.Unix()
+	}
+}
+
+// Records versions added in a run, tool -> versions.
+func (db *DB) RecordVersions(added map[string][]string, at time.Time) {
+	day := at.UTC().Format(dayFormat)
+	for tool, vList := range added {
+		if len(vList) == 0 {
+			continue
+		}
+		if db.Versions[tool] == nil {
+			db.Versions[tool] = map[string]int{}
+		}
+		db.Versions[tool][day] += len(vList)
+	}
+}
+
+type SourceStat struct {
+	Source   string  `json:"source"`
+	Nodes    int     `json:"nodes"`    // nodes ever seen.
+	Alive    int     `json:"alive"`    // nodes seen in the last run of the source.
+	Survival float64 `json:"survival"` // alive / nodes.
+}
+
+type CountryStat struct {
+	Country  string        `json:"country"`
+	Nodes    int           `json:"nodes"`
+	Lifetime time.Duration `json:"avg_lifetime"` // average time between first and last seen.
+}
+
+type WeekStat struct {
+	Tool  string `json:"tool"`
+	Week  string `json:"week"` // ISO week, like 2024-W07.
+	Added int    `json:"added"`
+}
+
+type Stats struct {
+	Sources   []*SourceStat  `json:"sources"`
+	Countries []*CountryStat `json:"countries"`
+	Versions  []*WeekStat    `json:"versions"`
+}
+
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// Summarizes the history, versions of the last weeks only.
+func (db *DB) Stats(weeks int) *Stats {
+	st := &Stats{Sources: []*SourceStat{}, Countries: []*CountryStat{}, Versions: []*WeekStat{}}
+	sources := map[string]*SourceStat{}
+	countries := map[string]*CountryStat{}
+	for _, n := range db.Nodes {
+		s, ok := sources[n.Source]
+		if !ok {
+			s = &SourceStat{Source: n.Source}
+			sources[n.Source] = s
+		}
+		s.Nodes++
+		if n.LastSeen >= db.SourceRuns[n.Source] {
+			s.Alive++
+		}
+		country := n.Country
+		if country == "" {
+			country = UnknownCountry
+		}
+		c, ok := countries[country]
+		if !ok {
+			c = &CountryStat{Country: country}
+			countries[country] = c
+		}
+		c.Nodes++
+		// sums up first, averaged below.
+		c.Lifetime += time.Duration(n.LastSeen-n.FirstSeen) * time.Second
+	}
+	for _, s := range sources {
+		s.Survival = float64(s.Alive) / float64(s.Nodes)
+		st.Sources = append(st.Sources, s)
+	}
+	sort.Slice(st.Sources, func(i, j int) bool { return st.Sources[i].Source < st.Sources[j].Source })
+	for _, c := range countries {
+		c.Lifetime /= time.Duration(c.Nodes)
+		st.Countries = append(st.Countries, c)
+	}
+	sort.Slice(st.Countries, func(i, j int) bool {
+		if st.Countries[i].Nodes != st.Countries[j].Nodes {
+			return st.Countries[i].Nodes > st.Countries[j].Nodes
+		}
+		return st.Countries[i].Country < st.Countries[j].Country
+	})
+
+	if weeks < 1 {
+		weeks = 1
+	}
+	since := isoWeek(time.Now().UTC().AddDate(0, 0, -7*(weeks-1)))
+	byWeek := map[[2]string]int{}
+	for tool, days := range db.Versions {
+		for day, n := range days {
+			t, err := time.Parse(dayFormat, day)
+			if err != nil {
+				continue
+			}
+			if week := isoWeek(t); week >= since {
+				byWeek[[2]string{tool, week}] += n
+			}
+		}
+	}
+	for k, n := range byWeek {
+		st.Versions = append(st.Versions, &WeekStat{Tool: k[0], Week: k[1], Added: n})
+	}
+	sort.Slice(st.Versions, func(i, j int) bool {
+		a, b := st.Versions[i], st.Versions[j]
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		return a.Week < b.Week
+	})
+	return st
+}
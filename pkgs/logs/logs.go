@@ -0,0 +1,363 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+/*
+Structured logging for all packages, based on log/slog.
+
+Console output is "pretty"(colored lines, like before) or "json", filtered by the log level.
+Runs also write json lines at debug level into a log file in the work dir, see OpenRunFile.
+Messages of a collector carry a "collector" attribute, see For.
+*/
+
+const (
+	FormatPretty string = "pretty"
+	FormatJson   string = "json"
+
+	LevelSuccess = slog.Level(2) // between info and warning.
+
+	LogDirName      string = "logs"
+	DefaultKeepLogs int    = 20
+	maxRunErrors    int    = 500
+)
+
+var (
+	level  = &slog.LevelVar{}
+	format = FormatPretty
+	stderr = false // console logs go to stderr as json lines, see UseStderr.
+	redact = func(s string) string { return s }
+
+	fileLock = &sync.Mutex{}
+	runFile  *os.File
+
+	errorsLock = &sync.Mutex{}
+	runErrors  = []string{}
+)
+
+func init() {
+	slog.SetDefault(slog.New(newHandler()))
+}
+
+// Parses "debug", "info", "warning" or "error", info for unknown levels.
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type Options struct {
+	Level  string // "info" by default.
+	Format string // "pretty" by default, or "json".
+	Redact func(string) string
+}
+
+// Applies options to the default logger, safe to call again.
+func Setup(opts *Options) {
+	level.Set(ParseLevel(opts.Level))
+	format = FormatPretty
+	if strings.EqualFold(opts.Format, FormatJson) {
+		format = FormatJson
+	}
+	if opts.Redact != nil {
+		redact = opts.Redact
+	}
+	slog.SetDefault(slog.New(newHandler()))
+}
+
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Sends console logs to stderr as json lines, so stdout only carries the output of a command, see --output json.
+func UseStderr() {
+	stderr = true
+	slog.SetDefault(slog.New(newHandler()))
+}
+
+/*
+Opens a log file for this run in dir, like logs/version-fetch-20240101-150405.log,
+and removes old files of the same name beyond keep. keep < 0 disables log files.
+*/
+func OpenRunFile(dir, name string, keep int) (fPath string) {
+	if keep < 0 {
+		return
+	}
+	if keep == 0 {
+		keep = DefaultKeepLogs
+	}
+	dir = filepath.Join(dir, LogDirName)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		Warning("Cannot create log dir: %+v", err)
+		return
+	}
+	fPath = filepath.Join(dir, fmt.Sprintf("%s-%s.log", name, time.Now().Format("20060102-150405")))
+	f, err := os.OpenFile(fPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		Warning("Cannot create log file: %+v", err)
+		return ""
+	}
+	fileLock.Lock()
+	if runFile != nil {
+		runFile.Close()
+	}
+	runFile = f
+	fileLock.Unlock()
+	slog.SetDefault(slog.New(newHandler()))
+	removeOldFiles(dir, name, keep)
+	return
+}
+
+// Closes the log file of the run.
+func CloseRunFile() {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if runFile != nil {
+		runFile.Close()
+		runFile = nil
+	}
+}
+
+func removeOldFiles(dir, name string, keep int) {
+	matches, _ := filepath.Glob(filepath.Join(dir, name+"-*.log"))
+	if len(matches) <= keep {
+		return
+	}
+	// timestamps sort by name.
+	sort.Strings(matches)
+	for _, fPath := range matches[:len(matches)-keep] {
+		os.Remove(fPath)
+	}
+}
+
+// Writes redacted records to the run file.
+type fileWriter struct{}
+
+func (fileWriter) Write(p []byte) (int, error) {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if runFile == nil {
+		return len(p), nil
+	}
+	if _, err := runFile.WriteString(redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// os.Stdout is looked up for each write, it is replaced by console redaction.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+type stderrWriter struct{}
+
+func (stderrWriter) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if l, ok := a.Value.Any().(slog.Level); ok && l == LevelSuccess {
+			a.Value = slog.StringValue("SUCCESS")
+		}
+	}
+	return a
+}
+
+func newHandler() slog.Handler {
+	var console slog.Handler
+	if stderr {
+		console = slog.NewJSONHandler(stderrWriter{}, &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel})
+	} else if format == FormatJson {
+		console = slog.NewJSONHandler(stdoutWriter{}, &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel})
+	} else {
+		console = &prettyHandler{level: level}
+	}
+	handlers := []slog.Handler{console}
+	fileLock.Lock()
+	if runFile != nil {
+		handlers = append(handlers, slog.NewJSONHandler(fileWriter{}, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: replaceLevel}))
+	}
+	fileLock.Unlock()
+	if len(handlers) == 1 {
+		return console
+	}
+	return multiHandler(handlers)
+}
+
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) (err error) {
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			if e := h.Handle(ctx, r.Clone()); e != nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	r := make(multiHandler, len(m))
+	for i, h := range m {
+		r[i] = h.WithAttrs(attrs)
+	}
+	return r
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	r := make(multiHandler, len(m))
+	for i, h := range m {
+		r[i] = h.WithGroup(name)
+	}
+	return r
+}
+
+/*
+Lines of gprint, the collector attribute becomes a prefix,
+other attributes are appended as key=value.
+*/
+type prettyHandler struct {
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func (h *prettyHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *prettyHandler) Handle(_ context.Context, r slog.Record) error {
+	sb := &strings.Builder{}
+	extra := []string{}
+	addAttr := func(a slog.Attr) bool {
+		if a.Key == "collector" {
+			fmt.Fprintf(sb, "[%s] ", a.Value.String())
+		} else {
+			extra = append(extra, fmt.Sprintf("%s=%v", a.Key, a.Value.Any()))
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		addAttr(a)
+	}
+	r.Attrs(addAttr)
+	sb.WriteString(r.Message)
+	if len(extra) > 0 {
+		sb.WriteString(" " + strings.Join(extra, " "))
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		gprint.PrintError("%s", sb.String())
+	case r.Level >= slog.LevelWarn:
+		gprint.PrintWarning("%s", sb.String())
+	case r.Level >= LevelSuccess:
+		gprint.PrintSuccess("%s", sb.String())
+	case r.Level >= slog.LevelInfo:
+		gprint.PrintInfo("%s", sb.String())
+	default:
+		gprint.Gray("%s", sb.String())
+	}
+	return nil
+}
+
+func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &prettyHandler{level: h.level, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *prettyHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// Logger scoped by attributes, like a collector.
+type Logger struct {
+	attrs []any
+}
+
+// Logger for a collector, messages carry its name.
+func For(collector string) *Logger {
+	return &Logger{attrs: []any{"collector", collector}}
+}
+
+func (l *Logger) log(lv slog.Level, format string, args ...any) {
+	if lv >= slog.LevelError {
+		l.recordError(fmt.Sprintf(format, args...))
+	}
+	logger := slog.Default()
+	if !logger.Enabled(context.Background(), lv) {
+		return
+	}
+	if l != nil {
+		logger = logger.With(l.attrs...)
+	}
+	logger.Log(context.Background(), lv, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) recordError(msg string) {
+	for i := 0; l != nil && i+1 < len(l.attrs); i += 2 {
+		if l.attrs[i] == "collector" {
+			msg = fmt.Sprintf("[%v] %s", l.attrs[i+1], msg)
+		}
+	}
+	errorsLock.Lock()
+	defer errorsLock.Unlock()
+	if len(runErrors) < maxRunErrors {
+		runErrors = append(runErrors, redact(msg))
+	}
+}
+
+// Error messages logged since the last ResetErrors, for the run report.
+func RunErrors() []string {
+	errorsLock.Lock()
+	defer errorsLock.Unlock()
+	return append([]string{}, runErrors...)
+}
+
+func ResetErrors() {
+	errorsLock.Lock()
+	runErrors = []string{}
+	errorsLock.Unlock()
+}
+
+func (l *Logger) Debug(format string, args ...any)   { l.log(slog.LevelDebug, format, args...) }
+func (l *Logger) Info(format string, args ...any)    { l.log(slog.LevelInfo, format, args...) }
+func (l *Logger) Success(format string, args ...any) { l.log(LevelSuccess, format, args...) }
+func (l *Logger) Warning(format string, args ...any) { l.log(slog.LevelWarn, format, args...) }
+func (l *Logger) Error(format string, args ...any)   { l.log(slog.LevelError, format, args...) }
+
+// Logs with the default logger, formats like fmt.Printf.
+func Debug(format string, args ...any)   { (*Logger)(nil).log(slog.LevelDebug, format, args...) }
+func Info(format string, args ...any)    { (*Logger)(nil).log(slog.LevelInfo, format, args...) }
+func Success(format string, args ...any) { (*Logger)(nil).log(LevelSuccess, format, args...) }
+func Warning(format string, args ...any) { (*Logger)(nil).log(slog.LevelWarn, format, args...) }
+func Error(format string, args ...any)   { (*Logger)(nil).log(slog.LevelError, format, args...) }
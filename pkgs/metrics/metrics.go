@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+Prometheus metrics of runs, served by "pxy serve" on /metrics in the text exposition format.
+
+Metrics are process wide, a one-off command records them too but nothing serves them.
+*/
+
+const (
+	kindGauge   string = "gauge"
+	kindCounter string = "counter"
+)
+
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	lock   *sync.Mutex
+	values map[string]float64 // label values joined by \xff -> value.
+}
+
+var (
+	registryLock = &sync.Mutex{}
+	registry     = []*metric{}
+)
+
+func newMetric(kind, name, help string, labels []string) *metric {
+	m := &metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		lock:   &sync.Mutex{},
+		values: map[string]float64{},
+	}
+	registryLock.Lock()
+	registry = append(registry, m)
+	registryLock.Unlock()
+	return m
+}
+
+func (m *metric) key(labelValues []string) string {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s takes %d labels, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+type Gauge struct {
+	m *metric
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m: newMetric(kindGauge, name, help, labels)}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	k := g.m.key(labelValues)
+	g.m.lock.Lock()
+	g.m.values[k] = v
+	g.m.lock.Unlock()
+}
+
+type Counter struct {
+	m *metric
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{m: newMetric(kindCounter, name, help, labels)}
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	k := c.m.key(labelValues)
+	c.m.lock.Lock()
+	c.m.values[k] += v
+	c.m.lock.Unlock()
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metric) write(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels := ""
+		if len(m.labels) > 0 {
+			pairs := []string{}
+			for i, v := range strings.Split(k, "\xff") {
+				pairs = append(pairs, fmt.Sprintf(`%s="%s"`, m.labels[i], labelEscaper.Replace(v)))
+			}
+			labels = "{" + strings.Join(pairs, ",") + "}"
+		}
+		fmt.Fprintf(w, "%s%s %v\n", m.name, labels, m.values[k])
+	}
+}
+
+// Writes all metrics in the text exposition format.
+func Write(w io.Writer) {
+	registryLock.Lock()
+	metrics := append([]*metric{}, registry...)
+	registryLock.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+var (
+	RunDuration       = NewGauge("pxy_run_duration_seconds", "Duration of the last run of a command.", "command")
+	RunLastSuccess    = NewGauge("pxy_run_last_success_timestamp_seconds", "Unix time of the last finished run of a command.", "command")
+	Runs              = NewCounter("pxy_runs_total", "Runs of a command by result, ok, failed(see confs/exit.go), canceled or skipped(the work dir was locked).", "command", "result")
+	CollectorSuccess  = NewGauge("pxy_collector_success", "1 when the last run of a collector found versions for all its files.", "collector")
+	CollectorDuration = NewGauge("pxy_collector_duration_seconds", "Fetch duration of the last run of a collector.", "collector")
+	CollectorVersions = NewGauge("pxy_collector_versions", "Versions collected for a version file in the last run.", "collector", "file")
+	Proxies           = NewGauge("pxy_proxies", "Proxies collected in the last run by protocol.", "protocol")
+	DownloadedBytes   = NewCounter("pxy_downloaded_bytes_total", "Bytes downloaded from a host.", "host")
+	UploadFailures    = NewCounter("pxy_upload_failures_total", "Uploads that failed or were blocked by gates.")
+)
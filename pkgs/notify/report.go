@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	ReportFileName     string = "report.json"
+	ReportTextFileName string = "report.txt"
+)
+
+/*
+Human readable report of a run: the summary with all items listed,
+and versions collected by each collector.
+*/
+func (s *Summary) Report() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s run, %s - %s\n", s.Command, s.StartedAt, s.FinishedAt)
+	if s.Failure != "" {
+		fmt.Fprintf(sb, "failed: %s, exit code %d\n", s.Failure, s.ExitCode)
+	}
+	sb.WriteString(s.text(-1))
+	if s.Downloaded > 0 {
+		fmt.Fprintf(sb, "\n\ndownloaded: %.1fMB", float64(s.Downloaded)/(1<<20))
+		hosts := make([]string, 0, len(s.DownloadedHosts))
+		for host := range s.DownloadedHosts {
+			hosts = append(hosts, host)
+		}
+		sort.Slice(hosts, func(i, j int) bool { return s.DownloadedHosts[hosts[i]] > s.DownloadedHosts[hosts[j]] })
+		for _, host := range hosts {
+			fmt.Fprintf(sb, "\n    %s: %.1fMB", host, float64(s.DownloadedHosts[host])/(1<<20))
+		}
+	}
+	if len(s.Collectors) == 0 {
+		sb.WriteString("\n")
+		return sb.String()
+	}
+	names := make([]string, 0, len(s.Collectors))
+	for name := range s.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb.WriteString("\n\ncollectors:\n")
+	for _, name := range names {
+		r := s.Collectors[name]
+		status := "ok"
+		if r.Failed {
+			status = "failed, " + r.Reason
+		}
+		fmt.Fprintf(sb, "- %s (%.1fs, %s)\n", name, r.Duration, status)
+		files := make([]string, 0, len(r.Files))
+		for fileName := range r.Files {
+			files = append(files, fileName)
+		}
+		sort.Strings(files)
+		for _, fileName := range files {
+			fmt.Fprintf(sb, "    %s: %d versions\n", fileName, r.Files[fileName])
+		}
+	}
+	return sb.String()
+}
+
+/*
+Saves report.json and report.txt into dir, replacing the report of the previous run.
+*/
+func WriteReport(dir string, s *Summary) (fPaths []string, err error) {
+	s.lock.Lock()
+	content, err := json.MarshalIndent(s, "", "  ")
+	s.lock.Unlock()
+	if err != nil {
+		return
+	}
+	jsonPath := filepath.Join(dir, ReportFileName)
+	if err = utils.WriteFile(jsonPath, content, os.ModePerm); err != nil {
+		return
+	}
+	textPath := filepath.Join(dir, ReportTextFileName)
+	if err = utils.WriteFile(textPath, []byte(s.Report()), os.ModePerm); err != nil {
+		return
+	}
+	return []string{jsonPath, textPath}, nil
+}
+
+// Loads report.json of the last run in dir.
+func LoadReport(dir string) (s *Summary, err error) {
+	content, err := os.ReadFile(filepath.Join(dir, ReportFileName))
+	if err != nil {
+		return nil, err
+	}
+	s = NewSummary()
+	err = json.Unmarshal(content, s)
+	return
+}
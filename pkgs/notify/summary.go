@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/diff"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Summary of a publish run, sent to webhooks and saved as the run report.
+*/
+type Summary struct {
+	Command         string                        `json:"command,omitempty"`
+	StartedAt       string                        `json:"started_at"`
+	FinishedAt      string                        `json:"finished_at"`
+	Published       []string                      `json:"published"`                  // all published files.
+	Changed         []string                      `json:"changed"`                    // files with new content.
+	Nodes           int                           `json:"nodes,omitempty"`            // proxy nodes in conf.txt.
+	NewProxies      int                           `json:"new_proxies,omitempty"`      // proxies not collected by the previous run.
+	RemovedProxies  int                           `json:"removed_proxies,omitempty"`  // proxies of the previous run not collected again.
+	NewVersions     map[string][]string           `json:"new_versions,omitempty"`     // app name -> versions not published before.
+	RemovedVersions map[string][]string           `json:"removed_versions,omitempty"` // app name -> published versions gone in this run.
+	ChangedFiles    map[string][]*diff.FileChange `json:"changed_files,omitempty"`    // app name -> changed urls and checksums of kept versions.
+	DeadLinks       []string                      `json:"dead_links,omitempty"`       // links found dead in this run.
+	Collectors      map[string]*CollectorResult   `json:"collectors,omitempty"`
+	Errors          []string                      `json:"errors,omitempty"` // error messages logged in this run.
+	Downloaded      int64                         `json:"downloaded_bytes,omitempty"`
+	DownloadedHosts map[string]int64              `json:"downloaded_hosts,omitempty"` // host -> bytes.
+	Failure         confs.FailureClass            `json:"failure,omitempty"`          // class of the failure that sets the exit code.
+	ExitCode        int                           `json:"exit_code"`
+	lock            *sync.Mutex
+}
+
+// Bytes downloaded in the run, in total and per host, set by pkgs/fetch.
+var BandwidthUsage func() (total int64, hosts map[string]int64)
+
+type CollectorResult struct {
+	Files    map[string]int `json:"files,omitempty"` // version file -> versions.
+	Duration float64        `json:"duration_seconds"`
+	Failed   bool           `json:"failed,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+}
+
+func NewSummary() (s *Summary) {
+	s = &Summary{
+		StartedAt:       utils.Now(),
+		NewVersions:     map[string][]string{},
+		RemovedVersions: map[string][]string{},
+		ChangedFiles:    map[string][]*diff.FileChange{},
+		Collectors:      map[string]*CollectorResult{},
+		lock:            &sync.Mutex{},
+	}
+	return
+}
+
+var (
+	currentLock = &sync.Mutex{}
+	current     = NewSummary()
+)
+
+// Summary of the current run, shared by all uploaders.
+func Current() *Summary {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	return current
+}
+
+// Starts the summary of a new run of a command.
+func Start(command string) (s *Summary) {
+	s = NewSummary()
+	s.Command = command
+	currentLock.Lock()
+	current = s
+	currentLock.Unlock()
+	return
+}
+
+// Marks the summary as finished, errors are the errors logged in the run.
+func (s *Summary) Finish(errors []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.FinishedAt = utils.Now()
+	s.Errors = errors
+	if BandwidthUsage != nil {
+		s.Downloaded, s.DownloadedHosts = BandwidthUsage()
+	}
+}
+
+// Failure class and exit code of the run, see confs/exit.go.
+func (s *Summary) SetFailure(class confs.FailureClass, code int) {
+	s.lock.Lock()
+	s.Failure, s.ExitCode = class, code
+	s.lock.Unlock()
+}
+
+func (s *Summary) AddFile(fileName string, changed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Published = append(s.Published, fileName)
+	sort.Strings(s.Published)
+	if changed {
+		s.Changed = append(s.Changed, fileName)
+		sort.Strings(s.Changed)
+	}
+}
+
+func (s *Summary) SetNodes(nodes int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Nodes = nodes
+}
+
+func (s *Summary) AddVersions(name string, vList ...string) {
+	if len(vList) == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.NewVersions[name] = append(s.NewVersions[name], vList...)
+	sort.Strings(s.NewVersions[name])
+}
+
+// Records the changelog of a version file compared with the previous run.
+func (s *Summary) AddChangelog(c *diff.Changelog) {
+	if c.Empty() {
+		return
+	}
+	s.AddVersions(c.Tool, c.Added...)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(c.Removed) > 0 {
+		s.RemovedVersions[c.Tool] = append(s.RemovedVersions[c.Tool], c.Removed...)
+		sort.Strings(s.RemovedVersions[c.Tool])
+	}
+	if len(c.Changed) > 0 {
+		s.ChangedFiles[c.Tool] = append(s.ChangedFiles[c.Tool], c.Changed...)
+	}
+}
+
+// New versions of the run, app name -> versions.
+func (s *Summary) AddedVersions() map[string][]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := make(map[string][]string, len(s.NewVersions))
+	for name, vList := range s.NewVersions {
+		r[name] = append([]string{}, vList...)
+	}
+	return r
+}
+
+func (s *Summary) SetProxies(added, removed int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.NewProxies, s.RemovedProxies = added, removed
+}
+
+func (s *Summary) collector(name string) *CollectorResult {
+	r, ok := s.Collectors[name]
+	if !ok {
+		r = &CollectorResult{Files: map[string]int{}}
+		s.Collectors[name] = r
+	}
+	return r
+}
+
+// Records the versions collected for a version file, a file without versions fails the collector.
+func (s *Summary) AddCollectorFile(name, fileName string, versions int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.collector(name)
+	r.Files[fileName] = versions
+	if versions == 0 {
+		r.Failed, r.Reason = true, "no versions for "+fileName
+	}
+}
+
+func (s *Summary) SetCollectorDuration(name string, d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.collector(name).Duration = d.Seconds()
+}
+
+func (s *Summary) FailCollector(name, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.collector(name)
+	r.Failed, r.Reason = true, reason
+}
+
+func (s *Summary) AddDeadLinks(urls ...string) {
+	if len(urls) == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.DeadLinks = append(s.DeadLinks, urls...)
+	sort.Strings(s.DeadLinks)
+}
+
+func (s *Summary) Empty() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.Published) == 0
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+/*
+Templates of webhook messages, NotifyTemplates in config, keyed by webhook type(slack, discord, telegram, generic)
+or "default" for all types. A template is Go template text, or the path of a .tmpl file, relative to the config dir.
+It renders the message of slack, discord and telegram webhooks, and the whole request body of generic webhooks,
+so any json can be built, like:
+
+	{"msgtype": "text", "text": {"content": {{json .Text}}}}
+
+Templates get the run summary, fields like .Command, .Published, .NewVersions and .Collectors as in report.json,
+.Text the default message, and funcs: join, json, first(n, list), keys(map).
+*/
+
+const NotifyTemplateDefault string = "default"
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v any) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+	"first": func(n int, items []string) []string {
+		if len(items) > n {
+			return items[:n]
+		}
+		return items
+	},
+	"keys": func(m any) (r []string) {
+		switch v := m.(type) {
+		case map[string][]string:
+			for k := range v {
+				r = append(r, k)
+			}
+		case map[string]*CollectorResult:
+			for k := range v {
+				r = append(r, k)
+			}
+		case map[string]int64:
+			for k := range v {
+				r = append(r, k)
+			}
+		}
+		sort.Strings(r)
+		return
+	},
+}
+
+type templateData struct {
+	*Summary
+	Text string
+}
+
+// Template of a webhook type, nil when there is none.
+func loadTemplate(cnf *confs.CollectorConf, hookType string) (*template.Template, error) {
+	text, ok := cnf.NotifyTemplates[hookType]
+	if !ok {
+		text, ok = cnf.NotifyTemplates[NotifyTemplateDefault]
+	}
+	if !ok || text == "" {
+		return nil, nil
+	}
+	if strings.HasSuffix(text, ".tmpl") {
+		fPath := text
+		if !filepath.IsAbs(fPath) {
+			fPath = filepath.Join(cnf.ConfDir(), fPath)
+		}
+		content, err := os.ReadFile(fPath)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+	return template.New(hookType).Funcs(templateFuncs).Parse(text)
+}
+
+// Renders the summary by a template.
+func (s *Summary) render(t *template.Template) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, &templateData{Summary: s, Text: s.Text()}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Renders the summary by all templates in config, to check them.
+func RenderTemplates(cnf *confs.CollectorConf, s *Summary) (r map[string]string, err error) {
+	r = map[string]string{}
+	for hookType := range cnf.NotifyTemplates {
+		t, err := loadTemplate(cnf, hookType)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			continue
+		}
+		if r[hookType], err = s.render(t); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+const (
+	WebhookGeneric  string = "generic"
+	WebhookSlack    string = "slack"
+	WebhookDiscord  string = "discord"
+	WebhookTelegram string = "telegram"
+	maxListed       int    = 10
+)
+
+/*
+Finds the payload template of a webhook.
+"slack+https://...", "discord+https://..." or "telegram+https://..." forces a template,
+otherwise it is guessed from the host, and generic json is used for unknown hosts.
+*/
+func webhookType(hookUrl string) (string, string) {
+	for _, t := range []string{WebhookGeneric, WebhookSlack, WebhookDiscord, WebhookTelegram} {
+		if strings.HasPrefix(hookUrl, t+"+") {
+			return t, strings.TrimPrefix(hookUrl, t+"+")
+		}
+	}
+	switch {
+	case strings.Contains(hookUrl, "hooks.slack.com"):
+		return WebhookSlack, hookUrl
+	case strings.Contains(hookUrl, "discord.com/api/webhooks"), strings.Contains(hookUrl, "discordapp.com/api/webhooks"):
+		return WebhookDiscord, hookUrl
+	case strings.Contains(hookUrl, "api.telegram.org/bot"):
+		// https://api.telegram.org/bot<token>/sendMessage?chat_id=<chat>
+		return WebhookTelegram, hookUrl
+	default:
+		return WebhookGeneric, hookUrl
+	}
+}
+
+// Plain text for chat apps.
+func (s *Summary) Text() string {
+	return s.text(maxListed)
+}
+
+// Lists at most limit items of each list, all items when limit < 0.
+func (s *Summary) text(limit int) string {
+	lines := []string{
+		fmt.Sprintf("proxy-collector published %d files, %d changed.", len(s.Published), len(s.Changed)),
+	}
+	addList := func(items []string) {
+		for i, item := range items {
+			if limit >= 0 && i >= limit {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(items)-limit))
+				break
+			}
+			lines = append(lines, "- "+item)
+		}
+	}
+	addList(s.Changed)
+	if s.Nodes > 0 {
+		lines = append(lines, fmt.Sprintf("proxy nodes: %d", s.Nodes))
+	}
+	if s.NewProxies > 0 || s.RemovedProxies > 0 {
+		lines = append(lines, fmt.Sprintf("proxies: %d new, %d removed", s.NewProxies, s.RemovedProxies))
+	}
+	for _, diff := range []struct {
+		kind     string
+		versions map[string][]string
+	}{{"new", s.NewVersions}, {"removed", s.RemovedVersions}} {
+		names := make([]string, 0, len(diff.versions))
+		for name := range diff.versions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vList := diff.versions[name]
+			if limit >= 0 && len(vList) > limit {
+				vList = append(vList[:limit:limit], "...")
+			}
+			lines = append(lines, fmt.Sprintf("%s %s versions: %s", diff.kind, name, strings.Join(vList, ", ")))
+		}
+	}
+	tools := make([]string, 0, len(s.ChangedFiles))
+	for name := range s.ChangedFiles {
+		tools = append(tools, name)
+	}
+	sort.Strings(tools)
+	for _, name := range tools {
+		changes := []string{}
+		for _, c := range s.ChangedFiles[name] {
+			changes = append(changes, c.String())
+		}
+		lines = append(lines, fmt.Sprintf("changed %s files: %d", name, len(changes)))
+		addList(changes)
+	}
+	failed := []string{}
+	for name, r := range s.Collectors {
+		if r.Failed {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, r.Reason))
+		}
+	}
+	sort.Strings(failed)
+	if len(failed) > 0 {
+		lines = append(lines, fmt.Sprintf("failed collectors: %d", len(failed)))
+		addList(failed)
+	}
+	if len(s.DeadLinks) > 0 {
+		lines = append(lines, fmt.Sprintf("new dead links: %d", len(s.DeadLinks)))
+		addList(s.DeadLinks)
+	}
+	if len(s.Errors) > 0 {
+		lines = append(lines, fmt.Sprintf("errors: %d", len(s.Errors)))
+		addList(s.Errors)
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+Request body of a webhook, text is the message of chat apps, from a template or s.Text().
+Generic webhooks get the summary as json, or the template output as it is.
+*/
+func (s *Summary) payload(hookType string, t *template.Template) ([]byte, error) {
+	text := ""
+	if t != nil {
+		var err error
+		if text, err = s.render(t); err != nil {
+			return nil, err
+		}
+		if hookType == WebhookGeneric {
+			return []byte(text), nil
+		}
+	} else if hookType != WebhookGeneric {
+		text = s.Text()
+	}
+	switch hookType {
+	case WebhookSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case WebhookDiscord:
+		// discord limit.
+		text = truncate(text, 2000)
+		return json.Marshal(map[string]string{"content": text})
+	case WebhookTelegram:
+		// telegram limit.
+		text = truncate(text, 4096)
+		return json.Marshal(map[string]string{"text": text})
+	default:
+		return json.Marshal(s)
+	}
+}
+
+// Cuts text to max characters with "...", on a rune boundary so multi-byte characters stay valid.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	n := 0
+	for i := range text {
+		if n == max-3 {
+			return text[:i] + "..."
+		}
+		n++
+	}
+	return text
+}
+
+/*
+Sends the summary to all webhooks in config.
+*/
+func Send(cnf *confs.CollectorConf, s *Summary) {
+	if len(cnf.Webhooks) == 0 || s == nil || s.Empty() {
+		return
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, hook := range cnf.Webhooks {
+		hookType, hookUrl := webhookType(hook)
+		t, err := loadTemplate(cnf, hookType)
+		if err != nil {
+			// a broken template does not silence the webhook.
+			logs.Error("Invalid template of %s webhooks, the default message is sent: %+v", hookType, err)
+			t = nil
+		}
+		content, err := s.payload(hookType, t)
+		if err != nil && t != nil {
+			logs.Error("Render template of %s webhooks failed, the default message is sent: %+v", hookType, err)
+			content, err = s.payload(hookType, nil)
+		}
+		if err != nil {
+			logs.Error("%+v", err)
+			continue
+		}
+		resp, err := client.Post(hookUrl, "application/json", bytes.NewReader(content))
+		if err != nil {
+			logs.Error("Webhook %s failed: %+v", confs.RedactURL(hookUrl), confs.RedactError(err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logs.Error("Webhook %s failed: %d", confs.RedactURL(hookUrl), resp.StatusCode)
+		}
+	}
+}
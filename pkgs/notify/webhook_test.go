@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"abc", 3, "abc"},
+		{"abcd", 3, "..."},
+		{"abcdef", 5, "ab..."},
+		{strings.Repeat("é", 5), 5, strings.Repeat("é", 5)},
+		{strings.Repeat("é", 6), 5, "éé..."},
+		{strings.Repeat("中", 2001), 2000, strings.Repeat("中", 1997) + "..."},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.text, tt.max)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package platform
+
+import (
+	"sort"
+	"strings"
+)
+
+/*
+Canonical os, arch and variant of downloads, shared with gvc, so that both sides agree on what a file name
+like "node-v20.0.0-osx-arm64.tar.gz" means. Values follow GOOS and GOARCH, this package has no dependencies
+besides the standard library and can be imported by clients as it is.
+
+	Parse("node-v20.0.0-osx-arm64.tar.gz")  // {Os: "darwin", Arch: "arm64"}
+	Parse("ripgrep-x86_64-unknown-linux-musl.tar.gz")  // {Os: "linux", Arch: "amd64", Variant: "musl"}
+
+Parts of names are matched longest first, the tables below are the whole mapping.
+*/
+
+const (
+	Windows string = "windows"
+	MacOS   string = "darwin"
+	Linux   string = "linux"
+	X64     string = "amd64"
+)
+
+var ArchOSs map[string]string = map[string]string{
+	"x86-64":      "amd64",
+	"win64":       "amd64",
+	"linux64":     "amd64",
+	"x86":         "386",
+	"i386":        "386",
+	"i686":        "386",
+	"arm64":       "arm64",
+	"armv6":       "arm",
+	"ppc64le":     "ppc64le",
+	"riscv64":     "riscv64",
+	"loong64":     "loong64",
+	"loongarch64": "loong64",
+	"s390x":       "s390x",
+	"mips64le":    "mips64le",
+	"mips64el":    "mips64le",
+	"macos":       "darwin",
+	"os x 10.8+":  "darwin",
+	"os x 10.6+":  "darwin",
+	"linux":       "linux",
+	"windows":     "windows",
+	"freebsd":     "freebsd",
+}
+
+/*
+Parts of file names and their GOARCH, matched longest first by ParseArch,
+so that "ppc64le" wins over "ppc64", "x86_64" over "x86" and "mips64el" over "mips".
+*/
+var ArchMap = map[string]string{
+	"win32-arm64": "arm64",
+	"amd64":       "amd64",
+	"x86-64":      "amd64",
+	"x86_64":      "amd64",
+	"x64":         "amd64",
+	"win64":       "amd64",
+	"64-bit":      "amd64",
+	"ia32":        "386",
+	"x86":         "386",
+	"i586":        "386",
+	"i686":        "386",
+	"i386":        "386",
+	"-386":        "386",
+	"_386":        "386",
+	"win32":       "386",
+	"32-bit":      "386",
+	"arm64":       "arm64",
+	"aarch64":     "arm64",
+	"aarch_64":    "arm64",
+	"arm32":       "arm",
+	"armv6":       "arm",
+	"armv7":       "arm",
+	"armhf":       "arm",
+	"ppc64le":     "ppc64le",
+	"ppcle_64":    "ppc64le",
+	"powerpc64le": "ppc64le",
+	"s390x":       "s390x",
+	"s390_64":     "s390x",
+	"powerpc64":   "ppc64",
+	"ppc64":       "ppc64",
+	"riscv64":     "riscv64",
+	"riscv_64":    "riscv64",
+	"loongarch64": "loong64",
+	"loong64":     "loong64",
+	"mips64le":    "mips64le",
+	"mips64el":    "mips64le",
+	"mips64":      "mips64",
+	"mipsle":      "mipsle",
+	"mipsel":      "mipsle",
+	"universal":   "universal",
+}
+
+var PlatformMap = map[string]string{
+	"macosx":  MacOS,
+	"apple":   MacOS,
+	"darwin":  MacOS,
+	"macos":   MacOS,
+	"mac":     MacOS,
+	"winnt":   Windows,
+	"win":     Windows,
+	"osx":     MacOS,
+	"linux":   Linux,
+	"windows": Windows,
+	"freebsd": "freebsd",
+	"aix":     "aix",
+}
+
+func MapArchAndOS(ArchOrOS string) (result string) {
+	result, ok := ArchOSs[strings.ToLower(ArchOrOS)]
+	if !ok {
+		result = ArchOrOS
+	}
+	return
+}
+
+// Keys of m, longest first, ties in alphabetical order, so that matching does not depend on map order.
+func longestFirst(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+var (
+	archKeys     = longestFirst(ArchMap)
+	platformKeys = longestFirst(PlatformMap)
+)
+
+func ParseArch(name string) string {
+	name = strings.ToLower(name)
+	if strings.Contains(name, "win32-x64") {
+		return "amd64"
+	}
+	for _, k := range archKeys {
+		if strings.Contains(name, k) {
+			return ArchMap[k]
+		}
+	}
+	return ""
+}
+
+func ParsePlatform(name string) string {
+	name = strings.ToLower(name)
+	for _, k := range platformKeys {
+		if k == "win" && strings.Contains(name, "darwin") {
+			continue
+		}
+		if strings.Contains(name, k) {
+			return PlatformMap[k]
+		}
+	}
+	return ""
+}
+
+// Variants of builds for the same os and arch, see ParseVariant.
+const (
+	VariantMusl      string = "musl"      // linux, statically or dynamically linked against musl, for alpine.
+	VariantGlibc     string = "glibc"     // linux, linked against glibc, like "-linux-gnu".
+	VariantMsvc      string = "msvc"      // windows, built by the msvc toolchain.
+	VariantMingw     string = "mingw"     // windows, built by the gnu toolchain, like "-windows-gnu".
+	VariantStatic    string = "static"    // statically linked, runs on any libc.
+	VariantUniversal string = "universal" // macOS universal binaries for amd64 and arm64.
+)
+
+/*
+Parses the build variant from a file name or url path, "" when there is none.
+"gnu" means glibc on linux and mingw on windows, so os is needed.
+*/
+func ParseVariant(name, os string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "musl"), strings.Contains(name, "alpine"):
+		return VariantMusl
+	case strings.Contains(name, "msvc"):
+		return VariantMsvc
+	case strings.Contains(name, "mingw"):
+		return VariantMingw
+	case strings.Contains(name, "glibc"):
+		return VariantGlibc
+	case strings.Contains(name, "-gnu"), strings.Contains(name, "_gnu"):
+		if os == Windows {
+			return VariantMingw
+		}
+		return VariantGlibc
+	case strings.Contains(name, "static"):
+		return VariantStatic
+	case strings.Contains(name, "universal"):
+		return VariantUniversal
+	}
+	return ""
+}
+
+// Canonical platform of a download.
+type Tuple struct {
+	Os      string `json:"os"`
+	Arch    string `json:"arch"`
+	Variant string `json:"variant,omitempty"`
+}
+
+// Like "linux/amd64" or "linux/amd64/musl".
+func (t Tuple) String() string {
+	s := t.Os + "/" + t.Arch
+	if t.Variant != "" {
+		s += "/" + t.Variant
+	}
+	return s
+}
+
+// Parses os, arch and variant from a file name, empty fields are unknown.
+func Parse(name string) Tuple {
+	t := Tuple{Os: ParsePlatform(name), Arch: ParseArch(name)}
+	t.Variant = ParseVariant(name, t.Os)
+	return t
+}
+
+/*
+Canonical os of a single value, like "osx" or "Windows" from an api field, unknown values are returned lower cased.
+Unlike ParsePlatform, values are not searched for parts, so "darwin-arm64" is no os.
+*/
+func CanonicalOs(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if os, ok := PlatformMap[s]; ok {
+		return os
+	}
+	if os, ok := ArchOSs[s]; ok {
+		return os
+	}
+	return s
+}
+
+// Canonical arch of a single value, like "x86_64" or "aarch64", unknown values are returned lower cased.
+func CanonicalArch(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if arch, ok := ArchMap[s]; ok {
+		return arch
+	}
+	if arch, ok := ArchOSs[s]; ok {
+		return arch
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+// File names of real downloads and what gvc must make of them.
+var parseTests = []struct {
+	name string
+	want Tuple
+}{
+	{"go1.22.0.linux-amd64.tar.gz", Tuple{Os: Linux, Arch: X64}},
+	{"go1.22.0.darwin-arm64.tar.gz", Tuple{Os: MacOS, Arch: "arm64"}},
+	{"go1.22.0.windows-386.zip", Tuple{Os: Windows, Arch: "386"}},
+	{"go1.22.0.linux-ppc64le.tar.gz", Tuple{Os: Linux, Arch: "ppc64le"}},
+	{"go1.22.0.linux-ppc64.tar.gz", Tuple{Os: Linux, Arch: "ppc64"}},
+	{"go1.22.0.linux-s390x.tar.gz", Tuple{Os: Linux, Arch: "s390x"}},
+	{"go1.22.0.linux-loong64.tar.gz", Tuple{Os: Linux, Arch: "loong64"}},
+	{"go1.22.0.linux-mips64le.tar.gz", Tuple{Os: Linux, Arch: "mips64le"}},
+	{"go1.22.0.freebsd-amd64.tar.gz", Tuple{Os: "freebsd", Arch: X64}},
+	{"node-v20.0.0-osx-arm64.tar.gz", Tuple{Os: MacOS, Arch: "arm64"}},
+	{"node-v20.0.0-win-x64.zip", Tuple{Os: Windows, Arch: X64}},
+	{"node-v20.0.0-linux-armv7l.tar.xz", Tuple{Os: Linux, Arch: "arm"}},
+	{"node-v20.0.0-aix-ppc64.tar.gz", Tuple{Os: "aix", Arch: "ppc64"}},
+	{"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz", Tuple{Os: Linux, Arch: X64, Variant: VariantMusl}},
+	{"ripgrep-14.1.0-aarch64-unknown-linux-gnu.tar.gz", Tuple{Os: Linux, Arch: "arm64", Variant: VariantGlibc}},
+	{"ripgrep-14.1.0-x86_64-pc-windows-msvc.zip", Tuple{Os: Windows, Arch: X64, Variant: VariantMsvc}},
+	{"ripgrep-14.1.0-x86_64-pc-windows-gnu.zip", Tuple{Os: Windows, Arch: X64, Variant: VariantMingw}},
+	{"ripgrep-14.1.0-x86_64-apple-darwin.tar.gz", Tuple{Os: MacOS, Arch: X64}},
+	{"zig-linux-x86_64-0.11.0.tar.xz", Tuple{Os: Linux, Arch: X64}},
+	{"zig-macos-aarch64-0.11.0.tar.xz", Tuple{Os: MacOS, Arch: "arm64"}},
+	{"zig-linux-riscv64-0.11.0.tar.xz", Tuple{Os: Linux, Arch: "riscv64"}},
+	{"julia-1.10.0-linux-i686.tar.gz", Tuple{Os: Linux, Arch: "386"}},
+	{"julia-1.10.0-win64.zip", Tuple{Os: Windows, Arch: X64}},
+	{"julia-1.10.0-win32.zip", Tuple{Os: Windows, Arch: "386"}},
+	{"julia-1.10.0-macaarch64.dmg", Tuple{Os: MacOS, Arch: "arm64"}},
+	{"python-3.12.0-amd64.exe", Tuple{Arch: X64}},
+	{"python-3.12.0-macos11.pkg", Tuple{Os: MacOS}},
+	{"VSCode-win32-arm64.zip", Tuple{Os: Windows, Arch: "arm64"}},
+	{"VSCode-win32-x64.zip", Tuple{Os: Windows, Arch: X64}},
+	{"VSCode-darwin-universal.zip", Tuple{Os: MacOS, Arch: "universal", Variant: VariantUniversal}},
+	{"OpenJDK21U-jdk_x64_linux_hotspot_21.0.1_12.tar.gz", Tuple{Os: Linux, Arch: X64}},
+	{"OpenJDK21U-jdk_aarch64_mac_hotspot_21.0.1_12.tar.gz", Tuple{Os: MacOS, Arch: "arm64"}},
+	{"OpenJDK21U-jdk_ppc64le_linux_hotspot_21.0.1_12.tar.gz", Tuple{Os: Linux, Arch: "ppc64le"}},
+	{"protoc-25.1-linux-aarch_64.zip", Tuple{Os: Linux, Arch: "arm64"}},
+	{"protoc-25.1-linux-s390_64.zip", Tuple{Os: Linux, Arch: "s390x"}},
+	{"protoc-25.1-linux-ppcle_64.zip", Tuple{Os: Linux, Arch: "ppc64le"}},
+	{"kubectl-linux-mipsel", Tuple{Os: Linux, Arch: "mipsle"}},
+	{"tool-linux-mips64el.tar.gz", Tuple{Os: Linux, Arch: "mips64le"}},
+	{"tool-linux-loongarch64.tar.gz", Tuple{Os: Linux, Arch: "loong64"}},
+	{"tool-linux-armhf.deb", Tuple{Os: Linux, Arch: "arm"}},
+	{"tool-x86_64-linux-static.tar.gz", Tuple{Os: Linux, Arch: X64, Variant: VariantStatic}},
+	{"tool-x86_64-linux-alpine.tar.gz", Tuple{Os: Linux, Arch: X64, Variant: VariantMusl}},
+	{"tool-x86_64-windows-mingw.zip", Tuple{Os: Windows, Arch: X64, Variant: VariantMingw}},
+	{"TOOL-LINUX-X86_64.TAR.GZ", Tuple{Os: Linux, Arch: X64}},
+	{"https://example.com/releases/v1.0.0/tool-linux-amd64.tar.gz", Tuple{Os: Linux, Arch: X64}},
+	{"tool-src.tar.gz", Tuple{}},
+	{"", Tuple{}},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range parseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.name); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArch(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		// longer parts win over the parts they contain.
+		{"ppc64le", "ppc64le"},
+		{"powerpc64le", "ppc64le"},
+		{"powerpc64", "ppc64"},
+		{"x86_64", X64},
+		{"x86-64", X64},
+		{"x86", "386"},
+		{"mips64el", "mips64le"},
+		{"mips64", "mips64"},
+		{"mipsle", "mipsle"},
+		{"win32-x64", X64},
+		{"win32-arm64", "arm64"},
+		{"win32", "386"},
+		{"64-bit", X64},
+		{"32-bit", "386"},
+		{"arm32", "arm"},
+		{"armv6l", "arm"},
+		{"AARCH64", "arm64"},
+		{"sparc", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseArch(tt.name); got != tt.want {
+			t.Errorf("ParseArch(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"darwin", MacOS},
+		// "darwin" contains "win".
+		{"tool-darwin-amd64", MacOS},
+		{"macosx", MacOS},
+		{"apple", MacOS},
+		{"osx", MacOS},
+		{"mac", MacOS},
+		{"winnt", Windows},
+		{"win", Windows},
+		{"Windows", Windows},
+		{"linux", Linux},
+		{"freebsd", "freebsd"},
+		{"aix", "aix"},
+		{"solaris", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ParsePlatform(tt.name); got != tt.want {
+			t.Errorf("ParsePlatform(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		name string
+		os   string
+		want string
+	}{
+		{"tool-x86_64-unknown-linux-gnu.tar.gz", Linux, VariantGlibc},
+		{"tool-x86_64-pc-windows-gnu.zip", Windows, VariantMingw},
+		{"tool_windows_gnu.zip", Windows, VariantMingw},
+		{"tool-linux-glibc2.17.tar.gz", Linux, VariantGlibc},
+		{"tool-x86_64-unknown-linux-musl.tar.gz", Linux, VariantMusl},
+		{"tool-alpine-x64.tar.gz", Linux, VariantMusl},
+		{"tool-x86_64-pc-windows-msvc.zip", Windows, VariantMsvc},
+		{"tool-macos-universal.tar.gz", MacOS, VariantUniversal},
+		{"tool-linux-amd64.tar.gz", Linux, ""},
+	}
+	for _, tt := range tests {
+		if got := ParseVariant(tt.name, tt.os); got != tt.want {
+			t.Errorf("ParseVariant(%q, %q) = %q, want %q", tt.name, tt.os, got, tt.want)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	osTests := []struct{ in, want string }{
+		{"osx", MacOS},
+		{" Windows ", Windows},
+		{"macOS", MacOS},
+		{"linux", Linux},
+		{"darwin-arm64", "darwin-arm64"},
+		{"Plan9", "plan9"},
+	}
+	for _, tt := range osTests {
+		if got := CanonicalOs(tt.in); got != tt.want {
+			t.Errorf("CanonicalOs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	archTests := []struct{ in, want string }{
+		{"x86_64", X64},
+		{"AARCH64", "arm64"},
+		{"i386", "386"},
+		{"linux64", X64},
+		{"x86_64-linux", "x86_64-linux"},
+		{"Sparc64", "sparc64"},
+	}
+	for _, tt := range archTests {
+		if got := CanonicalArch(tt.in); got != tt.want {
+			t.Errorf("CanonicalArch(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMapArchAndOS(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"x86-64", X64},
+		{"MacOS", MacOS},
+		{"OS X 10.8+", MacOS},
+		{"Unknown", "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := MapArchAndOS(tt.in); got != tt.want {
+			t.Errorf("MapArchAndOS(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func values(m map[string]string) map[string]bool {
+	r := map[string]bool{"": true}
+	for _, v := range m {
+		r[v] = true
+	}
+	return r
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// File names come from release pages, parsing any of them gives known values only, whatever the case.
+func FuzzParse(f *testing.F) {
+	for _, tt := range parseTests {
+		f.Add(tt.name)
+	}
+	arches, oses := values(ArchMap), values(PlatformMap)
+	variants := map[string]bool{"": true, VariantMusl: true, VariantGlibc: true, VariantMsvc: true,
+		VariantMingw: true, VariantStatic: true, VariantUniversal: true}
+	f.Fuzz(func(t *testing.T, name string) {
+		got := Parse(name)
+		if !arches[got.Arch] || !oses[got.Os] || !variants[got.Variant] {
+			t.Fatalf("Parse(%q) = %s, unknown values", name, got)
+		}
+		if isASCII(name) {
+			if upper := Parse(strings.ToUpper(name)); upper != got {
+				t.Fatalf("Parse(%q) = %s, but %s in upper case", name, got, upper)
+			}
+		}
+	})
+}
+
+// Canonical values stay as they are.
+func FuzzCanonical(f *testing.F) {
+	for _, s := range []string{"osx", " Windows ", "x86_64", "AARCH64", "win32", "linux64", "universal", ""} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if os := CanonicalOs(s); CanonicalOs(os) != os {
+			t.Fatalf("CanonicalOs(%q) = %q, but CanonicalOs(%q) = %q", s, os, os, CanonicalOs(os))
+		}
+		if arch := CanonicalArch(s); CanonicalArch(arch) != arch {
+			t.Fatalf("CanonicalArch(%q) = %q, but CanonicalArch(%q) = %q", s, arch, arch, CanonicalArch(arch))
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gvcgo/goutils/pkgs/gtea/bar"
+)
+
+/*
+Progress of a run: a bar from gtea with done/total counts, failures and the elapsed time,
+fed by collectors and subscription batches, and a table of their timings at the end.
+
+The bar is drawn only on terminals, see Start, timings are kept either way.
+Keyboard and signals are left to the run, so Ctrl-C still cancels it.
+*/
+
+type Timing struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed,omitempty"`
+}
+
+type Tracker struct {
+	lock    *sync.Mutex
+	bar     *bar.OrdinaryBar
+	done    chan struct{}
+	total   int
+	started map[string]time.Time
+	timings []*Timing
+}
+
+var (
+	currentLock = &sync.Mutex{}
+	current     *Tracker
+)
+
+/*
+Starts tracking a run, the bar is drawn to out, nil only keeps timings.
+Stop the previous tracker first.
+*/
+func Start(title string, out io.Writer) (t *Tracker) {
+	t = &Tracker{lock: &sync.Mutex{}, started: map[string]time.Time{}}
+	if out != nil {
+		t.bar = bar.NewOrdinaryBar(bar.WithTitle(title), bar.WithDefaultGradient(), bar.WithWidth(60))
+		t.bar.SetProgramOpts(tea.WithOutput(out), tea.WithInput(nil), tea.WithoutSignalHandler())
+		t.bar.EnableSucceeded()
+	}
+	currentLock.Lock()
+	current = t
+	currentLock.Unlock()
+	return
+}
+
+// Tracker of the current run, a tracker that only keeps timings when no run is tracked.
+func Current() *Tracker {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	if current == nil {
+		current = &Tracker{lock: &sync.Mutex{}, started: map[string]time.Time{}}
+	}
+	return current
+}
+
+// Adds n tasks to the total, the bar starts with the first ones.
+func (t *Tracker) AddTotal(n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.total += n
+	if t.bar == nil {
+		return
+	}
+	t.bar.SetTotal(int64(t.total))
+	if t.done == nil && t.total > 0 {
+		t.done = make(chan struct{})
+		go func() {
+			defer close(t.done)
+			t.bar.Run()
+		}()
+	}
+}
+
+func (t *Tracker) Begin(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.started[name] = time.Now()
+}
+
+// Ends a task started by Begin.
+func (t *Tracker) End(name string, failed bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	start, ok := t.started[name]
+	if !ok {
+		return
+	}
+	delete(t.started, name)
+	t.timings = append(t.timings, &Timing{Name: name, Duration: time.Since(start), Failed: failed})
+	if t.bar != nil {
+		succeeded := 1
+		if failed {
+			succeeded = 0
+		}
+		t.bar.Add(1, succeeded)
+	}
+}
+
+// Stops the bar, it is left as it is when tasks are not done, like canceled runs.
+func (t *Tracker) Stop() {
+	t.lock.Lock()
+	done := t.done
+	b := t.bar
+	t.lock.Unlock()
+	if done == nil {
+		return
+	}
+	b.Program.Quit()
+	<-done
+}
+
+// Timings of ended tasks, slowest first.
+func (t *Tracker) Timings() []*Timing {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	r := append([]*Timing{}, t.timings...)
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Duration > r[j].Duration })
+	return r
+}
+
+// Prints the timing table of a run.
+func (t *Tracker) PrintTable(w io.Writer) {
+	timings := t.Timings()
+	if len(timings) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tTIME\tRESULT")
+	for _, tm := range timings {
+		result := "ok"
+		if tm.Failed {
+			result = "failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", tm.Name, tm.Duration.Round(time.Millisecond), result)
+	}
+	tw.Flush()
+}
@@ -2,4 +2,4 @@
 
 export GOOS="linux"
 export GOARCH="s390x"
-go build -ldflags "-s -w" -o pxyc .
+go build -ldflags "-s -w -X main.Version=${VERSION:-dev}" -o pxyc .
@@ -1,14 +1,34 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/gvcgo/collector/pkgs/cache"
+	"github.com/gvcgo/collector/pkgs/clean"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/doctor"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/history"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/notify"
+	"github.com/gvcgo/collector/pkgs/progress"
 	"github.com/gvcgo/collector/pkgs/sites"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/versions"
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 type IVersion interface {
@@ -24,16 +44,69 @@ type App struct {
 	rootCmd *cobra.Command
 	runner  *SiteRunner
 	cnf     *confs.CollectorConf
+	cancel  context.CancelFunc
 }
 
 func NewApp() (a *App) {
+	// config flags are applied before config.json is loaded.
+	unknownKeys := confs.ConfArgsToEnv(os.Args[1:])
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		// config commands never prompt.
+		os.Setenv(confs.NonInteractiveEnvName, "true")
+	}
 	cnf := confs.NewCollectorConf()
+	logs.Setup(&logs.Options{Level: cnf.LogLevel, Format: cnf.LogFormat, Redact: confs.Redact})
+	if len(unknownKeys) > 0 {
+		logs.Error("Unknown config keys for --%s: %s, see pxy config show.", confs.ConfSetFlag, strings.Join(unknownKeys, ", "))
+		confs.Exit(confs.ConfigErrorExitCode)
+	}
+	trace.Setup(cnf.OtlpEndpoint, cnf.OtlpHeaders)
+	// Ctrl-C cancels the run.
+	ctx, cancel := confs.SignalContext()
+	cnf.SetContext(ctx)
 	a = &App{
-		rootCmd: &cobra.Command{},
-		runner:  NewSiteRunner(cnf),
-		cnf:     cnf,
+		rootCmd: &cobra.Command{
+			Use:     "pxy",
+			Short:   "Collects proxies and version lists for gvc, and publishes them.",
+			Version: Version,
+		},
+		runner: NewSiteRunner(cnf),
+		cnf:    cnf,
+		cancel: cancel,
 	}
 	a.rootCmd.AddGroup(&cobra.Group{ID: AppGroupID, Title: "Proxy Collector Commands: "})
+	a.rootCmd.PersistentFlags().StringArray(confs.ConfSetFlag, nil, "Overrides a field of config.json, like --set proxy_uri=http://127.0.0.1:2023, env vars are PXY_<KEY>. Repeatable.")
+	// applied by ConfArgsToEnv, kept for scripts.
+	for _, f := range confs.ConfFields() {
+		a.rootCmd.PersistentFlags().String(f.Flag, "", "")
+		a.rootCmd.PersistentFlags().MarkDeprecated(f.Flag, fmt.Sprintf("use %s instead", f.SetHint()))
+	}
+	a.rootCmd.PersistentFlags().String("profile", "", fmt.Sprintf("Profile to use, env: %s.", confs.ProfileEnvName))
+	a.rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Logs debug messages, like --set log_level=debug.")
+	a.rootCmd.PersistentFlags().Bool("dry-run", false, "Fetches and processes everything, but uploads nothing and keeps local state, prints diffs instead.")
+	a.rootCmd.PersistentFlags().StringP("output", "o", OutputText, "Output format, text or json. With json, logs go to stderr.")
+	a.rootCmd.PersistentFlags().Bool("no-progress", false, "Draws no progress bar on terminals.")
+	a.rootCmd.PersistentFlags().StringSlice("debug-http", nil, "Logs requests to these hosts and their subdomains, with headers, status and timing.")
+	a.rootCmd.PersistentFlags().Bool("debug-http-bodies", false, fmt.Sprintf("Saves bodies of requests logged by --debug-http into %s in the work dir.", fetch.DebugHttpDirName))
+	a.rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if ok, _ := cmd.Flags().GetBool("verbose"); ok {
+			logs.SetLevel(slog.LevelDebug)
+		}
+		if jsonOutput(cmd) {
+			logs.UseStderr()
+		}
+		if ok, _ := cmd.Flags().GetBool("dry-run"); ok {
+			os.Setenv(confs.UploadModeEnvName, confs.UploadModeDryRun)
+		}
+		if hosts, _ := cmd.Flags().GetStringSlice("debug-http"); len(hosts) > 0 {
+			bodyDir := ""
+			if ok, _ := cmd.Flags().GetBool("debug-http-bodies"); ok {
+				bodyDir = filepath.Join(cnf.DirPath(), fetch.DebugHttpDirName)
+			}
+			fetch.SetDebugHttp(hosts, bodyDir)
+		}
+	}
+	a.rootCmd.PersistentFlags().String("work-dir", "", fmt.Sprintf("Work dir for config and outputs, env: %s.", confs.WorkDirEnvName))
 	a.initiate()
 	return
 }
@@ -59,8 +132,39 @@ func (a *App) initiate() {
 		},
 	})
 
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "remove-domain",
+		Aliases: []string{"rd"},
+		GroupID: AppGroupID,
+		Short:   "Removes rawDomains from rawDomain list.",
+		Run: func(cmd *cobra.Command, args []string) {
+			a.cnf.RemoveRawDomains(args...)
+		},
+	})
+
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "remove-subscribedUrls",
+		Aliases: []string{"rs"},
+		GroupID: AppGroupID,
+		Short:   "Removes urls from subscribedUrl list.",
+		Run: func(cmd *cobra.Command, args []string) {
+			a.cnf.RemoveSubs(args...)
+		},
+	})
+
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "dedup-lists",
+		Aliases: []string{"dl"},
+		GroupID: AppGroupID,
+		Short:   "Removes duplicated items in subscribedUrl and rawDomain lists.",
+		Run: func(cmd *cobra.Command, args []string) {
+			a.cnf.DedupLists()
+		},
+	})
+
 	enableJsdelivr := "jsdelivr"
 	enableProxy := "proxy"
+	localOnly := "local"
 	getProxiesCmd := &cobra.Command{
 		Use:     "get-proxies",
 		Aliases: []string{"gp"},
@@ -73,6 +177,13 @@ func (a *App) initiate() {
 			if eProxy, _ := cmd.Flags().GetBool(enableProxy); eProxy {
 				os.Setenv(confs.ToEnableProxyEnvName, "true")
 			}
+			setUploadMode(cmd, localOnly)
+			defer a.startRun(cmd)()
+			if err := a.cnf.ValidateProxy(); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			upload.RefreshRemoteConfig(a.cnf)
 			if a.runner != nil {
 				a.runner.AddSite(sites.NewSubVPN(a.cnf))
 				a.runner.AddSite(sites.NewFreeFQVPN(a.cnf))
@@ -82,6 +193,7 @@ func (a *App) initiate() {
 	}
 	getProxiesCmd.Flags().BoolP(enableJsdelivr, "j", true, "Enables jsdelivr CDN.")
 	getProxiesCmd.Flags().BoolP(enableProxy, "p", false, "Enables proxy.")
+	getProxiesCmd.Flags().Bool(localOnly, false, "Keeps outputs in the work dir only.")
 	a.rootCmd.AddCommand(getProxiesCmd)
 
 	getEDomains := &cobra.Command{
@@ -93,6 +205,13 @@ func (a *App) initiate() {
 			if eProxy, _ := cmd.Flags().GetBool(enableProxy); eProxy {
 				os.Setenv(confs.ToEnableProxyEnvName, "true")
 			}
+			setUploadMode(cmd, localOnly)
+			defer a.startRun(cmd)()
+			if err := a.cnf.ValidateProxy(); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			upload.RefreshRemoteConfig(a.cnf)
 			if a.runner != nil {
 				a.runner.AddSite(sites.NewEDCollector(a.cnf))
 				a.runner.AddSite(sites.NewEDomains(a.cnf))
@@ -101,6 +220,7 @@ func (a *App) initiate() {
 		},
 	}
 	getEDomains.Flags().BoolP(enableProxy, "p", false, "Enables proxy.")
+	getEDomains.Flags().Bool(localOnly, false, "Keeps outputs in the work dir only.")
 	a.rootCmd.AddCommand(getEDomains)
 
 	a.rootCmd.AddCommand(&cobra.Command{
@@ -109,6 +229,10 @@ func (a *App) initiate() {
 		GroupID: AppGroupID,
 		Short:   "Shows rawDomain list.",
 		Run: func(cmd *cobra.Command, args []string) {
+			if jsonOutput(cmd) {
+				printJson(a.cnf.GetRawDomains())
+				return
+			}
 			a.cnf.ShowRawDomains()
 		},
 	})
@@ -119,6 +243,10 @@ func (a *App) initiate() {
 		GroupID: AppGroupID,
 		Short:   "Shows subscribed urls.",
 		Run: func(cmd *cobra.Command, args []string) {
+			if jsonOutput(cmd) {
+				printJson(a.cnf.GetSubscribers())
+				return
+			}
 			a.cnf.ShowSubs()
 		},
 	})
@@ -133,15 +261,26 @@ func (a *App) initiate() {
 		},
 	})
 
-	a.rootCmd.AddCommand(&cobra.Command{
+	noOverlap := "no-overlap"
+	resetKeyCmd := &cobra.Command{
 		Use:     "reset-cryptokey",
 		Aliases: []string{"rk"},
 		GroupID: AppGroupID,
 		Short:   "Resets cryptoKey.",
+		Long:    "Rotates cryptoKey, conf.txt keeps the old key for KeyOverlap while conf.new.txt uses the new key.",
 		Run: func(cmd *cobra.Command, args []string) {
+			if skip, _ := cmd.Flags().GetBool(noOverlap); skip {
+				if err := a.cnf.RotateCryptoKey(false); err != nil {
+					logs.Error("%+v", err)
+					confs.Fail(confs.FailConfig)
+				}
+				return
+			}
 			a.cnf.ResetCryptoKey()
 		},
-	})
+	}
+	resetKeyCmd.Flags().Bool(noOverlap, false, "Retires the old key immediately.")
+	a.rootCmd.AddCommand(resetKeyCmd)
 
 	a.rootCmd.AddCommand(&cobra.Command{
 		Use:     "set-localproxy",
@@ -173,63 +312,676 @@ func (a *App) initiate() {
 		},
 	})
 
-	a.rootCmd.AddCommand(&cobra.Command{
+	versionFetchCmd := &cobra.Command{
 		Use:     "version-fetch",
 		Aliases: []string{"vf"},
 		GroupID: AppGroupID,
 		Short:   "Get version list for gvc.",
 		Run: func(cmd *cobra.Command, args []string) {
-			verList := []IVersion{}
-			// github
-			verList = append(verList, versions.NewGithubRepo(a.cnf))
-			// installers
-			verList = append(verList, versions.NewInstaller(a.cnf))
-			// flutter
-			fmt.Println("flutter...")
-			verList = append(verList, versions.NewFlutter(a.cnf))
-			// golang
-			fmt.Println("golang...")
-			verList = append(verList, versions.NewGolang(a.cnf))
-			// gradle
-			fmt.Println("gradle...")
-			verList = append(verList, versions.NewGradle(a.cnf))
-
-			// java
-			fmt.Println("java...")
-			// verList = append(verList, versions.NewJDK(a.cnf))
-			verList = append(verList, versions.NewAdoptiumJDK(a.cnf)) // full list.
-			// julia
-			fmt.Println("julia...")
-			verList = append(verList, versions.NewJulia(a.cnf))
-			// maven
-			fmt.Println("maven...")
-			verList = append(verList, versions.NewMaven(a.cnf))
-			// nodejs
-			fmt.Println("nodejs...")
-			verList = append(verList, versions.NewNodejs(a.cnf))
-			// php: see github.
-			// fmt.Println("php...")
-			// verList = append(verList, versions.NewPhP(a.cnf))
-			// python
-			fmt.Println("python...")
-			verList = append(verList, versions.NewPython(a.cnf))
-			// zig
-			fmt.Println("zig...")
-			verList = append(verList, versions.NewZig(a.cnf))
-			// kubectl
-			fmt.Println("kubectl...")
-			verList = append(verList, versions.NewKubectl(a.cnf))
-
-			for _, ver := range verList {
-				ver.FetchAll()
-				ver.Upload()
+			setUploadMode(cmd, localOnly)
+			defer a.startRun(cmd)()
+			if err := a.cnf.ValidateProxy(); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			upload.RefreshRemoteConfig(a.cnf)
+			versions.LoadRules(a.cnf)
+			versions.LoadPlugins(a.cnf)
+			verList := map[string]IVersion{}
+			names := versions.EnabledCollectors(a.cnf)
+			if only, _ := cmd.Flags().GetStringSlice("only"); len(only) > 0 {
+				if names = selectCollectors(only); len(names) == 0 {
+					confs.Exit(confs.ConfigErrorExitCode)
+				}
+			}
+			// collectors are enabled and configured in the Collectors section of config.json.
+			for _, name := range names {
+				logs.For(name).Debug("created")
+				verList[name] = versions.NewCollector(name, a.cnf)
+			}
+
+			// collectors fetch concurrently, uploads run in another pool.
+			fetchPool := upload.NewPool(a.cnf.FetchWorkers)
+			pool := upload.NewPool(a.cnf.UploadWorkers)
+			tracker := progress.Current()
+			tracker.AddTotal(len(names))
+			for _, name := range names {
+				name, ver := name, verList[name]
+				fetchPool.Go(func() {
+					if a.cnf.Canceled() {
+						return
+					}
+					log, start := logs.For(name), time.Now()
+					log.Info("Fetching...")
+					tracker.Begin(name)
+					_, span := trace.Start(a.cnf.Context(), "collector.fetch", "collector", name)
+					err := versions.Isolate(name, "fetch", ver.FetchAll)
+					span.Fail(err)
+					span.End()
+					if err != nil {
+						a.failCollector(name, err)
+						tracker.End(name, true)
+						return
+					}
+					// results of a canceled collector are incomplete.
+					if a.cnf.Canceled() {
+						metrics.CollectorSuccess.Set(0, name)
+						notify.Current().FailCollector(name, "canceled")
+						log.Warning("Canceled, not uploaded.")
+						tracker.End(name, true)
+						return
+					}
+					log.Debug("Fetched in %s.", time.Since(start).Round(time.Millisecond))
+					metrics.CollectorDuration.Set(time.Since(start).Seconds(), name)
+					notify.Current().SetCollectorDuration(name, time.Since(start))
+					// set to 0 on upload when a version file gets nothing.
+					metrics.CollectorSuccess.Set(1, name)
+					pool.Go(func() {
+						_, span := trace.Start(a.cnf.Context(), "collector.upload", "collector", name)
+						defer span.End()
+						if err := versions.Isolate(name, "upload", ver.Upload); err != nil {
+							span.Fail(err)
+							a.failCollector(name, err)
+							tracker.End(name, true)
+							return
+						}
+						tracker.End(name, false)
+						log.Debug("Done in %s.", time.Since(start).Round(time.Millisecond))
+					})
+				})
+			}
+			fetchPool.Wait()
+			pool.Wait()
+			up := upload.NewUploader(a.cnf)
+			// all-in-one bundle.
+			if a.cnf.Canceled() {
+				logs.Warning("Canceled, the bundle is not updated.")
+			} else if fPath := versions.BuildBundle(a.cnf); fPath != "" {
+				up.Upload(fPath)
+			}
+			up.UploadManifest()
+		},
+	}
+	versionFetchCmd.Flags().Bool(localOnly, false, "Keeps outputs in the work dir only.")
+	versionFetchCmd.Flags().StringSlice("only", nil, "Collectors to run, like golang,nodejs, even disabled ones. All enabled collectors by default.")
+	a.rootCmd.AddCommand(versionFetchCmd)
+
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "collectors",
+		GroupID: AppGroupID,
+		Short:   "Lists version collectors.",
+		Run: func(cmd *cobra.Command, args []string) {
+			versions.LoadRules(a.cnf)
+			versions.LoadPlugins(a.cnf)
+			if jsonOutput(cmd) {
+				enabled := map[string]bool{}
+				for _, name := range versions.CollectorNames() {
+					enabled[name] = versions.IsCollectorEnabled(a.cnf, name)
+				}
+				printJson(enabled)
+				return
+			}
+			for _, name := range versions.CollectorNames() {
+				if versions.IsCollectorEnabled(a.cnf, name) {
+					fmt.Println(gprint.GreenStr("%s enabled", name))
+				} else {
+					fmt.Println(gprint.YellowStr("%s disabled", name))
+				}
+			}
+		},
+	})
+
+	fixturesCmd := &cobra.Command{
+		Use:     "fixtures",
+		GroupID: AppGroupID,
+		Short:   "Checks parsing of version collectors against recorded pages.",
+		Long:    "Example: pxy fixtures [name...], all collectors with fixtures in --dir by default, --record fetches live pages and saves them as the new fixtures.",
+		Run: func(cmd *cobra.Command, args []string) {
+			versions.LoadRules(a.cnf)
+			versions.LoadPlugins(a.cnf)
+			dir, _ := cmd.Flags().GetString("dir")
+			record, _ := cmd.Flags().GetBool("record")
+			names := args
+			if len(names) == 0 && !record {
+				names = versions.FixtureCollectors(dir)
+				if len(names) == 0 {
+					logs.Error("No fixtures in %s, record them with --record.", dir)
+					confs.Exit(1)
+				}
+			} else if len(names) == 0 {
+				names = versions.CollectorNames()
+			}
+			failed := versions.RunFixtures(a.cnf, dir, names, record)
+			if jsonOutput(cmd) {
+				printJson(map[string][]string{"failed": append([]string{}, failed...)})
+			}
+			if len(failed) > 0 {
+				logs.Error("Fixtures failed: %s", strings.Join(failed, ", "))
+				confs.Exit(1)
+			}
+		},
+	}
+	fixturesCmd.Flags().String("dir", versions.FixturesDirName, "Dir of fixtures.")
+	fixturesCmd.Flags().Bool("record", false, "Records fixtures from live pages.")
+	a.rootCmd.AddCommand(fixturesCmd)
+
+	rulesCmd := &cobra.Command{
+		Use:     "rules",
+		GroupID: AppGroupID,
+		Short:   "Loads rule files of declarative collectors and tries them.",
+		Long:    "Example: pxy rules [name...], --watch reloads and tries rule files when they change, until Ctrl-C.",
+		Run: func(cmd *cobra.Command, args []string) {
+			names := versions.LoadRules(a.cnf)
+			logs.Info("%d rules loaded from %s.", len(names), a.cnf.RulesPath())
+			if len(args) > 0 {
+				names = args
+			}
+			versions.TryRules(a.cnf, names)
+			if ok, _ := cmd.Flags().GetBool("watch"); ok {
+				versions.WatchRules(a.cnf, func(changed []string) {
+					versions.TryRules(a.cnf, changed)
+				})
+			}
+		},
+	}
+	rulesCmd.Flags().Bool("watch", false, "Reloads rule files when they change.")
+	rulesCmd.AddCommand(&cobra.Command{
+		Use:   "new [name]",
+		Short: "Walks through a new rule file: page or github repo, filters, versions and os/arch mappings.",
+		Long:  "Example: pxy rules new neovim, the rule is tried after each step and saved into RulesDir.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !confs.Interactive() {
+				logs.Error("pxy rules new needs a terminal.")
+				confs.Exit(1)
+			}
+			versions.LoadRules(a.cnf)
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			fPath, err := versions.RuleWizard(a.cnf, name, os.Stdin, confs.RawStdout())
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("Rule saved to %s, try it by pxy rules %s.", fPath, strings.TrimSuffix(filepath.Base(fPath), ".yaml"))
+		},
+	})
+	a.rootCmd.AddCommand(rulesCmd)
+
+	deadLinksCmd := &cobra.Command{
+		Use:     "dead-links",
+		GroupID: AppGroupID,
+		Short:   "Lists quarantined and dropped files of version collectors.",
+		Long:    "Example: pxy dead-links [url...], --clear removes the given links or all links, so they are checked again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			store := versions.DeadLinkStore(a.cnf)
+			if ok, _ := cmd.Flags().GetBool("clear"); ok {
+				var err error
+				if len(args) > 0 {
+					_, err = store.Remove(args...)
+				} else {
+					err = store.Update(func([]*versions.DeadLink) []*versions.DeadLink { return nil })
+				}
+				if err != nil {
+					logs.Error("%+v", err)
+					confs.Exit(1)
+				}
+				return
+			}
+			links, err := store.List()
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			if jsonOutput(cmd) {
+				printJson(append([]*versions.DeadLink{}, links...))
+				return
+			}
+			drop := versions.DeadLinkDrop(a.cnf)
+			for _, l := range links {
+				state := gprint.YellowStr("quarantined")
+				if l.Dropped(drop) {
+					state = gprint.RedStr("dropped")
+				}
+				fmt.Printf("%s %s %s(%d) x%d since %s\n", state, l.Collector, l.Url, l.Code, l.Failures, l.FirstSeen)
+			}
+		},
+	}
+	deadLinksCmd.Flags().Bool("clear", false, "Removes dead links.")
+	a.rootCmd.AddCommand(deadLinksCmd)
+
+	rollbackCmd := &cobra.Command{
+		Use:     "rollback",
+		Aliases: []string{"rb"},
+		GroupID: AppGroupID,
+		Short:   "Publishes a previous snapshot again.",
+		Long:    "Example: pxy rb [snapshot], the latest snapshot is used by default. Use --list to show snapshots.",
+		Run: func(cmd *cobra.Command, args []string) {
+			setUploadMode(cmd, localOnly)
+			up := upload.NewUploader(a.cnf)
+			if ok, _ := cmd.Flags().GetBool("list"); ok {
+				if jsonOutput(cmd) {
+					printJson(append([]string{}, up.ListSnapshots()...))
+					return
+				}
+				for _, s := range up.ListSnapshots() {
+					fmt.Println(s)
+				}
+				return
+			}
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			up.Rollback(name)
+		},
+	}
+	rollbackCmd.Flags().BoolP("list", "l", false, "Lists snapshots.")
+	rollbackCmd.Flags().Bool(localOnly, false, "Keeps outputs in the work dir only.")
+	a.rootCmd.AddCommand(rollbackCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:     "cache",
+		GroupID: AppGroupID,
+		Short:   "Shows the cache of checksums, HEAD results and GitHub API responses.",
+		Long:    "Example: pxy cache, --clear [bucket...] removes the given buckets or the whole cache.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if ok, _ := cmd.Flags().GetBool("clear"); ok {
+				if err := cache.Clear(a.cnf.CachePath(), args...); err != nil {
+					logs.Error("%+v", err)
+					confs.Exit(1)
+				}
+				return
+			}
+			if jsonOutput(cmd) {
+				printJson(append([]*cache.BucketInfo{}, cache.List(a.cnf.CachePath())...))
+				return
+			}
+			for _, b := range cache.List(a.cnf.CachePath()) {
+				fmt.Printf("%s: %d entries, %d expired, %.1fKB\n", b.Name, b.Entries, b.Expired, float64(b.Size)/1024)
+			}
+		},
+	}
+	cacheCmd.Flags().Bool("clear", false, "Removes cached entries.")
+	a.rootCmd.AddCommand(cacheCmd)
+
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "clean",
+		GroupID: AppGroupID,
+		Short:   "Prunes old logs, expired cache entries, old history and stale temp files in the work dir.",
+		Long:    "Example: pxy clean, pxy clean --dry-run lists what would be removed. Retention: RetainLogDays and RetainHistoryDays in config.",
+		Run: func(cmd *cobra.Command, args []string) {
+			unlock, err := a.cnf.LockWorkDir(a.commandName(cmd))
+			if err != nil {
+				logs.Error("%v", err)
+				confs.Exit(confs.BusyExitCode)
+			}
+			defer unlock()
+			r := clean.Run(a.cnf, confs.DryRun())
+			if jsonOutput(cmd) {
+				printJson(r)
+				return
+			}
+			counts, sizes, kinds := map[string]int{}, map[string]int64{}, []string{}
+			for _, item := range r.Items {
+				if _, ok := counts[item.Kind]; !ok {
+					kinds = append(kinds, item.Kind)
+				}
+				counts[item.Kind] += item.Count
+				sizes[item.Kind] += item.Size
+			}
+			for _, kind := range kinds {
+				fmt.Printf("%s: %d removed, %.1fMB\n", kind, counts[kind], float64(sizes[kind])/(1<<20))
+			}
+			if r.DryRun {
+				logs.Warning("Dry run, nothing was removed, %.1fMB would be freed.", float64(r.Freed)/(1<<20))
+			} else {
+				logs.Success("%.1fMB freed.", float64(r.Freed)/(1<<20))
+			}
+		},
+	})
+
+	doctorCmd := &cobra.Command{
+		Use:     "doctor",
+		GroupID: AppGroupID,
+		Short:   "Diagnoses proxy, DNS, storage credentials, disk space, clock skew and vendor endpoints.",
+		Long:    "Example: pxy doctor, pxy doctor --proxy checks through the proxy. Exits with 1 when a check fails.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if eProxy, _ := cmd.Flags().GetBool(enableProxy); eProxy {
+				os.Setenv(confs.ToEnableProxyEnvName, "true")
+			}
+			results := doctor.Run(a.cnf)
+			failed := 0
+			for _, r := range results {
+				if !r.OK {
+					failed++
+				}
+			}
+			if jsonOutput(cmd) {
+				printJson(results)
+			} else {
+				for _, r := range results {
+					if r.OK {
+						logs.Success("%s: %s", r.Name, r.Detail)
+						continue
+					}
+					logs.Error("%s: %s", r.Name, r.Detail)
+					fmt.Println(gprint.YellowStr("  fix: %s", r.Fix))
+				}
+			}
+			if failed > 0 {
+				confs.Exit(1)
+			}
+		},
+	}
+	doctorCmd.Flags().BoolP(enableProxy, "p", false, "Checks through the proxy.")
+	a.rootCmd.AddCommand(doctorCmd)
+
+	a.initConfigCmd()
+	a.initServeCmd()
+	a.initServiceCmd()
+	a.initLookupCmds()
+	a.initReleaseCmds()
+	a.initGroupCmds(versionFetchCmd, getProxiesCmd, getEDomains)
+
+	a.rootCmd.AddCommand(&cobra.Command{
+		Use:     "profiles",
+		GroupID: AppGroupID,
+		Short:   "Lists profiles, select one by --profile or env PXY_PROFILE.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if jsonOutput(cmd) {
+				printJson(map[string]any{"current": a.cnf.Profile(), "profiles": append([]string{}, confs.ListProfiles()...)})
+				return
+			}
+			for _, name := range confs.ListProfiles() {
+				if name == a.cnf.Profile() {
+					logs.Success("* %s", name)
+				} else {
+					fmt.Println("  " + name)
+				}
 			}
 		},
 	})
 }
 
+func (a *App) initConfigCmd() {
+	configCmd := &cobra.Command{
+		Use:     "config",
+		GroupID: AppGroupID,
+		Short:   "Sets up or validates config without prompts.",
+	}
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Sets up config, other fields can be set by --set key=value.",
+		Long:  "Example: pxy config init --type github --username X --token Y --repo Z",
+		Run: func(cmd *cobra.Command, args []string) {
+			typeName, _ := cmd.Flags().GetString("type")
+			sType, err := confs.ParseStorageType(typeName)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			username, _ := cmd.Flags().GetString("username")
+			token, _ := cmd.Flags().GetString("token")
+			repo, _ := cmd.Flags().GetString("repo")
+			if err := a.cnf.Init(sType, username, token, repo); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			logs.Success("Config saved.")
+		},
+	}
+	initCmd.Flags().String("type", "github", "Storage type: github, gitee, git, azure or gcs.")
+	initCmd.Flags().String("username", "", "Github/Gitee username.")
+	initCmd.Flags().String("token", "", "Github/Gitee access token.")
+	initCmd.Flags().String("repo", "", "Github/Gitee repo name.")
+	configCmd.AddCommand(initCmd)
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Checks token, repo and write permission.",
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := false
+			checks := upload.ValidateConf(a.cnf)
+			if jsonOutput(cmd) {
+				for _, c := range checks {
+					failed = failed || !c.OK
+				}
+				printJson(checks)
+				if failed {
+					confs.Exit(confs.ConfigErrorExitCode)
+				}
+				return
+			}
+			for _, c := range checks {
+				if c.OK {
+					logs.Success("%s: ok %s", c.Name, c.Detail)
+				} else {
+					failed = true
+					logs.Error("%s: %s", c.Name, c.Detail)
+				}
+			}
+			if failed {
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+		},
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "notify-preview",
+		Short: "Renders webhook messages of NotifyTemplates with the report of the last run.",
+		Run: func(cmd *cobra.Command, args []string) {
+			s, err := notify.LoadReport(a.cnf.DirPath())
+			if err != nil {
+				logs.Error("No report of a previous run: %+v", err)
+				confs.Exit(1)
+			}
+			rendered, err := notify.RenderTemplates(a.cnf, s)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(confs.ConfigErrorExitCode)
+			}
+			if len(rendered) == 0 {
+				logs.Info("No NotifyTemplates, the default message:")
+				fmt.Println(s.Text())
+				return
+			}
+			hookTypes := make([]string, 0, len(rendered))
+			for hookType := range rendered {
+				hookTypes = append(hookTypes, hookType)
+			}
+			sort.Strings(hookTypes)
+			for _, hookType := range hookTypes {
+				fmt.Println(gprint.CyanStr("--- %s", hookType))
+				fmt.Println(rendered[hookType])
+			}
+		},
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Shows the effective config, with flags, env vars and the profile applied, secrets redacted.",
+		Run: func(cmd *cobra.Command, args []string) {
+			fields := confs.ConfFields()
+			if jsonOutput(cmd) {
+				values := map[string]any{}
+				for _, f := range fields {
+					values[f.Name] = a.cnf.FieldValue(f)
+				}
+				printJson(values)
+				return
+			}
+			for _, f := range fields {
+				v := a.cnf.FieldValue(f)
+				if content, err := json.Marshal(v); err == nil {
+					fmt.Printf("%s: %s\n", f.Name, content)
+				}
+			}
+		},
+	})
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports config, secrets, lists and history into an encrypted archive.",
+		Long:  "Example: pxy config export pxy-state.enc",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			setArchivePassphrase(cmd)
+			if err := a.cnf.Export(args[0]); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("Exported to %s.", args[0])
+		},
+	}
+	exportCmd.Flags().String("passphrase", "", fmt.Sprintf("Passphrase of the archive, env: %s.", confs.ArchivePassphraseEnvName))
+	configCmd.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Imports an archive created by export.",
+		Long:  "Example: pxy config import pxy-state.enc",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Help()
+				return
+			}
+			setArchivePassphrase(cmd)
+			if err := a.cnf.Import(args[0]); err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+		},
+	}
+	importCmd.Flags().String("passphrase", "", fmt.Sprintf("Passphrase of the archive, env: %s.", confs.ArchivePassphraseEnvName))
+	configCmd.AddCommand(importCmd)
+	a.rootCmd.AddCommand(configCmd)
+}
+
+/*
+Starts a run of a command: logs also go to a file in the work dir, a new summary is started for the run report,
+and spans of the run are children of a run span. Call the returned func when the run ends.
+*/
+func (a *App) startRun(cmd *cobra.Command) (end func()) {
+	name := a.commandName(cmd)
+	unlock, err := a.cnf.LockWorkDir(name)
+	if err != nil {
+		logs.Error("%v", err)
+		confs.Exit(confs.BusyExitCode)
+	}
+	notify.Start(name)
+	logs.ResetErrors()
+	confs.ResetFailures()
+	if fPath := logs.OpenRunFile(a.cnf.DirPath(), name, a.cnf.LogFiles); fPath != "" {
+		logs.Debug("Logging to %s.", fPath)
+	}
+	if confs.DryRun() {
+		// outputs of the previous dry run are replaced.
+		os.RemoveAll(a.cnf.DryRunPath())
+		if err := os.MkdirAll(a.cnf.DryRunPath(), os.ModePerm); err != nil {
+			logs.Error("%+v", err)
+		}
+	}
+	var bar io.Writer
+	if a.showProgress(cmd) {
+		bar = confs.RawStdout()
+	}
+	tracker := progress.Start(name, bar)
+	fetch.ResetBandwidth()
+	if !a.cnf.CacheDisabled {
+		cache.Open(a.cnf.CachePath())
+	}
+	parent := a.cnf.Context()
+	ctx, span := trace.Start(parent, "run", "command", name)
+	a.cnf.SetContext(ctx)
+	endCancelable := a.cnf.StartCancelable()
+	return func() {
+		tracker.Stop()
+		if !jsonOutput(cmd) {
+			tracker.PrintTable(os.Stdout)
+		}
+		span.Set("canceled", a.cnf.Canceled())
+		span.End()
+		trace.Flush()
+		fetch.CloseIdle()
+		endCancelable()
+		cache.Close()
+		a.cnf.SetContext(parent)
+		if added := notify.Current().AddedVersions(); len(added) > 0 && confs.UploadMode() == "" {
+			err := history.Update(a.cnf.HistoryPath(), a.cnf.HistoryRetention(), func(db *history.DB) {
+				db.RecordVersions(added, time.Now())
+			})
+			if err != nil {
+				logs.Warning("Save history failed: %+v", err)
+			}
+		}
+		s := notify.Current()
+		s.Finish(logs.RunErrors())
+		s.SetFailure(a.failure())
+		if confs.UploadMode() == "" && !a.cnf.Canceled() {
+			// like webhooks, alerts are not sent by dry runs, local runs and canceled runs. upload retry may have nothing to publish.
+			notify.Alert(a.cnf, s, a.commandName(cmd) != "upload-retry")
+		}
+		if confs.DryRun() {
+			logs.Warning("Dry run, nothing was uploaded, outputs are in %s.", a.cnf.DryRunPath())
+		}
+		if jsonOutput(cmd) {
+			printJson(notify.Current())
+		}
+		logs.CloseRunFile()
+		unlock()
+	}
+}
+
+// Progress bars only go to terminals, and not with json output.
+func (a *App) showProgress(cmd *cobra.Command) bool {
+	if off, _ := cmd.Flags().GetBool("no-progress"); off || jsonOutput(cmd) {
+		return false
+	}
+	return term.IsTerminal(int(confs.RawStdout().Fd()))
+}
+
+// A collector panicked or exited, the run goes on and exits with CollectorFailedExitCode.
+func (a *App) failCollector(name string, err error) {
+	confs.Fail(confs.FailCollector)
+	metrics.CollectorSuccess.Set(0, name)
+	notify.Current().FailCollector(name, err.Error())
+}
+
+func setArchivePassphrase(cmd *cobra.Command) {
+	if p, _ := cmd.Flags().GetString("passphrase"); p != "" {
+		os.Setenv(confs.ArchivePassphraseEnvName, p)
+	}
+}
+
+// --local wins over the global --dry-run.
+func setUploadMode(cmd *cobra.Command, localOnly string) {
+	if ok, _ := cmd.Flags().GetBool(localOnly); ok {
+		os.Setenv(confs.UploadModeEnvName, confs.UploadModeLocal)
+	}
+}
+
 func (a *App) Run() {
 	if err := a.rootCmd.Execute(); err != nil {
-		gprint.PrintError("%+v", err)
+		logs.Error("%+v", err)
+	}
+	_, code := a.failure()
+	a.cancel()
+	if code != 0 {
+		confs.Exit(code)
+	}
+}
+
+// Failure class and exit code of the current run, see confs/exit.go.
+func (a *App) failure() (confs.FailureClass, int) {
+	if a.cnf.Canceled() {
+		return confs.FailCanceled, confs.CanceledExitCode
 	}
+	return confs.Failure()
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/versions"
+	"github.com/spf13/cobra"
+)
+
+/*
+Commands grouped by what they work on, like "pxy versions run" and "pxy proxies run",
+"pxy fetch golang jdk" runs collectors given as arguments.
+The flat commands, like version-fetch, are kept for scripts and cron jobs.
+Shell completion scripts come from "pxy completion bash|zsh|fish|powershell".
+*/
+
+// A subcommand that runs like cmd, with the same flags.
+func subcommand(use, short string, cmd *cobra.Command) *cobra.Command {
+	c := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  cmd.Long,
+		Run:   cmd.Run,
+	}
+	c.Flags().AddFlagSet(cmd.Flags())
+	return c
+}
+
+// Name of a command for run logs and reports, like version-fetch or versions-run.
+func (a *App) commandName(cmd *cobra.Command) string {
+	path := strings.TrimPrefix(cmd.CommandPath(), a.rootCmd.Name()+" ")
+	return strings.ReplaceAll(path, " ", "-")
+}
+
+// Registered collectors of names, unknown names are logged.
+func selectCollectors(names []string) (r []string) {
+	known := map[string]bool{}
+	for _, name := range versions.CollectorNames() {
+		known[name] = true
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if known[name] {
+			r = append(r, name)
+		} else {
+			logs.Error("Unknown collector: %s, see pxy collectors.", name)
+		}
+	}
+	return
+}
+
+func (a *App) initGroupCmds(versionFetchCmd, getProxiesCmd, testDomainsCmd *cobra.Command) {
+	versionsCmd := &cobra.Command{
+		Use:     "versions",
+		GroupID: AppGroupID,
+		Short:   "Version lists for gvc.",
+	}
+	runVersions := subcommand("run", "Collects and publishes version lists.", versionFetchCmd)
+	runVersions.Long = "Example: pxy versions run --only golang,nodejs --dry-run"
+	versionsCmd.AddCommand(runVersions)
+	a.rootCmd.AddCommand(versionsCmd)
+
+	// collectors as arguments, like pxy fetch golang jdk.
+	fetchCmd := subcommand("fetch [collector...]", "Collects and publishes version lists of collectors, all enabled ones by default.", versionFetchCmd)
+	fetchCmd.GroupID = AppGroupID
+	fetchCmd.Long = "Example: pxy fetch golang jdk installers --local, then pxy upload."
+	fetchCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return versions.CollectorNames(), cobra.ShellCompDirectiveNoFileComp
+	}
+	fetchCmd.Run = func(cmd *cobra.Command, args []string) {
+		if len(args) > 0 {
+			cmd.Flags().Set("only", strings.Join(args, ","))
+		}
+		versionFetchCmd.Run(cmd, args)
+	}
+	a.rootCmd.AddCommand(fetchCmd)
+
+	proxiesCmd := &cobra.Command{
+		Use:     "proxies",
+		GroupID: AppGroupID,
+		Short:   "Proxies and edgetunnel domains.",
+	}
+	proxiesCmd.AddCommand(subcommand("run", "Collects and publishes proxies.", getProxiesCmd))
+	proxiesCmd.AddCommand(subcommand("test-domains", "Tests domains for edgetunnels.", testDomainsCmd))
+	a.rootCmd.AddCommand(proxiesCmd)
+
+	uploadCmd := &cobra.Command{
+		Use:     "upload",
+		GroupID: AppGroupID,
+		Short:   "Uploads of collected files.",
+		Long:    "Example: pxy upload, merges version files kept in the work dir by pxy fetch --local with the published copies and uploads them.",
+		Run: func(cmd *cobra.Command, args []string) {
+			defer a.startRun(cmd)()
+			up := upload.NewUploader(a.cnf)
+			for _, fPath := range localVersionFiles(a.cnf) {
+				if !versions.UploadLocalFile(a.cnf, up, fPath) {
+					confs.Fail(confs.FailUpload)
+				}
+			}
+			if fPath := versions.BuildBundle(a.cnf); fPath != "" {
+				up.Upload(fPath)
+			}
+			up.UploadManifest()
+		},
+	}
+	uploadCmd.AddCommand(&cobra.Command{
+		Use:   "retry",
+		Short: "Uploads files whose uploads failed in previous runs again.",
+		Long:  "Example: pxy upload retry, exits with 5 when uploads fail again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			defer a.startRun(cmd)()
+			up := upload.NewUploader(a.cnf)
+			// files failing again are recorded by Upload, the run exits with UploadFailedExitCode.
+			up.RetryPending()
+			up.UploadManifest()
+		},
+	})
+	a.rootCmd.AddCommand(uploadCmd)
+}
+
+// Version files in the work dir, their exports are written again when they are uploaded.
+func localVersionFiles(cnf *confs.CollectorConf) (r []string) {
+	// the dry-run dir with --dry-run.
+	dir := cnf.OutputPath("")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), versions.VersionFileSuffix) {
+			continue
+		}
+		r = append(r, filepath.Join(dir, entry.Name()))
+	}
+	return
+}
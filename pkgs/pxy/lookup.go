@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/history"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/versions"
+	"github.com/spf13/cobra"
+)
+
+// Failed reads of published files are network errors, unknown tools and missing files are usage errors.
+func lookupExitCode(err error) int {
+	if errors.Is(err, versions.ErrReadPublished) {
+		return confs.NetworkErrorExitCode
+	}
+	return 1
+}
+
+// pxy list, pxy search, pxy export and pxy verify, queries of collected version files, and pxy stats over the history.
+func (a *App) initLookupCmds() {
+	listCmd := &cobra.Command{
+		Use:     "list <tool>",
+		GroupID: AppGroupID,
+		Short:   "Lists collected versions of a tool.",
+		Long:    "Example: pxy list go, --remote reads the published file.",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			remote, _ := cmd.Flags().GetBool("remote")
+			vs, err := versions.LoadVersions(a.cnf, args[0], remote)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(lookupExitCode(err))
+			}
+			if jsonOutput(cmd) {
+				printJson(vs)
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tFILES")
+			for _, vName := range vs.Names() {
+				fmt.Fprintf(w, "%s\t%d\n", vName, len(vs[vName]))
+			}
+			w.Flush()
+		},
+	}
+	listCmd.Flags().Bool("remote", false, "Reads the published file from the storage.")
+	a.rootCmd.AddCommand(listCmd)
+
+	searchCmd := &cobra.Command{
+		Use:     "search <tool>",
+		GroupID: AppGroupID,
+		Short:   "Searches collected files of a tool by os, arch and version.",
+		Long:    "Example: pxy search node --os darwin --arch arm64 --version 20, -o json prints json.",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			q := &versions.Query{Tool: args[0]}
+			q.Os, _ = cmd.Flags().GetString("os")
+			q.Arch, _ = cmd.Flags().GetString("arch")
+			q.Version, _ = cmd.Flags().GetString("version")
+			q.Remote, _ = cmd.Flags().GetBool("remote")
+			matches, err := versions.Search(a.cnf, q)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(lookupExitCode(err))
+			}
+			if jsonOutput(cmd) {
+				printJson(matches)
+				return
+			}
+			if len(matches) == 0 {
+				logs.Warning("Nothing found.")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tOS\tARCH\tURL")
+			for _, m := range matches {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Version, m.Os, m.Arch, m.Url)
+			}
+			w.Flush()
+		},
+	}
+	searchCmd.Flags().String("os", "", "Operating system, like linux, darwin or windows.")
+	searchCmd.Flags().String("arch", "", "Architecture, like amd64 or arm64.")
+	searchCmd.Flags().String("version", "", "Prefix of versions, like 1.22.")
+	searchCmd.Flags().Bool("remote", false, "Reads the published file from the storage.")
+	a.rootCmd.AddCommand(searchCmd)
+
+	exportCmd := &cobra.Command{
+		Use:     "export <tool>",
+		GroupID: AppGroupID,
+		Short:   "Prints collected versions of a tool for other version managers.",
+		Long:    "Example: pxy export go --format scoop, formats: " + strings.Join(versions.ExportFormats(), ", ") + ".",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString("format")
+			remote, _ := cmd.Flags().GetBool("remote")
+			vs, err := versions.LoadVersions(a.cnf, args[0], remote)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(lookupExitCode(err))
+			}
+			content, err := versions.Export(vs, args[0], format)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			if len(content) == 0 {
+				logs.Warning("Nothing to export.")
+				return
+			}
+			os.Stdout.Write(content)
+		},
+	}
+	exportCmd.Flags().String("format", versions.ExportAsdf, "Format, one of "+strings.Join(versions.ExportFormats(), ", ")+".")
+	exportCmd.Flags().Bool("remote", false, "Reads the published file from the storage.")
+	a.rootCmd.AddCommand(exportCmd)
+
+	verifyCmd := &cobra.Command{
+		Use:     "verify [tool...]",
+		GroupID: AppGroupID,
+		Short:   "Verifies published version files: schema, and a sample of urls.",
+		Long:    "Example: pxy verify, pxy verify go nodejs --sample 50. Exits with 1 when anything is broken.",
+		Run: func(cmd *cobra.Command, args []string) {
+			sample, _ := cmd.Flags().GetInt("sample")
+			report := versions.Verify(a.cnf, args, sample)
+			if jsonOutput(cmd) {
+				printJson(report)
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "FILE\tVERSION\tURL\tPROBLEM")
+				for _, b := range report.Broken {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.File, b.Version, b.Url, b.Problem)
+				}
+				w.Flush()
+				fmt.Printf("%d files, %d versions, %d urls checked, %d broken.\n",
+					report.Files, report.Versions, report.Checked, len(report.Broken))
+			}
+			if len(report.Broken) > 0 {
+				confs.Exit(1)
+			}
+		},
+	}
+	verifyCmd.Flags().Int("sample", 20, "Urls to check by HEAD requests, 0 checks none.")
+	a.rootCmd.AddCommand(verifyCmd)
+
+	statsCmd := &cobra.Command{
+		Use:     "stats",
+		GroupID: AppGroupID,
+		Short:   "Shows node survival per source, node lifetime per country and new versions per week.",
+		Long:    "Example: pxy stats --weeks 12, from the history of past runs in the work dir.",
+		Run: func(cmd *cobra.Command, args []string) {
+			weeks, _ := cmd.Flags().GetInt("weeks")
+			db, err := history.Load(a.cnf.HistoryPath())
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			st := db.Stats(weeks)
+			if jsonOutput(cmd) {
+				printJson(st)
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SOURCE\tNODES\tALIVE\tSURVIVAL")
+			for _, s := range st.Sources {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\n", s.Source, s.Nodes, s.Alive, s.Survival*100)
+			}
+			fmt.Fprintln(w, "\nCOUNTRY\tNODES\tAVG LIFETIME")
+			for _, c := range st.Countries {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", c.Country, c.Nodes, c.Lifetime.Round(time.Hour))
+			}
+			fmt.Fprintln(w, "\nTOOL\tWEEK\tADDED")
+			for _, v := range st.Versions {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", v.Tool, v.Week, v.Added)
+			}
+			w.Flush()
+		},
+	}
+	statsCmd.Flags().Int("weeks", 8, "Weeks of new versions to show.")
+	a.rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/spf13/cobra"
+)
+
+/*
+Output of commands, "text" for people or "json" for scripts, chosen by the global --output flag.
+With json, stdout only carries one json document per command, logs go to stderr as json lines.
+*/
+
+const (
+	OutputText string = "text"
+	OutputJson string = "json"
+)
+
+func jsonOutput(cmd *cobra.Command) bool {
+	output, _ := cmd.Flags().GetString("output")
+	return strings.EqualFold(output, OutputJson)
+}
+
+func printJson(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logs.Error("%+v", err)
+	}
+}
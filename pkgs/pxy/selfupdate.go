@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/spf13/cobra"
+)
+
+// Version of pxy, set by go build -ldflags "-X main.Version=v1.2.3".
+var Version = "dev"
+
+// Exit code of a failed release command, code unless the storage or the key is not configured or the binary is invalid.
+func releaseExitCode(err error, code int) int {
+	switch {
+	case errors.Is(err, upload.ErrNoStorage), errors.Is(err, upload.ErrInvalidReleaseKey):
+		return confs.ConfigErrorExitCode
+	case errors.Is(err, upload.ErrInvalidRelease):
+		return 1
+	}
+	return code
+}
+
+// pxy release publishes pxy itself into the storage repo, pxy self-update installs it.
+func (a *App) initReleaseCmds() {
+	releaseCmd := &cobra.Command{
+		Use:     "release",
+		GroupID: AppGroupID,
+		Short:   "Releases of pxy itself in the storage repo, for pxy self-update.",
+	}
+	publishCmd := &cobra.Command{
+		Use:   "publish <os/arch=binary>...",
+		Short: "Publishes pxy binaries, signed when ReleaseSigningKey is set.",
+		Long:  "Example: pxy release publish --version v1.2.0 linux/amd64=./pxy_linux windows/amd64=./pxy.exe",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			version, _ := cmd.Flags().GetString("version")
+			if version == "" {
+				logs.Error("--version is required.")
+				confs.Exit(1)
+			}
+			binaries := map[string]string{}
+			for _, arg := range args {
+				platform, fPath, ok := strings.Cut(arg, "=")
+				if !ok || !strings.Contains(platform, "/") {
+					logs.Error("Invalid binary %s, like linux/amd64=./pxy.", arg)
+					confs.Exit(1)
+				}
+				binaries[platform] = fPath
+			}
+			r, err := upload.NewUploader(a.cnf).PublishRelease(version, binaries)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(releaseExitCode(err, confs.UploadFailedExitCode))
+			}
+			if jsonOutput(cmd) {
+				printJson(r)
+				return
+			}
+			logs.Success("Release %s published, %d binaries.", r.Version, len(r.Assets))
+			if a.cnf.ReleaseSigningKey == "" {
+				logs.Warning("Binaries are not signed, set ReleaseSigningKey to sign them.")
+			}
+		},
+	}
+	publishCmd.Flags().String("version", "", "Version of the release, like v1.2.0.")
+	releaseCmd.AddCommand(publishCmd)
+
+	releaseCmd.AddCommand(&cobra.Command{
+		Use:   "keygen <private key file>",
+		Short: "Creates an ed25519 key pair for signing releases.",
+		Long:  "Example: pxy release keygen ~/.pxy-release.pem, then set ReleaseSigningKey to the file and ReleasePublicKey on installs.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pub, err := upload.GenerateReleaseKey(args[0])
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("Private key saved to %s.", args[0])
+			fmt.Printf("ReleasePublicKey: %s\n", pub)
+		},
+	})
+	a.rootCmd.AddCommand(releaseCmd)
+
+	selfUpdateCmd := &cobra.Command{
+		Use:     "self-update",
+		GroupID: AppGroupID,
+		Short:   "Updates pxy to the latest release in the storage repo.",
+		Long:    "Example: pxy self-update, pxy self-update --check. Restart pxy serve after updates.",
+		Run: func(cmd *cobra.Command, args []string) {
+			up := upload.NewUploader(a.cnf)
+			r, err := up.LatestRelease()
+			if err != nil {
+				logs.Error("Find latest release failed: %+v", err)
+				confs.Exit(releaseExitCode(err, confs.NetworkErrorExitCode))
+			}
+			platform := runtime.GOOS + "/" + runtime.GOARCH
+			force, _ := cmd.Flags().GetBool("force")
+			check, _ := cmd.Flags().GetBool("check")
+			if !force && Version != "dev" {
+				// an older release in the index may be a replayed one, it is not installed without --force.
+				switch cmp := utils.CompareVersion(r.Version, Version); {
+				case cmp == 0:
+					logs.Success("pxy %s is up to date.", Version)
+					return
+				case cmp < 0 && check:
+					logs.Info("pxy %s is newer than the latest release %s.", Version, r.Version)
+					return
+				case cmp < 0:
+					logs.Error("Release %s is older than pxy %s, refused, --force installs it.", r.Version, Version)
+					confs.Exit(1)
+				}
+			}
+			if check {
+				logs.Info("pxy %s is available, current: %s.", r.Version, Version)
+				return
+			}
+			if a.cnf.ReleasePublicKey == "" {
+				logs.Warning("ReleasePublicKey is not set, only the sha256 is checked.")
+			}
+			content, err := up.DownloadRelease(r, platform, a.cnf.ReleasePublicKey)
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(releaseExitCode(err, confs.NetworkErrorExitCode))
+			}
+			exePath, err := os.Executable()
+			if err == nil {
+				exePath, err = filepath.EvalSymlinks(exePath)
+			}
+			if err == nil {
+				err = upload.ReplaceBinary(exePath, content)
+			}
+			if err != nil {
+				logs.Error("Replace binary failed: %+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("pxy is updated to %s.", r.Version)
+		},
+	}
+	selfUpdateCmd.Flags().Bool("check", false, "Only checks for a new release.")
+	selfUpdateCmd.Flags().Bool("force", false, "Installs the latest release even if it is not newer, or older.")
+	a.rootCmd.AddCommand(selfUpdateCmd)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/rate"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/spf13/cobra"
+)
+
+/*
+Daemon mode: runs commands like version-fetch on an interval,
+and serves /metrics for prometheus and /healthz for alerts on silent breakage.
+*/
+
+type runState struct {
+	LastRun     string  `json:"last_run,omitempty"`
+	LastSuccess string  `json:"last_success,omitempty"`
+	Duration    float64 `json:"duration_seconds"`
+	Result      string  `json:"result,omitempty"`
+	lastSuccess time.Time
+}
+
+type health struct {
+	lock     *sync.Mutex
+	started  time.Time
+	interval time.Duration
+	commands []string
+	runs     map[string]*runState
+}
+
+func newHealth(interval time.Duration, commands []string) *health {
+	h := &health{
+		lock:     &sync.Mutex{},
+		started:  time.Now(),
+		interval: interval,
+		commands: commands,
+		runs:     map[string]*runState{},
+	}
+	for _, name := range commands {
+		h.runs[name] = &runState{}
+	}
+	return h
+}
+
+func (h *health) record(name string, start time.Time, result string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := time.Now()
+	s := h.runs[name]
+	s.LastRun = utils.FormatTime(now)
+	s.Duration = now.Sub(start).Seconds()
+	s.Result = result
+	if result == "ok" {
+		s.lastSuccess = now
+		s.LastSuccess = s.LastRun
+	}
+}
+
+/*
+Unhealthy when a command has not finished a run for two intervals,
+counted from the start of the daemon before its first run.
+*/
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	healthy := true
+	for _, s := range h.runs {
+		last := s.lastSuccess
+		if last.IsZero() {
+			last = h.started
+		}
+		if time.Since(last) > 2*h.interval {
+			healthy = false
+		}
+	}
+	status := map[string]any{"status": "ok", "runs": h.runs}
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		status["status"] = "stale"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// Runs a command in this process, like running pxy <name>.
+func (a *App) runScheduled(name string, h *health) {
+	cmd, _, err := a.rootCmd.Find(strings.Fields(name))
+	if err != nil || cmd == a.rootCmd || cmd.Run == nil {
+		logs.Error("Unknown command to serve: %s", name)
+		return
+	}
+	// a cron job or another pxy serve may be running in the same work dir, the run is skipped then.
+	unlock, err := a.cnf.LockWorkDir(name)
+	if err != nil {
+		logs.Warning("Scheduled run of %s skipped: %v", name, err)
+		metrics.Runs.Inc(name, "skipped")
+		return
+	}
+	defer unlock()
+	fetch.ResetRetries()
+	upload.ResetGitSync()
+	start := time.Now()
+	logs.Info("Scheduled run of %s.", name)
+	cmd.Run(cmd, nil)
+	result := "ok"
+	if a.cnf.Canceled() {
+		result = "canceled"
+	} else if _, code := confs.Failure(); code != 0 {
+		result = "failed"
+	}
+	metrics.RunDuration.Set(time.Since(start).Seconds(), name)
+	metrics.Runs.Inc(name, result)
+	if result == "ok" {
+		metrics.RunLastSuccess.Set(float64(time.Now().Unix()), name)
+	}
+	h.record(name, start, result)
+}
+
+func (a *App) initServeCmd() {
+	serveCmd := &cobra.Command{
+		Use:     "serve",
+		GroupID: AppGroupID,
+		Short:   "Runs commands on an interval, serves /metrics and /healthz.",
+		Long:    `Example: pxy serve --addr :9102 --interval 6h --commands "versions run,proxies run"`,
+		Run: func(cmd *cobra.Command, args []string) {
+			addr, _ := cmd.Flags().GetString("addr")
+			commands, _ := cmd.Flags().GetStringSlice("commands")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			if interval <= 0 || len(commands) == 0 {
+				cmd.Help()
+				return
+			}
+			for i := range commands {
+				commands[i] = strings.TrimSpace(commands[i])
+			}
+			serve := func() { a.serve(addr, interval, commands) }
+			// started by pxy service install on windows, stopping the service cancels the run like Ctrl-C.
+			if !runAsService(ServiceName, filepath.Join(a.cnf.DirPath(), ServiceLogName), a.cancel, serve) {
+				serve()
+			}
+		},
+	}
+	serveCmd.Flags().String("addr", ":9102", "Listen address of /metrics and /healthz.")
+	serveCmd.Flags().Duration("interval", 6*time.Hour, "Interval between runs.")
+	serveCmd.Flags().StringSlice("commands", []string{"version-fetch"}, "Commands to run, like version-fetch,get-proxies.")
+	a.rootCmd.AddCommand(serveCmd)
+}
+
+// Runs commands on an interval until canceled, with /metrics and /healthz on addr.
+func (a *App) serve(addr string, interval time.Duration, commands []string) {
+	h := newHealth(interval, commands)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", h)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logs.Error("Serve %s failed: %+v", addr, err)
+			confs.Exit(confs.ConfigErrorExitCode)
+		}
+	}()
+	logs.Info("Serving metrics on %s, running %s every %s.", addr, strings.Join(commands, ", "), interval)
+	for {
+		rotateServiceLog(a.cnf.DirPath())
+		for _, name := range commands {
+			if a.cnf.Canceled() {
+				break
+			}
+			a.runScheduled(name, h)
+		}
+		if rate.SleepContext(a.cnf.Context(), interval) != nil {
+			break
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/spf13/cobra"
+)
+
+/*
+pxy service registers pxy serve with the service manager of the system:
+a systemd unit on linux, a launchd agent on macOS and a service on windows, see service_<os>.go.
+
+The service runs the current binary with the work dir and profile of this install.
+Run logs go to the work dir and are rotated by LogFiles. Console output goes to journald on linux,
+and to service.log in the work dir on macOS and windows, which is truncated when it grows too large.
+*/
+
+const (
+	ServiceName        string = "pxy"
+	ServiceDescription string = "proxy-collector: collects proxies and version lists for gvc, and publishes them."
+	ServiceLogName     string = "service.log"
+	ServiceLogMaxSize  int64  = 10 << 20 // bytes.
+)
+
+type serviceSpec struct {
+	Name    string
+	Exe     string
+	Args    []string          // arguments of pxy serve.
+	Env     map[string]string // like XDG dirs.
+	WorkDir string            // data dir of the install.
+	ConfDir string            // config dir of the install, systemd units read service.env in it.
+	System  bool              // a system unit instead of a user unit, linux only.
+}
+
+func (a *App) serviceSpec(cmd *cobra.Command) (s *serviceSpec, err error) {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s = &serviceSpec{Name: ServiceName, Exe: exe, Env: map[string]string{}, WorkDir: a.cnf.DirPath(), ConfDir: a.cnf.ConfDir()}
+	s.System, _ = cmd.Flags().GetBool("system")
+	addr, _ := cmd.Flags().GetString("addr")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	commands, _ := cmd.Flags().GetStringSlice("commands")
+	s.Args = []string{"serve", "--addr", addr, "--interval", interval.String(), "--commands", strings.Join(commands, ",")}
+
+	// the service manager may run pxy with another home dir or user, the dirs of this install are passed on.
+	confDir, dataDir := confs.RootDirs()
+	if confDir == dataDir {
+		s.Args = append(s.Args, "--work-dir", dataDir)
+	} else {
+		for _, name := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME"} {
+			if v := os.Getenv(name); v != "" {
+				s.Env[name] = v
+			}
+		}
+	}
+	if profile := a.cnf.Profile(); profile != "" {
+		s.Args = append(s.Args, "--profile", profile)
+	}
+	return
+}
+
+func (a *App) initServiceCmd() {
+	serviceCmd := &cobra.Command{
+		Use:     "service",
+		GroupID: AppGroupID,
+		Short:   "Installs pxy serve as a systemd unit, a launchd agent or a windows service.",
+	}
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Installs and starts the service.",
+		Long:  `Example: pxy service install --interval 6h --commands "versions run,proxies run", --system installs a system unit on linux.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			s, err := a.serviceSpec(cmd)
+			if err == nil {
+				err = installService(s)
+			}
+			if err != nil {
+				logs.Error("Install service failed: %+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("Service %s is installed and started, it runs pxy %s.", s.Name, strings.Join(s.Args, " "))
+		},
+	}
+	installCmd.Flags().String("addr", ":9102", "Listen address of /metrics and /healthz.")
+	installCmd.Flags().Duration("interval", 6*time.Hour, "Interval between runs.")
+	installCmd.Flags().StringSlice("commands", []string{"version-fetch"}, "Commands to run, like version-fetch,get-proxies.")
+	installCmd.Flags().Bool("system", false, "Installs a system unit running as the current user, instead of a user unit, linux only.")
+	serviceCmd.AddCommand(installCmd)
+
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stops and removes the service.",
+		Run: func(cmd *cobra.Command, args []string) {
+			system, _ := cmd.Flags().GetBool("system")
+			if err := uninstallService(ServiceName, system); err != nil {
+				logs.Error("Uninstall service failed: %+v", err)
+				confs.Exit(1)
+			}
+			logs.Success("Service %s is removed.", ServiceName)
+		},
+	}
+	uninstallCmd.Flags().Bool("system", false, "Removes the system unit, linux only.")
+	serviceCmd.AddCommand(uninstallCmd)
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows whether the service is installed and running.",
+		Run: func(cmd *cobra.Command, args []string) {
+			system, _ := cmd.Flags().GetBool("system")
+			status, err := serviceStatus(ServiceName, system)
+			if jsonOutput(cmd) {
+				r := map[string]string{"name": ServiceName, "status": status}
+				if err != nil {
+					r["error"] = err.Error()
+				}
+				printJson(r)
+			} else if err == nil {
+				logs.Info("Service %s: %s", ServiceName, status)
+			}
+			if err != nil {
+				logs.Error("%+v", err)
+				confs.Exit(1)
+			}
+		},
+	}
+	statusCmd.Flags().Bool("system", false, "Checks the system unit, linux only.")
+	serviceCmd.AddCommand(statusCmd)
+	a.rootCmd.AddCommand(serviceCmd)
+}
+
+// Truncates the console log of the service when it is larger than ServiceLogMaxSize, the service keeps appending to it.
+// Windows allows it while the service has the log open, it is opened for appending with shared writes.
+func rotateServiceLog(workDir string) {
+	fPath := filepath.Join(workDir, ServiceLogName)
+	if info, err := os.Stat(fPath); err == nil && info.Size() > ServiceLogMaxSize {
+		os.Truncate(fPath, 0)
+	}
+}
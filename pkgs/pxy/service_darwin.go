@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+// Launchd agents in ~/Library/LaunchAgents, running as the current user after login.
+
+const launchdLabel string = "com.gvcgo.pxy"
+
+const launchdPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>%s</string>
+    <key>ProgramArguments</key>
+    <array>
+%s    </array>
+    <key>EnvironmentVariables</key>
+    <dict>
+%s    </dict>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <dict>
+        <key>SuccessfulExit</key>
+        <false/>
+    </dict>
+    <key>StandardOutPath</key>
+    <string>%s</string>
+    <key>StandardErrorPath</key>
+    <string>%s</string>
+</dict>
+</plist>
+`
+
+func launchdPlistPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Library", "LaunchAgents", launchdLabel+".plist")
+}
+
+func xmlEscape(s string) string {
+	sb := &strings.Builder{}
+	xml.EscapeText(sb, []byte(s))
+	return sb.String()
+}
+
+func installService(s *serviceSpec) error {
+	if s.System {
+		return fmt.Errorf("--system is linux only, launchd agents run as the current user")
+	}
+	args := &strings.Builder{}
+	for _, arg := range append([]string{s.Exe}, s.Args...) {
+		fmt.Fprintf(args, "        <string>%s</string>\n", xmlEscape(arg))
+	}
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := &strings.Builder{}
+	for _, k := range keys {
+		fmt.Fprintf(env, "        <key>%s</key>\n        <string>%s</string>\n", xmlEscape(k), xmlEscape(s.Env[k]))
+	}
+	logPath := xmlEscape(filepath.Join(s.WorkDir, ServiceLogName))
+	plist := fmt.Sprintf(launchdPlistTemplate, launchdLabel, args.String(), env.String(), logPath, logPath)
+	fPath := launchdPlistPath()
+	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
+		return err
+	}
+	// a loaded agent is replaced.
+	exec.Command("launchctl", "unload", fPath).Run()
+	if err := utils.WriteFile(fPath, []byte(plist), 0644); err != nil {
+		return err
+	}
+	if out, err := exec.Command("launchctl", "load", "-w", fPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+func uninstallService(name string, system bool) error {
+	fPath := launchdPlistPath()
+	if _, err := os.Stat(fPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s is not installed", fPath)
+	}
+	exec.Command("launchctl", "unload", "-w", fPath).Run()
+	return os.Remove(fPath)
+}
+
+func serviceStatus(name string, system bool) (string, error) {
+	if _, err := os.Stat(launchdPlistPath()); os.IsNotExist(err) {
+		return "not installed", nil
+	}
+	out, err := exec.Command("launchctl", "list", launchdLabel).CombinedOutput()
+	if err != nil {
+		return "not loaded", nil
+	}
+	if strings.Contains(string(out), `"PID" =`) {
+		return "running", nil
+	}
+	return "loaded, not running", nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+// Systemd units, user units in ~/.config/systemd/user by default, system units in /etc/systemd/system.
+
+const systemdUnitTemplate = `[Unit]
+Description=%s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+%sExecStart=%s
+Restart=on-failure
+RestartSec=30
+%s
+[Install]
+WantedBy=%s
+`
+
+func systemdUnitPath(name string, system bool) string {
+	if system {
+		return filepath.Join("/etc/systemd/system", name+".service")
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".config", "systemd", "user", name+".service")
+}
+
+func systemctl(system bool, args ...string) ([]byte, error) {
+	if !system {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...).CombinedOutput()
+}
+
+// Quotes arguments with spaces for ExecStart.
+func systemdQuote(args []string) string {
+	r := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t\"") {
+			arg = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+		r[i] = arg
+	}
+	return strings.Join(r, " ")
+}
+
+func installService(s *serviceSpec) error {
+	userLine, wantedBy := "", "default.target"
+	if s.System {
+		// the user running sudo, not root.
+		name := os.Getenv("SUDO_USER")
+		if name == "" {
+			u, err := user.Current()
+			if err != nil {
+				return err
+			}
+			name = u.Username
+		}
+		userLine, wantedBy = fmt.Sprintf("User=%s\n", name), "multi-user.target"
+	}
+	envLines := []string{}
+	for k, v := range s.Env {
+		envLines = append(envLines, fmt.Sprintf("Environment=%s", systemdQuote([]string{k + "=" + v})))
+	}
+	sort.Strings(envLines)
+	// secrets like PXY_SECRET_PASSPHRASE go into service.env in the config dir, not into the unit.
+	envLines = append(envLines, "EnvironmentFile=-"+filepath.Join(s.ConfDir, "service.env"))
+	unit := fmt.Sprintf(systemdUnitTemplate,
+		ServiceDescription,
+		userLine,
+		systemdQuote(append([]string{s.Exe}, s.Args...)),
+		strings.Join(envLines, "\n")+"\n",
+		wantedBy,
+	)
+	fPath := systemdUnitPath(s.Name, s.System)
+	if err := os.MkdirAll(filepath.Dir(fPath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := utils.WriteFile(fPath, []byte(unit), 0644); err != nil {
+		return err
+	}
+	if out, err := systemctl(s.System, "daemon-reload"); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	if out, err := systemctl(s.System, "enable", "--now", s.Name); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+func uninstallService(name string, system bool) error {
+	fPath := systemdUnitPath(name, system)
+	if _, err := os.Stat(fPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s is not installed", fPath)
+	}
+	// fails for units that are already stopped, which is fine.
+	systemctl(system, "disable", "--now", name)
+	if err := os.Remove(fPath); err != nil {
+		return err
+	}
+	_, err := systemctl(system, "daemon-reload")
+	return err
+}
+
+func serviceStatus(name string, system bool) (string, error) {
+	if _, err := os.Stat(systemdUnitPath(name, system)); os.IsNotExist(err) {
+		return "not installed", nil
+	}
+	// is-active exits with non-zero codes for inactive units.
+	out, _ := systemctl(system, "is-active", name)
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func installService(s *serviceSpec) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func uninstallService(name string, system bool) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func serviceStatus(name string, system bool) (string, error) {
+	return "", fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
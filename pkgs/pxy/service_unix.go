@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// Services of systemd and launchd are plain processes, stopped by SIGTERM.
+func runAsService(name, logPath string, stop func(), run func()) bool {
+	return false
+}
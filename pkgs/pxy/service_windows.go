@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Windows services, installed and removed from an elevated prompt.
+
+func installService(s *serviceSpec) error {
+	if s.System {
+		return fmt.Errorf("--system is linux only")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to the service manager failed, run as administrator: %w", err)
+	}
+	defer m.Disconnect()
+	if srv, err := m.OpenService(s.Name); err == nil {
+		srv.Close()
+		return fmt.Errorf("service %s exists, run pxy service uninstall first", s.Name)
+	}
+	srv, err := m.CreateService(s.Name, s.Exe, mgr.Config{
+		DisplayName:      "pxy",
+		Description:      ServiceDescription,
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+	}, s.Args...)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	err = srv.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return err
+	}
+	return srv.Start()
+}
+
+func uninstallService(name string, system bool) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to the service manager failed, run as administrator: %w", err)
+	}
+	defer m.Disconnect()
+	srv, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer srv.Close()
+	// fails for services that are already stopped, which is fine.
+	srv.Control(svc.Stop)
+	return srv.Delete()
+}
+
+func serviceStatus(name string, system bool) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer m.Disconnect()
+	srv, err := m.OpenService(name)
+	if err != nil {
+		return "not installed", nil
+	}
+	defer srv.Close()
+	status, err := srv.Query()
+	if err != nil {
+		return "", err
+	}
+	switch status.State {
+	case svc.Running:
+		return "running", nil
+	case svc.Stopped:
+		return "stopped", nil
+	case svc.StartPending:
+		return "starting", nil
+	case svc.StopPending:
+		return "stopping", nil
+	default:
+		return fmt.Sprintf("state %d", status.State), nil
+	}
+}
+
+type serviceHandler struct {
+	stop func()
+	run  func()
+}
+
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.run()
+	}()
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				// the run in progress is canceled like by Ctrl-C, finished results are still published.
+				h.stop()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+/*
+Runs run as a windows service when started by the service manager, stop cancels it.
+Services have no console, output is appended to logPath instead, see rotateServiceLog.
+Returns false when not started by the service manager.
+*/
+func runAsService(name, logPath string, stop func(), run func()) bool {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return false
+	}
+	if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err == nil {
+		confs.RedirectConsole(f)
+	}
+	svc.Run(name, &serviceHandler{stop: stop, run: run})
+	return true
+}
@@ -6,14 +6,20 @@ import (
 	"math/rand"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/history"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/notify"
 	"github.com/gvcgo/collector/pkgs/sites"
+	"github.com/gvcgo/collector/pkgs/trace"
 	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
 	"github.com/gvcgo/goutils/pkgs/crypt"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/vpnparser/pkgs/outbound"
 )
 
@@ -35,7 +41,7 @@ func HandleRawUri(rawUri string) (result string) {
 		if r := crypt.DecodeBase64(strings.Split(rawUri, "://")[1]); r != "" {
 			result = "vmess://" + r
 		}
-		return
+		return dropLocal(result)
 	}
 
 	if strings.Contains(rawUri, "\u0026") {
@@ -44,12 +50,15 @@ func HandleRawUri(rawUri string) (result string) {
 	if strings.Contains(rawUri, "amp;") {
 		rawUri = strings.ReplaceAll(rawUri, "amp;", "")
 	}
-	rawUri, _ = url.QueryUnescape(rawUri)
+	// invalid escapes are kept as they are.
+	if unescaped, err := url.QueryUnescape(rawUri); err == nil {
+		rawUri = unescaped
+	}
 	r, err := url.Parse(rawUri)
 	result = rawUri
 	if err != nil {
-		gprint.PrintError("%+v", err)
-		return
+		logs.Error("%+v", err)
+		return dropLocal(result)
 	}
 
 	host := r.Host
@@ -71,20 +80,26 @@ func HandleRawUri(rawUri string) (result string) {
 	}
 
 	if strings.Contains(result, "%") {
-		result, _ = url.QueryUnescape(result)
+		if unescaped, err := url.QueryUnescape(result); err == nil {
+			result = unescaped
+		}
 	}
-	result = HandleQuery(result)
-	if strings.Contains(result, "127.0.0.1") || strings.Contains(result, "127.0.0.0") {
+	return dropLocal(HandleQuery(result))
+}
+
+// Uris of local addresses are dropped.
+func dropLocal(rawUri string) string {
+	if strings.Contains(rawUri, "127.0.0.1") || strings.Contains(rawUri, "127.0.0.0") {
 		return ""
 	}
-	return
+	return rawUri
 }
 
 type SiteRunner struct {
 	Result        *outbound.Result `json:"vpn_list"`
 	domainList    []string
 	rawDomainList []string
-	result        map[string]struct{}
+	result        map[string]history.Seen // proxy -> where it was seen.
 	cnf           *confs.CollectorConf
 	sites         []sites.ISite
 	uploader      *upload.Uploader
@@ -95,9 +110,8 @@ func NewSiteRunner(cnf *confs.CollectorConf) (sr *SiteRunner) {
 		Result:        outbound.NewResult(),
 		domainList:    []string{},
 		rawDomainList: []string{},
-		result:        map[string]struct{}{},
+		result:        map[string]history.Seen{},
 		cnf:           cnf,
-		uploader:      upload.NewUploader(cnf),
 	}
 	return
 }
@@ -106,9 +120,22 @@ func (s *SiteRunner) AddSite(st sites.ISite) {
 	s.sites = append(s.sites, st)
 }
 
-func (s *SiteRunner) wrapItem(rawUri string) *outbound.ProxyItem {
-	item := outbound.NewItem(rawUri)
-	if strings.HasPrefix(item.Address, "127.0.") {
+/*
+Parses a proxy uri, nil for local addresses and uris the parser cannot handle.
+Uris come from public pages and subscriptions, a panic of the parser on a hostile uri only drops that uri.
+*/
+func (s *SiteRunner) wrapItem(rawUri string) (item *outbound.ProxyItem) {
+	if rawUri == "" {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logs.Warning("Parse proxy uri failed: %v", r)
+			item = nil
+		}
+	}()
+	item = outbound.NewItem(rawUri)
+	if item == nil || strings.HasPrefix(item.Address, "127.0.") {
 		return nil
 	}
 	item.GetOutbound()
@@ -116,23 +143,37 @@ func (s *SiteRunner) wrapItem(rawUri string) *outbound.ProxyItem {
 }
 
 func (s *SiteRunner) Run() {
-	s.result = map[string]struct{}{}
+	// created on run, so that flags like --dry-run are applied.
+	s.uploader = upload.NewUploader(s.cnf)
+	s.result = map[string]history.Seen{}
 	s.Result = outbound.NewResult()
 
 	s.domainList = []string{}
 	s.rawDomainList = []string{}
+	// sites are added again by the next run, like runs of pxy serve.
+	defer func() { s.sites = nil }()
 
 	for _, st := range s.sites {
+		if s.cnf.Canceled() {
+			break
+		}
+		// sites run one by one, their fetches are children of the site span.
+		runCtx := s.cnf.Context()
+		ctx, span := trace.Start(runCtx, "site", "type", string(st.Type()))
+		s.cnf.SetContext(ctx)
 		switch st.Type() {
 		case sites.Subscribed, sites.FreeFQ:
 			st.SetHandler(func(result []string) {
 				for _, rawUri := range result {
 					rawUri = HandleRawUri(rawUri)
 					proxyItem := s.wrapItem(rawUri)
+					if proxyItem == nil {
+						continue
+					}
 					proxyStr := fmt.Sprintf("%s%s:%d", proxyItem.Scheme, proxyItem.Address, proxyItem.Port)
 					if _, ok := s.result[proxyStr]; !ok {
 						s.Result.AddItem(proxyItem)
-						s.result[proxyStr] = struct{}{}
+						s.result[proxyStr] = history.Seen{Source: string(st.Type()), Country: proxyItem.Location}
 					}
 				}
 			})
@@ -152,16 +193,62 @@ func (s *SiteRunner) Run() {
 			// s.doDomains()
 		default:
 		}
+		span.End()
+		s.cnf.SetContext(runCtx)
+	}
+	if s.cnf.Canceled() {
+		logs.Warning("Canceled, partial results are not published.")
+		s.uploader.Wait()
+		return
 	}
 	s.doProxy()
 	s.doRawDomains()
 	s.doDomains()
+	// waits for pending uploads.
+	s.uploader.UploadManifest()
+}
+
+/*
+Compares proxies of this run with the previous run for the run report, only counts are reported.
+Proxies are identified by scheme, address and port, and are recorded into the history for pxy stats.
+*/
+func (s *SiteRunner) diffProxies() {
+	prev := []string{}
+	if content, err := os.ReadFile(s.cnf.ProxyListPath()); err == nil {
+		json.Unmarshal(content, &prev)
+	}
+	added, removed := len(s.result), 0
+	for _, p := range prev {
+		if _, ok := s.result[p]; ok {
+			added--
+		} else {
+			removed++
+		}
+	}
+	notify.Current().SetProxies(added, removed)
+
+	cur := make([]string, 0, len(s.result))
+	for p := range s.result {
+		cur = append(cur, p)
+	}
+	sort.Strings(cur)
+	if content, err := json.Marshal(cur); err == nil && !confs.DryRun() {
+		utils.WriteFile(s.cnf.ProxyListPath(), content, os.ModePerm)
+	}
+	if !confs.DryRun() {
+		err := history.Update(s.cnf.HistoryPath(), s.cnf.HistoryRetention(), func(db *history.DB) {
+			db.RecordNodes(s.result, time.Now())
+		})
+		if err != nil {
+			logs.Warning("Save history failed: %+v", err)
+		}
+	}
 }
 
 func (s *SiteRunner) doProxy() {
 
-	gprint.PrintSuccess("Total Proxies: %d", s.Result.Len())
-	gprint.PrintSuccess(
+	logs.Success("Total Proxies: %d", s.Result.Len())
+	logs.Success(
 		"vmess[%d]; vless[%d]; ss[%d]; trojan[%d]; ssr[%d]",
 		s.Result.VmessTotal,
 		s.Result.VlessTotal,
@@ -169,6 +256,15 @@ func (s *SiteRunner) doProxy() {
 		s.Result.TrojanTotal,
 		s.Result.SSRTotal,
 	)
+	for protocol, n := range map[string]int{
+		"vmess":  s.Result.VmessTotal,
+		"vless":  s.Result.VlessTotal,
+		"ss":     s.Result.SSTotal,
+		"trojan": s.Result.TrojanTotal,
+		"ssr":    s.Result.SSRTotal,
+	} {
+		metrics.Proxies.Set(float64(n), protocol)
+	}
 	fPath := s.cnf.VPNFilePath()
 	var cstZone = time.FixedZone("CST", 8*3600)
 	now := time.Now().In(cstZone)
@@ -176,25 +272,38 @@ func (s *SiteRunner) doProxy() {
 	if s.Result.Len() <= 0 {
 		return
 	}
+	s.diffProxies()
 	if s.Result.VlessTotal > 3000 {
 		// avoid too many items for neobox to handle.
-		gprint.Yellow("Only 3k items for vless...")
+		logs.Warning("Only 3k items for vless...")
 		start := rand.Intn(s.Result.VlessTotal - 3000)
 		end := 3000 + start
 		s.Result.Vless = s.Result.Vless[start:end]
 		s.Result.VlessTotal = 3000
 	}
 
-	if content, err := json.Marshal(s.Result); err == nil {
-		gprint.PrintWarning("neobox key: %s", s.cnf.CryptoKey)
-		cc := crypt.NewCrptWithKey([]byte(s.cnf.CryptoKey))
-		if r, err := cc.AesEncrypt([]byte(content)); err == nil {
-			if err = os.WriteFile(fPath, r, os.ModePerm); err == nil {
-				s.uploader.Upload(fPath)
-			}
+	content, err := json.Marshal(s.Result)
+	if err != nil {
+		logs.Error("marshal failed: %+v", err)
+		return
+	}
+	// during a key rotation, conf.txt keeps the old key and conf.new.txt gets the new one.
+	s.cnf.RetireOldKey(now)
+	confKey, newKey := s.cnf.PublishKeys(now)
+	logs.Warning("neobox key: %s", confKey)
+	s.encryptAndUpload(fPath, confKey, content)
+	if newKey != "" {
+		logs.Warning("neobox new key: %s", newKey)
+		s.encryptAndUpload(s.cnf.VPNNewFilePath(), newKey, content)
+	}
+}
+
+func (s *SiteRunner) encryptAndUpload(fPath, key string, content []byte) {
+	cc := crypt.NewCrptWithKey([]byte(key))
+	if r, err := cc.AesEncrypt(content); err == nil {
+		if err = utils.WriteFileWithBackup(fPath, r, os.ModePerm); err == nil {
+			s.uploader.UploadAsync(fPath)
 		}
-	} else {
-		gprint.PrintError("marshal failed: %+v", err)
 	}
 }
 
@@ -203,7 +312,7 @@ func (s *SiteRunner) doRawDomains() {
 		return
 	}
 	s.cnf.AddRawDomains(s.rawDomainList...)
-	s.uploader.Upload(s.cnf.RawDomainPath())
+	s.uploader.UploadAsync(s.cnf.RawDomainOutputPath())
 }
 
 func (s *SiteRunner) doDomains() {
@@ -212,7 +321,7 @@ func (s *SiteRunner) doDomains() {
 	}
 	fPath := s.cnf.DomainPath()
 	content := strings.Join(s.domainList, "\n")
-	if err := os.WriteFile(fPath, []byte(content), os.ModePerm); err == nil {
-		s.uploader.Upload(fPath)
+	if err := utils.WriteFileWithBackup(fPath, []byte(content), os.ModePerm); err == nil {
+		s.uploader.UploadAsync(fPath)
 	}
 }
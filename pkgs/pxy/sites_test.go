@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var seedRawUris = []string{
+	"vmess://eyJ2IjoiMiIsInBzIjoibm9kZSIsImFkZCI6IjEuMi4zLjQiLCJwb3J0IjoiNDQzIiwiaWQiOiJpZCIsImFpZCI6IjAiLCJuZXQiOiJ3cyJ9",
+	"vless://b0dd64e4-0fbd-4038-9139-d1f32a68a0dc@example.com:443?type=ws&security=tls&path=%2Fws#vless",
+	"ss://YWVzLTEyOC1nY206cGFzcw@1.2.3.4:8388#ss",
+	"ss://YWVzLTEyOC1nY206cGFzc0AxLjIuMy40OjgzODg#ss-sip008",
+	"ssr://MS4yLjMuNDo4Mzg4Om9yaWdpbjphZXMtMTI4LWNmYjpwbGFpbjpjR0Z6Y3cvP3JlbWFya3M9",
+	"trojan://pass@[2001:db8::1]:443?sni=example.com;allowInsecure=1#trojan",
+	"trojan://pass@127.0.0.1:443#local",
+	"vless://%zz@example.com:443?amp;type=ws",
+	"",
+}
+
+// Uris from public pages are hostile input, neither the clean up nor the parser may take a run down.
+func FuzzHandleRawUri(f *testing.F) {
+	for _, uri := range seedRawUris {
+		f.Add(uri)
+	}
+	s := &SiteRunner{}
+	f.Fuzz(func(t *testing.T, rawUri string) {
+		result := HandleRawUri(rawUri)
+		if strings.Contains(result, "127.0.0.1") {
+			t.Fatalf("HandleRawUri(%q) = %q, local addresses are kept", rawUri, result)
+		}
+		if item := s.wrapItem(result); item != nil && strings.HasPrefix(item.Address, "127.0.") {
+			t.Fatalf("wrapItem(%q) kept the local address %s", result, item.Address)
+		}
+	})
+}
+
+func FuzzHandleQuery(f *testing.F) {
+	f.Add("trojan://p@h:1?sni=a;allowInsecure=1#x")
+	f.Add("ss://a@b:1?plugin=obfs-local;obfs=http&x=1")
+	f.Add("?;")
+	f.Fuzz(func(t *testing.T, rawUri string) {
+		result := HandleQuery(rawUri)
+		if !strings.Contains(rawUri, "?") && result != rawUri {
+			t.Fatalf("HandleQuery(%q) = %q, uris without query are kept", rawUri, result)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+Limiter paces calls and transferred bytes, like storage calls of uploads and requests to a host.
+Every call reserves a slot, so concurrent workers share the same budget.
+*/
+type Limiter struct {
+	perMinute int   // calls per minute.
+	bps       int64 // bytes per second.
+	lock      *sync.Mutex
+	nextCall  time.Time
+	nextByte  time.Time
+}
+
+func NewLimiter(perMinute int, bps int64) (l *Limiter) {
+	l = &Limiter{
+		perMinute: perMinute,
+		bps:       bps,
+		lock:      &sync.Mutex{},
+	}
+	return
+}
+
+// Reserves d from next, returns how long to sleep.
+func (l *Limiter) reserve(next *time.Time, d time.Duration) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if next.Before(now) {
+		*next = now
+	}
+	wait := next.Sub(now)
+	*next = next.Add(d)
+	return wait
+}
+
+func (l *Limiter) WaitCall() {
+	if l.perMinute <= 0 {
+		return
+	}
+	time.Sleep(l.reserve(&l.nextCall, time.Minute/time.Duration(l.perMinute)))
+}
+
+// Like WaitCall, returns early with the error of ctx when it is canceled.
+func (l *Limiter) WaitCallContext(ctx context.Context) error {
+	if l.perMinute <= 0 {
+		return ctx.Err()
+	}
+	return SleepContext(ctx, l.reserve(&l.nextCall, time.Minute/time.Duration(l.perMinute)))
+}
+
+func (l *Limiter) WaitBytes(n int64) {
+	if l.bps <= 0 || n <= 0 {
+		return
+	}
+	time.Sleep(l.reserve(&l.nextByte, time.Duration(n)*time.Second/time.Duration(l.bps)))
+}
+
+// Sleeps for d, returns early with the error of ctx when it is canceled.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
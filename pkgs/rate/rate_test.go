@@ -0,0 +1,41 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleepContext(t *testing.T) {
+	if err := SleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("SleepContext() = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := SleepContext(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("SleepContext() canceled = %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("SleepContext() did not return on cancel")
+	}
+}
+
+// Calls share the budget, the second one of 600 per minute waits 100ms.
+func TestLimiterWaitCall(t *testing.T) {
+	l := NewLimiter(600, 0)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.WaitCallContext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("two calls took %v, want about 100ms", d)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewLimiter(0, 0).WaitCallContext(ctx); err != context.Canceled {
+		t.Errorf("WaitCallContext() without limit = %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+)
+
+/*
+Verification of detached signatures of upstream artifacts and checksum files, against pinned public keys:
+
+	gpg       armored or binary signatures(.asc, .sig), keys are an armored keyring, like the KEYS file of Apache projects.
+	minisign  .minisig files, keys are minisign .pub files, prehashed signatures included.
+	cosign    base64 signatures of sign-blob, keys are PEM public keys. Keyless signatures need the signing certificate,
+	          which must chain to the pinned Fulcio roots in the key file and carry a matching identity.
+
+Data is read as a stream, so large artifacts are never held in memory, except by legacy minisign signatures.
+*/
+
+const (
+	TypeGpg      string = "gpg"
+	TypeMinisign string = "minisign"
+	TypeCosign   string = "cosign"
+)
+
+var ErrInvalid = errors.New("invalid signature")
+
+// A pinned public key, loaded once per run.
+type Key struct {
+	Type     string
+	gpg      openpgp.EntityList
+	minisign *minisignKey
+	cosign   *ecdsa.PublicKey
+	roots    *x509.CertPool // fulcio roots for keyless cosign signatures.
+}
+
+// Loads a key file by the signature type.
+func LoadKey(sigType, fPath string) (*Key, error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{Type: sigType}
+	switch sigType {
+	case TypeGpg:
+		if bytes.Contains(content, []byte("-----BEGIN PGP")) {
+			k.gpg, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+		} else {
+			k.gpg, err = openpgp.ReadKeyRing(bytes.NewReader(content))
+		}
+	case TypeMinisign:
+		k.minisign, err = parseMinisignKey(string(content))
+	case TypeCosign:
+		err = k.loadCosign(content)
+	default:
+		err = fmt.Errorf("unknown signature type: %q", sigType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+/*
+Verifies a signature of data. cert is the PEM signing certificate of keyless cosign signatures,
+identity a regexp its SAN must match, both are empty otherwise.
+*/
+func (k *Key) Verify(data io.Reader, sig, cert []byte, identity string) error {
+	switch k.Type {
+	case TypeGpg:
+		var err error
+		if bytes.Contains(sig, []byte("-----BEGIN PGP")) {
+			_, err = openpgp.CheckArmoredDetachedSignature(k.gpg, data, bytes.NewReader(sig), nil)
+		} else {
+			_, err = openpgp.CheckDetachedSignature(k.gpg, data, bytes.NewReader(sig), nil)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		return nil
+	case TypeMinisign:
+		return k.minisign.verify(data, sig)
+	case TypeCosign:
+		return k.verifyCosign(data, sig, cert, identity)
+	}
+	return fmt.Errorf("unknown signature type: %q", k.Type)
+}
+
+/*
+Minisign, see https://jedisct1.github.io/minisign/. A key is "Ed", an 8 bytes key id and an ed25519 key.
+A signature is "Ed" or "ED"(blake2b-512 prehashed), the key id and an ed25519 signature, then a trusted comment
+signed along with the signature.
+*/
+type minisignKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// The base64 line of a minisign file, comment lines are skipped.
+func minisignLines(content string) (lines []string) {
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+func parseMinisignKey(content string) (*minisignKey, error) {
+	lines := minisignLines(content)
+	if len(lines) == 0 {
+		return nil, errors.New("empty minisign key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, errors.New("not a minisign ed25519 key")
+	}
+	return &minisignKey{id: raw[2:10], key: ed25519.PublicKey(raw[10:])}, nil
+}
+
+func (k *minisignKey) verify(data io.Reader, sig []byte) error {
+	lines := minisignLines(string(sig))
+	if len(lines) < 3 || !strings.HasPrefix(lines[1], "trusted comment:") {
+		return fmt.Errorf("%w: not a minisign signature", ErrInvalid)
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: not a minisign signature", ErrInvalid)
+	}
+	if !bytes.Equal(raw[2:10], k.id) {
+		return fmt.Errorf("%w: signed by key %X, pinned %X", ErrInvalid, raw[2:10], k.id)
+	}
+	var message []byte
+	switch string(raw[:2]) {
+	case "ED":
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, data); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	case "Ed":
+		if message, err = io.ReadAll(data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown minisign algorithm %q", ErrInvalid, raw[:2])
+	}
+	if !ed25519.Verify(k.key, message, raw[10:]) {
+		return ErrInvalid
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	trusted := strings.TrimPrefix(lines[1], "trusted comment: ")
+	if !ed25519.Verify(k.key, append(raw[10:], trusted...), global) {
+		return fmt.Errorf("%w: trusted comment", ErrInvalid)
+	}
+	return nil
+}
+
+/*
+Cosign keys are a PEM public key, or PEM certificates of Fulcio roots(and intermediates) for keyless signatures.
+Fulcio certificates live for minutes, so the chain is checked at the time the certificate was issued.
+*/
+func (k *Key) loadCosign(content []byte) error {
+	for rest := content; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			key, ok := pub.(*ecdsa.PublicKey)
+			if !ok {
+				return errors.New("cosign keys must be ecdsa")
+			}
+			k.cosign = key
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+			if k.roots == nil {
+				k.roots = x509.NewCertPool()
+			}
+			k.roots.AddCert(cert)
+		}
+	}
+	if k.cosign == nil && k.roots == nil {
+		return errors.New("no public key or certificate found")
+	}
+	return nil
+}
+
+// Sign-blob signatures and certificates are base64 encoded, some releases publish them decoded.
+func decodeBase64(content []byte) []byte {
+	content = bytes.TrimSpace(content)
+	if r, err := base64.StdEncoding.DecodeString(string(content)); err == nil {
+		return r
+	}
+	return content
+}
+
+func (k *Key) verifyCosign(data io.Reader, sig, cert []byte, identity string) error {
+	key := k.cosign
+	if len(cert) > 0 {
+		if k.roots == nil {
+			return fmt.Errorf("%w: keyless signature, no fulcio roots pinned", ErrInvalid)
+		}
+		block, _ := pem.Decode(decodeBase64(cert))
+		if block == nil {
+			return fmt.Errorf("%w: broken certificate", ErrInvalid)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if _, err := c.Verify(x509.VerifyOptions{
+			Roots:       k.roots,
+			CurrentTime: c.NotBefore,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if err := matchIdentity(c, identity); err != nil {
+			return err
+		}
+		ok := false
+		if key, ok = c.PublicKey.(*ecdsa.PublicKey); !ok {
+			return fmt.Errorf("%w: certificate key is not ecdsa", ErrInvalid)
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("%w: no public key pinned", ErrInvalid)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(key, h.Sum(nil), decodeBase64(sig)) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Identities of Fulcio certificates are SAN uris of CI workflows or emails.
+func matchIdentity(c *x509.Certificate, identity string) error {
+	if identity == "" {
+		return fmt.Errorf("%w: keyless signatures need an identity", ErrInvalid)
+	}
+	re, err := regexp.Compile(identity)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, u := range c.URIs {
+		names = append(names, u.String())
+	}
+	names = append(names, c.EmailAddresses...)
+	for _, name := range names {
+		if re.MatchString(name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: identities %v do not match %s", ErrInvalid, names, identity)
+}
@@ -0,0 +1,101 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Vectors in testdata are signed by gpg, and in the formats of minisign and cosign by testdata/gen.go.
+const testIdentity = "^https://github.com/example/tool/"
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	if name == "" {
+		return nil
+	}
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		sigType  string
+		key      string
+		sig      string
+		cert     string
+		identity string
+		tampered bool
+		ok       bool
+	}{
+		{"gpg armored", TypeGpg, "gpg-key.asc", "data.txt.asc", "", "", false, true},
+		{"gpg binary", TypeGpg, "gpg-key.asc", "data.txt.sig", "", "", false, true},
+		{"gpg tampered", TypeGpg, "gpg-key.asc", "data.txt.asc", "", "", true, false},
+		{"gpg wrong key", TypeGpg, "gpg-key.asc", "data.txt.other.asc", "", "", false, false},
+		{"gpg other key pinned", TypeGpg, "gpg-other.asc", "data.txt.asc", "", "", false, false},
+
+		{"minisign prehashed", TypeMinisign, "minisign.pub", "data.txt.minisig", "", "", false, true},
+		{"minisign legacy", TypeMinisign, "minisign.pub", "data.txt.legacy.minisig", "", "", false, true},
+		{"minisign tampered", TypeMinisign, "minisign.pub", "data.txt.minisig", "", "", true, false},
+		{"minisign legacy tampered", TypeMinisign, "minisign.pub", "data.txt.legacy.minisig", "", "", true, false},
+		{"minisign wrong key", TypeMinisign, "minisign.pub", "data.txt.other.minisig", "", "", false, false},
+
+		{"cosign key", TypeCosign, "cosign.pub", "data.txt.cosign.sig", "", "", false, true},
+		{"cosign tampered", TypeCosign, "cosign.pub", "data.txt.cosign.sig", "", "", true, false},
+		{"cosign wrong key", TypeCosign, "cosign.pub", "data.txt.cosign.other.sig", "", "", false, false},
+
+		{"keyless", TypeCosign, "fulcio.pem", "data.txt.keyless.sig", "data.txt.keyless.pem", testIdentity, false, true},
+		{"keyless tampered", TypeCosign, "fulcio.pem", "data.txt.keyless.sig", "data.txt.keyless.pem", testIdentity, true, false},
+		{"keyless wrong identity", TypeCosign, "fulcio.pem", "data.txt.keyless.sig", "data.txt.keyless.pem", "^https://github.com/attacker/", false, false},
+		{"keyless no identity", TypeCosign, "fulcio.pem", "data.txt.keyless.sig", "data.txt.keyless.pem", "", false, false},
+		{"keyless issued by an expired root", TypeCosign, "fulcio-expired.pem", "data.txt.expired.sig", "data.txt.expired.pem", testIdentity, false, false},
+		{"keyless other root pinned", TypeCosign, "fulcio.pem", "data.txt.expired.sig", "data.txt.expired.pem", testIdentity, false, false},
+		{"keyless cert with a pinned key", TypeCosign, "cosign.pub", "data.txt.keyless.sig", "data.txt.keyless.pem", testIdentity, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadKey(tt.sigType, filepath.Join("testdata", tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := readTestdata(t, "data.txt")
+			if tt.tampered {
+				data = bytes.Replace(data, []byte("0123"), []byte("3210"), 1)
+			}
+			err = key.Verify(bytes.NewReader(data), readTestdata(t, tt.sig), readTestdata(t, tt.cert), tt.identity)
+			if tt.ok && err != nil {
+				t.Errorf("Verify() = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify() = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	tests := []struct {
+		sigType string
+		key     string
+		ok      bool
+	}{
+		{TypeGpg, "gpg-key.asc", true},
+		{TypeMinisign, "minisign.pub", true},
+		{TypeMinisign, "gpg-key.asc", false},
+		{TypeCosign, "cosign.pub", true},
+		{TypeCosign, "data.txt", false},
+		{"x509", "cosign.pub", false},
+		{TypeGpg, "missing.asc", false},
+	}
+	for _, tt := range tests {
+		if _, err := LoadKey(tt.sigType, filepath.Join("testdata", tt.key)); (err == nil) != tt.ok {
+			t.Errorf("LoadKey(%s, %s) = %v, want ok %v", tt.sigType, tt.key, err, tt.ok)
+		}
+	}
+}
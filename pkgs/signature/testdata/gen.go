@@ -0,0 +1,158 @@
+//go:build ignore
+
+// Writes the minisign and cosign vectors of signature_test.go, in the formats of the minisign and cosign tools:
+//
+//	go run gen.go
+//
+// The gpg vectors are made by gpg 2.2 itself:
+//
+//	gpg --batch --gen-key (an ed25519 key release@example.com and an rsa key other@example.com)
+//	gpg --armor --export release@example.com > gpg-key.asc
+//	gpg --armor --export other@example.com > gpg-other.asc
+//	gpg --local-user release@example.com --armor --detach-sign -o data.txt.asc data.txt
+//	gpg --local-user release@example.com --detach-sign -o data.txt.sig data.txt
+//	gpg --local-user other@example.com --armor --detach-sign -o data.txt.other.asc data.txt
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const identity = "https://github.com/example/tool/.github/workflows/release.yml@refs/tags/v1.0.0"
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func write(name string, content []byte) {
+	must(os.WriteFile(name, content, 0o644))
+}
+
+func minisignKey() (id []byte, pub ed25519.PublicKey, priv ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	must(err)
+	id = make([]byte, 8)
+	rand.Read(id)
+	return
+}
+
+func minisignPub(id []byte, pub ed25519.PublicKey) []byte {
+	raw := append(append([]byte("Ed"), id...), pub...)
+	return []byte(fmt.Sprintf("untrusted comment: minisign public key %X\n%s\n", id, base64.StdEncoding.EncodeToString(raw)))
+}
+
+func minisignSig(alg string, id []byte, priv ed25519.PrivateKey, data []byte) []byte {
+	message := data
+	if alg == "ED" {
+		h := blake2b.Sum512(data)
+		message = h[:]
+	}
+	sig := ed25519.Sign(priv, message)
+	trusted := "timestamp:1700000000\tfile:data.txt\thashed"
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), trusted...))
+	raw := append(append([]byte(alg), id...), sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), trusted, base64.StdEncoding.EncodeToString(global)))
+}
+
+func cosignSig(key *ecdsa.PrivateKey, data []byte) []byte {
+	h := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	must(err)
+	return []byte(base64.StdEncoding.EncodeToString(sig))
+}
+
+func newKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must(err)
+	return key
+}
+
+func pemBlock(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func root(name string, notBefore, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key := newKey()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"sigstore.dev"}, CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	must(err)
+	cert, err := x509.ParseCertificate(der)
+	must(err)
+	return cert, key
+}
+
+// A short lived signing certificate like those of Fulcio, the signature is by its key.
+func leaf(parent *x509.Certificate, parentKey *ecdsa.PrivateKey, notBefore time.Time, data []byte) (certPem, sig []byte) {
+	key := newKey()
+	san, _ := url.Parse(identity)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{san},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	must(err)
+	// cosign publishes certificates base64 encoded.
+	return []byte(base64.StdEncoding.EncodeToString(pemBlock("CERTIFICATE", der))), cosignSig(key, data)
+}
+
+func main() {
+	data, err := os.ReadFile("data.txt")
+	must(err)
+
+	id, pub, priv := minisignKey()
+	write("minisign.pub", minisignPub(id, pub))
+	write("data.txt.minisig", minisignSig("ED", id, priv, data))
+	write("data.txt.legacy.minisig", minisignSig("Ed", id, priv, data))
+	otherId, _, otherPriv := minisignKey()
+	write("data.txt.other.minisig", minisignSig("ED", otherId, otherPriv, data))
+
+	key := newKey()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	must(err)
+	write("cosign.pub", pemBlock("PUBLIC KEY", der))
+	write("data.txt.cosign.sig", cosignSig(key, data))
+	write("data.txt.cosign.other.sig", cosignSig(newKey(), data))
+
+	issued := time.Date(2024, 1, 13, 10, 0, 0, 0, time.UTC)
+	fulcio, fulcioKey := root("sigstore", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+	write("fulcio.pem", pemBlock("CERTIFICATE", fulcio.Raw))
+	cert, sig := leaf(fulcio, fulcioKey, issued, data)
+	write("data.txt.keyless.pem", cert)
+	write("data.txt.keyless.sig", sig)
+	// issued after its root expired.
+	expired, expiredKey := root("sigstore", time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	write("fulcio-expired.pem", pemBlock("CERTIFICATE", expired.Raw))
+	cert, sig = leaf(expired, expiredKey, issued, data)
+	write("data.txt.expired.pem", cert)
+	write("data.txt.expired.sig", sig)
+}
@@ -14,9 +14,10 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gogf/gf/v2/util/gconv"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/request"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
@@ -54,6 +55,9 @@ func (e *EDomains) SetHandler(h func([]string)) {
 func (e *EDomains) sendDomains() {
 	e.sender = make(chan string, 100)
 	for _, d := range e.cnf.GetRawDomains() {
+		if e.cnf.Canceled() {
+			break
+		}
 		e.sender <- d
 	}
 	close(e.sender)
@@ -75,7 +79,7 @@ func (e *EDomains) isCloudflareCDN(sUrl string) (ok bool) {
 			}
 		}
 	} else {
-		gprint.PrintWarning("Failed to parse IP: %s", sUrl)
+		logs.Warning("Failed to parse IP: %s", sUrl)
 	}
 	return
 }
@@ -97,20 +101,24 @@ func (e *EDomains) verifyDomain(sUrl string) {
 	if !strings.HasPrefix(sUrl, "https://") {
 		u = "https://" + sUrl
 	}
-	if resp, err := client.Get(u); err == nil && resp != nil {
+	req, err := http.NewRequestWithContext(e.cnf.Context(), http.MethodGet, u, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := client.Do(req); err == nil && resp != nil {
 		// if len(resp.TLS.PeerCertificates) > 0 {
 		// 	certInfo := resp.TLS.PeerCertificates[0]
 		// 	if strings.Contains(strings.ToLower(certInfo.Subject.String()), "cloudflare") {
-		// 		gprint.PrintSuccess(sUrl)
+		// 		logs.Success(sUrl)
 		// 		e.lock.Lock()
 		// 		e.result = append(e.result, sUrl)
 		// 		e.lock.Unlock()
 		// 	} else {
-		// 		gprint.PrintInfo("No cloudflare: %s", sUrl)
+		// 		logs.Info("No cloudflare: %s", sUrl)
 		// 	}
 		// }
 		if e.isCloudflareCDN(sUrl) {
-			gprint.PrintSuccess(sUrl)
+			logs.Success(sUrl)
 			e.lock.Lock()
 			e.result = append(e.result, sUrl)
 			e.lock.Unlock()
@@ -119,7 +127,7 @@ func (e *EDomains) verifyDomain(sUrl string) {
 			resp.Body.Close()
 		}
 	} else {
-		gprint.PrintWarning("%+v", err)
+		logs.Warning("%+v", err)
 	}
 }
 
@@ -144,7 +152,7 @@ func (e *EDomains) Run() {
 		e.domains()
 	}
 	if e.handler != nil {
-		gprint.PrintInfo("Total: %d", len(e.result))
+		logs.Info("Total: %d", len(e.result))
 		e.handler(e.result)
 	}
 }
@@ -186,10 +194,7 @@ func NewEDCollector(cnf *confs.CollectorConf) (ec *EDCollector) {
 		urls: map[string]struct{}{},
 	}
 	if gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
-		if ec.cnf.ProxyURI == "" {
-			ec.cnf.ProxyURI = DefaultProxy
-		}
-		ec.fetcher.Proxy = ec.cnf.ProxyURI
+		ec.fetcher.Proxy = ec.cnf.Proxy()
 	}
 	return
 }
@@ -212,9 +217,12 @@ func (e *EDCollector) GetResult() []string {
 
 func (e *EDCollector) GetWebsites() {
 	for sUrl := range e.urls {
-		gprint.PrintInfo("Fetch: %s", sUrl)
+		if e.cnf.Canceled() {
+			return
+		}
+		logs.Info("Fetch: %s", sUrl)
 		e.fetcher.SetUrl(sUrl)
-		if respStr, rCode := e.fetcher.GetString(); rCode == 200 {
+		if respStr, rCode := fetch.GetString(e.cnf, e.fetcher); rCode == 200 {
 			if doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(respStr)); err == nil && doc != nil {
 				tr := doc.Find("table").Find("tr")
 				tr.Each(func(_ int, s *goquery.Selection) {
@@ -232,7 +240,7 @@ func (e *EDCollector) Run() {
 	e.result = map[string]struct{}{}
 	for _, sUrl := range e.startUrls {
 		e.fetcher.SetUrl(sUrl)
-		if respStr, rCode := e.fetcher.GetString(); rCode == 200 {
+		if respStr, rCode := fetch.GetString(e.cnf, e.fetcher); rCode == 200 {
 			// os.WriteFile("test.html", []byte(respStr), 0666)
 			if doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(respStr)); err == nil && doc != nil {
 				div := doc.Find("div.card-body").First()
@@ -250,7 +258,7 @@ func (e *EDCollector) Run() {
 	}
 	e.GetWebsites()
 	if e.handler != nil {
-		gprint.PrintInfo("Total rawDomains: %d", len(e.GetResult()))
+		logs.Info("Total rawDomains: %d", len(e.GetResult()))
 		e.handler(e.GetResult())
 	}
 }
@@ -2,18 +2,15 @@ package sites
 
 import (
 	"bytes"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gogf/gf/v2/util/gconv"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/request"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
@@ -46,10 +43,7 @@ func NewFreeFQVPN(cnf *confs.CollectorConf) (fv *FreeFQVPNs) {
 	}
 
 	if gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
-		if fv.cnf.ProxyURI == "" {
-			fv.cnf.ProxyURI = DefaultProxy
-		}
-		fv.fetcher.Proxy = fv.cnf.ProxyURI
+		fv.fetcher.Proxy = fv.cnf.Proxy()
 	}
 	return
 }
@@ -63,43 +57,21 @@ func (f *FreeFQVPNs) SetHandler(h func([]string)) {
 }
 
 func (f *FreeFQVPNs) getUrl(sUrl string) (r string) {
-	c := &http.Client{
-		Timeout: time.Duration(30) * time.Second,
-	}
-
-	if gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
-		if f.cnf.ProxyURI == "" {
-			f.cnf.ProxyURI = DefaultProxy
-		}
-		u, _ := url.Parse(f.cnf.ProxyURI)
-		c.Transport = &http.Transport{
-			MaxIdleConns:    10,
-			MaxConnsPerHost: 10,
-			IdleConnTimeout: time.Duration(10) * time.Second,
-			Proxy:           http.ProxyURL(u),
-		}
-	}
-
-	if resp, err := c.Get(sUrl); err == nil {
-		content, _ := io.ReadAll(resp.Body)
-		r = string(content)
-		resp.Body.Close()
-	} else {
-		gprint.PrintError("%+v", err)
-	}
+	f.fetcher.SetUrl(sUrl)
+	r, _ = fetch.GetString(f.cnf, f.fetcher)
 	return
 }
 
 func (f *FreeFQVPNs) getUrls() (r []string) {
 	for _, sUrl := range f.urls {
-		gprint.PrintInfo("Getting: %s", sUrl)
+		logs.Info("Getting: %s", sUrl)
 		content := f.getUrl(sUrl)
 		// fmt.Println(content)
 		if doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(content)); err == nil && doc != nil {
 			href := doc.Find("td.news_list").Find("ul").First().Find("li").First().Find("a").AttrOr("href", "")
 			if href != "" {
 				detailUrl := f.host + href
-				gprint.PrintInfo("Dowload: %s", detailUrl)
+				logs.Info("Dowload: %s", detailUrl)
 				content = f.getUrl(detailUrl)
 				if doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(content)); err == nil && doc != nil {
 					fUrl := doc.Find("fieldset").Find("a").AttrOr("href", "")
@@ -0,0 +1,400 @@
+package sites
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/goutils/pkgs/crypt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	maxUriLength int = 1 << 20
+	sniffSize    int = 4096
+)
+
+// Kinds of pages returned instead of a subscription payload.
+const (
+	PageHtml       string = "html page"
+	PageCloudflare string = "cloudflare challenge"
+	PageCaptive    string = "captive portal"
+)
+
+var (
+	cloudflareMarkers = []string{
+		"cf-browser-verification", "cf_chl_opt", "challenge-platform", "cf-challenge",
+		"<title>just a moment...</title>", "attention required! | cloudflare",
+	}
+	captiveMarkers = []string{
+		"<wispaccessgatewayparam", "captive portal", "captive-portal", "hotspot login", "wifi login", "wi-fi login",
+	}
+)
+
+// A page returned by a subscription url instead of a payload, the fetch failed.
+type PageError struct {
+	Kind string
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("got a %s instead of a subscription", e.Kind)
+}
+
+/*
+Tells pages from payloads by the beginning of a response: error pages, cloudflare challenges and
+captive portals are html or xml, payloads never start with "<". "" for payloads.
+*/
+func sniffPage(head []byte) string {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(string(head), "\ufeff"))
+	if !strings.HasPrefix(trimmed, "<") {
+		return ""
+	}
+	lower := strings.ToLower(trimmed)
+	for _, m := range cloudflareMarkers {
+		if strings.Contains(lower, m) {
+			return PageCloudflare
+		}
+	}
+	for _, m := range captiveMarkers {
+		if strings.Contains(lower, m) {
+			return PageCaptive
+		}
+	}
+	return PageHtml
+}
+
+/*
+Extracts proxy uris from a subscription payload according to the format hint.
+Pages are refused with a *PageError whatever the hint is, so they never reach the parsers.
+
+Uri lists, plain or base64 encoded, are decoded and parsed line by line while they are read,
+clash and sing-box configs are read at once to be parsed.
+*/
+func parseSubStream(r io.Reader, format string) (uris []string, err error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(sniffSize)
+	if kind := sniffPage(head); kind != "" {
+		return nil, &PageError{Kind: kind}
+	}
+	if format == confs.SubFormatAuto {
+		format = guessSubFormat(br)
+	}
+	switch format {
+	case confs.SubFormatBase64:
+		return base64Lines(br)
+	case confs.SubFormatPlain:
+		return uriLines(br)
+	case confs.SubFormatClash, confs.SubFormatSingbox:
+		content, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		if format == confs.SubFormatClash {
+			return parseClash(content), nil
+		}
+		return parseSingbox(content), nil
+	default:
+		return nil, nil
+	}
+}
+
+// Guesses the format from the beginning of a payload.
+func guessSubFormat(br *bufio.Reader) string {
+	head, _ := br.Peek(sniffSize)
+	lower := strings.ToLower(string(head))
+	switch {
+	case strings.Contains(lower, "proxies:"):
+		return confs.SubFormatClash
+	case strings.Contains(lower, "\"outbounds\""):
+		return confs.SubFormatSingbox
+	case strings.Contains(lower, "://"):
+		return confs.SubFormatPlain
+	default:
+		return confs.SubFormatBase64
+	}
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxUriLength)
+	return scanner
+}
+
+func uriLines(r io.Reader) (uris []string, err error) {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.Contains(line, "://") {
+			uris = append(uris, line)
+		}
+	}
+	return uris, scanner.Err()
+}
+
+/*
+Decodes base64 lines of a payload, each line is a base64 encoded uri list, usually there is only one.
+A line is decoded while it is read, urlsafe alphabets and missing paddings are accepted.
+*/
+func base64Lines(br *bufio.Reader) (uris []string, err error) {
+	buf := make([]byte, 4096)
+	for {
+		line := &base64Line{br: br}
+		found, _ := uriLines(base64.NewDecoder(base64.StdEncoding, line))
+		uris = append(uris, found...)
+		// the rest of a broken line is skipped.
+		for !line.eol {
+			line.Read(buf)
+		}
+		if line.err != nil {
+			return uris, line.err
+		}
+		if line.eof {
+			return uris, nil
+		}
+	}
+}
+
+// Reads one base64 line of a payload, padded to a multiple of 4.
+type base64Line struct {
+	br    *bufio.Reader
+	count int
+	eol   bool  // end of the line.
+	eof   bool  // end of the payload.
+	err   error // read errors other than io.EOF.
+}
+
+func (l *base64Line) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if l.eol {
+			if l.count%4 == 0 {
+				break
+			}
+			p[n] = '='
+			n++
+			l.count++
+			continue
+		}
+		c, err := l.br.ReadByte()
+		if err != nil {
+			l.eol, l.eof = true, true
+			if err != io.EOF {
+				l.err = err
+			}
+			continue
+		}
+		switch c {
+		case '\n':
+			l.eol = true
+			continue
+		case '\r', ' ', '\t', '=':
+			continue
+		case '-':
+			c = '+'
+		case '_':
+			c = '/'
+		}
+		p[n] = c
+		n++
+		l.count++
+	}
+	if n == 0 && l.eol {
+		return 0, io.EOF
+	}
+	return
+}
+
+/*
+subNode is a proxy node from clash or sing-box configs.
+Only shadowsocks, vmess, vless and trojan are converted to uris.
+*/
+type subNode struct {
+	Type     string
+	Name     string
+	Server   string
+	Port     int
+	Cipher   string
+	Password string
+	UUID     string
+	AlterID  int
+	Flow     string
+	Network  string
+	Path     string
+	Host     string
+	TLS      bool
+	SNI      string
+}
+
+func (n *subNode) URI() string {
+	server := strings.TrimSuffix(strings.TrimPrefix(n.Server, "["), "]")
+	if !validServer(server) || n.Port <= 0 || n.Port > 65535 {
+		return ""
+	}
+	// IPv6 servers are bracketed.
+	addr := net.JoinHostPort(server, strconv.Itoa(n.Port))
+	name := url.PathEscape(n.Name)
+	query := url.Values{}
+	if n.Network != "" && n.Network != "tcp" {
+		query.Set("type", n.Network)
+	}
+	if n.Path != "" {
+		query.Set("path", n.Path)
+	}
+	if n.Host != "" {
+		query.Set("host", n.Host)
+	}
+	if n.SNI != "" {
+		query.Set("sni", n.SNI)
+	}
+
+	switch n.Type {
+	case "ss", "shadowsocks":
+		userInfo := crypt.EncodeBase64(fmt.Sprintf("%s:%s", n.Cipher, n.Password))
+		return fmt.Sprintf("ss://%s@%s#%s", userInfo, addr, name)
+	case "vmess":
+		tls := ""
+		if n.TLS {
+			tls = "tls"
+		}
+		network := n.Network
+		if network == "" {
+			network = "tcp"
+		}
+		content, _ := json.Marshal(map[string]string{
+			"v":    "2",
+			"ps":   n.Name,
+			"add":  n.Server,
+			"port": gconv.String(n.Port),
+			"id":   n.UUID,
+			"aid":  gconv.String(n.AlterID),
+			"net":  network,
+			"type": "none",
+			"host": n.Host,
+			"path": n.Path,
+			"tls":  tls,
+			"sni":  n.SNI,
+		})
+		return "vmess://" + crypt.EncodeBase64(string(content))
+	case "vless":
+		if n.TLS {
+			query.Set("security", "tls")
+		}
+		if n.Flow != "" {
+			query.Set("flow", n.Flow)
+		}
+		return fmt.Sprintf("vless://%s@%s?%s#%s", url.PathEscape(n.UUID), addr, query.Encode(), name)
+	case "trojan":
+		return fmt.Sprintf("trojan://%s@%s?%s#%s", url.PathEscape(n.Password), addr, query.Encode(), name)
+	default:
+		return ""
+	}
+}
+
+/*
+Servers are IPs or host names, anything else, like characters of uri syntax,
+would inject parts into the uri.
+*/
+func validServer(server string) bool {
+	if server == "" {
+		return false
+	}
+	if net.ParseIP(server) != nil {
+		return true
+	}
+	for _, c := range server {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '.' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeURIs(nodes []*subNode) (r []string) {
+	for _, n := range nodes {
+		if uri := n.URI(); uri != "" {
+			r = append(r, uri)
+		}
+	}
+	return
+}
+
+// Converts proxies in a clash config.
+func parseClash(content []byte) (r []string) {
+	conf := struct {
+		Proxies []map[string]any `yaml:"proxies"`
+	}{}
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		return
+	}
+	nodes := []*subNode{}
+	for _, p := range conf.Proxies {
+		n := &subNode{
+			Type:     gconv.String(p["type"]),
+			Name:     gconv.String(p["name"]),
+			Server:   gconv.String(p["server"]),
+			Port:     gconv.Int(p["port"]),
+			Cipher:   gconv.String(p["cipher"]),
+			Password: gconv.String(p["password"]),
+			UUID:     gconv.String(p["uuid"]),
+			AlterID:  gconv.Int(p["alterId"]),
+			Flow:     gconv.String(p["flow"]),
+			Network:  gconv.String(p["network"]),
+			TLS:      gconv.Bool(p["tls"]),
+			SNI:      gconv.String(p["servername"]),
+		}
+		if n.SNI == "" {
+			n.SNI = gconv.String(p["sni"])
+		}
+		if n.Type == "trojan" {
+			n.TLS = true
+		}
+		if opts := gconv.Map(p["ws-opts"]); opts != nil {
+			n.Path = gconv.String(opts["path"])
+			n.Host = gconv.String(gconv.Map(opts["headers"])["Host"])
+		}
+		nodes = append(nodes, n)
+	}
+	return nodeURIs(nodes)
+}
+
+// Converts outbounds in a sing-box config.
+func parseSingbox(content []byte) (r []string) {
+	conf := struct {
+		Outbounds []map[string]any `json:"outbounds"`
+	}{}
+	if err := json.Unmarshal(content, &conf); err != nil {
+		return
+	}
+	nodes := []*subNode{}
+	for _, o := range conf.Outbounds {
+		n := &subNode{
+			Type:     gconv.String(o["type"]),
+			Name:     gconv.String(o["tag"]),
+			Server:   gconv.String(o["server"]),
+			Port:     gconv.Int(o["server_port"]),
+			Cipher:   gconv.String(o["method"]),
+			Password: gconv.String(o["password"]),
+			UUID:     gconv.String(o["uuid"]),
+			AlterID:  gconv.Int(o["alter_id"]),
+			Flow:     gconv.String(o["flow"]),
+		}
+		if tls := gconv.Map(o["tls"]); tls != nil {
+			n.TLS = gconv.Bool(tls["enabled"])
+			n.SNI = gconv.String(tls["server_name"])
+		}
+		if transport := gconv.Map(o["transport"]); transport != nil {
+			n.Network = gconv.String(transport["type"])
+			n.Path = gconv.String(transport["path"])
+			n.Host = gconv.String(gconv.Map(transport["headers"])["Host"])
+		}
+		nodes = append(nodes, n)
+	}
+	return nodeURIs(nodes)
+}
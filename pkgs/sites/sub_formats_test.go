@@ -0,0 +1,121 @@
+package sites
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/goutils/pkgs/crypt"
+)
+
+var subFormats = []string{
+	confs.SubFormatAuto,
+	confs.SubFormatBase64,
+	confs.SubFormatPlain,
+	confs.SubFormatClash,
+	confs.SubFormatSingbox,
+}
+
+const (
+	seedUris = "vmess://eyJhZGQiOiIxLjIuMy40IiwicG9ydCI6IjQ0MyJ9\n" +
+		"vless://uuid@example.com:443?type=ws&security=tls#node\n" +
+		"ss://YWVzLTEyOC1nY206cGFzcw@1.2.3.4:8388#ss\n" +
+		"ssr://MS4yLjMuNDo4Mzg4Om9yaWdpbjphZXMtMTI4LWNmYjpwbGFpbjpjR0Z6Y3cvP3JlbWFya3M9\n" +
+		"trojan://pass@[2001:db8::1]:443?sni=example.com#trojan\n"
+	seedClash = `proxies:
+  - {name: a, type: ss, server: 1.2.3.4, port: 8388, cipher: aes-128-gcm, password: pass}
+  - {name: b, type: vmess, server: example.com, port: 443, uuid: id, alterId: 0, tls: true}
+  - {name: c, type: trojan, server: "evil.com/#", port: 443, password: pass}
+`
+	seedSingbox = `{"outbounds": [
+  {"type": "vless", "tag": "a", "server": "example.com", "server_port": 443, "uuid": "id", "tls": {"enabled": true}},
+  {"type": "shadowsocks", "tag": "b", "server": "::1", "server_port": 70000, "method": "aes-128-gcm", "password": "p"}
+]}`
+)
+
+// Subscriptions are hostile input, no payload may panic, and only uris come out.
+func FuzzParseSubStream(f *testing.F) {
+	f.Add([]byte(seedUris))
+	f.Add([]byte(base64.StdEncoding.EncodeToString([]byte(seedUris))))
+	f.Add([]byte(base64.RawURLEncoding.EncodeToString([]byte(seedUris)) + "\r\n" + base64.StdEncoding.EncodeToString([]byte("ss://x@y:1"))))
+	f.Add([]byte(seedClash))
+	f.Add([]byte(seedSingbox))
+	f.Add([]byte("<html><title>Just a moment...</title></html>"))
+	f.Add([]byte("\ufeff====\n-_-_\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, format := range subFormats {
+			uris, err := parseSubStream(bytes.NewReader(data), format)
+			if err != nil {
+				continue
+			}
+			for _, uri := range uris {
+				if !strings.Contains(uri, "://") {
+					t.Fatalf("format %q: %q is not an uri", format, uri)
+				}
+			}
+		}
+	})
+}
+
+// A base64 payload decodes to the same uris as the plain list, whatever the alphabet and padding are.
+func FuzzBase64Lines(f *testing.F) {
+	f.Add(seedUris)
+	f.Add("ss://a@b:1\r\nnot an uri\n\n  trojan://p@h:2  ")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, text string) {
+		want, _ := uriLines(strings.NewReader(text))
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			payload := enc.EncodeToString([]byte(text))
+			got, err := base64Lines(bufio.NewReader(strings.NewReader(payload)))
+			if err != nil {
+				t.Fatalf("base64Lines(%q): %v", payload, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("base64Lines(%q) = %q, want %q", payload, got, want)
+			}
+		}
+	})
+}
+
+// Fields of clash and sing-box nodes never change the server or port of the uri.
+func FuzzSubNodeURI(f *testing.F) {
+	for _, typ := range []string{"ss", "vmess", "vless", "trojan"} {
+		f.Add(typ, "example.com", 443, "name", "pass", "uuid")
+		f.Add(typ, "[2001:db8::1]", 8443, "节点 #1", "p@ss/word?#", "u@evil.com:1/#")
+		f.Add(typ, "evil.com/#@", 1, "", "", "")
+		f.Add(typ, "fe80::1%eth0", 65536, "", "", "")
+	}
+	f.Fuzz(func(t *testing.T, typ, server string, port int, name, password, uuid string) {
+		n := &subNode{Type: typ, Name: name, Server: server, Port: port, Password: password, UUID: uuid, Cipher: "aes-128-gcm"}
+		uri := n.URI()
+		if uri == "" {
+			return
+		}
+		wantHost := strings.TrimSuffix(strings.TrimPrefix(server, "["), "]")
+		if typ == "vmess" {
+			content := crypt.DecodeBase64(strings.TrimPrefix(uri, "vmess://"))
+			v := map[string]string{}
+			if err := json.Unmarshal([]byte(content), &v); err != nil {
+				t.Fatalf("%q: %v", uri, err)
+			}
+			if v["add"] != server || v["port"] != strconv.Itoa(port) {
+				t.Fatalf("%q: server %q:%q, want %q:%d", uri, v["add"], v["port"], server, port)
+			}
+			return
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatalf("%q: %v", uri, err)
+		}
+		if u.Hostname() != wantHost || u.Port() != strconv.Itoa(port) {
+			t.Fatalf("%q: server %q:%q, want %q:%d", uri, u.Hostname(), u.Port(), wantHost, port)
+		}
+	})
+}
@@ -1,14 +1,16 @@
 package sites
 
 import (
+	"net/url"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/gogf/gf/v2/util/gconv"
-	"github.com/gvcgo/goutils/pkgs/crypt"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/request"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/progress"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
@@ -29,7 +31,7 @@ func NewSubVPN(cnf *confs.CollectorConf) (sv *SubscribedVPNs) {
 		fetcher: request.NewFetcher(),
 	}
 	if gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
-		sv.fetcher.Proxy = sv.cnf.ProxyURI
+		sv.fetcher.Proxy = sv.cnf.Proxy()
 	}
 	return
 }
@@ -44,37 +46,57 @@ func (s *SubscribedVPNs) SetHandler(h func([]string)) {
 
 // Fetches subscribed urls.
 func (s *SubscribedVPNs) fetch() {
-	if s.cnf != nil {
-		for _, sUrl := range s.cnf.GetSubs() {
-			subUrl := confs.HandleSubscribedUrl(sUrl, s.cnf)
-			if subUrl == "" {
-				continue
-			}
-			gprint.PrintInfo("Getting: %s", subUrl)
-			s.fetcher.SetUrl(subUrl)
-			if content, statusCode := s.fetcher.GetString(); len(content) > 0 {
-				decryptedContent := crypt.DecodeBase64(content)
-				if len(decryptedContent) == 0 && len(content) > 500 && !strings.Contains(content, "</html>") {
-					// fmt.Println(content)
-					for _, encryptedContent := range strings.Split(content, "\n") {
-						decryptedContent = crypt.DecodeBase64(strings.TrimSpace(encryptedContent))
-						for _, rawUri := range strings.Split(decryptedContent, "\n") {
-							if strings.Contains(rawUri, "://") {
-								s.result = append(s.result, strings.TrimSpace(rawUri))
-							}
-						}
-					}
-				} else if len(content) > 800 && !strings.Contains(content, "</html>") {
-					for _, rawUri := range strings.Split(decryptedContent, "\n") {
-						if strings.Contains(rawUri, "://") {
-							s.result = append(s.result, strings.TrimSpace(rawUri))
-						}
-					}
-				}
-			} else {
-				gprint.PrintError("status code: %d", statusCode)
-			}
+	if s.cnf == nil {
+		return
+	}
+	now := time.Now()
+	fetched := []string{}
+	tracker := progress.Current()
+	for _, sub := range s.cnf.GetSubscribers() {
+		if err := sub.Validate(); err != nil {
+			logs.Warning("%+v", err)
+			continue
+		}
+		if s.cnf.Canceled() {
+			break
+		}
+		if !sub.Due(now) {
+			continue
 		}
+		subUrl := confs.HandleSubscribedUrl(sub.Url, s.cnf)
+		if subUrl == "" {
+			continue
+		}
+		logs.Info("Getting: %s", subUrl)
+		// subscriptions are tracked by host, their urls often carry tokens.
+		task := "sub"
+		if u, err := url.Parse(subUrl); err == nil {
+			task += " " + u.Host
+		}
+		tracker.AddTotal(1)
+		tracker.Begin(task)
+		s.fetcher.SetUrl(subUrl)
+		s.fetcher.Headers = sub.Headers
+		body, _, err := fetch.Open(s.cnf, s.fetcher, s.cnf.SubMaxSize(sub))
+		if err != nil {
+			logs.Error("Get %s failed: %+v", subUrl, err)
+			tracker.End(task, true)
+			continue
+		}
+		uris, err := parseSubStream(body, sub.Format)
+		body.Close()
+		if err != nil {
+			// a payload over the size limit is dropped as a whole, pages like cloudflare challenges fail the fetch.
+			logs.Error("Read %s failed: %+v", subUrl, err)
+			tracker.End(task, true)
+			continue
+		}
+		tracker.End(task, false)
+		s.result = append(s.result, uris...)
+		fetched = append(fetched, sub.Url)
+	}
+	if len(fetched) > 0 {
+		s.cnf.MarkSubsFetched(fetched...)
 	}
 }
 
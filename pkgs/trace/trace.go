@@ -0,0 +1,262 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+OpenTelemetry tracing of runs, exported by OTLP over http with json encoding.
+
+Spans: the run of a command, collectors fetching and uploading, fetches (with hosts and urls, so slow sites
+and subscriptions show up), HEAD checks, checksums and uploads. Spans are children of the run span
+in the run context, see confs.CollectorConf.Context.
+
+Tracing is off unless OtlpEndpoint or OTEL_EXPORTER_OTLP_ENDPOINT is set, like http://localhost:4318.
+*/
+
+const (
+	OtlpEndpointEnvName string = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	OtlpHeadersEnvName  string = "OTEL_EXPORTER_OTLP_HEADERS"
+	ServiceName         string = "proxy-collector"
+	batchSize           int    = 512
+)
+
+var (
+	exportLock = &sync.Mutex{}
+	endpoint   string
+	headers    = map[string]string{}
+	pending    = []*otlpSpan{}
+)
+
+/*
+Enables tracing when endpoint, or OTEL_EXPORTER_OTLP_ENDPOINT, is set.
+hdrs are like "key1=value1,key2=value2", OTEL_EXPORTER_OTLP_HEADERS by default.
+*/
+func Setup(ep, hdrs string) {
+	if ep == "" {
+		ep = os.Getenv(OtlpEndpointEnvName)
+	}
+	if hdrs == "" {
+		hdrs = os.Getenv(OtlpHeadersEnvName)
+	}
+	exportLock.Lock()
+	defer exportLock.Unlock()
+	endpoint = strings.TrimSuffix(ep, "/")
+	headers = map[string]string{}
+	for _, kv := range strings.Split(hdrs, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+}
+
+func Enabled() bool {
+	exportLock.Lock()
+	defer exportLock.Unlock()
+	return endpoint != ""
+}
+
+type spanKey struct{}
+
+// A span, nil when tracing is off, methods of a nil span do nothing.
+type Span struct {
+	traceId  string
+	spanId   string
+	parentId string
+	name     string
+	start    time.Time
+	lock     *sync.Mutex
+	attrs    []*otlpAttr
+	err      string
+	ended    bool
+}
+
+func newId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+/*
+Starts a span as a child of the span in ctx, attributes are key, value pairs.
+Returns ctx with the span.
+*/
+func Start(ctx context.Context, name string, kv ...any) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	s := &Span{
+		spanId: newId(8),
+		name:   name,
+		start:  time.Now(),
+		lock:   &sync.Mutex{},
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceId, s.parentId = parent.traceId, parent.spanId
+	} else {
+		s.traceId = newId(16)
+	}
+	s.Set(kv...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *Span) Set(kv ...any) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		a := &otlpAttr{Key: fmt.Sprint(kv[i])}
+		switch v := kv[i+1].(type) {
+		case int:
+			a.Value.IntValue = strconv.Itoa(v)
+		case int64:
+			a.Value.IntValue = strconv.FormatInt(v, 10)
+		case bool:
+			a.Value.BoolValue = &v
+		default:
+			str := fmt.Sprint(v)
+			a.Value.StringValue = &str
+		}
+		s.attrs = append(s.attrs, a)
+	}
+}
+
+// Marks the span as failed.
+func (s *Span) Fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	s.err = err.Error()
+	s.lock.Unlock()
+}
+
+// Ends the span, and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	sp := &otlpSpan{
+		TraceId:      s.traceId,
+		SpanId:       s.spanId,
+		ParentSpanId: s.parentId,
+		Name:         s.name,
+		Kind:         1, // internal.
+		Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+		End:          strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:   s.attrs,
+	}
+	if s.err != "" {
+		sp.Status = &otlpStatus{Code: 2, Message: s.err}
+	}
+	s.lock.Unlock()
+
+	exportLock.Lock()
+	pending = append(pending, sp)
+	full := len(pending) >= batchSize
+	exportLock.Unlock()
+	if full {
+		go Flush()
+	}
+}
+
+// Exports ended spans, at the end of a run and when a batch is full.
+func Flush() {
+	exportLock.Lock()
+	spans, ep, hdrs := pending, endpoint, headers
+	pending = []*otlpSpan{}
+	exportLock.Unlock()
+	if len(spans) == 0 || ep == "" {
+		return
+	}
+	body := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []*otlpAttr{stringAttr("service.name", ServiceName)},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "github.com/gvcgo/collector"},
+				"spans": spans,
+			}},
+		}},
+	}
+	content, err := json.Marshal(body)
+	if err != nil {
+		logs.Warning("Encode spans failed: %+v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep+"/v1/traces", bytes.NewReader(content))
+	if err != nil {
+		logs.Warning("Export spans failed: %+v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hdrs {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logs.Warning("Export spans failed: %+v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logs.Warning("Export spans failed, status code: %d", resp.StatusCode)
+	}
+}
+
+// OTLP json encoding, ids are hex and times are nanoseconds as strings.
+type otlpSpan struct {
+	TraceId      string      `json:"traceId"`
+	SpanId       string      `json:"spanId"`
+	ParentSpanId string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []*otlpAttr `json:"attributes,omitempty"`
+	Status       *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    string  `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	} `json:"value"`
+}
+
+func stringAttr(k, v string) *otlpAttr {
+	a := &otlpAttr{Key: k}
+	a.Value.StringValue = &v
+	return a
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,176 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+const (
+	AzureAPIVersion string = "2021-08-06"
+)
+
+/*
+AzureStorage uploads files as block blobs into an Azure Blob Storage container,
+authorized by a SAS token with read/write/delete permissions.
+*/
+type AzureStorage struct {
+	Account   string
+	Container string
+	SAS       string // SAS token, with or without the leading "?".
+	Proxy     string
+	client    *http.Client
+}
+
+func NewAzureStorage(account, container, sas string) (a *AzureStorage) {
+	a = &AzureStorage{
+		Account:   account,
+		Container: container,
+		SAS:       strings.TrimPrefix(sas, "?"),
+	}
+	return
+}
+
+func (a *AzureStorage) blobUrl(blobPath string) string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s?%s",
+		a.Account, a.Container, (&url.URL{Path: blobPath}).EscapedPath(), a.SAS)
+}
+
+func (a *AzureStorage) do(method, blobPath string, body []byte, headers map[string]string) (r []byte, code int) {
+	return a.doUrl(method, a.blobUrl(blobPath), body, headers)
+}
+
+func (a *AzureStorage) doUrl(method, rawUrl string, body []byte, headers map[string]string) (r []byte, code int) {
+	if a.client == nil {
+		a.client = newHttpClient(a.Proxy)
+	}
+	req, err := http.NewRequest(method, rawUrl, bytes.NewReader(body))
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	req.Header.Set("x-ms-version", AzureAPIVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	defer resp.Body.Close()
+	r, _ = io.ReadAll(resp.Body)
+	return r, resp.StatusCode
+}
+
+// Containers are created in the azure portal.
+func (a *AzureStorage) CreateRepo(repoName string) []byte {
+	logs.Warning("Please create the azure container %s manually.", a.Container)
+	return nil
+}
+
+func (a *AzureStorage) GetRepoInfo(repoName string) []byte {
+	return []byte(fmt.Sprintf(`{"id":"%s/%s"}`, a.Account, a.Container))
+}
+
+func (a *AzureStorage) GetContents(repoName, remotePath, fileName string) []byte {
+	p := contentsPath(remotePath, fileName)
+	content, code := a.do(http.MethodGet, p, nil, nil)
+	switch code {
+	case http.StatusOK:
+		return contentsInfo(fileName, p, content)
+	case http.StatusNotFound:
+		return notFoundInfo()
+	}
+	return nil
+}
+
+func (a *AzureStorage) UploadFile(repoName, remotePath, localPath, shaStr string) []byte {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return failureInfo(err)
+	}
+	fName := filepath.Base(localPath)
+	p := contentsPath(remotePath, fName)
+	r, code := a.do(http.MethodPut, p, content, map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+		"Content-Type":   contentType(localPath),
+	})
+	if code != http.StatusCreated {
+		return failureInfo(fmt.Errorf("status %d: %s", code, strings.TrimSpace(string(r))))
+	}
+	return uploadedInfo(fName, p)
+}
+
+func (a *AzureStorage) DeleteFile(repoName, remotePath, fileName, shaStr string) []byte {
+	r, _ := a.do(http.MethodDelete, contentsPath(remotePath, fileName), nil, nil)
+	return r
+}
+
+func contentType(fPath string) string {
+	switch {
+	case strings.HasSuffix(fPath, ".json"):
+		return "application/json"
+	case strings.HasSuffix(fPath, ".txt"):
+		return "text/plain; charset=utf-8"
+	case strings.HasSuffix(fPath, compressSuffix[CompressGzip]):
+		return "application/gzip"
+	case strings.HasSuffix(fPath, compressSuffix[CompressZstd]):
+		return "application/zstd"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func azureBlockID(idx int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", idx)))
+}
+
+/*
+Uploads a large file as staged blocks, then commits the block list.
+Uncommitted blocks are kept by azure for 7 days, so finished blocks are skipped on resume.
+*/
+func (a *AzureStorage) PutResumable(remotePath, localFilePath string, state *ResumeState) error {
+	blobUrl := a.blobUrl(remotePath)
+	blockList := "<?xml version=\"1.0\" encoding=\"utf-8\"?><BlockList>"
+	for idx := 0; idx < state.PartCount(); idx++ {
+		blockID := azureBlockID(idx)
+		blockList += fmt.Sprintf("<Latest>%s</Latest>", blockID)
+		if state.PartDone(idx) {
+			continue
+		}
+		err := retryPart(fmt.Sprintf("block %d of %s", idx, remotePath), func() error {
+			part, err := readRange(localFilePath, int64(idx)*state.PartSize, state.PartSize)
+			if err != nil {
+				return err
+			}
+			r, code := a.doUrl(http.MethodPut, blobUrl+"&comp=block&blockid="+url.QueryEscape(blockID), part, nil)
+			if code != http.StatusCreated {
+				return fmt.Errorf("status %d: %s", code, string(r))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		state.Parts = append(state.Parts, idx)
+		state.Save()
+	}
+	blockList += "</BlockList>"
+	r, code := a.doUrl(http.MethodPut, blobUrl+"&comp=blocklist", []byte(blockList), map[string]string{
+		"x-ms-blob-content-type": contentType(localFilePath),
+	})
+	if code != http.StatusCreated {
+		return fmt.Errorf("commit blocks of %s failed: %d %s", remotePath, code, string(r))
+	}
+	state.Done()
+	return nil
+}
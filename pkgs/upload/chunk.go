@@ -0,0 +1,175 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	DefaultChunkSize int64  = 1 << 20 // gitee contents api rejects large files.
+	ChunkIndexSuffix string = ".index.json"
+	chunkNamePattern string = "%s.part%03d"
+)
+
+/*
+ChunkIndex describes how to reassemble a file split into chunks:
+download every chunk in order, concatenate them and verify the sha256.
+
+	{
+	    "name": "go.version.json",
+	    "size": 2345678,
+	    "sha256": "...",
+	    "chunk_size": 1048576,
+	    "chunks": ["go.version.json.part001", "go.version.json.part002", "go.version.json.part003"]
+	}
+*/
+type ChunkIndex struct {
+	Name      string   `json:"name"`
+	Size      int64    `json:"size"`
+	Sha256    string   `json:"sha256"`
+	ChunkSize int64    `json:"chunk_size"`
+	Chunks    []string `json:"chunks"`
+}
+
+func (u *Uploader) chunkSize() int64 {
+	if u.cnf.ChunkSize > 0 {
+		return u.cnf.ChunkSize
+	}
+	return DefaultChunkSize
+}
+
+// Only gitee needs chunking for now.
+func (u *Uploader) needChunk(localFilePath string) bool {
+	if u.cnf.Type != confs.StorageGitee {
+		return false
+	}
+	info, err := os.Stat(localFilePath)
+	return err == nil && info.Size() > u.chunkSize()
+}
+
+// Splits a file into numbered chunks in a temp dir.
+func splitFile(localFilePath string, chunkSize int64) (tmpDir string, chunks []string, err error) {
+	src, err := os.Open(localFilePath)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	tmpDir, err = os.MkdirTemp("", "pxy-chunks-")
+	if err != nil {
+		return
+	}
+	fileName := filepath.Base(localFilePath)
+	for i := 1; ; i++ {
+		chunkPath := filepath.Join(tmpDir, fmt.Sprintf(chunkNamePattern, fileName, i))
+		var (
+			dst *os.File
+			n   int64
+		)
+		if dst, err = os.Create(chunkPath); err != nil {
+			return
+		}
+		n, err = io.CopyN(dst, src, chunkSize)
+		dst.Close()
+		if n > 0 {
+			chunks = append(chunks, chunkPath)
+		} else {
+			os.Remove(chunkPath)
+		}
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+/*
+Uploads an oversized file as chunks plus an index file.
+Returns remote paths of the chunks and the index.
+The index is only uploaded when every chunk is, then the unchunked copy of an earlier run is deleted.
+*/
+func (u *Uploader) uploadChunks(localFilePath, remotePath string) (chunks []string, index string, err error) {
+	tmpDir, chunkPaths, err := splitFile(localFilePath, u.chunkSize())
+	if tmpDir != "" {
+		defer os.RemoveAll(tmpDir)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("split %s failed: %w", localFilePath, err)
+	}
+
+	_, remoteName := splitRemotePath(remotePath)
+	idx := &ChunkIndex{
+		Name:      remoteName,
+		ChunkSize: u.chunkSize(),
+	}
+	idx.Size, idx.Sha256 = fileSha256(localFilePath)
+	for i, chunkPath := range chunkPaths {
+		chunkRemotePath := fmt.Sprintf(chunkNamePattern, remotePath, i+1)
+		if err = u.upload(chunkPath, chunkRemotePath); err != nil {
+			return nil, "", fmt.Errorf("upload chunk %s failed: %w", chunkRemotePath, err)
+		}
+		_, chunkName := splitRemotePath(chunkRemotePath)
+		idx.Chunks = append(idx.Chunks, chunkName)
+		chunks = append(chunks, chunkRemotePath)
+	}
+
+	content, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	indexPath := filepath.Join(tmpDir, filepath.Base(localFilePath)+ChunkIndexSuffix)
+	if err = utils.WriteFile(indexPath, content, os.ModePerm); err != nil {
+		return nil, "", err
+	}
+	index = remotePath + ChunkIndexSuffix
+	if err = u.upload(indexPath, index); err != nil {
+		return nil, "", fmt.Errorf("upload chunk index %s failed: %w", index, err)
+	}
+	if u.mode == "" {
+		if err := u.storage.Delete(remotePath); err != nil && !errors.Is(err, ErrNotFound) {
+			logs.Warning("Delete unchunked %s failed: %+v", remotePath, err)
+		}
+	}
+	return chunks, index, nil
+}
+
+// Reassembles a chunked file from its index, see ChunkIndex.
+func (u *Uploader) publishedChunks(remotePath string) ([]byte, error) {
+	content, err := u.storage.Get(remotePath + ChunkIndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	idx := &ChunkIndex{}
+	if err := json.Unmarshal(content, idx); err != nil {
+		return nil, fmt.Errorf("parse chunk index of %s failed: %w", remotePath, err)
+	}
+	remoteDir, _ := splitRemotePath(remotePath)
+	buf := &bytes.Buffer{}
+	for _, chunkName := range idx.Chunks {
+		chunk, err := u.storage.Get(path.Join(remoteDir, chunkName))
+		if err != nil {
+			return nil, fmt.Errorf("get chunk %s failed: %w", chunkName, err)
+		}
+		buf.Write(chunk)
+	}
+	h := sha256.Sum256(buf.Bytes())
+	if int64(buf.Len()) != idx.Size || hex.EncodeToString(h[:]) != idx.Sha256 {
+		return nil, fmt.Errorf("chunks of %s do not match the index", remotePath)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package upload
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressGzip        string = "gzip"
+	CompressZstd        string = "zstd"
+	DefaultCompressSize int64  = 1 << 20 // 1MB
+)
+
+var compressSuffix = map[string]string{
+	CompressGzip: ".gz",
+	CompressZstd: ".zst",
+}
+
+// Parses compress methods from config, like "gzip,zstd".
+func parseCompressMethods(s string) (r []string) {
+	for _, m := range strings.Split(strings.ToLower(s), ",") {
+		m = strings.TrimSpace(m)
+		if _, ok := compressSuffix[m]; ok {
+			r = append(r, m)
+		}
+	}
+	return
+}
+
+/*
+Compresses a local file, the compressed file is saved next to the original one.
+*/
+func compressFile(localFilePath, method string) (dstPath string, err error) {
+	src, err := os.Open(localFilePath)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	// written to a temp file and renamed when complete.
+	dstPath = localFilePath + compressSuffix[method]
+	dst, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".tmp-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		dst.Close()
+		if err == nil {
+			os.Chmod(dst.Name(), 0o644)
+			err = os.Rename(dst.Name(), dstPath)
+		}
+		if err != nil {
+			os.Remove(dst.Name())
+		}
+	}()
+
+	var w io.WriteCloser
+	switch method {
+	case CompressZstd:
+		w, err = zstd.NewWriter(dst, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	default:
+		w, err = gzip.NewWriterLevel(dst, gzip.BestCompression)
+	}
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		w.Close()
+		return
+	}
+	if err = w.Close(); err == nil {
+		err = dst.Sync()
+	}
+	return
+}
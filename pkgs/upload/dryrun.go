@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/diff"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+)
+
+const (
+	maxDiffLines int = 10
+)
+
+// Compares two files line by line, ignoring the order of lines.
+func diffLines(oldContent, newContent []byte) (added, removed []string) {
+	oldLines := map[string]int{}
+	for _, line := range strings.Split(string(oldContent), "\n") {
+		oldLines[line]++
+	}
+	for _, line := range strings.Split(string(newContent), "\n") {
+		if oldLines[line] > 0 {
+			oldLines[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	for line, count := range oldLines {
+		for i := 0; i < count; i++ {
+			removed = append(removed, line)
+		}
+	}
+	return
+}
+
+// Prints versions and files that would change in a version file, see pkgs/diff.
+func printChangelog(remotePath string, oldContent, content []byte) {
+	c, err := diff.Versions(strings.TrimSuffix(path.Base(remotePath), ".version.json"), oldContent, content)
+	if err != nil {
+		logs.Warning("Diff %s failed: %+v", remotePath, err)
+		return
+	}
+	if c.Empty() {
+		logs.Info("unchanged: %s", remotePath)
+		return
+	}
+	logs.Warning("changed: %s, +%d -%d versions, %d files changed", remotePath, len(c.Added), len(c.Removed), len(c.Changed))
+	for i, vName := range c.Added {
+		if i >= maxDiffLines {
+			break
+		}
+		gprint.Green("+ %s", vName)
+	}
+	for i, vName := range c.Removed {
+		if i >= maxDiffLines {
+			break
+		}
+		gprint.Red("- %s", vName)
+	}
+	for i, fc := range c.Changed {
+		if i >= maxDiffLines {
+			break
+		}
+		gprint.Yellow("~ %s", fc)
+	}
+}
+
+/*
+Published copy of a file for dry-run diffs, from the storage,
+or the copy in the work dir of an output in the dry-run dir without a storage.
+*/
+func (u *Uploader) dryRunBase(localFilePath, remotePath string) ([]byte, error) {
+	if u.storage != nil {
+		return u.storage.Get(remotePath)
+	}
+	wPath := filepath.Join(u.cnf.DirPath(), filepath.Base(localFilePath))
+	if wPath == localFilePath {
+		return nil, ErrNotFound
+	}
+	return os.ReadFile(wPath)
+}
+
+// Prints what would be pushed instead of uploading.
+func (u *Uploader) dryUpload(localFilePath, remotePath string) {
+	content, err := os.ReadFile(localFilePath)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	logs.Info("[%s] %s -> %s (%d bytes)", u.mode, localFilePath, remotePath, len(content))
+	if u.mode == confs.UploadModeLocal {
+		return
+	}
+	if strings.HasSuffix(remotePath, compressSuffix[CompressGzip]) || strings.HasSuffix(remotePath, compressSuffix[CompressZstd]) {
+		return
+	}
+
+	oldContent, err := u.dryRunBase(localFilePath, remotePath)
+	if err != nil {
+		logs.Info("new file: %s", remotePath)
+		return
+	}
+	if strings.HasSuffix(remotePath, ".version.json") {
+		printChangelog(remotePath, oldContent, content)
+		return
+	}
+	added, removed := diffLines(oldContent, content)
+	if len(added) == 0 && len(removed) == 0 {
+		logs.Info("unchanged: %s", remotePath)
+		return
+	}
+	logs.Warning("changed: %s, +%d -%d lines", remotePath, len(added), len(removed))
+	for i, line := range added {
+		if i >= maxDiffLines {
+			break
+		}
+		gprint.Green("+ %s", line)
+	}
+	for i, line := range removed {
+		if i >= maxDiffLines {
+			break
+		}
+		gprint.Red("- %s", line)
+	}
+}
@@ -0,0 +1,157 @@
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/goutils/pkgs/crypt"
+)
+
+const (
+	DefaultMinVersions int = 1
+	DefaultMinNodes    int = 10
+)
+
+const (
+	GateValidJson   string = "valid-json"
+	GateSchema      string = "json-schema"
+	GateMinVersions string = "min-versions"
+	GateMinNodes    string = "min-nodes"
+)
+
+// GateError tells which gate blocked an upload.
+type GateError struct {
+	Gate   string
+	File   string
+	Reason string
+}
+
+func (g *GateError) Error() string {
+	return fmt.Sprintf("gate %s failed for %s: %s", g.Gate, g.File, g.Reason)
+}
+
+func newGateError(gate, localFilePath, format string, args ...any) *GateError {
+	return &GateError{
+		Gate:   gate,
+		File:   filepath.Base(localFilePath),
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+/*
+Runs sanity gates before a file is published.
+
+ 1. valid-json: json files must be decodable;
+ 2. json-schema: json files must match the schema configured for their category in GateSchemas,
+    version files use VersionFileSchema by default;
+ 3. min-versions: a version file must have at least GateMinVersions versions;
+ 4. min-nodes: conf.txt must have at least GateMinNodes proxy nodes.
+*/
+func (u *Uploader) checkGates(localFilePath string) error {
+	if u.cnf.GateDisabled {
+		return nil
+	}
+	fileName := filepath.Base(localFilePath)
+	category, _ := fileCategory(fileName)
+	switch {
+	case strings.HasSuffix(fileName, ".json"):
+		content, err := os.ReadFile(localFilePath)
+		if err != nil {
+			return newGateError(GateValidJson, localFilePath, "%v", err)
+		}
+		var v any
+		if err := json.Unmarshal(content, &v); err != nil {
+			return newGateError(GateValidJson, localFilePath, "%v", err)
+		}
+		if err := u.checkSchema(category, fileName, localFilePath, v); err != nil {
+			return err
+		}
+		if strings.HasSuffix(fileName, ".version.json") {
+			return u.checkVersions(localFilePath, v)
+		}
+	case fileName == confs.VPNFileName, fileName == confs.VPNNewFileName:
+		return u.checkNodes(localFilePath)
+	}
+	return nil
+}
+
+func (u *Uploader) checkSchema(category, fileName, localFilePath string, v any) error {
+	var schema *Schema
+	if sPath := u.cnf.GateSchemas[category]; sPath != "" {
+		s, err := loadSchema(sPath)
+		if err != nil {
+			return newGateError(GateSchema, localFilePath, "cannot load schema %s: %v", sPath, err)
+		}
+		schema = s
+	} else if strings.HasSuffix(fileName, ".version.json") {
+		schema = VersionFileSchema
+	}
+	if err := schema.Validate(v, ""); err != nil {
+		return newGateError(GateSchema, localFilePath, "%v", err)
+	}
+	return nil
+}
+
+func (u *Uploader) checkVersions(localFilePath string, v any) error {
+	minVersions := u.cnf.GateMinVersions
+	if minVersions <= 0 {
+		minVersions = DefaultMinVersions
+	}
+	vList, _ := v.(map[string]any)
+	count := len(vList)
+	if _, ok := vList[VersionLatestKey].(string); ok {
+		count--
+	}
+	if count < minVersions {
+		return newGateError(GateMinVersions, localFilePath, "%d versions, at least %d expected", count, minVersions)
+	}
+	return nil
+}
+
+// conf.txt is encrypted, every array in the decrypted json is a list of nodes.
+func (u *Uploader) countNodes(localFilePath string) (total int, err error) {
+	content, err := os.ReadFile(localFilePath)
+	if err != nil {
+		return
+	}
+	// conf.txt may still be encrypted with the old key during a key rotation.
+	key, _ := u.cnf.PublishKeys(time.Now())
+	if filepath.Base(localFilePath) == confs.VPNNewFileName {
+		key = u.cnf.CryptoKey
+	}
+	cc := crypt.NewCrptWithKey([]byte(key))
+	decrypted, err := cc.AesDecrypt(content)
+	if err != nil {
+		return 0, fmt.Errorf("cannot decrypt: %v", err)
+	}
+	result := map[string]any{}
+	if err = json.Unmarshal(decrypted, &result); err != nil {
+		return
+	}
+	for _, item := range result {
+		if nodes, ok := item.([]any); ok {
+			total += len(nodes)
+		}
+	}
+	return
+}
+
+func (u *Uploader) checkNodes(localFilePath string) error {
+	minNodes := u.cnf.GateMinNodes
+	if minNodes <= 0 {
+		minNodes = DefaultMinNodes
+	}
+	total, err := u.countNodes(localFilePath)
+	if err != nil {
+		return newGateError(GateMinNodes, localFilePath, "%v", err)
+	}
+	if total < minNodes {
+		return newGateError(GateMinNodes, localFilePath, "%d nodes, at least %d expected", total, minNodes)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+const (
+	GCSScope     string = "https://www.googleapis.com/auth/devstorage.read_write"
+	GCSTokenUri  string = "https://oauth2.googleapis.com/token"
+	GCSApi       string = "https://storage.googleapis.com/storage/v1"
+	GCSUploadApi string = "https://storage.googleapis.com/upload/storage/v1"
+)
+
+// Fields used from a service account key file.
+type GCSServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+/*
+GCSStorage uploads files into a Google Cloud Storage bucket,
+authorized by a service account key file.
+*/
+type GCSStorage struct {
+	Bucket          string
+	CredentialsPath string
+	Proxy           string
+	client          *http.Client
+	lock            *sync.Mutex
+	token           string
+	tokenExpire     time.Time
+}
+
+func NewGCSStorage(bucket, credentialsPath string) (g *GCSStorage) {
+	g = &GCSStorage{
+		Bucket:          bucket,
+		CredentialsPath: credentialsPath,
+		lock:            &sync.Mutex{},
+	}
+	return
+}
+
+func (g *GCSStorage) httpClient() *http.Client {
+	if g.client == nil {
+		g.client = newHttpClient(g.Proxy)
+	}
+	return g.client
+}
+
+// Gets an access token for the service account, cached until 5 minutes before it expires.
+func (g *GCSStorage) accessToken() (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.token != "" && time.Now().Add(5*time.Minute).Before(g.tokenExpire) {
+		return g.token, nil
+	}
+	content, err := os.ReadFile(g.CredentialsPath)
+	if err != nil {
+		return "", err
+	}
+	sa := &GCSServiceAccount{}
+	if err = json.Unmarshal(content, sa); err != nil {
+		return "", err
+	}
+	if sa.TokenUri == "" {
+		sa.TokenUri = GCSTokenUri
+	}
+	key, err := parseRSAPrivateKey([]byte(sa.PrivateKey))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	assertion, err := signJWT(key, map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": GCSScope,
+		"aud":   sa.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := g.httpClient().PostForm(sa.TokenUri, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("cannot get gcs access token, status: %d", resp.StatusCode)
+	}
+	g.token = result.AccessToken
+	confs.RegisterSecrets(g.token)
+	g.tokenExpire = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return g.token, nil
+}
+
+func (g *GCSStorage) do(method, rawUrl string, body []byte, contentType string) (r []byte, code int) {
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	r, _, code, err := g.request(method, rawUrl, body, headers)
+	if err != nil {
+		logs.Error("%+v", err)
+	}
+	return r, code
+}
+
+func (g *GCSStorage) request(method, rawUrl string, body []byte, headers map[string]string) (r []byte, header http.Header, code int, err error) {
+	token, err := g.accessToken()
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(method, rawUrl, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := g.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	r, _ = io.ReadAll(resp.Body)
+	return r, resp.Header, resp.StatusCode, nil
+}
+
+func (g *GCSStorage) objectUrl(objectPath string) string {
+	return fmt.Sprintf("%s/b/%s/o/%s", GCSApi, g.Bucket, url.PathEscape(objectPath))
+}
+
+// Buckets are created in the gcp console.
+func (g *GCSStorage) CreateRepo(repoName string) []byte {
+	logs.Warning("Please create the gcs bucket %s manually.", g.Bucket)
+	return nil
+}
+
+func (g *GCSStorage) GetRepoInfo(repoName string) []byte {
+	r, _ := g.do(http.MethodGet, fmt.Sprintf("%s/b/%s", GCSApi, g.Bucket), nil, "")
+	return r
+}
+
+func (g *GCSStorage) GetContents(repoName, remotePath, fileName string) []byte {
+	p := contentsPath(remotePath, fileName)
+	content, code := g.do(http.MethodGet, g.objectUrl(p)+"?alt=media", nil, "")
+	switch code {
+	case http.StatusOK:
+		return contentsInfo(fileName, p, content)
+	case http.StatusNotFound:
+		return notFoundInfo()
+	}
+	return nil
+}
+
+func (g *GCSStorage) UploadFile(repoName, remotePath, localPath, shaStr string) []byte {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return failureInfo(err)
+	}
+	fName := filepath.Base(localPath)
+	p := contentsPath(remotePath, fName)
+	uploadUrl := fmt.Sprintf("%s/b/%s/o?uploadType=media&name=%s", GCSUploadApi, g.Bucket, url.QueryEscape(p))
+	r, code := g.do(http.MethodPost, uploadUrl, content, contentType(localPath))
+	if code != http.StatusOK {
+		return failureInfo(fmt.Errorf("status %d: %s", code, strings.TrimSpace(string(r))))
+	}
+	return uploadedInfo(fName, p)
+}
+
+func (g *GCSStorage) DeleteFile(repoName, remotePath, fileName, shaStr string) []byte {
+	r, _ := g.do(http.MethodDelete, g.objectUrl(contentsPath(remotePath, fileName)), nil, "")
+	return r
+}
+
+// Asks the session how many bytes are stored, -1 for an expired session.
+func (g *GCSStorage) sessionOffset(session string, size int64) int64 {
+	_, header, code, err := g.request(http.MethodPut, session, nil, map[string]string{
+		"Content-Range": fmt.Sprintf("bytes */%d", size),
+	})
+	switch {
+	case err != nil:
+		return -1
+	case code == http.StatusOK || code == http.StatusCreated:
+		return size
+	case code == 308:
+		// Range: bytes=0-1048575
+		var end int64
+		if _, err := fmt.Sscanf(header.Get("Range"), "bytes=0-%d", &end); err == nil {
+			return end + 1
+		}
+		return 0
+	default:
+		return -1
+	}
+}
+
+/*
+Uploads a large file with a resumable session.
+The session uri is kept in state, so the next run continues from the stored offset.
+*/
+func (g *GCSStorage) PutResumable(remotePath, localFilePath string, state *ResumeState) error {
+	var offset int64 = -1
+	if state.Session != "" {
+		offset = g.sessionOffset(state.Session, state.Size)
+	}
+	if offset < 0 {
+		startUrl := fmt.Sprintf("%s/b/%s/o?uploadType=resumable&name=%s", GCSUploadApi, g.Bucket, url.QueryEscape(remotePath))
+		r, header, code, err := g.request(http.MethodPost, startUrl, nil, map[string]string{
+			"X-Upload-Content-Type": contentType(localFilePath),
+		})
+		if err != nil || code != http.StatusOK || header.Get("Location") == "" {
+			return fmt.Errorf("start resumable upload of %s failed: %d %s %v", remotePath, code, string(r), err)
+		}
+		state.Session, offset = header.Get("Location"), 0
+		state.Save()
+	}
+
+	for offset < state.Size {
+		start := offset
+		err := retryPart(fmt.Sprintf("bytes from %d of %s", start, remotePath), func() error {
+			part, err := readRange(localFilePath, start, state.PartSize)
+			if err != nil {
+				return err
+			}
+			r, header, code, err := g.request(http.MethodPut, state.Session, part, map[string]string{
+				"Content-Range": fmt.Sprintf("bytes %d-%d/%d", start, start+int64(len(part))-1, state.Size),
+			})
+			switch {
+			case err != nil:
+				return err
+			case code == http.StatusOK || code == http.StatusCreated:
+				offset = state.Size
+			case code == 308:
+				var end int64
+				if _, err := fmt.Sscanf(header.Get("Range"), "bytes=0-%d", &end); err != nil {
+					return fmt.Errorf("no range in response")
+				}
+				offset = end + 1
+			default:
+				return fmt.Errorf("status %d: %s", code, string(r))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	state.Done()
+	return nil
+}
@@ -0,0 +1,296 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+const (
+	GithubAPI         string = "https://api.github.com"
+	GithubAccept      string = "application/vnd.github+json"
+	GithubAPIVersion  string = "2022-11-28"
+	AuthTypeToken     string = "token" // classic or fine-grained personal access token.
+	AuthTypeGithubApp string = "app"   // github app installation token.
+	maxRateLimitWait  int    = 3
+)
+
+/*
+GithubStorage talks to the github contents api directly, so that rate-limit headers are visible.
+
+Auth:
+1. classic PAT or fine-grained PAT(github_pat_xxx), sent as a Bearer token;
+2. github app, an installation token is created from the app's private key and refreshed before it expires.
+
+Rate limit:
+When X-RateLimit-Remaining reaches 0 (or a 403/429 with Retry-After is returned),
+requests sleep until X-RateLimit-Reset instead of failing mid-run.
+*/
+type GithubStorage struct {
+	UserName       string
+	Token          string
+	AuthType       string
+	AppID          string
+	InstallationID string
+	PrivateKeyPath string
+	Proxy          string
+	client         *http.Client
+	lock           *sync.Mutex
+	appToken       string
+	appTokenExpire time.Time
+	rateRemaining  int
+	rateReset      time.Time
+}
+
+func NewGithubStorage(username, token string) (g *GithubStorage) {
+	g = &GithubStorage{
+		UserName:      username,
+		Token:         token,
+		AuthType:      AuthTypeToken,
+		lock:          &sync.Mutex{},
+		rateRemaining: -1,
+	}
+	return
+}
+
+func (g *GithubStorage) httpClient() *http.Client {
+	if g.client == nil {
+		g.client = newHttpClient(g.Proxy)
+	}
+	return g.client
+}
+
+func (g *GithubStorage) formatRepoName(repoName string) string {
+	repoName = strings.Trim(repoName, "/")
+	if strings.Contains(repoName, "/") {
+		return repoName
+	}
+	return fmt.Sprintf("%s/%s", g.UserName, repoName)
+}
+
+// Creates a JWT for the github app.
+func (g *GithubStorage) appJWT() (string, error) {
+	content, err := os.ReadFile(g.PrivateKeyPath)
+	if err != nil {
+		return "", err
+	}
+	key, err := parseRSAPrivateKey(content)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return signJWT(key, map[string]any{
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": g.AppID,
+	})
+}
+
+// Gets an installation token for the github app, cached until 5 minutes before it expires.
+func (g *GithubStorage) installationToken() (string, error) {
+	if g.appToken != "" && time.Now().Add(5*time.Minute).Before(g.appTokenExpire) {
+		return g.appToken, nil
+	}
+	jwt, err := g.appJWT()
+	if err != nil {
+		return "", err
+	}
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/app/installations/%s/access_tokens", GithubAPI, g.InstallationID), nil)
+	req.Header.Set("Accept", GithubAccept)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	resp, err := g.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	result := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("cannot create installation token, status: %d", resp.StatusCode)
+	}
+	g.appToken, g.appTokenExpire = result.Token, result.ExpiresAt
+	confs.RegisterSecrets(g.appToken)
+	return g.appToken, nil
+}
+
+func (g *GithubStorage) authHeader() (string, error) {
+	if g.AuthType == AuthTypeGithubApp {
+		token, err := g.installationToken()
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "Bearer " + g.Token, nil
+}
+
+// Records rate-limit headers of a response.
+func (g *GithubStorage) updateRateLimit(resp *http.Response) {
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		g.rateRemaining = remaining
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		g.rateReset = time.Unix(reset, 0)
+	}
+}
+
+// Sleeps until the rate limit resets when the quota is exhausted.
+func (g *GithubStorage) waitForRateLimit() {
+	if g.rateRemaining != 0 {
+		return
+	}
+	if wait := time.Until(g.rateReset); wait > 0 {
+		logs.Warning("Github rate limit exhausted, sleeping until %s.", g.rateReset.Format(time.RFC3339))
+		time.Sleep(wait + time.Second)
+	}
+	g.rateRemaining = -1
+}
+
+// Finds how long to wait before retrying a rate limited response, 0 for other responses.
+func (g *GithubStorage) retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if g.rateRemaining == 0 {
+		if wait := time.Until(g.rateReset); wait > 0 {
+			return wait + time.Second
+		}
+		return time.Second
+	}
+	return 0
+}
+
+// Waits for the rate limit and gets auth header, shared state is guarded by the lock.
+func (g *GithubStorage) prepare() (client *http.Client, auth string, err error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.waitForRateLimit()
+	auth, err = g.authHeader()
+	return g.httpClient(), auth, err
+}
+
+func (g *GithubStorage) do(method, apiPath string, body any) (r []byte) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	for i := 0; i <= maxRateLimitWait; i++ {
+		client, auth, err := g.prepare()
+		if err != nil {
+			logs.Error("%+v", err)
+			return
+		}
+		req, err := http.NewRequest(method, GithubAPI+apiPath, bytes.NewReader(payload))
+		if err != nil {
+			logs.Error("%+v", err)
+			return
+		}
+		req.Header.Set("Accept", GithubAccept)
+		req.Header.Set("X-GitHub-Api-Version", GithubAPIVersion)
+		req.Header.Set("Authorization", auth)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			logs.Error("%+v", err)
+			return
+		}
+		r, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		g.lock.Lock()
+		g.updateRateLimit(resp)
+		wait := g.retryAfter(resp)
+		g.lock.Unlock()
+		if wait == 0 {
+			return
+		}
+		logs.Warning("Github rate limited, retry in %s.", wait)
+		time.Sleep(wait)
+	}
+	return
+}
+
+func contentsPath(remotePath, fileName string) string {
+	return strings.TrimLeft(path.Join(filepath.ToSlash(remotePath), fileName), "/")
+}
+
+// Create a repo.
+func (g *GithubStorage) CreateRepo(repoName string) []byte {
+	if g.AuthType == AuthTypeGithubApp {
+		logs.Warning("Github app cannot create repos, please create %s manually.", g.formatRepoName(repoName))
+		return nil
+	}
+	return g.do(http.MethodPost, "/user/repos", map[string]any{"name": repoName})
+}
+
+// Get info of a repo.
+func (g *GithubStorage) GetRepoInfo(repoName string) []byte {
+	return g.do(http.MethodGet, fmt.Sprintf("/repos/%s", g.formatRepoName(repoName)), nil)
+}
+
+// Gets file list of a repo or info for a single file.
+func (g *GithubStorage) GetContents(repoName, remotePath, fileName string) []byte {
+	return g.do(http.MethodGet, fmt.Sprintf("/repos/%s/contents/%s", g.formatRepoName(repoName), contentsPath(remotePath, fileName)), nil)
+}
+
+/*
+Upload/Update a file for a repo.
+SHA is needed for Update.
+*/
+func (g *GithubStorage) UploadFile(repoName, remotePath, localPath, shaStr string) []byte {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		logs.Error("file: %s does not exist.", localPath)
+		return nil
+	}
+	fName := filepath.Base(localPath)
+	body := map[string]any{
+		"message": fmt.Sprintf("update file: %s.", fName),
+		"content": base64.StdEncoding.EncodeToString(content),
+	}
+	if shaStr != "" {
+		body["sha"] = shaStr
+	}
+	return g.do(http.MethodPut, fmt.Sprintf("/repos/%s/contents/%s", g.formatRepoName(repoName), contentsPath(remotePath, fName)), body)
+}
+
+/*
+Delete a file in a repo.
+SHA is needed for Delete.
+*/
+func (g *GithubStorage) DeleteFile(repoName, remotePath, fileName, shaStr string) []byte {
+	body := map[string]any{
+		"message": fmt.Sprintf("delete file: %s.", fileName),
+		"sha":     shaStr,
+	}
+	return g.do(http.MethodDelete, fmt.Sprintf("/repos/%s/contents/%s", g.formatRepoName(repoName), contentsPath(remotePath, fileName)), body)
+}
+
+/*
+Get releases list.
+*/
+func (g *GithubStorage) GetReleaseList(repoName string) []byte {
+	return g.do(http.MethodGet, fmt.Sprintf("/repos/%s/releases", g.formatRepoName(repoName)), nil)
+}
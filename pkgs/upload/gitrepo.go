@@ -0,0 +1,242 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+var (
+	gitLock   = &sync.Mutex{}
+	gitSynced = map[string]bool{}
+)
+
+const (
+	DefaultGitBranch string = "main"
+	DefaultGitEmail  string = "pxy@localhost"
+)
+
+/*
+GitStorage commits outputs into a local clone of any git remote,
+so that self-hosted remotes without a contents api are supported.
+
+Commits are pushed by Flush, which is called after the manifest upload.
+*/
+type GitStorage struct {
+	Remote  string
+	Branch  string
+	SSHKey  string
+	Author  string
+	Email   string
+	repoDir string
+}
+
+func NewGitStorage(remote, repoDir string) (g *GitStorage) {
+	g = &GitStorage{
+		Remote:  remote,
+		Branch:  DefaultGitBranch,
+		Author:  "pxy",
+		Email:   DefaultGitEmail,
+		repoDir: repoDir,
+	}
+	return
+}
+
+func (g *GitStorage) git(args ...string) (string, error) {
+	args = append([]string{"-C", g.repoDir, "-c", "user.name=" + g.Author, "-c", "user.email=" + g.Email}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Env = os.Environ()
+	if g.SSHKey != "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+GitSSHCommand(g.SSHKey))
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("git %s: %v: %s", strings.Join(args[6:], " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), err
+}
+
+/*
+Ssh command for GIT_SSH_COMMAND with a private key,
+git runs it through a shell, so the key path is quoted.
+*/
+func GitSSHCommand(sshKey string) string {
+	return fmt.Sprintf("ssh -i '%s' -o IdentitiesOnly=yes", strings.ReplaceAll(sshKey, "'", `'\''`))
+}
+
+/*
+Forgets that clones are synced, so that the next run fetches and rebases again.
+Long running processes like pxy serve call it before each run.
+*/
+func ResetGitSync() {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	gitSynced = map[string]bool{}
+}
+
+/*
+Clones the remote, or rebases local commits onto the remote branch, once per run.
+The clone is shared by all uploaders, so the lock and sync state are global.
+*/
+func (g *GitStorage) sync() error {
+	if gitSynced[g.repoDir] {
+		return nil
+	}
+	fresh := false
+	if ok, _ := gutils.PathIsExist(filepath.Join(g.repoDir, ".git")); !ok {
+		fresh = true
+		os.MkdirAll(g.repoDir, os.ModePerm)
+		if _, err := g.git("init"); err != nil {
+			return err
+		}
+		if _, err := g.git("remote", "add", "origin", g.Remote); err != nil {
+			return err
+		}
+	} else {
+		g.git("remote", "set-url", "origin", g.Remote)
+	}
+	if _, err := g.git("fetch", "origin"); err != nil {
+		return err
+	}
+	remoteBranch := "origin/" + g.Branch
+	if _, err := g.git("rev-parse", "--verify", remoteBranch); err != nil {
+		// empty remote, the branch is created by the first commit.
+		g.git("checkout", "-B", g.Branch)
+	} else if _, err := g.git("checkout", g.Branch); fresh || err != nil {
+		if _, err := g.git("checkout", "-B", g.Branch, remoteBranch); err != nil {
+			return err
+		}
+	} else if _, err := g.git("rebase", remoteBranch); err != nil {
+		g.git("rebase", "--abort")
+		return err
+	}
+	gitSynced[g.repoDir] = true
+	return nil
+}
+
+func (g *GitStorage) CreateRepo(repoName string) []byte {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if err := g.sync(); err != nil {
+		logs.Error("%+v", err)
+	}
+	return nil
+}
+
+func (g *GitStorage) GetRepoInfo(repoName string) []byte {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if err := g.sync(); err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	r, _ := json.Marshal(map[string]string{"id": g.Remote, "branch": g.Branch})
+	return r
+}
+
+// Returns info like the github contents api: name, path, sha and base64 content.
+func (g *GitStorage) GetContents(repoName, remotePath, fileName string) []byte {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if err := g.sync(); err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	p := contentsPath(remotePath, fileName)
+	content, err := os.ReadFile(filepath.Join(g.repoDir, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		return notFoundInfo()
+	}
+	if err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	h := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content)))
+	r, _ := json.Marshal(map[string]string{
+		"name":    fileName,
+		"path":    p,
+		"sha":     hex.EncodeToString(h[:]),
+		"content": base64.StdEncoding.EncodeToString(content),
+	})
+	return r
+}
+
+/*
+Copies the file into the clone and commits it, sha is not needed.
+Returns the new info like the contents api, or a message when git fails.
+*/
+func (g *GitStorage) UploadFile(repoName, remotePath, localPath, shaStr string) []byte {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if err := g.sync(); err != nil {
+		return failureInfo(err)
+	}
+	fName := filepath.Base(localPath)
+	p := contentsPath(remotePath, fName)
+	dst := filepath.Join(g.repoDir, filepath.FromSlash(p))
+	os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if _, err := gutils.CopyFile(localPath, dst); err != nil {
+		return failureInfo(err)
+	}
+	if _, err := g.git("add", "--", p); err != nil {
+		return failureInfo(err)
+	}
+	out, err := g.git("status", "--porcelain", "--", p)
+	if err != nil {
+		return failureInfo(err)
+	}
+	if strings.TrimSpace(out) != "" {
+		if _, err := g.git("commit", "-m", fmt.Sprintf("update file: %s.", fName), "--", p); err != nil {
+			return failureInfo(err)
+		}
+	}
+	return uploadedInfo(fName, p)
+}
+
+func (g *GitStorage) DeleteFile(repoName, remotePath, fileName, shaStr string) []byte {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if err := g.sync(); err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	p := contentsPath(remotePath, fileName)
+	if _, err := g.git("rm", "--", p); err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	out, err := g.git("commit", "-m", fmt.Sprintf("delete file: %s.", fileName), "--", p)
+	if err != nil {
+		logs.Error("%+v", err)
+		return nil
+	}
+	return []byte(out)
+}
+
+// Pushes local commits to the remote.
+func (g *GitStorage) Flush() error {
+	gitLock.Lock()
+	defer gitLock.Unlock()
+	if !gitSynced[g.repoDir] {
+		return nil
+	}
+	if _, err := g.git("push", "origin", g.Branch); err != nil {
+		return err
+	}
+	logs.Success("Pushed to %s (%s).", g.Remote, g.Branch)
+	return nil
+}
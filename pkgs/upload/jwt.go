@@ -0,0 +1,95 @@
+package upload
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Parses a PEM encoded RSA private key, PKCS1 or PKCS8.
+func parseRSAPrivateKey(content []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not a RSA key")
+	}
+	return key, nil
+}
+
+// Creates a JWT signed with RS256.
+func signJWT(key *rsa.PrivateKey, claims map[string]any) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := header + "." + enc.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+func newHttpClient(proxy string) (c *http.Client) {
+	c = &http.Client{Timeout: 30 * time.Minute}
+	if proxy != "" {
+		if u, err := url.Parse(proxy); err == nil {
+			c.Transport = &http.Transport{Proxy: http.ProxyURL(u)}
+		}
+	}
+	return
+}
+
+// Info of a file like the github contents api, so that dry-run diffs work for every storage.
+func contentsInfo(fileName, fPath string, content []byte) []byte {
+	h := sha256.Sum256(content)
+	r, _ := json.Marshal(map[string]string{
+		"name":    fileName,
+		"path":    fPath,
+		"sha":     base64.RawURLEncoding.EncodeToString(h[:]),
+		"content": base64.StdEncoding.EncodeToString(content),
+	})
+	return r
+}
+
+// Body of github-like contents apis for missing files, see ContentsStorage.info.
+func notFoundInfo() []byte {
+	r, _ := json.Marshal(map[string]string{"message": notFoundMessage})
+	return r
+}
+
+// Body of a successful upload, Put checks the content.
+func uploadedInfo(fileName, fPath string) []byte {
+	r, _ := json.Marshal(map[string]any{
+		"content": map[string]string{"name": fileName, "path": fPath},
+	})
+	return r
+}
+
+// Body of a failed upload, Put returns the message as an error.
+func failureInfo(err error) []byte {
+	r, _ := json.Marshal(map[string]string{"message": err.Error()})
+	return r
+}
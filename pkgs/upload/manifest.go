@@ -0,0 +1,77 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+var manifestLock = &sync.Mutex{}
+
+type ManifestItem struct {
+	Path       string            `json:"path"`
+	Size       int64             `json:"size"`
+	Sha256     string            `json:"sha256"`
+	Compressed map[string]string `json:"compressed,omitempty"` // compress method -> path.
+	Chunks     []string          `json:"chunks,omitempty"`     // for files split into chunks.
+	Index      string            `json:"index,omitempty"`      // chunk index file.
+	UpdatedAt  string            `json:"updated_at"`
+}
+
+/*
+Manifest records every published file, so clients can find the compressed copies.
+*/
+type Manifest struct {
+	Files     map[string]*ManifestItem `json:"files"`
+	UpdatedAt string                   `json:"updated_at"`
+	fPath     string
+}
+
+func loadManifest(fPath string) (m *Manifest) {
+	m = &Manifest{
+		Files: map[string]*ManifestItem{},
+		fPath: fPath,
+	}
+	if content, err := os.ReadFile(fPath); err == nil {
+		json.Unmarshal(content, m)
+		if m.Files == nil {
+			m.Files = map[string]*ManifestItem{}
+		}
+	}
+	return
+}
+
+func (m *Manifest) save() error {
+	m.UpdatedAt = utils.Now()
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileWithBackup(m.fPath, content, os.ModePerm)
+}
+
+func fileSha256(fPath string) (size int64, sum string) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	h := sha256.Sum256(content)
+	return int64(len(content)), hex.EncodeToString(h[:])
+}
+
+// Records a published file and its compressed copies into the local manifest.
+func recordManifest(manifestPath, localFilePath string, item *ManifestItem) {
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+
+	m := loadManifest(manifestPath)
+	item.UpdatedAt = utils.Now()
+	item.Size, item.Sha256 = fileSha256(localFilePath)
+	m.Files[filepath.Base(localFilePath)] = item
+	m.save()
+}
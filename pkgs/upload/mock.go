@@ -0,0 +1,102 @@
+package upload
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+/*
+MemoryStorage keeps uploaded files in memory,
+so that collectors can be tested without real credentials:
+
+	st := upload.NewMemoryStorage()
+	upload.UseStorage(st)
+	ver := versions.NewGolang(cnf)
+	ver.FetchAll()
+	ver.Upload()
+	content, _ := st.Get("go.version.json")
+*/
+type MemoryStorage struct {
+	files map[string][]byte
+	lock  *sync.Mutex
+}
+
+func NewMemoryStorage() (m *MemoryStorage) {
+	m = &MemoryStorage{
+		files: map[string][]byte{},
+		lock:  &sync.Mutex{},
+	}
+	return
+}
+
+func (m *MemoryStorage) Put(remotePath, localFilePath string) error {
+	content, err := os.ReadFile(localFilePath)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.files[remotePath] = content
+	return nil
+}
+
+func (m *MemoryStorage) Get(remotePath string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	content, ok := m.files[remotePath]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, content...), nil
+}
+
+func (m *MemoryStorage) Delete(remotePath string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.files[remotePath]; !ok {
+		return ErrNotFound
+	}
+	delete(m.files, remotePath)
+	return nil
+}
+
+func (m *MemoryStorage) Exists(remotePath string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.files[remotePath]
+	return ok, nil
+}
+
+// Remote paths of all files, sorted.
+func (m *MemoryStorage) Files() (r []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for p := range m.files {
+		r = append(r, p)
+	}
+	sort.Strings(r)
+	return
+}
+
+var storageOverride Storage
+
+/*
+UseStorage makes every new Uploader use st instead of the storage in config,
+nil restores the default.
+*/
+func UseStorage(st Storage) {
+	storageOverride = st
+}
+
+// Creates an uploader with the given storage, for tests.
+func NewUploaderWithStorage(cnf *confs.CollectorConf, st Storage) (up *Uploader) {
+	up = &Uploader{
+		cnf:     cnf,
+		storage: st,
+		pool:    NewPool(cnf.UploadWorkers),
+	}
+	return
+}
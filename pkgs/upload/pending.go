@@ -0,0 +1,66 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+const (
+	// local files whose uploads failed, retried by "pxy upload retry".
+	PendingUploadsFileName string = "pending_uploads.txt"
+)
+
+func (u *Uploader) pending() *confs.ListStore[string] {
+	return confs.NewLineStore(filepath.Join(u.cnf.DirPath(), PendingUploadsFileName), "")
+}
+
+// Records the result of an upload, failed files are kept for RetryPending.
+func (u *Uploader) recordPending(localFilePath string, failed bool) {
+	if u.mode != "" || filepath.Base(localFilePath) == PendingUploadsFileName {
+		return
+	}
+	store := u.pending()
+	var err error
+	if failed {
+		_, err = store.Add(localFilePath)
+	} else if _, sErr := os.Stat(store.Path); sErr == nil {
+		_, err = store.Remove(localFilePath)
+	}
+	if err != nil {
+		logs.Warning("Update %s failed: %+v", PendingUploadsFileName, err)
+	}
+}
+
+/*
+Uploads files whose uploads failed in previous runs again, resumable uploads go on from their last part.
+Files removed from the work dir are dropped from the list. Returns the files that failed again.
+*/
+func (u *Uploader) RetryPending() (failed []string) {
+	files, err := u.pending().List()
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	if len(files) == 0 {
+		logs.Info("No pending uploads.")
+		return
+	}
+	for _, fPath := range files {
+		if u.cnf.Canceled() {
+			break
+		}
+		if _, err := os.Stat(fPath); err != nil {
+			logs.Warning("%s is gone, dropped from pending uploads.", fPath)
+			u.pending().Remove(fPath)
+			continue
+		}
+		if err := u.Upload(fPath); err != nil {
+			failed = append(failed, fPath)
+		}
+	}
+	logs.Info("Retried %d pending uploads, %d failed.", len(files), len(failed))
+	return
+}
@@ -0,0 +1,47 @@
+package upload
+
+import (
+	"sync"
+)
+
+const (
+	DefaultUploadWorkers int = 4
+)
+
+/*
+Pool runs uploads with a bounded number of workers.
+Call Wait before uploading files that must come last, like the manifest.
+*/
+type Pool struct {
+	sem chan struct{}
+	wg  *sync.WaitGroup
+}
+
+func NewPool(workers int) (p *Pool) {
+	if workers <= 0 {
+		workers = DefaultUploadWorkers
+	}
+	p = &Pool{
+		sem: make(chan struct{}, workers),
+		wg:  &sync.WaitGroup{},
+	}
+	return
+}
+
+// Runs f in a worker, blocks while all workers are busy.
+func (p *Pool) Go(f func()) {
+	p.wg.Add(1)
+	p.sem <- struct{}{}
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+		f()
+	}()
+}
+
+// Waits for all queued jobs.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,246 @@
+package upload
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Releases of pxy itself, published into the storage repo for pxy self-update.
+
+Binaries go into releases/, named like pxy_linux_amd64 or pxy_windows_amd64.exe,
+with releases/pxy.release.json listing the version, sha256 sums and signatures.
+A signature is the ed25519 signature of "version|platform|name|sha256" of a binary by ReleaseSigningKey,
+so a signed binary can not be passed off as another version or platform.
+*/
+
+const (
+	ReleaseDir       string = "releases"
+	ReleaseIndexName string = "pxy.release.json"
+)
+
+var (
+	// binaries with a wrong sha256 or signature, they are never installed.
+	ErrInvalidRelease    = errors.New("invalid release")
+	ErrInvalidReleaseKey = errors.New("invalid ReleasePublicKey")
+)
+
+type ReleaseAsset struct {
+	Name      string `json:"name"`
+	Sha256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"` // base64.
+}
+
+type Release struct {
+	Version     string                   `json:"version"`
+	PublishedAt string                   `json:"published_at"`
+	Assets      map[string]*ReleaseAsset `json:"assets"` // platform like "linux/amd64" -> asset.
+}
+
+// Name of the binary of a platform, like "linux/amd64".
+func ReleaseAssetName(platform string) string {
+	name := "pxy_" + strings.ReplaceAll(platform, "/", "_")
+	if strings.HasPrefix(platform, "windows/") {
+		name += ".exe"
+	}
+	return name
+}
+
+// Creates a new signing key, the private key is saved as PEM into fPath, the public key is returned in base64.
+func GenerateReleaseKey(fPath string) (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(fPath); err == nil {
+		return "", fmt.Errorf("%s already exists", fPath)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err = utils.WriteFile(fPath, content, 0600); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// The message signed for an asset, see PublishRelease.
+func releaseMessage(version, platform string, asset *ReleaseAsset) []byte {
+	return []byte(strings.Join([]string{version, platform, asset.Name, asset.Sha256}, "|"))
+}
+
+func loadReleaseKey(fPath string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ed25519 key")
+	}
+	return key, nil
+}
+
+/*
+Publishes binaries of a release, platform like "linux/amd64" -> local path.
+Binaries are signed when ReleaseSigningKey is set, the index is uploaded last.
+*/
+func (u *Uploader) PublishRelease(version string, binaries map[string]string) (r *Release, err error) {
+	if u.storage == nil && u.mode == "" {
+		return nil, ErrNoStorage
+	}
+	var key ed25519.PrivateKey
+	if u.cnf.ReleaseSigningKey != "" {
+		if key, err = loadReleaseKey(u.cnf.ReleaseSigningKey); err != nil {
+			return nil, fmt.Errorf("load signing key failed: %w", err)
+		}
+	}
+	r = &Release{Version: version, PublishedAt: utils.Now(), Assets: map[string]*ReleaseAsset{}}
+	platforms := make([]string, 0, len(binaries))
+	for platform := range binaries {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		fPath := binaries[platform]
+		size, sum := fileSha256(fPath)
+		if size == 0 {
+			return nil, fmt.Errorf("cannot read %s", fPath)
+		}
+		asset := &ReleaseAsset{Name: ReleaseAssetName(platform), Sha256: sum}
+		if key != nil {
+			asset.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, releaseMessage(version, platform, asset)))
+		}
+		if err = u.upload(fPath, ReleaseDir+"/"+asset.Name); err != nil {
+			return nil, fmt.Errorf("upload %s failed: %w", asset.Name, err)
+		}
+		r.Assets[platform] = asset
+	}
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	indexPath := u.cnf.OutputPath(ReleaseIndexName)
+	if err = utils.WriteFile(indexPath, content, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err = u.upload(indexPath, ReleaseDir+"/"+ReleaseIndexName); err != nil {
+		return nil, fmt.Errorf("upload %s failed: %w", ReleaseIndexName, err)
+	}
+	return r, nil
+}
+
+// The latest published release.
+func (u *Uploader) LatestRelease() (*Release, error) {
+	if u.storage == nil {
+		return nil, ErrNoStorage
+	}
+	content, err := u.storage.Get(ReleaseDir + "/" + ReleaseIndexName)
+	if err != nil {
+		return nil, err
+	}
+	r := &Release{}
+	if err = json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ReleaseIndexName, err)
+	}
+	return r, nil
+}
+
+/*
+Downloads the binary of a platform in r and verifies its sha256, and its signature when publicKey(base64) is set.
+Binaries without signatures are rejected when publicKey is set.
+*/
+func (u *Uploader) DownloadRelease(r *Release, platform, publicKey string) ([]byte, error) {
+	if u.storage == nil {
+		return nil, ErrNoStorage
+	}
+	asset, ok := r.Assets[platform]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no binary for %s", r.Version, platform)
+	}
+	content, err := u.storage.Get(ReleaseDir + "/" + asset.Name)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(content)
+	if sum := hex.EncodeToString(h[:]); sum != asset.Sha256 {
+		return nil, fmt.Errorf("%w: sha256 mismatch of %s: %s, expected %s", ErrInvalidRelease, asset.Name, sum, asset.Sha256)
+	}
+	if publicKey == "" {
+		return content, nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrInvalidReleaseKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(asset.Signature)
+	if err != nil || asset.Signature == "" {
+		return nil, fmt.Errorf("%w: %s is not signed", ErrInvalidRelease, asset.Name)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), releaseMessage(r.Version, platform, asset), sig) {
+		return nil, fmt.Errorf("%w: invalid signature of %s", ErrInvalidRelease, asset.Name)
+	}
+	return content, nil
+}
+
+/*
+Replaces the binary at exePath with content.
+The old binary is renamed first, running binaries can not be overwritten on windows,
+there it is kept as .old and removed by RemoveOldBinary on the next start.
+*/
+func ReplaceBinary(exePath string, content []byte) error {
+	newPath := exePath + ".new"
+	if err := os.WriteFile(newPath, content, 0755); err != nil {
+		return err
+	}
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(exePath, oldPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		// puts the old binary back.
+		os.Rename(oldPath, exePath)
+		return err
+	}
+	if filepath.Ext(exePath) != ".exe" {
+		os.Remove(oldPath)
+	}
+	return nil
+}
+
+// Removes the binary left by ReplaceBinary on windows, it fails silently while the old binary still runs.
+func RemoveOldBinary() {
+	exePath, err := os.Executable()
+	if err == nil {
+		exePath, err = filepath.EvalSymlinks(exePath)
+	}
+	if err == nil && filepath.Ext(exePath) == ".exe" {
+		os.Remove(exePath + ".old")
+	}
+}
@@ -0,0 +1,146 @@
+package upload
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+// Publishes a signed release of two binaries into memory, returns it with the public key.
+func publishTestRelease(t *testing.T) (*Uploader, *MemoryStorage, *Release, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv(confs.WorkDirEnvName, dir)
+	cnf := confs.NewCollectorConf()
+	cnf.ReleaseSigningKey = filepath.Join(dir, "release.pem")
+	pub, err := GenerateReleaseKey(cnf.ReleaseSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaries := map[string]string{}
+	for platform, content := range map[string]string{"linux/amd64": "linux binary", "windows/amd64": "windows binary"} {
+		fPath := filepath.Join(dir, ReleaseAssetName(platform))
+		if err := os.WriteFile(fPath, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		binaries[platform] = fPath
+	}
+	st := NewMemoryStorage()
+	up := NewUploaderWithStorage(cnf, st)
+	if _, err := up.PublishRelease("v1.2.0", binaries); err != nil {
+		t.Fatal(err)
+	}
+	r, err := up.LatestRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return up, st, r, pub
+}
+
+func TestPublishRelease(t *testing.T) {
+	_, st, r, _ := publishTestRelease(t)
+	if r.Version != "v1.2.0" || len(r.Assets) != 2 {
+		t.Fatalf("latest release = %+v", r)
+	}
+	for platform, asset := range r.Assets {
+		if asset.Name != ReleaseAssetName(platform) || asset.Sha256 == "" || asset.Signature == "" {
+			t.Errorf("asset of %s = %+v", platform, asset)
+		}
+	}
+	want := []string{"releases/pxy.release.json", "releases/pxy_linux_amd64", "releases/pxy_windows_amd64.exe"}
+	if got := st.Files(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestDownloadRelease(t *testing.T) {
+	otherPub, err := GenerateReleaseKey(filepath.Join(t.TempDir(), "other.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		platform string
+		key      func(pub string) string
+		edit     func(r *Release, st *MemoryStorage)
+		ok       bool
+	}{
+		{"signed", "linux/amd64", nil, nil, true},
+		{"no key", "linux/amd64", func(string) string { return "" }, nil, true},
+		{"other key", "linux/amd64", func(string) string { return otherPub }, nil, false},
+		{"invalid key", "linux/amd64", func(string) string { return "abc" }, nil, false},
+		{"no binary", "darwin/arm64", nil, nil, false},
+		{"unsigned", "linux/amd64", nil, func(r *Release, _ *MemoryStorage) { r.Assets["linux/amd64"].Signature = "" }, false},
+		{"other version", "linux/amd64", nil, func(r *Release, _ *MemoryStorage) { r.Version = "v1.3.0" }, false},
+		{"other platform", "linux/amd64", nil, func(r *Release, _ *MemoryStorage) { r.Assets["linux/amd64"] = r.Assets["windows/amd64"] }, false},
+		{"tampered binary", "linux/amd64", nil, func(_ *Release, st *MemoryStorage) {
+			fPath := filepath.Join(t.TempDir(), "pxy")
+			os.WriteFile(fPath, []byte("evil binary"), 0o755)
+			st.Put("releases/pxy_linux_amd64", fPath)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, st, r, pub := publishTestRelease(t)
+			if tt.key != nil {
+				pub = tt.key(pub)
+			}
+			if tt.edit != nil {
+				tt.edit(r, st)
+			}
+			content, err := up.DownloadRelease(r, tt.platform, pub)
+			if tt.ok && (err != nil || string(content) != "linux binary") {
+				t.Errorf("DownloadRelease() = %q, %v", content, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("DownloadRelease() passed, want an error")
+			}
+		})
+	}
+}
+
+func TestReplaceBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		exeName string
+		keepOld bool
+	}{
+		{"unix", "pxy", false},
+		{"windows", "pxy.exe", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exePath := filepath.Join(t.TempDir(), tt.exeName)
+			if err := os.WriteFile(exePath, []byte("old"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ReplaceBinary(exePath, []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if content, _ := os.ReadFile(exePath); !bytes.Equal(content, []byte("new")) {
+				t.Errorf("binary = %q, want new", content)
+			}
+			if _, err := os.Stat(exePath + ".new"); err == nil {
+				t.Error(".new is left")
+			}
+			content, err := os.ReadFile(exePath + ".old")
+			if tt.keepOld && string(content) != "old" {
+				t.Errorf(".old = %q, %v, want old", content, err)
+			}
+			if !tt.keepOld && err == nil {
+				t.Error(".old is left")
+			}
+		})
+	}
+	exePath := filepath.Join(t.TempDir(), "missing")
+	if err := ReplaceBinary(exePath, []byte("new")); err == nil {
+		t.Error("ReplaceBinary() of a missing binary passed")
+	}
+	if _, err := os.Stat(exePath + ".new"); err == nil {
+		t.Error(".new is left after a failed replace")
+	}
+}
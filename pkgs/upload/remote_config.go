@@ -0,0 +1,55 @@
+package upload
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/request"
+)
+
+// Fetches RemoteConfig from an url or from the storage repo.
+func (u *Uploader) FetchRemoteConfig() ([]byte, error) {
+	if u.cnf.RemoteConfigIsUrl() {
+		f := request.NewFetcher()
+		f.SetUrl(u.cnf.RemoteConfig)
+		f.Timeout = 30 * time.Second
+		if confs.EnableProxyOrNot() {
+			f.Proxy = u.cnf.Proxy()
+		}
+		content, code := f.GetString()
+		if code != 200 {
+			return nil, fmt.Errorf("fetch remote config failed, status code: %d", code)
+		}
+		return []byte(content), nil
+	}
+	if u.mode == confs.UploadModeLocal {
+		return nil, fmt.Errorf("remote storage is not used in %s mode", u.mode)
+	}
+	if u.storage == nil {
+		return nil, ErrNoStorage
+	}
+	return u.storage.Get(u.cnf.RemoteConfig)
+}
+
+/*
+Refreshes subscribers, rawDomains and collector options from RemoteConfig,
+falls back to the last fetched copy when the remote one is not available.
+*/
+func RefreshRemoteConfig(cnf *confs.CollectorConf) {
+	if cnf.RemoteConfig == "" {
+		return
+	}
+	content, err := NewUploader(cnf).FetchRemoteConfig()
+	if err == nil {
+		err = cnf.ApplyRemoteConfig(content)
+	}
+	if err == nil {
+		return
+	}
+	logs.Warning("Remote config %s is not available: %+v", cnf.RemoteConfig, err)
+	if err = cnf.ApplyCachedRemoteConfig(); err != nil {
+		logs.Warning("%+v, local config is used.", err)
+	}
+}
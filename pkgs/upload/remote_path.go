@@ -0,0 +1,105 @@
+package upload
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+/*
+Categories for remote path templates.
+
+Example for RemotePaths in config.json:
+
+	{
+	    "versions": "versions/{name}.version.json",
+	    "proxy": "proxy/{date}/{file}"
+	}
+
+Placeholders: {name}, {file}, {date}, {year}, {month}, {day}.
+Files of a category without template are uploaded into the repo root.
+*/
+const (
+	CategoryVersions string = "versions"
+	CategoryProxy    string = "proxy"
+	CategoryDomains  string = "domains"
+	CategoryManifest string = "manifest"
+	CategoryDefault  string = "default"
+)
+
+// Finds category and short name for a local file.
+func fileCategory(fileName string) (category, name string) {
+	name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	switch {
+	case strings.HasSuffix(fileName, ".version.json"):
+		return CategoryVersions, strings.TrimSuffix(fileName, ".version.json")
+	case strings.HasSuffix(fileName, ".versions.json"):
+		return CategoryVersions, strings.TrimSuffix(fileName, ".versions.json")
+	case fileName == confs.VPNFileName, fileName == confs.VPNNewFileName:
+		return CategoryProxy, name
+	case fileName == confs.DomainFileName, fileName == confs.RawDomainFileName:
+		return CategoryDomains, name
+	case fileName == confs.ManifestFileName:
+		return CategoryManifest, name
+	default:
+		return CategoryDefault, name
+	}
+}
+
+// Renders the remote path for a local file, compressed copies follow their originals.
+func RemotePath(templates map[string]string, localFilePath string) string {
+	fileName := filepath.Base(localFilePath)
+	var cSuffix string
+	for _, suffix := range compressSuffix {
+		if strings.HasSuffix(fileName, suffix) {
+			cSuffix = suffix
+			fileName = strings.TrimSuffix(fileName, suffix)
+			break
+		}
+	}
+
+	category, name := fileCategory(fileName)
+	tpl := templates[category]
+	if tpl == "" {
+		tpl = templates[CategoryDefault]
+	}
+	if tpl == "" {
+		return fileName + cSuffix
+	}
+	now := time.Now().UTC()
+	r := strings.NewReplacer(
+		"{name}", name,
+		"{file}", fileName,
+		"{date}", now.Format("2006-01-02"),
+		"{year}", now.Format("2006"),
+		"{month}", now.Format("01"),
+		"{day}", now.Format("02"),
+	).Replace(tpl)
+	return strings.Trim(path.Clean(r), "/") + cSuffix
+}
+
+/*
+Storage backends take the remote file name from the local file,
+so a file is copied into a temp dir when the template renames it.
+*/
+func stageFile(localFilePath, remoteName string) (stagedPath string, cleanup func()) {
+	cleanup = func() {}
+	if filepath.Base(localFilePath) == remoteName {
+		return localFilePath, cleanup
+	}
+	tmpDir, err := os.MkdirTemp("", "pxy-upload-")
+	if err != nil {
+		return localFilePath, cleanup
+	}
+	stagedPath = filepath.Join(tmpDir, remoteName)
+	if _, err := gutils.CopyFile(localFilePath, stagedPath); err != nil {
+		os.RemoveAll(tmpDir)
+		return localFilePath, cleanup
+	}
+	return stagedPath, func() { os.RemoveAll(tmpDir) }
+}
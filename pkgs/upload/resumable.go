@@ -0,0 +1,112 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	DefaultResumableSize int64  = 8 << 20 // files larger than this use resumable uploads.
+	DefaultPartSize      int64  = 4 << 20 // must be a multiple of 256KiB for gcs.
+	maxPartRetries       int    = 3
+	resumeDirName        string = "pxy-uploads"
+)
+
+/*
+ResumableStorage is implemented by backends that upload large files in parts:
+azure (staged blocks) and gcs (resumable sessions).
+Finished parts are recorded in state, so a failed transfer resumes in the next run
+instead of restarting from the first byte.
+*/
+type ResumableStorage interface {
+	PutResumable(remotePath, localFilePath string, state *ResumeState) error
+}
+
+// ResumeState records the progress of a resumable upload.
+type ResumeState struct {
+	Remote   string `json:"remote"`
+	Sha256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"part_size"`
+	Session  string `json:"session,omitempty"` // gcs session uri.
+	Parts    []int  `json:"parts,omitempty"`   // finished azure blocks.
+	fPath    string
+}
+
+// Loads the state for a file, a new state is returned if the file changed.
+func loadResumeState(stateDir, remotePath, localFilePath string, partSize int64) (s *ResumeState) {
+	size, sum := fileSha256(localFilePath)
+	h := sha256.Sum256([]byte(remotePath))
+	s = &ResumeState{
+		fPath: filepath.Join(stateDir, hex.EncodeToString(h[:8])+".json"),
+	}
+	if content, err := os.ReadFile(s.fPath); err == nil {
+		json.Unmarshal(content, s)
+	}
+	if s.Remote != remotePath || s.Sha256 != sum || s.Size != size || s.PartSize != partSize {
+		s.Remote, s.Sha256, s.Size, s.PartSize = remotePath, sum, size, partSize
+		s.Session, s.Parts = "", nil
+	}
+	return
+}
+
+func (s *ResumeState) Save() {
+	os.MkdirAll(filepath.Dir(s.fPath), os.ModePerm)
+	if content, err := json.Marshal(s); err == nil {
+		utils.WriteFile(s.fPath, content, os.ModePerm)
+	}
+}
+
+// Removes the state after a finished upload.
+func (s *ResumeState) Done() {
+	os.Remove(s.fPath)
+}
+
+func (s *ResumeState) PartDone(idx int) bool {
+	for _, p := range s.Parts {
+		if p == idx {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ResumeState) PartCount() int {
+	return int((s.Size + s.PartSize - 1) / s.PartSize)
+}
+
+// Reads at most size bytes from start of a file.
+func readRange(localFilePath string, start, size int64) ([]byte, error) {
+	f, err := os.Open(localFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Retries a part upload with backoff.
+func retryPart(name string, f func() error) (err error) {
+	for i := 1; i <= maxPartRetries; i++ {
+		if err = f(); err == nil {
+			return
+		}
+		logs.Warning("%s failed(%d/%d): %+v", name, i, maxPartRetries, err)
+		time.Sleep(time.Duration(i*2) * time.Second)
+	}
+	return fmt.Errorf("%s failed after %d retries: %v", name, maxPartRetries, err)
+}
@@ -0,0 +1,202 @@
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+Schema is a small subset of JSON Schema, enough to check the published files:
+type, required, properties, additionalProperties, items, minItems, minProperties,
+enum, minLength and anyOf.
+*/
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             int                `json:"minItems,omitempty"`
+	MinProperties        int                `json:"minProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"` // strings only.
+	MinLength            int                `json:"minLength,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+// Newest release in a version file, written when VersionLatest is set in config.
+const VersionLatestKey string = "latest"
+
+// Allowed values in version files, "" means unknown or not applicable.
+var (
+	VersionOses = []string{
+		"", "any", "aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios",
+		"js", "linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows",
+	}
+	VersionArches = []string{
+		"", "any", "all", "universal", "386", "amd64", "arm", "arm64", "loong64", "mips", "mipsle",
+		"mips64", "mips64le", "ppc64", "ppc64le", "riscv64", "s390x", "wasm",
+	}
+	VersionVariants    = []string{"", "musl", "glibc", "msvc", "mingw", "static", "universal"}
+	VersionSumTypes    = []string{"", "md5", "sha1", "sha256", "sha512"}
+	VersionSumStatuses = []string{"", "computed", "verified", "mismatch"}
+)
+
+// Keys of files in version files, with the old keys that are written besides them for one release cycle.
+var versionFileKeys = [][2]string{
+	{"url", "Url"}, {"arch", "Arch"}, {"os", "Os"}, {"sum", "Sum"}, {"sum_type", "SumType"}, {"extra", "Extra"},
+}
+
+/*
+VersionFileSchema describes *.version.json:
+
+	{"latest": "1.0.0", "1.0.0": [{"url": "...", "arch": "amd64", "os": "linux", "sum": "...", "sum_type": "sha256", "extra": ""}]}
+
+A file needs an url, only hint entries like "please use conda to install." have an extra instead.
+Os, arch, sum_type and variant are lower case. Variant tells builds for the same os and arch apart:
+musl and glibc on linux, msvc and mingw on windows, static for any libc, universal for macOS.
+Files written before have the old keys "Url", "SumType" and so on only, both are valid.
+*/
+var VersionFileSchema = &Schema{
+	Type:       "object",
+	Properties: map[string]*Schema{VersionLatestKey: {Type: "string"}},
+	AdditionalProperties: &Schema{
+		Type:     "array",
+		MinItems: 1,
+		Items:    versionFileItem(),
+	},
+}
+
+func versionFileItem() *Schema {
+	fields := map[string]*Schema{
+		"url":           {Type: "string"},
+		"arch":          {Type: "string", Enum: VersionArches},
+		"os":            {Type: "string", Enum: VersionOses},
+		"sum":           {Type: "string"},
+		"sum_type":      {Type: "string", Enum: VersionSumTypes},
+		"extra":         {Type: "string"},
+		"variant":       {Type: "string", Enum: VersionVariants},
+		"sum_status":    {Type: "string", Enum: VersionSumStatuses},
+		"sig_verified":  {Type: "boolean"},
+		"size":          {Type: "integer"},
+		"last_modified": {Type: "string"},
+		"released_at":   {Type: "string"},
+		"eol_at":        {Type: "string"},
+	}
+	item := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, keys := range versionFileKeys {
+		item.Properties[keys[0]] = fields[keys[0]]
+		item.Properties[keys[1]] = fields[keys[0]]
+	}
+	// added after the key change, they have no old keys.
+	for _, key := range []string{"variant", "sum_status", "sig_verified", "size", "last_modified", "released_at", "eol_at"} {
+		item.Properties[key] = fields[key]
+	}
+	// an url, or an extra for hints, by either key.
+	for _, key := range []string{"url", "Url", "extra", "Extra"} {
+		item.AnyOf = append(item.AnyOf, &Schema{Required: []string{key}, Properties: map[string]*Schema{key: {MinLength: 1}}})
+	}
+	return item
+}
+
+func loadSchema(fPath string) (s *Schema, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return
+	}
+	s = &Schema{}
+	err = json.Unmarshal(content, s)
+	return
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+// Validates a decoded json value, returns the first violation found.
+func (s *Schema) Validate(v any, where string) error {
+	if s == nil {
+		return nil
+	}
+	if where == "" {
+		where = "$"
+	}
+	vt := jsonType(v)
+	if s.Type != "" && s.Type != vt && !(s.Type == "integer" && vt == "number") {
+		return fmt.Errorf("%s: expected %s, got %s", where, s.Type, vt)
+	}
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, sub := range s.AnyOf {
+			err := sub.Validate(v, where)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s: matches none of anyOf: %s", where, strings.Join(errs, "; "))
+		}
+	}
+	switch val := v.(type) {
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, val) {
+			return fmt.Errorf("%s: %q is not one of %q", where, val, s.Enum)
+		}
+		if len(val) < s.MinLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", where, s.MinLength, len(val))
+		}
+	case map[string]any:
+		if len(val) < s.MinProperties {
+			return fmt.Errorf("%s: expected at least %d properties, got %d", where, s.MinProperties, len(val))
+		}
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				return fmt.Errorf("%s: missing required property %q", where, key)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := s.Properties[key]
+			if sub == nil {
+				sub = s.AdditionalProperties
+			}
+			if err := sub.Validate(val[key], fmt.Sprintf("%s.%s", where, key)); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if len(val) < s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", where, s.MinItems, len(val))
+		}
+		for i, item := range val {
+			if err := s.Items.Validate(item, fmt.Sprintf("%s[%d]", where, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
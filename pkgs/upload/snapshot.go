@@ -0,0 +1,155 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+)
+
+const (
+	DefaultSnapshotKeep int     = 3
+	MaxShrinkRatio      float64 = 0.8 // a file shrinking more than this is treated as broken output.
+	snapshotTimeFormat  string  = "20060102-150405"
+)
+
+var (
+	snapshotID   string
+	snapshotOnce = &sync.Once{}
+)
+
+/*
+Snapshots keep copies of published files in <workdir>/snapshots/<run id>/,
+one directory per run, only the latest SnapshotKeep runs are kept.
+*/
+func currentSnapshotID() string {
+	snapshotOnce.Do(func() {
+		snapshotID = time.Now().UTC().Format(snapshotTimeFormat)
+	})
+	return snapshotID
+}
+
+// Lists snapshot names, oldest first.
+func (u *Uploader) ListSnapshots() (r []string) {
+	dList, _ := os.ReadDir(u.cnf.SnapshotDir())
+	for _, d := range dList {
+		if d.IsDir() {
+			r = append(r, d.Name())
+		}
+	}
+	sort.Strings(r)
+	return
+}
+
+func (u *Uploader) snapshotKeep() int {
+	if u.cnf.SnapshotKeep > 0 {
+		return u.cnf.SnapshotKeep
+	}
+	return DefaultSnapshotKeep
+}
+
+// Removes old snapshots, keeps the latest ones.
+func (u *Uploader) pruneSnapshots() {
+	sList := u.ListSnapshots()
+	for len(sList) > u.snapshotKeep() {
+		os.RemoveAll(filepath.Join(u.cnf.SnapshotDir(), sList[0]))
+		sList = sList[1:]
+	}
+}
+
+// Copies a published file into the snapshot of the current run.
+func (u *Uploader) saveSnapshot(localFilePath string) {
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+
+	sDir := filepath.Join(u.cnf.SnapshotDir(), currentSnapshotID())
+	if ok, _ := gutils.PathIsExist(sDir); !ok {
+		os.MkdirAll(sDir, os.ModePerm)
+		u.pruneSnapshots()
+	}
+	if _, err := gutils.CopyFile(localFilePath, filepath.Join(sDir, filepath.Base(localFilePath))); err != nil {
+		logs.Error("Save snapshot for %s failed: %+v", localFilePath, err)
+	}
+}
+
+// Finds the latest copy of a file published by a previous run.
+func (u *Uploader) previousSnapshotFile(fileName string) string {
+	sList := u.ListSnapshots()
+	for i := len(sList) - 1; i >= 0; i-- {
+		if sList[i] == currentSnapshotID() {
+			continue
+		}
+		fPath := filepath.Join(u.cnf.SnapshotDir(), sList[i], fileName)
+		if ok, _ := gutils.PathIsExist(fPath); ok {
+			return fPath
+		}
+	}
+	return ""
+}
+
+/*
+Checks whether a file shrank by more than MaxShrinkRatio compared with the previous snapshot.
+If so, the local file is restored from the snapshot and should not be published.
+*/
+func (u *Uploader) shrunk(localFilePath string) bool {
+	prevPath := u.previousSnapshotFile(filepath.Base(localFilePath))
+	if prevPath == "" {
+		return false
+	}
+	prevInfo, err1 := os.Stat(prevPath)
+	info, err2 := os.Stat(localFilePath)
+	if err1 != nil || err2 != nil || prevInfo.Size() == 0 {
+		return false
+	}
+	if float64(info.Size()) >= float64(prevInfo.Size())*(1-MaxShrinkRatio) {
+		return false
+	}
+	logs.Error("%s shrank from %d to %d bytes, keeps the previous snapshot.", localFilePath, prevInfo.Size(), info.Size())
+	if _, err := gutils.CopyFile(prevPath, localFilePath); err != nil {
+		logs.Error("Restore %s failed: %+v", localFilePath, err)
+	}
+	return true
+}
+
+/*
+Rollback publishes all files in a snapshot again.
+The latest snapshot before the current run is used when name is empty.
+*/
+func (u *Uploader) Rollback(name string) {
+	if u.storage == nil && u.mode == "" {
+		logs.Error("Storage is not initialized, please check your configurations.")
+		return
+	}
+	if name == "" {
+		for _, s := range u.ListSnapshots() {
+			if s != currentSnapshotID() {
+				name = s
+			}
+		}
+	}
+	sDir := filepath.Join(u.cnf.SnapshotDir(), name)
+	dList, err := os.ReadDir(sDir)
+	if name == "" || err != nil {
+		logs.Error("No snapshot found: %s", name)
+		return
+	}
+	logs.Info("Rolling back to snapshot: %s", name)
+	for _, d := range dList {
+		if d.IsDir() {
+			continue
+		}
+		fPath := filepath.Join(u.cnf.DirPath(), d.Name())
+		if _, err := gutils.CopyFile(filepath.Join(sDir, d.Name()), fPath); err != nil {
+			logs.Error("%+v", err)
+			continue
+		}
+		u.pool.Go(func() {
+			u.publish(fPath)
+		})
+	}
+	u.UploadManifest()
+}
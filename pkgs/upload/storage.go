@@ -0,0 +1,180 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gvcgo/goutils/pkgs/request"
+	"github.com/gvcgo/goutils/pkgs/storage"
+)
+
+var ErrNotFound = errors.New("remote file not found")
+
+// Message of github-like contents apis for missing files.
+const notFoundMessage = "Not Found"
+
+/*
+Storage is what the Uploader needs from a backend.
+Remote paths are slash separated and relative to the root of the repo/bucket.
+*/
+type Storage interface {
+	Put(remotePath, localFilePath string) error
+	Get(remotePath string) ([]byte, error) // returns ErrNotFound for missing files.
+	Delete(remotePath string) error
+	Exists(remotePath string) (bool, error)
+}
+
+/*
+ContentsStorage puts backends with a github-like contents api behind Storage:
+github, gitee, git, azure and gcs.
+*/
+type ContentsStorage struct {
+	Repo          string
+	ResumableSize int64  // files larger than this use resumable uploads when supported.
+	PartSize      int64  // part size of resumable uploads.
+	StateDir      string // progress of resumable uploads.
+	storage       storage.IStorage
+}
+
+func NewContentsStorage(repo string, st storage.IStorage) (c *ContentsStorage) {
+	c = &ContentsStorage{
+		Repo:          repo,
+		ResumableSize: DefaultResumableSize,
+		PartSize:      DefaultPartSize,
+		StateDir:      filepath.Join(os.TempDir(), resumeDirName),
+		storage:       st,
+	}
+	return
+}
+
+// The wrapped storage.
+func (c *ContentsStorage) Raw() storage.IStorage {
+	return c.storage
+}
+
+// Creates the repo if it does not exist.
+func (c *ContentsStorage) EnsureRepo() {
+	content := c.storage.GetRepoInfo(c.Repo)
+	if !strings.Contains(string(content), `"id":`) {
+		c.storage.CreateRepo(c.Repo)
+	}
+}
+
+/*
+Looks up the info of a remote file.
+ErrNotFound is only returned for a 404 or an info without sha,
+other failures like rate limits, api errors or a failed git sync are returned as errors.
+*/
+func (c *ContentsStorage) info(remotePath string) (*gjson.Json, error) {
+	remoteDir, remoteName := splitRemotePath(remotePath)
+	raw := bytes.TrimSpace(c.storage.GetContents(c.Repo, remoteDir, remoteName))
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("get %s failed: no response", remotePath)
+	}
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("get %s failed: unexpected response", remotePath)
+	}
+	if raw[0] == '[' {
+		// gitee lists an empty directory for missing files.
+		if len(bytes.TrimSpace(raw[1:len(raw)-1])) == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get %s failed: is a directory", remotePath)
+	}
+	j := gjson.New(raw)
+	if j.Get("sha").String() != "" {
+		return j, nil
+	}
+	if msg := j.Get("message").String(); msg != "" && !strings.EqualFold(msg, notFoundMessage) {
+		return nil, fmt.Errorf("get %s failed: %s", remotePath, msg)
+	}
+	return nil, ErrNotFound
+}
+
+func (c *ContentsStorage) Put(remotePath, localFilePath string) error {
+	if rs, ok := c.storage.(ResumableStorage); ok {
+		if info, err := os.Stat(localFilePath); err == nil && info.Size() > c.ResumableSize {
+			return rs.PutResumable(remotePath, localFilePath, loadResumeState(c.StateDir, remotePath, localFilePath, c.PartSize))
+		}
+	}
+	remoteDir, remoteName := splitRemotePath(remotePath)
+	stagedPath, cleanup := stageFile(localFilePath, remoteName)
+	defer cleanup()
+
+	shaStr := ""
+	info, err := c.info(remotePath)
+	switch {
+	case err == nil:
+		shaStr = info.Get("sha").String()
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+	raw := bytes.TrimSpace(c.storage.UploadFile(c.Repo, remoteDir, stagedPath, shaStr))
+	if len(raw) == 0 || !json.Valid(raw) {
+		return fmt.Errorf("upload %s failed: unexpected response", remotePath)
+	}
+	j := gjson.New(raw)
+	if j.Get("content").IsNil() {
+		msg := j.Get("message").String()
+		if msg == "" {
+			msg = "no content in response"
+		}
+		return fmt.Errorf("upload %s failed: %s", remotePath, msg)
+	}
+	return nil
+}
+
+func (c *ContentsStorage) Get(remotePath string) (r []byte, err error) {
+	j, err := c.info(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if encoded := j.Get("content").String(); encoded != "" {
+		return base64.StdEncoding.DecodeString(strings.ReplaceAll(encoded, "\n", ""))
+	}
+	// github returns no content for files larger than 1MB.
+	dUrl := j.Get("download_url").String()
+	if dUrl == "" {
+		return nil, fmt.Errorf("get %s failed: no content", remotePath)
+	}
+	f := request.NewFetcher()
+	f.SetUrl(dUrl)
+	content, code := f.GetString()
+	if code != 200 {
+		return nil, fmt.Errorf("download %s failed: status %d", remotePath, code)
+	}
+	return []byte(content), nil
+}
+
+func (c *ContentsStorage) Delete(remotePath string) error {
+	info, err := c.info(remotePath)
+	if err != nil {
+		return err
+	}
+	remoteDir, remoteName := splitRemotePath(remotePath)
+	c.storage.DeleteFile(c.Repo, remoteDir, remoteName, info.Get("sha").String())
+	return nil
+}
+
+func (c *ContentsStorage) Exists(remotePath string) (bool, error) {
+	_, err := c.info(remotePath)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Pushes buffered changes for storages like git.
+func (c *ContentsStorage) Flush() error {
+	if f, ok := c.storage.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/diff"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/notify"
+)
+
+// Changelog of a version file compared with its previous copy, see pkgs/diff.
+func versionChangelog(prevPath, localFilePath string) (*diff.Changelog, error) {
+	prev, _ := os.ReadFile(prevPath)
+	cur, err := os.ReadFile(localFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Versions(strings.TrimSuffix(filepath.Base(localFilePath), ".version.json"), prev, cur)
+}
+
+// Records a published file into the run summary for webhooks, before the snapshot is saved.
+func (u *Uploader) summarize(localFilePath string) {
+	s := notify.Current()
+	fileName := filepath.Base(localFilePath)
+	prevPath := u.previousSnapshotFile(fileName)
+	changed := true
+	if prevPath != "" {
+		_, sum := fileSha256(localFilePath)
+		_, prevSum := fileSha256(prevPath)
+		changed = sum != prevSum
+	}
+	s.AddFile(fileName, changed)
+
+	switch {
+	case fileName == confs.VPNFileName:
+		if nodes, err := u.countNodes(localFilePath); err == nil {
+			s.SetNodes(nodes)
+		}
+	case strings.HasSuffix(fileName, ".version.json") && changed && prevPath != "":
+		if c, err := versionChangelog(prevPath, localFilePath); err == nil {
+			s.AddChangelog(c)
+		} else {
+			logs.Warning("Diff %s failed: %+v", fileName, err)
+		}
+	}
+}
+
+/*
+Finishes the run summary, saves it as report.json and report.txt in the work dir,
+uploads them when UploadReport is set, and sends it to webhooks.
+*/
+func (u *Uploader) report() {
+	s := notify.Current()
+	s.Finish(logs.RunErrors())
+	s.SetFailure(confs.Failure())
+	fPaths, err := notify.WriteReport(u.cnf.DirPath(), s)
+	if err != nil {
+		logs.Error("Save run report failed: %+v", err)
+	} else {
+		logs.Info("Run report saved to %s.", strings.Join(fPaths, ", "))
+	}
+	if u.cnf.UploadReport {
+		for _, fPath := range fPaths {
+			if err := u.upload(fPath, RemotePath(u.cnf.RemotePaths, fPath)); err != nil {
+				logs.Error("Upload %s failed: %+v", filepath.Base(fPath), err)
+			}
+		}
+	}
+	if u.mode == "" {
+		notify.Send(u.cnf, s)
+	}
+}
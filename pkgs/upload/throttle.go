@@ -0,0 +1,71 @@
+package upload
+
+import (
+	"os"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/rate"
+)
+
+var (
+	globalLimiter *rate.Limiter
+	limiterOnce   = &sync.Once{}
+)
+
+// The limiter shared by all uploaders in this run.
+func getLimiter(cnf *confs.CollectorConf) *rate.Limiter {
+	limiterOnce.Do(func() {
+		if cnf.UploadRateLimit > 0 || cnf.UploadBandwidth > 0 {
+			globalLimiter = rate.NewLimiter(cnf.UploadRateLimit, cnf.UploadBandwidth)
+		}
+	})
+	return globalLimiter
+}
+
+// ThrottledStorage applies a rate.Limiter to another Storage.
+type ThrottledStorage struct {
+	Storage
+	limiter *rate.Limiter
+}
+
+func NewThrottledStorage(st Storage, l *rate.Limiter) (t *ThrottledStorage) {
+	t = &ThrottledStorage{
+		Storage: st,
+		limiter: l,
+	}
+	return
+}
+
+func (t *ThrottledStorage) Put(remotePath, localFilePath string) error {
+	t.limiter.WaitCall()
+	if info, err := os.Stat(localFilePath); err == nil {
+		t.limiter.WaitBytes(info.Size())
+	}
+	return t.Storage.Put(remotePath, localFilePath)
+}
+
+func (t *ThrottledStorage) Get(remotePath string) ([]byte, error) {
+	t.limiter.WaitCall()
+	content, err := t.Storage.Get(remotePath)
+	t.limiter.WaitBytes(int64(len(content)))
+	return content, err
+}
+
+func (t *ThrottledStorage) Delete(remotePath string) error {
+	t.limiter.WaitCall()
+	return t.Storage.Delete(remotePath)
+}
+
+func (t *ThrottledStorage) Exists(remotePath string) (bool, error) {
+	t.limiter.WaitCall()
+	return t.Storage.Exists(remotePath)
+}
+
+func (t *ThrottledStorage) Flush() error {
+	if f, ok := t.Storage.(flusher); ok {
+		t.limiter.WaitCall()
+		return f.Flush()
+	}
+	return nil
+}
@@ -1,74 +1,322 @@
 package upload
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/gogf/gf/v2/encoding/gjson"
 	"github.com/gogf/gf/v2/util/gconv"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/storage"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/goutils/pkgs/gutils"
+	"github.com/gvcgo/goutils/pkgs/storage"
+)
+
+var (
+	ErrNoStorage = errors.New("storage is not initialized")
+	ErrShrunk    = errors.New("file shrank too much, previous snapshot is kept")
 )
 
 type Uploader struct {
 	cnf     *confs.CollectorConf
-	storage storage.IStorage
+	storage Storage
+	mode    string
+	pool    *Pool
 }
 
 func NewUploader(cnf *confs.CollectorConf) (up *Uploader) {
+	if storageOverride != nil {
+		return NewUploaderWithStorage(cnf, storageOverride)
+	}
 	up = &Uploader{
-		cnf: cnf,
+		cnf:  cnf,
+		mode: confs.UploadMode(),
+		pool: NewPool(cnf.UploadWorkers),
 	}
 	up.initiate()
 	return
 }
 
 func (u *Uploader) initiate() {
+	var raw storage.IStorage
 	switch u.cnf.Type {
 	case confs.StorageGithub:
-		if u.cnf.UserName != "" && u.cnf.Token != "" && u.cnf.Repo != "" {
-			st := storage.NewGhStorage(u.cnf.UserName, u.cnf.Token)
+		hasAuth := u.cnf.Token != "" || (u.cnf.GithubAppID != "" && u.cnf.GithubAppInstallationID != "")
+		if u.cnf.UserName != "" && hasAuth && u.cnf.Repo != "" {
+			st := NewGithubStorage(u.cnf.UserName, u.cnf.Token)
+			if u.cnf.GithubAppID != "" {
+				st.AuthType = AuthTypeGithubApp
+				st.AppID = u.cnf.GithubAppID
+				st.InstallationID = u.cnf.GithubAppInstallationID
+				st.PrivateKeyPath = u.cnf.GithubAppPrivateKey
+			}
 			if u.cnf.ProxyURI != "" && gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
 				st.Proxy = u.cnf.ProxyURI
 			}
-			u.storage = st
+			raw = st
 		}
 	case confs.StorageGitee:
 		if u.cnf.UserName != "" && u.cnf.Token != "" && u.cnf.Repo != "" {
-			u.storage = storage.NewGtStorage(u.cnf.UserName, u.cnf.Token)
+			raw = storage.NewGtStorage(u.cnf.UserName, u.cnf.Token)
+		}
+	case confs.StorageGit:
+		if u.cnf.GitRemote != "" {
+			st := NewGitStorage(u.cnf.GitRemote, u.cnf.GitRepoDir())
+			if u.cnf.GitBranch != "" {
+				st.Branch = u.cnf.GitBranch
+			}
+			if u.cnf.UserName != "" {
+				st.Author = u.cnf.UserName
+			}
+			if u.cnf.GitEmail != "" {
+				st.Email = u.cnf.GitEmail
+			}
+			st.SSHKey = u.cnf.GitSSHKey
+			raw = st
+		}
+	case confs.StorageAzure:
+		if u.cnf.AzureAccount != "" && u.cnf.AzureContainer != "" && u.cnf.AzureSAS != "" {
+			st := NewAzureStorage(u.cnf.AzureAccount, u.cnf.AzureContainer, u.cnf.AzureSAS)
+			if u.cnf.ProxyURI != "" && gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
+				st.Proxy = u.cnf.ProxyURI
+			}
+			raw = st
+		}
+	case confs.StorageGCS:
+		if u.cnf.GCSBucket != "" && u.cnf.GCSCredentials != "" {
+			st := NewGCSStorage(u.cnf.GCSBucket, u.cnf.GCSCredentials)
+			if u.cnf.ProxyURI != "" && gconv.Bool(os.Getenv(confs.ToEnableProxyEnvName)) {
+				st.Proxy = u.cnf.ProxyURI
+			}
+			raw = st
 		}
 	default:
-		gprint.PrintError("Unknown storage type: %v", u.cnf.Type)
+		logs.Error("Unknown storage type: %v", u.cnf.Type)
+	}
+	if raw == nil {
+		return
+	}
+	cs := NewContentsStorage(u.cnf.Repo, raw)
+	cs.StateDir = u.cnf.ResumeDir()
+	if u.cnf.ResumableSize > 0 {
+		cs.ResumableSize = u.cnf.ResumableSize
+	}
+	if u.cnf.PartSize > 0 {
+		cs.PartSize = u.cnf.PartSize
+	}
+	if u.mode == "" {
+		// Try to create the repo, skipped in dry-run and local mode.
+		cs.EnsureRepo()
+	}
+	u.storage = cs
+	if l := getLimiter(u.cnf); l != nil {
+		u.storage = NewThrottledStorage(cs, l)
+	}
+}
+
+func (u *Uploader) Upload(localFilePath string) (err error) {
+	_, span := trace.Start(u.cnf.Context(), "upload", "file", filepath.Base(localFilePath))
+	defer func() {
+		span.Fail(err)
+		span.End()
+	}()
+	if u.storage == nil && u.mode == "" {
+		logs.Error("Storage is not initialized, please check your configurations.")
+		confs.Fail(confs.FailConfig)
+		return ErrNoStorage
+	}
+	if err = u.checkGates(localFilePath); err != nil {
+		logs.Error("Upload blocked, %v", err)
+		metrics.UploadFailures.Inc()
+		confs.Fail(confs.FailGate)
+		return
+	}
+	if u.shrunk(localFilePath) {
+		confs.Fail(confs.FailGate)
+		return ErrShrunk
+	}
+	if err = u.publish(localFilePath); err != nil {
+		logs.Error("%+v", err)
+		metrics.UploadFailures.Inc()
+		confs.Fail(confs.FailUpload)
+		u.recordPending(localFilePath, true)
+		return
+	}
+	u.recordPending(localFilePath, false)
+	if u.mode == "" {
+		u.summarize(localFilePath)
+		u.saveSnapshot(localFilePath)
+	}
+	return
+}
+
+func (u *Uploader) publish(localFilePath string) (err error) {
+	remotePath := RemotePath(u.cnf.RemotePaths, localFilePath)
+	item := &ManifestItem{
+		Path:       remotePath,
+		Compressed: map[string]string{},
+	}
+	if u.needChunk(localFilePath) {
+		if item.Chunks, item.Index, err = u.uploadChunks(localFilePath, remotePath); err != nil {
+			return
+		}
+	} else if err = u.upload(localFilePath, remotePath); err != nil {
+		return
+	}
+
+	// copies that failed are left out of the manifest, the file goes to the pending uploads.
+	for _, cPath := range u.compress(localFilePath) {
+		cRemotePath := RemotePath(u.cnf.RemotePaths, cPath)
+		var cErr error
+		if u.needChunk(cPath) {
+			_, cRemotePath, cErr = u.uploadChunks(cPath, cRemotePath)
+		} else {
+			cErr = u.upload(cPath, cRemotePath)
+		}
+		if cErr != nil {
+			err = errors.Join(err, fmt.Errorf("upload %s failed: %w", filepath.Base(cPath), cErr))
+			continue
+		}
+		method := CompressGzip
+		if strings.HasSuffix(cPath, compressSuffix[CompressZstd]) {
+			method = CompressZstd
+		}
+		item.Compressed[method] = cRemotePath
+	}
+	if u.mode != confs.UploadModeDryRun {
+		recordManifest(u.cnf.ManifestPath(), localFilePath, item)
+	}
+	return
+}
+
+/*
+Content of the published copy of a local file.
+In local mode or without storage, the local file from the last run is the published copy.
+Files published as chunks are read back through their index.
+Returns ErrNotFound when it has not been published yet.
+*/
+func (u *Uploader) Published(localFilePath string) ([]byte, error) {
+	if u.mode == confs.UploadModeLocal || u.storage == nil {
+		content, err := os.ReadFile(localFilePath)
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return content, err
+	}
+	remotePath := RemotePath(u.cnf.RemotePaths, localFilePath)
+	content, err := u.storage.Get(remotePath)
+	if errors.Is(err, ErrNotFound) && u.cnf.Type == confs.StorageGitee {
+		return u.publishedChunks(remotePath)
+	}
+	return content, err
+}
+
+// Uploads a file in the worker pool, see Wait.
+func (u *Uploader) UploadAsync(localFilePath string) {
+	u.pool.Go(func() {
+		u.Upload(localFilePath)
+	})
+}
+
+// Waits for all files queued by UploadAsync.
+func (u *Uploader) Wait() {
+	u.pool.Wait()
+}
+
+func splitRemotePath(remotePath string) (remoteDir, remoteName string) {
+	remoteDir, remoteName = path.Split(remotePath)
+	remoteDir = strings.TrimSuffix(remoteDir, "/")
+	return
+}
+
+func (u *Uploader) upload(localFilePath, remotePath string) error {
+	if u.mode != "" {
+		u.dryUpload(localFilePath, remotePath)
+		return nil
+	}
+	return u.storage.Put(remotePath, localFilePath)
+}
+
+// Creates compressed copies for large json files.
+func (u *Uploader) compress(localFilePath string) (r []string) {
+	methods := parseCompressMethods(u.cnf.Compress)
+	if len(methods) == 0 || !strings.HasSuffix(localFilePath, ".json") {
+		return
+	}
+	minSize := u.cnf.CompressSize
+	if minSize <= 0 {
+		minSize = DefaultCompressSize
+	}
+	if info, err := os.Stat(localFilePath); err != nil || info.Size() < minSize {
+		return
 	}
-	if u.storage != nil {
-		// Try to create the repo.
-		content := u.storage.GetRepoInfo(u.cnf.Repo)
-		if !strings.Contains(string(content), `"id":`) {
-			u.storage.CreateRepo(u.cnf.Repo)
+	for _, m := range methods {
+		if cPath, err := compressFile(localFilePath, m); err == nil {
+			r = append(r, cPath)
+		} else {
+			logs.Error("Compress %s failed: %+v", localFilePath, err)
 		}
 	}
+	return
 }
 
-func (u *Uploader) Upload(localFilePath string) (r []byte) {
-	if u.storage == nil {
-		gprint.PrintError("Storage is not initialized, please check your configurations.")
+// Uploads the manifest file after all pending uploads, so it is always the last one.
+func (u *Uploader) UploadManifest() (err error) {
+	u.Wait()
+	if u.storage == nil && u.mode == "" {
+		logs.Error("Storage is not initialized, please check your configurations.")
+		confs.Fail(confs.FailConfig)
+		return ErrNoStorage
+	}
+	defer func() {
+		if fErr := u.flush(); fErr != nil && err == nil {
+			err = fErr
+		}
+		u.report()
+	}()
+	fPath := u.cnf.ManifestPath()
+	if ok, _ := gutils.PathIsExist(fPath); !ok {
 		return
 	}
-	fileName := filepath.Base(localFilePath)
-	content := u.storage.GetContents(u.cnf.Repo, "", fileName)
-	shaStr := gjson.New(content).Get("sha").String()
-	return u.storage.UploadFile(u.cnf.Repo, "", localFilePath, shaStr)
+	return u.upload(fPath, RemotePath(u.cnf.RemotePaths, fPath))
+}
+
+// Storages like git buffer changes until Flush.
+type flusher interface {
+	Flush() error
+}
+
+func (u *Uploader) flush() error {
+	f, ok := u.storage.(flusher)
+	if !ok || u.mode != "" {
+		return nil
+	}
+	if err := f.Flush(); err != nil {
+		logs.Error("Push failed: %+v", err)
+		metrics.UploadFailures.Inc()
+		confs.Fail(confs.FailUpload)
+		return err
+	}
+	return nil
 }
 
 // Get release list.
 func (u *Uploader) GetGithubReleaseList(repoName string) (r []byte) {
-	if u.storage == nil {
-		gprint.PrintError("Storage is not initialized, please check your configurations.")
+	st := u.storage
+	if t, ok := st.(*ThrottledStorage); ok {
+		st = t.Storage
+	}
+	cs, ok := st.(*ContentsStorage)
+	if !ok || cs == nil {
+		logs.Error("Storage is not initialized, please check your configurations.")
 		return
 	}
-	if st, ok := u.storage.(*storage.GhStorage); ok && st != nil {
+	if st, ok := cs.Raw().(*GithubStorage); ok && st != nil {
 		r = st.GetReleaseList(repoName)
 	}
 	return
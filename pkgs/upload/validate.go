@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/goutils/pkgs/storage"
+)
+
+const (
+	writeCheckFileName string = ".pxy-write-check"
+)
+
+// Check is the result of a config validation step.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+func badCredentials(content []byte) bool {
+	s := string(content)
+	return strings.Contains(s, "Bad credentials") || strings.Contains(s, "401 Unauthorized") || strings.Contains(s, "Invalid access token")
+}
+
+/*
+ValidateConf checks config up front: required fields, token validity,
+repo existence and write permission, so that broken credentials do not fail a run midway.
+*/
+func ValidateConf(cnf *confs.CollectorConf) (checks []Check) {
+	if missing := cnf.Missing(); len(missing) > 0 {
+		return append(checks, Check{Name: "config", Detail: "missing: " + strings.Join(missing, ", ")})
+	}
+	checks = append(checks, Check{Name: "config", OK: true})
+
+	u := &Uploader{cnf: cnf, mode: confs.UploadModeDryRun, pool: NewPool(1)}
+	u.initiate()
+	cs, ok := u.storage.(*ContentsStorage)
+	if !ok || cs == nil {
+		return append(checks, Check{Name: "storage", Detail: "storage is not initialized"})
+	}
+
+	info := cs.Raw().GetRepoInfo(cnf.Repo)
+	switch st := cs.Raw().(type) {
+	case *GithubStorage:
+		token := Check{Name: "token"}
+		if st.AuthType == AuthTypeGithubApp {
+			if _, err := st.installationToken(); err != nil {
+				token.Detail = err.Error()
+			} else {
+				token.OK = true
+			}
+		} else {
+			login := gjson.New(st.do(http.MethodGet, "/user", nil)).Get("login").String()
+			token.OK, token.Detail = login != "", login
+		}
+		if !token.OK && token.Detail == "" {
+			token.Detail = "invalid token"
+		}
+		checks = append(checks, token)
+	case *storage.GtStorage:
+		token := Check{Name: "token", OK: !badCredentials(info)}
+		if !token.OK {
+			token.Detail = "invalid token"
+		}
+		checks = append(checks, token)
+	}
+
+	j := gjson.New(info)
+	repo := Check{Name: "repo", OK: strings.Contains(string(info), `"id":`)}
+	if !repo.OK {
+		repo.Detail = "repo not found: " + j.Get("message").String()
+		return append(checks, repo)
+	}
+	checks = append(checks, repo)
+	return append(checks, checkWrite(cs, j))
+}
+
+// Uses permissions in repo info for github and gitee, writes a probe file for others.
+func checkWrite(cs *ContentsStorage, repoInfo *gjson.Json) Check {
+	c := Check{Name: "write"}
+	switch cs.Raw().(type) {
+	case *GithubStorage:
+		if repoInfo.Get("permissions").IsNil() {
+			// installation tokens get no permissions field.
+			return probeWrite(cs)
+		}
+		c.OK = repoInfo.Get("permissions.push").Bool()
+	case *storage.GtStorage:
+		c.OK = repoInfo.Get("permission.push").Bool()
+	default:
+		return probeWrite(cs)
+	}
+	if !c.OK {
+		c.Detail = "no push permission"
+	}
+	return c
+}
+
+func probeWrite(cs *ContentsStorage) Check {
+	c := Check{Name: "write"}
+	tmpDir, err := os.MkdirTemp("", "pxy-check-")
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	defer os.RemoveAll(tmpDir)
+	fPath := filepath.Join(tmpDir, writeCheckFileName)
+	os.WriteFile(fPath, []byte("pxy"), os.ModePerm)
+	if err := cs.Put(writeCheckFileName, fPath); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if ok, _ := cs.Exists(writeCheckFileName); !ok {
+		c.Detail = "probe file not found after upload"
+		return c
+	}
+	cs.Delete(writeCheckFileName)
+	if err := cs.Flush(); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK = true
+	return c
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+/*
+Detection of checksum types, so collectors do not hard-code "sha256" for sums of unknown kind.
+
+Sums are hex strings, their type follows from the length. Checksum files come in these layouts:
+
+	<sum>  <name>                   GNU style, like sha256sum output and SHASUMS256.txt, "*<name>" for binary mode.
+	SHA256 (<name>) = <sum>         BSD style, like shasum --tag output.
+	sha256:<sum>                    prefixed, like docker digests.
+	<sum>                           a bare sum, like foo.tar.gz.sha256.
+
+Json digests, like {"foo.zip": "sha256:<sum>"} or [{"name": "foo.zip", "sha256": "<sum>"}], are read too.
+*/
+
+// Registered checksum file formats, see RegisterSumParser.
+const (
+	SumFormatLines string = "lines" // the line layouts above, one entry per line.
+	SumFormatJson  string = "json"  // json digests, see parseJsonSums.
+)
+
+const (
+	SumMd5    string = "md5"
+	SumSha1   string = "sha1"
+	SumSha256 string = "sha256"
+	SumSha512 string = "sha512"
+)
+
+var sumTypesByLen = map[int]string{32: SumMd5, 40: SumSha1, 64: SumSha256, 128: SumSha512}
+
+var (
+	hexPattern       = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	bsdSumPattern    = regexp.MustCompile(`^([A-Za-z0-9-]+)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+	prefixSumPattern = regexp.MustCompile(`^(?i)(md5|sha1|sha256|sha512)[:=-]([0-9a-fA-F]+)$`)
+)
+
+// Checksum type of a hex sum by its length, "" when it is not a hex sum.
+func SumTypeOf(sum string) string {
+	sum = strings.TrimSpace(sum)
+	if !hexPattern.MatchString(sum) {
+		return ""
+	}
+	return sumTypesByLen[len(sum)]
+}
+
+/*
+Parses a line of a checksum file in any of the layouts above, name is "" for prefixed and bare sums.
+The type always follows from the length of the sum, names of BSD style lines may disagree, like "SHA2-256".
+*/
+func ParseSumLine(line string) (sum, sumType, name string) {
+	line = strings.TrimSpace(line)
+	if m := bsdSumPattern.FindStringSubmatch(line); m != nil {
+		sum, name = m[3], m[2]
+	} else if m := prefixSumPattern.FindStringSubmatch(line); m != nil {
+		sum = m[2]
+	} else if fields := strings.Fields(line); len(fields) > 0 {
+		sum = fields[0]
+		if len(fields) > 1 {
+			name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+	}
+	if sumType = SumTypeOf(sum); sumType == "" {
+		return "", "", ""
+	}
+	return strings.ToLower(sum), sumType, name
+}
+
+// An entry of a checksum file, Name is "" for bare sums.
+type SumEntry struct {
+	Name string
+	Sum  string // lower case hex.
+	Type string
+}
+
+/*
+A parser of a checksum file format, it returns nil for content in other formats.
+Parsers are registered by RegisterSumParser and tried in the order of registration by ParseSums,
+so collectors reuse them instead of splitting strings themselves.
+*/
+type SumParser func(content string) []*SumEntry
+
+type namedSumParser struct {
+	name  string
+	parse SumParser
+}
+
+var sumParsers = []*namedSumParser{}
+
+// Registers a parser of checksum files, a parser of the same name is replaced.
+func RegisterSumParser(name string, parse SumParser) {
+	for _, p := range sumParsers {
+		if p.name == name {
+			p.parse = parse
+			return
+		}
+	}
+	sumParsers = append(sumParsers, &namedSumParser{name: name, parse: parse})
+}
+
+// Names of registered parsers, in the order they are tried.
+func SumParsers() (r []string) {
+	for _, p := range sumParsers {
+		r = append(r, p.name)
+	}
+	return
+}
+
+func init() {
+	RegisterSumParser(SumFormatJson, parseJsonSums)
+	RegisterSumParser(SumFormatLines, parseSumLines)
+}
+
+// Entries of a checksum file by the first parser that understands it, or by the parser of format when it is set.
+func ParseSums(content, format string) []*SumEntry {
+	for _, p := range sumParsers {
+		if format != "" && p.name != format {
+			continue
+		}
+		if entries := p.parse(content); len(entries) > 0 {
+			return entries
+		}
+	}
+	return nil
+}
+
+/*
+Finds the sum of fileName in a checksum file with one or many entries, in any registered format.
+Names are compared by their base, so "./dist/foo.zip" matches "foo.zip". A single entry without a name,
+like the content of foo.zip.sha256, matches any file name.
+*/
+func FindSum(content, fileName string) (sum, sumType string) {
+	return SumOf(ParseSums(content, ""), fileName)
+}
+
+// The sum of fileName in parsed entries, like FindSum.
+func SumOf(entries []*SumEntry, fileName string) (sum, sumType string) {
+	fileName = path.Base(fileName)
+	for _, e := range entries {
+		if e.Name != "" && path.Base(e.Name) == fileName {
+			return e.Sum, e.Type
+		}
+	}
+	if len(entries) == 1 && entries[0].Name == "" {
+		return entries[0].Sum, entries[0].Type
+	}
+	return "", ""
+}
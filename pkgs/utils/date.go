@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Dates of upstreams come in many layouts: RFC1123 headers like Last-Modified, RFC3339 timestamps of apis,
+dates like "2024-01-13" in tags and pages. All of them are parsed by ParseTime, and recorded in UTC:
+timestamps as RFC3339 by Timestamp, dates as "2006-01-02" by Date, so files written on machines in
+different time zones agree. Layouts without a zone are taken as UTC.
+*/
+
+const DateLayout string = "2006-01-02"
+
+// Upstream clocks ahead of ours by more than it are not trusted, see Timestamp.
+const MaxClockSkew = 10 * time.Minute
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.ANSIC,
+	time.UnixDate,
+	DateLayout,
+	"2006/01/02",
+	"2006.01.02",
+	"20060102",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// Parses s in any of the layouts above, in UTC. ok is false when nothing matches.
+func ParseTime(s string) (t time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return
+	}
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			return parsed.UTC(), true
+		}
+	}
+	if parsed, err := http.ParseTime(s); err == nil {
+		return parsed.UTC(), true
+	}
+	return
+}
+
+/*
+A recorded timestamp, RFC3339 in UTC, "" when s cannot be parsed. Timestamps ahead of now by more than
+MaxClockSkew come from skewed upstream clocks, now is recorded instead.
+*/
+func Timestamp(s string) string {
+	t, ok := ParseTime(s)
+	if !ok {
+		return ""
+	}
+	if now := time.Now().UTC(); t.After(now.Add(MaxClockSkew)) {
+		t = now
+	}
+	return FormatTime(t)
+}
+
+// A date like "2024-01-13" in UTC, "" when s cannot be parsed. Dates may lie in the future, like end of life dates.
+func Date(s string) string {
+	t, ok := ParseTime(s)
+	if !ok {
+		return ""
+	}
+	return t.Format(DateLayout)
+}
+
+// t as a recorded timestamp, RFC3339 in UTC.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Now as a recorded timestamp.
+func Now() string {
+	return FormatTime(time.Now())
+}
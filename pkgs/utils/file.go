@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/*
+Crash safe writes of local files, like version files, conf.txt and config.json.
+
+Content goes to a temp file in the same dir, which is synced and renamed over the file,
+so a crash or a full disk mid-run never leaves a partial file behind.
+*/
+
+const BackupSuffix string = ".bak"
+
+// Writes to a temp file in the same dir and renames it, so readers never see a partial file.
+func WriteFile(fPath string, content []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(fPath), filepath.Base(fPath)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err = f.Write(content); err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, fPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// the rename is durable once the dir is synced, windows does not support it.
+	if d, err := os.Open(filepath.Dir(fPath)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Like WriteFile, and keeps the previous content in <file>.bak when the content changes.
+func WriteFileWithBackup(fPath string, content []byte, perm os.FileMode) error {
+	if old, err := os.ReadFile(fPath); err == nil && len(old) > 0 && string(old) != string(content) {
+		if err = WriteFile(fPath+BackupSuffix, old, perm); err != nil {
+			return err
+		}
+	}
+	return WriteFile(fPath, content, perm)
+}
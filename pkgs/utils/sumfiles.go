@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Keys of file names and sums in objects of json digests, like the assets of release apis.
+var (
+	jsonSumNameKeys = []string{"name", "filename", "file", "path"}
+	jsonSumKeys     = []string{"sha512", "sha256", "sha1", "md5", "digest", "checksum", "hash", "shasum"}
+)
+
+func parseSumLines(content string) (entries []*SumEntry) {
+	for _, line := range strings.Split(content, "\n") {
+		if sum, sumType, name := ParseSumLine(line); sum != "" {
+			entries = append(entries, &SumEntry{Name: name, Sum: sum, Type: sumType})
+		}
+	}
+	return
+}
+
+/*
+Json digests: objects of file names to sums, and objects with a name and a sum key anywhere in the document,
+like {"assets": [{"name": "foo.zip", "digest": "sha256:<sum>"}]}. Sums may carry a prefix like "sha256:".
+*/
+func parseJsonSums(content string) (entries []*SumEntry) {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil
+	}
+	var data any
+	if err := json.Unmarshal([]byte(trimmed), &data); err != nil {
+		return nil
+	}
+	walkJsonSums(data, &entries)
+	return
+}
+
+func walkJsonSums(data any, entries *[]*SumEntry) {
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			walkJsonSums(item, entries)
+		}
+	case map[string]any:
+		if e := jsonSumEntry(v); e != nil {
+			*entries = append(*entries, e)
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if s, ok := v[k].(string); ok {
+				// {"foo.zip": "<sum>"}
+				if sum, sumType, _ := ParseSumLine(s); sum != "" && !strings.ContainsAny(s, " \t") {
+					*entries = append(*entries, &SumEntry{Name: k, Sum: sum, Type: sumType})
+				}
+				continue
+			}
+			walkJsonSums(v[k], entries)
+		}
+	}
+}
+
+// An object with a file name and a sum, nil for other objects.
+func jsonSumEntry(obj map[string]any) *SumEntry {
+	name := ""
+	for _, k := range jsonSumNameKeys {
+		if s, ok := obj[k].(string); ok && s != "" {
+			name = s
+			break
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	for _, k := range jsonSumKeys {
+		if s, ok := obj[k].(string); ok {
+			if sum, sumType, _ := ParseSumLine(s); sum != "" {
+				return &SumEntry{Name: name, Sum: sum, Type: sumType}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+/*
+Normalization of download urls before they are written into version files, so that the same file always
+has the same url, and clients never download through trackers:
+
+  - relative urls are resolved against the page they were found on;
+  - scheme and host are lower cased, default ports and fragments are dropped;
+  - tracking parameters like utm_source are stripped, other parameters are kept, they may sign the url;
+  - paths are percent-encoded, like spaces as %20.
+
+Urls that cannot be parsed are returned trimmed.
+*/
+
+// Tracking parameters, those ending with "_" are prefixes.
+var trackingParams = []string{"utm_", "gclid", "fbclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_gl"}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range trackingParams {
+		if key == p || (strings.HasSuffix(p, "_") && strings.HasPrefix(key, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalizes a download url, base is the url of the page it was found on, "" when it is absolute.
+func NormalizeUrl(rawUrl, base string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	if !u.IsAbs() && base != "" {
+		b, err := url.Parse(base)
+		if err != nil {
+			return rawUrl
+		}
+		u = b.ResolveReference(u)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		// not Hostname, it drops the brackets of ipv6 hosts.
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.RawQuery != "" {
+		q := u.Query()
+		stripped := false
+		for key := range q {
+			if isTrackingParam(key) {
+				q.Del(key)
+				stripped = true
+			}
+		}
+		// the query is left untouched otherwise, signed urls depend on its exact form.
+		if stripped {
+			u.RawQuery = q.Encode()
+		}
+	}
+	return u.String()
+}
+
+/*
+Upgrades an http url to https when the host is in httpsHosts, like hosts that serve other files of the same
+version file over https. Hosts are compared lower cased.
+*/
+func UpgradeHttps(rawUrl string, httpsHosts map[string]bool) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme != "http" || !httpsHosts[strings.ToLower(u.Host)] {
+		return rawUrl
+	}
+	u.Scheme = "https"
+	return u.String()
+}
@@ -0,0 +1,58 @@
+package utils
+
+import "testing"
+
+func TestNormalizeUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		base string
+		want string
+	}{
+		{"absolute", "https://example.com/a/tool.tar.gz", "", "https://example.com/a/tool.tar.gz"},
+		{"trimmed", "  https://example.com/tool.zip\n", "", "https://example.com/tool.zip"},
+		{"relative", "tool-1.0.0.tar.gz", "https://example.com/downloads/", "https://example.com/downloads/tool-1.0.0.tar.gz"},
+		{"root relative", "/dl/tool.zip", "https://example.com/downloads/index.html", "https://example.com/dl/tool.zip"},
+		{"parent relative", "../tool.zip", "https://example.com/a/b/", "https://example.com/a/tool.zip"},
+		{"scheme relative", "//cdn.example.com/tool.zip", "https://example.com/", "https://cdn.example.com/tool.zip"},
+		{"relative without base", "tool.zip", "", "tool.zip"},
+		{"case", "HTTPS://Example.COM/Tool.zip", "", "https://example.com/Tool.zip"},
+		{"https default port", "https://example.com:443/tool.zip", "", "https://example.com/tool.zip"},
+		{"http default port", "http://example.com:80/tool.zip", "", "http://example.com/tool.zip"},
+		{"other port", "https://example.com:8443/tool.zip", "", "https://example.com:8443/tool.zip"},
+		{"http port on https", "https://example.com:80/tool.zip", "", "https://example.com:80/tool.zip"},
+		{"ipv6", "https://[2001:db8::1]/tool.zip", "", "https://[2001:db8::1]/tool.zip"},
+		{"ipv6 default port", "https://[2001:db8::1]:443/tool.zip", "", "https://[2001:db8::1]/tool.zip"},
+		{"ipv6 http default port", "http://[::1]:80/tool.zip", "", "http://[::1]/tool.zip"},
+		{"ipv6 other port", "https://[2001:DB8::1]:8443/tool.zip", "", "https://[2001:db8::1]:8443/tool.zip"},
+		{"fragment", "https://example.com/tool.zip#sha256", "", "https://example.com/tool.zip"},
+		{"tracking", "https://example.com/tool.zip?utm_source=x&utm_medium=y", "", "https://example.com/tool.zip"},
+		{"tracking and others", "https://example.com/tool.zip?v=2&gclid=abc&a=1", "", "https://example.com/tool.zip?a=1&v=2"},
+		{"signed query kept", "https://example.com/tool.zip?X-Amz-Signature=ab%2Fcd&b=1&a=2", "", "https://example.com/tool.zip?X-Amz-Signature=ab%2Fcd&b=1&a=2"},
+		{"spaces", "https://example.com/my tool.zip", "", "https://example.com/my%20tool.zip"},
+		{"broken", "https://example.com/%zz", "", "https://example.com/%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUrl(tt.raw, tt.base); got != tt.want {
+				t.Errorf("NormalizeUrl(%q, %q) = %q, want %q", tt.raw, tt.base, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeHttps(t *testing.T) {
+	hosts := map[string]bool{"example.com": true}
+	tests := []struct{ raw, want string }{
+		{"http://example.com/tool.zip", "https://example.com/tool.zip"},
+		{"http://Example.com/tool.zip", "https://Example.com/tool.zip"},
+		{"http://other.com/tool.zip", "http://other.com/tool.zip"},
+		{"https://example.com/tool.zip", "https://example.com/tool.zip"},
+		{"ftp://example.com/tool.zip", "ftp://example.com/tool.zip"},
+	}
+	for _, tt := range tests {
+		if got := UpgradeHttps(tt.raw, hosts); got != tt.want {
+			t.Errorf("UpgradeHttps(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+/*
+Version names as vendors write them:
+
+	1.22.0, v1.22.0, go1.21rc1, 3.13.0a1, 21.0.1+12, 8u392, 2024-01-13, 1.0.0-beta.2
+
+A name is split into release numbers and an optional pre-release label with numbers.
+Separators ".", "-", "_", "+" and "u" between numbers are ignored, missing numbers count as 0.
+*/
+var (
+	releasePattern = regexp.MustCompile(`^\d+(?:(?:[.\-_+]|u)\d+)*`)
+	numPattern     = regexp.MustCompile(`\d+`)
+	prePattern     = regexp.MustCompile(`(?i)^[.\-_+]?(dev|snapshot|nightly|alpha|a|beta|b|m|preview|pre|ea|rc)(?:[.\-_]?(\d+(?:\.\d+)*))?`)
+)
+
+// Ranks of pre-release labels, a release ranks above all of them.
+var preRanks = map[string]int{
+	"dev":      1,
+	"snapshot": 1,
+	"nightly":  1,
+	"alpha":    2,
+	"a":        2,
+	"beta":     3,
+	"b":        3,
+	"m":        4,
+	"preview":  5,
+	"pre":      5,
+	"ea":       6,
+	"rc":       7,
+}
+
+const releaseRank = 100
+
+type parsedVersion struct {
+	nums    []int64
+	rank    int
+	preNums []int64
+}
+
+func parseVersion(name string) (p parsedVersion) {
+	s := strings.TrimSpace(name)
+	if i := strings.IndexAny(s, "0123456789"); i > 0 {
+		s = s[i:] // v1.0, go1.22, jdk-21...
+	}
+	release := releasePattern.FindString(s)
+	for _, n := range numPattern.FindAllString(release, -1) {
+		p.nums = append(p.nums, gconv.Int64(n))
+	}
+	p.rank = releaseRank
+	if m := prePattern.FindStringSubmatch(s[len(release):]); m != nil {
+		p.rank = preRanks[strings.ToLower(m[1])]
+		for _, n := range numPattern.FindAllString(m[2], -1) {
+			p.preNums = append(p.preNums, gconv.Int64(n))
+		}
+	}
+	return
+}
+
+func compareNums(a, b []int64) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+/*
+Compares version names, returns 1 when a is newer, -1 when b is newer.
+A release is newer than its pre-releases: 1.21rc1 < 1.21.0 < 1.21.1.
+Names without numbers are older than names with numbers.
+*/
+func CompareVersion(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	switch {
+	case len(pa.nums) > 0 && len(pb.nums) == 0:
+		return 1
+	case len(pa.nums) == 0 && len(pb.nums) > 0:
+		return -1
+	}
+	if r := compareNums(pa.nums, pb.nums); r != 0 {
+		return r
+	}
+	if pa.rank != pb.rank {
+		if pa.rank > pb.rank {
+			return 1
+		}
+		return -1
+	}
+	if r := compareNums(pa.preNums, pb.preNums); r != 0 {
+		return r
+	}
+	return strings.Compare(a, b)
+}
+
+// Pre-releases like rc, beta, alpha, preview and ea builds.
+func IsPrerelease(name string) bool {
+	return parseVersion(name).rank != releaseRank
+}
+
+/*
+The release line of a version with the given number of numbers,
+like "1.21" for 1.21.3 with 2 numbers, missing numbers count as 0.
+*/
+func VersionLine(name string, numbers int) string {
+	nums := parseVersion(name).nums
+	parts := make([]string, numbers)
+	for i := range parts {
+		parts[i] = "0"
+		if i < len(nums) {
+			parts[i] = strconv.FormatInt(nums[i], 10)
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		want parsedVersion
+	}{
+		{"1.22.0", parsedVersion{nums: []int64{1, 22, 0}, rank: releaseRank}},
+		{"v1.22.0", parsedVersion{nums: []int64{1, 22, 0}, rank: releaseRank}},
+		{"go1.21rc1", parsedVersion{nums: []int64{1, 21}, rank: preRanks["rc"], preNums: []int64{1}}},
+		{"1.21rc1", parsedVersion{nums: []int64{1, 21}, rank: preRanks["rc"], preNums: []int64{1}}},
+		{"3.13.0a1", parsedVersion{nums: []int64{3, 13, 0}, rank: preRanks["a"], preNums: []int64{1}}},
+		{"1.0.0-beta.2", parsedVersion{nums: []int64{1, 0, 0}, rank: preRanks["beta"], preNums: []int64{2}}},
+		{"21.0.1+12", parsedVersion{nums: []int64{21, 0, 1, 12}, rank: releaseRank}},
+		{"8u392", parsedVersion{nums: []int64{8, 392}, rank: releaseRank}},
+		{"2024-01-13", parsedVersion{nums: []int64{2024, 1, 13}, rank: releaseRank}},
+		{"jdk-21", parsedVersion{nums: []int64{21}, rank: releaseRank}},
+		{"latest", parsedVersion{rank: releaseRank}},
+	}
+	for _, tt := range tests {
+		if got := parseVersion(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseVersion(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.21.0", "1.21.0", 0},
+		{"v1.21.0", "v1.21.0", 0},
+		{"1.21.1", "1.21.0", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.21.1", "1.21.0", 1},
+		{"1.21.0", "v1.21.1", -1},
+		{"go1.22.0", "go1.21.5", 1},
+		{"1.21.0", "1.21rc1", 1},
+		{"1.21rc2", "1.21rc1", 1},
+		{"1.21rc1", "1.21beta2", 1},
+		{"1.21rc1", "1.20.9", 1},
+		{"1.0.0-beta.2", "1.0.0-beta.1", 1},
+		{"8u392", "8u372", 1},
+		{"11.0.21", "8u392", 1},
+		{"2024-01-13", "2023-12-31", 1},
+		{"2024-01-13", "2024-01-02", 1},
+		{"1.0.0", "latest", 1},
+		{"latest", "1.0.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersion(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersion(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersion(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"1.21.0", false},
+		{"v1.21.0", false},
+		{"1.21rc1", true},
+		{"go1.22rc2", true},
+		{"3.13.0a1", true},
+		{"1.0.0-beta.2", true},
+		{"2.0.0-M1", true},
+		{"22-ea", true},
+		{"1.0.0-nightly", true},
+		{"8u392", false},
+		{"21.0.1+12", false},
+		{"2024-01-13", false},
+	}
+	for _, tt := range tests {
+		if got := IsPrerelease(tt.name); got != tt.want {
+			t.Errorf("IsPrerelease(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package versions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+/*
+Go API for embedding collectors in other programs:
+
+	cnf := confs.NewCollectorConf()
+	vs, err := versions.NewGolang(cnf).Collect(ctx)
+	files, err := versions.CollectFiles(ctx, cnf, "github")
+
+Collect fetches the versions of a collector and returns them normalized and filtered by the options of the collector
+in config, without publishing them: nothing is written or uploaded, and no HEAD requests or checksums are made.
+A confs.Exit or a panic in a collector is returned as an error instead of exiting, and so is a canceled ctx.
+Logs go through slog.Default(), replace it to capture them. Call Collect once per collector.
+
+Collectors writing several version files, github and installers, have CollectFiles instead,
+keyed by version file names like "neovim.version.json".
+*/
+
+var ErrNoVersions = errors.New("no versions collected")
+
+// A collector of one version file.
+type VersionsCollector interface {
+	Collect(ctx context.Context) (Versions, error)
+	VersionFileName() string
+}
+
+// A collector of several version files.
+type FilesCollector interface {
+	CollectFiles(ctx context.Context) (map[string]Versions, error)
+}
+
+// Runs fetch with ctx as the context of cnf.
+func runCollect(ctx context.Context, cnf *confs.CollectorConf, name string, fetch func()) error {
+	parent := cnf.Context()
+	cnf.SetContext(ctx)
+	defer cnf.SetContext(parent)
+	if err := Isolate(name, "Collect", fetch); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Normalizes and filters versions like publishVersions, before any network check.
+func collected(cnf *confs.CollectorConf, name string, vs Versions) Versions {
+	for _, files := range vs {
+		for _, f := range files {
+			if f != nil {
+				f.Normalize()
+			}
+		}
+	}
+	vs.upgradeHttps()
+	return FilterVersions(cnf.CollectorOptions(name), vs)
+}
+
+// Collect of collectors of one version file, the result is also kept in vs.
+func collectVersions(ctx context.Context, cnf *confs.CollectorConf, name string, fetch func(), vs *Versions) (Versions, error) {
+	if err := runCollect(ctx, cnf, name, fetch); err != nil {
+		return nil, err
+	}
+	*vs = collected(cnf, name, *vs)
+	if len(*vs) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoVersions)
+	}
+	return *vs, nil
+}
+
+// CollectFiles of collectors of several version files, fileNamePattern turns a key of files into a file name.
+func collectFiles(ctx context.Context, cnf *confs.CollectorConf, name string, fetch func(), files map[string]Versions, fileNamePattern string) (map[string]Versions, error) {
+	if err := runCollect(ctx, cnf, name, fetch); err != nil {
+		return nil, err
+	}
+	r := map[string]Versions{}
+	for key, vs := range files {
+		vs = collected(cnf, name, vs)
+		files[key] = vs
+		if len(vs) > 0 {
+			r[fmt.Sprintf(fileNamePattern, key)] = vs
+		}
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoVersions)
+	}
+	return r, nil
+}
+
+// Collects the version files of a registered collector, like "golang", keyed by version file names.
+func CollectFiles(ctx context.Context, cnf *confs.CollectorConf, name string) (map[string]Versions, error) {
+	switch c := NewCollector(name, cnf).(type) {
+	case nil:
+		return nil, fmt.Errorf("unknown collector: %s", name)
+	case FilesCollector:
+		return c.CollectFiles(ctx)
+	case VersionsCollector:
+		vs, err := c.Collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]Versions{c.VersionFileName(): vs}, nil
+	}
+	return nil, fmt.Errorf("%s cannot be collected without publishing", name)
+}
@@ -0,0 +1,75 @@
+package versions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	VersionFileSuffix string = ".version.json"
+	BundleFileName    string = "all.versions.json"
+)
+
+/*
+Aggregates every "<name>.version.json" in the work dir into a single file,
+so clients can fetch all version lists with one request.
+
+	{
+	    "go": {"1.22.0": [...]},
+	    "nodejs": {"21.6.1": [...]}
+	}
+
+Version files of a dry run replace the ones in the work dir.
+*/
+func BuildBundle(cnf *confs.CollectorConf) (fPath string) {
+	dirs := []string{cnf.DirPath()}
+	if confs.DryRun() {
+		dirs = append(dirs, cnf.DryRunPath())
+	}
+	bundle := map[string]Versions{}
+	for i, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if i == 0 {
+				logs.Error("%+v", err)
+				return
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), VersionFileSuffix) {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			vs := Versions{}
+			if err := json.Unmarshal(content, &vs); err != nil {
+				logs.Warning("Invalid version file: %s", entry.Name())
+				continue
+			}
+			bundle[strings.TrimSuffix(entry.Name(), VersionFileSuffix)] = vs
+		}
+	}
+	if len(bundle) == 0 {
+		return
+	}
+	content, err := json.Marshal(bundle)
+	if err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	fPath = cnf.OutputPath(BundleFileName)
+	if err := utils.WriteFile(fPath, content, os.ModePerm); err != nil {
+		logs.Error("%+v", err)
+		return ""
+	}
+	return
+}
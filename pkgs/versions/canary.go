@@ -0,0 +1,241 @@
+package versions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/mholt/archiver/v3"
+)
+
+/*
+Canary validation of new versions, before they are published.
+
+Up to CanarySample files of versions that are not in the published copy are picked randomly,
+downloaded into a temp dir like gvc would, checked against their published sums, and extracted:
+every entry of an archive is decompressed and read. Installers can not be run here,
+exe, msi, pkg, dmg, deb and rpm files are checked by their formats.
+Files that fail are not published, versions left without files are dropped.
+Network errors and files larger than ChecksumMaxSize are skipped, they prove nothing.
+*/
+
+var ErrCanary = errors.New("canary failed")
+
+// Leading bytes of installer formats, by extension.
+var installerMagics = map[string][]byte{
+	".exe": []byte("MZ"),
+	".msi": {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1},
+	".pkg": []byte("xar!"),
+	".deb": []byte("!<arch>\n"),
+	".rpm": {0xED, 0xAB, 0xEE, 0xDB},
+}
+
+func canaryCheck(cnf *confs.CollectorConf, collector string, vs, published Versions) Versions {
+	if cnf.CanarySample <= 0 {
+		return vs
+	}
+	type target struct {
+		vName string
+		file  *VFile
+	}
+	targets := []*target{}
+	for vName, files := range vs {
+		if _, ok := published[vName]; ok {
+			continue
+		}
+		for _, f := range files {
+			if f != nil && strings.HasPrefix(f.Url, "http") {
+				targets = append(targets, &target{vName: vName, file: f})
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return vs
+	}
+	_, span := trace.Start(cnf.Context(), "canary", "collector", collector)
+	defer span.End()
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+
+	log := logs.For(collector)
+	passed, failed := 0, map[*VFile]bool{}
+	for i := 0; i < len(targets) && i < cnf.CanarySample && !cnf.Canceled(); i++ {
+		t := targets[i]
+		err := canary(cnf, t.file)
+		switch {
+		case err == nil:
+			passed++
+		case errors.Is(err, ErrCanary):
+			log.Error("%s of %s is not published: %v", t.file.Url, t.vName, err)
+			failed[t.file] = true
+		default:
+			log.Warning("Canary of %s skipped: %+v", t.file.Url, err)
+		}
+	}
+	log.Info("Canary: %d new files passed, %d failed.", passed, len(failed))
+	span.Set("passed", passed, "failed", len(failed))
+	if len(failed) == 0 {
+		return vs
+	}
+	r := Versions{}
+	for vName, files := range vs {
+		kept := VFileList{}
+		for _, f := range files {
+			if !failed[f] {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) > 0 {
+			r[vName] = kept
+		}
+	}
+	return r
+}
+
+/*
+Downloads and validates a file, errors wrapping ErrCanary are proof of a broken file,
+other errors are not.
+*/
+func canary(cnf *confs.CollectorConf, f *VFile) error {
+	dir, err := os.MkdirTemp("", "pxy-canary-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	name := path.Base(strings.SplitN(f.Url, "?", 2)[0])
+	if name == "" || name == "/" || name == "." {
+		name = "artifact"
+	}
+	fPath := filepath.Join(dir, name)
+	out, err := os.Create(fPath)
+	if err != nil {
+		return err
+	}
+	var h hash.Hash
+	if f.Sum != "" {
+		h = newHash(f.SumType)
+	}
+	w := io.Writer(out)
+	if h != nil {
+		w = io.MultiWriter(out, h)
+	}
+	maxSize := cnf.ChecksumMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultChecksumMaxSize
+	}
+	_, err = fetch.Stream(cnf, f.Url, w, maxSize)
+	out.Close()
+	if err != nil {
+		return err
+	}
+	if h != nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, strings.TrimSpace(f.Sum)) {
+			f.SumStatus = SumMismatch
+			return fmt.Errorf("%w: %s sum is %s, published %s", ErrCanary, f.SumType, sum, f.Sum)
+		}
+		f.SumStatus = SumVerified
+	}
+	if err = validateArtifact(fPath); err != nil {
+		return fmt.Errorf("%w: %v", ErrCanary, err)
+	}
+	if f.Sum == "" {
+		// the file is downloaded anyway.
+		content, err := os.Open(fPath)
+		if err == nil {
+			s := sha256.New()
+			io.Copy(s, content)
+			content.Close()
+			f.Sum, f.SumType, f.SumStatus = hex.EncodeToString(s.Sum(nil)), utils.SumSha256, SumComputed
+		}
+	}
+	return nil
+}
+
+// Checks that a downloaded file is what its name says.
+func validateArtifact(fPath string) error {
+	head := make([]byte, 512)
+	fd, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	n, _ := io.ReadFull(fd, head)
+	fd.Close()
+	head = head[:n]
+	if n == 0 {
+		return errors.New("empty file")
+	}
+	// a page instead of the file, like a login or a "not found" page with 200.
+	if lower := bytes.ToLower(bytes.TrimSpace(head)); bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")) {
+		return errors.New("got an html page")
+	}
+	ext := strings.ToLower(filepath.Ext(fPath))
+	if magic, ok := installerMagics[ext]; ok {
+		if !bytes.HasPrefix(head, magic) {
+			return fmt.Errorf("not a %s file", ext)
+		}
+		return nil
+	}
+	if ext == ".dmg" {
+		return validateDmg(fPath)
+	}
+	format, err := archiver.ByExtension(fPath)
+	if err != nil {
+		// not an archive, like a binary or a script.
+		return nil
+	}
+	switch a := format.(type) {
+	case archiver.Walker:
+		entries := 0
+		err = a.Walk(fPath, func(af archiver.File) error {
+			if !af.IsDir() {
+				if _, err := io.Copy(io.Discard, af); err != nil {
+					return fmt.Errorf("%s: %w", af.Name(), err)
+				}
+			}
+			entries++
+			return nil
+		})
+		if err == nil && entries == 0 {
+			err = errors.New("empty archive")
+		}
+		return err
+	case archiver.Decompressor:
+		fd, err := os.Open(fPath)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		return a.Decompress(fd, io.Discard)
+	}
+	return nil
+}
+
+// Disk images end with a 512 bytes "koly" trailer.
+func validateDmg(fPath string) error {
+	fd, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	trailer := make([]byte, 4)
+	if _, err = fd.Seek(-512, io.SeekEnd); err == nil {
+		_, err = io.ReadFull(fd, trailer)
+	}
+	if err != nil || string(trailer) != "koly" {
+		return errors.New("not a .dmg file")
+	}
+	return nil
+}
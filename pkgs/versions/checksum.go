@@ -0,0 +1,137 @@
+package versions
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"math/rand"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/cache"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	DefaultChecksumMaxSize int64 = 512 << 20
+)
+
+// SumStatus of a VFile.
+const (
+	SumComputed string = "computed" // the site publishes no sum, Sum is computed by the collector.
+	SumVerified string = "verified" // the published sum matches the artifact.
+	SumMismatch string = "mismatch" // the published sum does not match the artifact.
+)
+
+// Keeps the results of checks on the published copy of the same file.
+func (v *VFile) inherit(published *VFile) {
+	if v.Size == 0 && v.LastModified == "" {
+		v.Size, v.LastModified = published.Size, published.LastModified
+	}
+	// dates are kept when the release history could not be fetched this time.
+	if v.ReleasedAt == "" {
+		v.ReleasedAt = published.ReleasedAt
+	}
+	if v.EolAt == "" {
+		v.EolAt = published.EolAt
+	}
+	switch {
+	case v.Sum == "" && published.SumStatus == SumComputed:
+		v.Sum, v.SumType, v.SumStatus = published.Sum, published.SumType, published.SumStatus
+	case v.Sum != "" && strings.EqualFold(v.Sum, published.Sum):
+		v.SumStatus, v.SigVerified = published.SumStatus, published.SigVerified
+	}
+}
+
+func newHash(sumType string) hash.Hash {
+	switch strings.ToLower(sumType) {
+	case utils.SumMd5:
+		return md5.New()
+	case utils.SumSha1:
+		return sha1.New()
+	case utils.SumSha256:
+		return sha256.New()
+	case utils.SumSha512:
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+/*
+Downloads and hashes artifacts of a version file, the downloads are streamed and never saved:
+
+ 1. up to ChecksumCompute files without a sum get a sha256 sum;
+ 2. up to ChecksumSample files with a published sum are picked randomly and verified.
+
+Checked files are skipped, results are kept across runs by MergeVersions,
+so all files are covered after enough runs.
+*/
+func checkSums(cnf *confs.CollectorConf, collector string, vs Versions) {
+	if cnf.ChecksumCompute <= 0 && cnf.ChecksumSample <= 0 {
+		return
+	}
+	_, span := trace.Start(cnf.Context(), "checksums", "collector", collector)
+	defer span.End()
+	var missing, published []*VFile
+	for _, files := range vs {
+		for _, f := range files {
+			switch {
+			case f == nil || f.Url == "" || f.SumStatus != "":
+			case f.Sum == "":
+				missing = append(missing, f)
+			case newHash(f.SumType) != nil:
+				published = append(published, f)
+			}
+		}
+	}
+	rand.Shuffle(len(missing), func(i, j int) { missing[i], missing[j] = missing[j], missing[i] })
+	rand.Shuffle(len(published), func(i, j int) { published[i], published[j] = published[j], published[i] })
+
+	maxSize := cnf.ChecksumMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultChecksumMaxSize
+	}
+	computed, verified, mismatched := 0, 0, 0
+	for i := 0; i < len(missing) && i < cnf.ChecksumCompute && !cnf.Canceled(); i++ {
+		f := missing[i]
+		key := "sha256 " + f.Url
+		if !cache.Get(cache.BucketSums, key, &f.Sum) {
+			h := sha256.New()
+			if _, err := fetch.Stream(cnf, f.Url, h, maxSize); err != nil {
+				logs.For(collector).Warning("Compute sum of %s failed: %+v", f.Url, err)
+				continue
+			}
+			f.Sum = hex.EncodeToString(h.Sum(nil))
+			cache.Set(cache.BucketSums, key, f.Sum, cache.SumsTtl)
+		}
+		f.SumType, f.SumStatus = utils.SumSha256, SumComputed
+		computed++
+	}
+	for i := 0; i < len(published) && i < cnf.ChecksumSample && !cnf.Canceled(); i++ {
+		f := published[i]
+		h := newHash(f.SumType)
+		if _, err := fetch.Stream(cnf, f.Url, h, maxSize); err != nil {
+			logs.For(collector).Warning("Verify sum of %s failed: %+v", f.Url, err)
+			continue
+		}
+		if strings.EqualFold(hex.EncodeToString(h.Sum(nil)), strings.TrimSpace(f.Sum)) {
+			f.SumStatus = SumVerified
+			verified++
+		} else {
+			f.SumStatus = SumMismatch
+			mismatched++
+			logs.For(collector).Error("Checksum mismatch: %s, published %s %s.", f.Url, f.SumType, f.Sum)
+		}
+	}
+	if computed+verified+mismatched > 0 {
+		logs.For(collector).Info("Checksums: %d computed, %d verified, %d mismatched.", computed, verified, mismatched)
+		span.Set("computed", computed, "verified", verified, "mismatched", mismatched)
+	}
+}
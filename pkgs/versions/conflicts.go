@@ -0,0 +1,104 @@
+package versions
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Checks of a version file before it is written, signs of parser bugs or upstream tampering:
+
+	duplicates      two files of a version for the same os, arch, variant and extra.
+	sum conflicts   an url published before with a different sum, files of "latest" are skipped, they move.
+
+GateDuplicates and GateSumConflicts in config decide to warn(default), to block the version file, or to skip the check.
+A blocked version file is neither written nor uploaded, the run exits with confs.GateBlockedExitCode.
+*/
+
+// Problems of a check, nil when there are none.
+func findDuplicates(vs Versions) (problems []string) {
+	for _, vName := range vs.Names() {
+		byPlatform := map[string][]string{}
+		for _, f := range vs[vName] {
+			if f == nil || f.Url == "" {
+				continue
+			}
+			key := strings.Join([]string{f.Os, f.Arch, f.Variant, f.Extra}, "/")
+			byPlatform[key] = append(byPlatform[key], f.Url)
+		}
+		keys := make([]string, 0, len(byPlatform))
+		for key := range byPlatform {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if urls := byPlatform[key]; len(urls) > 1 {
+				problems = append(problems, vName+" has "+strings.Join(urls, ", ")+" for "+key)
+			}
+		}
+	}
+	return
+}
+
+func isMoving(vName string, f *VFile) bool {
+	return vName == "latest" || f.Extra == "latest"
+}
+
+func findSumConflicts(vs, published Versions) (problems []string) {
+	publishedSums := map[string]string{}
+	for vName, files := range published {
+		for _, f := range files {
+			if f != nil && f.Url != "" && f.Sum != "" && !isMoving(vName, f) {
+				publishedSums[f.Url] = f.Sum
+			}
+		}
+	}
+	for _, vName := range vs.Names() {
+		for _, f := range vs[vName] {
+			if f == nil || f.Sum == "" || isMoving(vName, f) {
+				continue
+			}
+			if old, ok := publishedSums[f.Url]; ok && !strings.EqualFold(old, f.Sum) {
+				problems = append(problems, f.Url+" of "+vName+" was published with "+old+", now "+f.Sum)
+			}
+		}
+	}
+	return
+}
+
+// Reports problems of the checks, false when the version file is blocked.
+func checkConflicts(cnf *confs.CollectorConf, collector, fileName string, vs, published Versions) bool {
+	if cnf.GateDisabled {
+		return true
+	}
+	log := logs.For(collector)
+	passed := true
+	checks := []struct {
+		name     string
+		mode     string
+		problems func() []string
+	}{
+		{"duplicate files", cnf.GateDuplicates, func() []string { return findDuplicates(vs) }},
+		{"sum conflicts", cnf.GateSumConflicts, func() []string { return findSumConflicts(vs, published) }},
+	}
+	for _, c := range checks {
+		mode := strings.ToLower(c.mode)
+		if mode == confs.GateOff {
+			continue
+		}
+		problems := c.problems()
+		if len(problems) == 0 {
+			continue
+		}
+		if mode == confs.GateBlock {
+			log.Error("%s blocked by %d %s: %s", fileName, len(problems), c.name, strings.Join(problems, "; "))
+			passed = false
+			continue
+		}
+		log.Warning("%s has %d %s: %s", fileName, len(problems), c.name, strings.Join(problems, "; "))
+	}
+	return passed
+}
@@ -0,0 +1,104 @@
+package versions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
+)
+
+/*
+Release and end of life dates of versions, so clients can show the age of a toolchain and warn about unsupported ones:
+
+	nodejs  released from the date in index.json, eol from the release schedule of the Node.js Release WG.
+	golang  both from the release history, a major release is supported until the second newer one is released.
+	java    released from published_at of the github releases, adoptium publishes no eol dates per release.
+
+Dates are "YYYY-MM-DD" in UTC by utils.Date, versions without a known date have none.
+*/
+
+const (
+	NodeScheduleUrl  string = "https://raw.githubusercontent.com/nodejs/Release/main/schedule.json"
+	GoReleaseHistory string = "https://go.dev/doc/devel/release"
+)
+
+var (
+	goReleasePattern = regexp.MustCompile(`go(1\.\d+(?:\.\d+)?)\s+\(released\s+(\d{4}[-/]\d{2}[-/]\d{2})\)`)
+	goMajorPattern   = regexp.MustCompile(`^1\.(\d+)`)
+)
+
+// Sets dates on all files of a version, empty dates are skipped.
+func (vs Versions) setDates(vName, releasedAt, eolAt string) {
+	for _, f := range vs[vName] {
+		if f == nil {
+			continue
+		}
+		if releasedAt != "" {
+			f.ReleasedAt = releasedAt
+		}
+		if eolAt != "" {
+			f.EolAt = eolAt
+		}
+	}
+}
+
+// End dates of Node.js release lines, keys are like "v20" and "v0.12".
+func nodeSchedule(cnf *confs.CollectorConf, fetcher *request.Fetcher) map[string]string {
+	schedule := map[string]struct {
+		End string `json:"end"`
+	}{}
+	if err := getApiJson(cnf, fetcher, NodeScheduleUrl, &schedule); err != nil {
+		logs.For("nodejs").Warning("Release schedule: %+v", err)
+		return nil
+	}
+	r := map[string]string{}
+	for line, s := range schedule {
+		r[line] = utils.Date(s.End)
+	}
+	return r
+}
+
+// Release line of a Node.js version, "v20" for "20.11.0", "v0.12" for "0.12.18".
+func nodeLine(vName string) string {
+	parts := strings.Split(vName, ".")
+	if parts[0] == "0" && len(parts) > 1 {
+		return "v0." + parts[1]
+	}
+	return "v" + parts[0]
+}
+
+// Release dates of Go versions from the release history, keys are like "1.22.0", "1.20" and "1.20.3".
+func goReleaseDates(cnf *confs.CollectorConf, fetcher *request.Fetcher) map[string]string {
+	f := fetch.Clone(fetcher)
+	f.SetUrl(GoReleaseHistory)
+	content, code := fetch.GetString(cnf, f)
+	if code != 200 {
+		logs.For("golang").Warning("Release history: get %s failed, status code: %d", GoReleaseHistory, code)
+		return nil
+	}
+	r := map[string]string{}
+	for _, m := range goReleasePattern.FindAllStringSubmatch(content, -1) {
+		r[m[1]] = utils.Date(m[2])
+	}
+	return r
+}
+
+// A Go major release is supported until two newer majors are released, 1.20 ends with the release of 1.22.0.
+func goEolAt(dates map[string]string, vName string) string {
+	m := goMajorPattern.FindStringSubmatch(vName)
+	if m == nil {
+		return ""
+	}
+	minor, _ := strconv.Atoi(m[1])
+	next := fmt.Sprintf("1.%d", minor+2)
+	if d, ok := dates[next+".0"]; ok {
+		return d
+	}
+	return dates[next]
+}
@@ -0,0 +1,147 @@
+package versions
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/notify"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+const (
+	DeadLinkFileName    string = "dead_links.json"
+	DefaultDeadLinkDrop int    = 3
+)
+
+/*
+DeadLink is a quarantined file, its link answered 404 or 410.
+
+Quarantined files are left out of published version files and checked again on each run,
+a file is restored when its link answers 200. After DeadLinkDrop dead answers in a row
+the file is dropped and never checked again, until it is removed from dead_links.json.
+*/
+type DeadLink struct {
+	Url       string `json:"url"`
+	Collector string `json:"collector"`
+	Version   string `json:"version"`
+	Code      int    `json:"code"`
+	Failures  int    `json:"failures"` // dead answers in a row.
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+	File      *VFile `json:"file"`
+}
+
+func (d *DeadLink) Dropped(drop int) bool {
+	return d.Failures >= drop
+}
+
+// Store for dead_links.json.
+func DeadLinkStore(cnf *confs.CollectorConf) *confs.ListStore[*DeadLink] {
+	return &confs.ListStore[*DeadLink]{
+		Path: filepath.Join(cnf.DirPath(), DeadLinkFileName),
+		Key:  func(d *DeadLink) string { return d.Url },
+		Decode: func(content []byte) (r []*DeadLink, err error) {
+			err = json.Unmarshal(content, &r)
+			return
+		},
+		Encode: func(links []*DeadLink) ([]byte, error) {
+			if links == nil {
+				links = []*DeadLink{}
+			}
+			return json.MarshalIndent(links, "", "    ")
+		},
+	}
+}
+
+func DeadLinkDrop(cnf *confs.CollectorConf) int {
+	if cnf.DeadLinkDrop > 0 {
+		return cnf.DeadLinkDrop
+	}
+	return DefaultDeadLinkDrop
+}
+
+// Dead links known to a collector run.
+type deadLinks struct {
+	cnf   *confs.CollectorConf
+	links map[string]*DeadLink
+}
+
+func loadDeadLinks(cnf *confs.CollectorConf) *deadLinks {
+	d := &deadLinks{cnf: cnf, links: map[string]*DeadLink{}}
+	list, err := DeadLinkStore(cnf).List()
+	if err != nil {
+		logs.Error("%+v", err)
+	}
+	for _, l := range list {
+		if l != nil {
+			d.links[l.Url] = l
+		}
+	}
+	return d
+}
+
+func (d *deadLinks) has(url string) bool {
+	_, ok := d.links[url]
+	return ok
+}
+
+func (d *deadLinks) dropped(url string) bool {
+	l, ok := d.links[url]
+	return ok && l.Dropped(DeadLinkDrop(d.cnf))
+}
+
+/*
+Records results of HEAD checks: dead links are quarantined, links answering 200 are restored.
+Returns links found dead for the first time, they are also added to the run summary for webhooks.
+*/
+func (d *deadLinks) record(collector string, targets []*headTarget) (newlyDead []string) {
+	now := utils.Now()
+	changed, restored := map[string]*DeadLink{}, map[string]bool{}
+	for _, t := range targets {
+		url := t.file.Url
+		switch {
+		case isDeadCode(t.code):
+			l, ok := d.links[url]
+			if !ok {
+				l = &DeadLink{Url: url, Collector: collector, FirstSeen: now}
+				d.links[url] = l
+				newlyDead = append(newlyDead, url)
+			}
+			l.Version, l.Code, l.File, l.LastSeen = t.vName, t.code, t.file, now
+			l.Failures++
+			changed[url] = l
+		case t.code == 200 && d.has(url):
+			logs.For(collector).Info("Dead link is back, restored: %s", url)
+			delete(d.links, url)
+			restored[url] = true
+		}
+	}
+	if len(changed) == 0 && len(restored) == 0 {
+		return
+	}
+	notify.Current().AddDeadLinks(newlyDead...)
+	// other collectors may update the store at the same time.
+	err := DeadLinkStore(d.cnf).Update(func(list []*DeadLink) []*DeadLink {
+		kept := []*DeadLink{}
+		for _, l := range list {
+			if l == nil || restored[l.Url] {
+				continue
+			}
+			if c, ok := changed[l.Url]; ok {
+				l = c
+				delete(changed, l.Url)
+			}
+			kept = append(kept, l)
+		}
+		for _, l := range changed {
+			kept = append(kept, l)
+		}
+		return kept
+	})
+	if err != nil {
+		logs.Error("Save dead links failed: %+v", err)
+	}
+	return
+}
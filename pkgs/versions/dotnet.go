@@ -1,26 +1,48 @@
 package versions
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
-	DotNetVersionFileName string = "dotnet.version.json"
+	DotNetVersionFileName  string = "dotnet.version.json"
+	DotNetReleasesIndexUrl string = "https://dotnetcli.blob.core.windows.net/dotnet/release-metadata/releases-index.json"
 )
 
+// releases-index.json and releases.json of the release metadata.
+type dotNetChannel struct {
+	ChannelVersion string `json:"channel-version"`
+	SupportPhase   string `json:"support-phase"`
+	ReleasesJson   string `json:"releases.json"`
+}
+
+type dotNetFile struct {
+	Rid  string `json:"rid"`
+	Url  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+type dotNetSdk struct {
+	Version string        `json:"version"`
+	Files   []*dotNetFile `json:"files"`
+}
+
+type dotNetRelease struct {
+	Sdk  *dotNetSdk   `json:"sdk"`
+	Sdks []*dotNetSdk `json:"sdks"`
+}
+
 /*
 .Net versions.
 
@@ -46,11 +68,7 @@ func NewDotNet(cnf *confs.CollectorConf) (d *DotNet) {
 		host:     "https://dotnet.microsoft.com",
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := d.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		d.fetcher.Proxy = pxy
+		d.fetcher.Proxy = d.cnf.Proxy()
 	}
 	return d
 }
@@ -58,18 +76,18 @@ func NewDotNet(cnf *confs.CollectorConf) (d *DotNet) {
 func (d *DotNet) getDoc() {
 	d.fetcher.SetUrl(d.homepage)
 	d.fetcher.Timeout = 180 * time.Second
-	if resp, sCode := d.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(d.cnf, d.fetcher); resp != "" && sCode == 200 {
 		var err error
 		d.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if d.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", d.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", d.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Printf("Failed: %s, code: %d\n", d.homepage, sCode)
+		logs.Error("Failed: %s, code: %d", d.homepage, sCode)
 	}
 }
 
@@ -77,34 +95,30 @@ func (d *DotNet) fetchVersion(vUrl, vStr string) {
 	d.fetcher.SetUrl(vUrl)
 	d.fetcher.Timeout = 180 * time.Second
 	var doc *goquery.Document
-	if resp, sCode := d.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(d.cnf, d.fetcher); resp != "" && sCode == 200 {
 		var err error
 		doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", d.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", d.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Printf("Failed: %s, code: %d\n", d.homepage, sCode)
+		logs.Error("Failed: %s, code: %d", d.homepage, sCode)
 		return
 	}
 
 	link := doc.Find("a#directLink").AttrOr("href", "")
 	sha512Str := doc.Find("input#checksum").AttrOr("value", "")
-	sumType := "SHA512"
-	if sha512Str == "" {
-		sumType = sha512Str
-	}
 	if _, ok := d.versions[vStr]; !ok {
 		d.versions[vStr] = []*VFile{}
 	}
 	d.versions[vStr] = append(d.versions[vStr], &VFile{
 		Url:     link,
 		Sum:     sha512Str,
-		SumType: sumType,
+		SumType: utils.SumTypeOf(sha512Str),
 		Arch:    utils.ParseArch(vUrl),
 		Os:      utils.ParsePlatform(vUrl),
 	})
@@ -130,7 +144,60 @@ func filterDotNetSDKByUrl(vUrl string) bool {
 	return true
 }
 
+// SDKs of supported channels from the release metadata.
+func (d *DotNet) fetchFromApi() {
+	index := struct {
+		Channels []*dotNetChannel `json:"releases-index"`
+	}{}
+	if err := getApiJson(d.cnf, d.fetcher, DotNetReleasesIndexUrl, &index); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for _, c := range index.Channels {
+		if c.SupportPhase == "eol" || c.ReleasesJson == "" {
+			continue
+		}
+		channel := struct {
+			Releases []*dotNetRelease `json:"releases"`
+		}{}
+		if err := getApiJson(d.cnf, d.fetcher, c.ReleasesJson, &channel); err != nil {
+			logs.Error("%+v", err)
+			continue
+		}
+		for _, r := range channel.Releases {
+			sdks := r.Sdks
+			if len(sdks) == 0 && r.Sdk != nil {
+				sdks = []*dotNetSdk{r.Sdk}
+			}
+			for _, sdk := range sdks {
+				if sdk == nil || sdk.Version == "" || len(d.versions[sdk.Version]) > 0 {
+					continue
+				}
+				for _, f := range sdk.Files {
+					if !strings.HasSuffix(f.Url, ".zip") && !strings.HasSuffix(f.Url, ".tar.gz") {
+						continue
+					}
+					if !filterDotNetSDKByUrl(f.Url) || strings.Contains(f.Rid, "musl") {
+						continue
+					}
+					d.versions[sdk.Version] = append(d.versions[sdk.Version], &VFile{
+						Url:     f.Url,
+						Sum:     f.Hash,
+						SumType: utils.SumTypeOf(f.Hash),
+						Arch:    utils.ParseArch(f.Rid),
+						Os:      utils.ParsePlatform(f.Rid),
+					})
+				}
+			}
+		}
+	}
+}
+
 func (d *DotNet) FetchAll() {
+	withApiFallback(d.cnf, "dotnet", func() int { return len(d.versions) }, d.scrape, d.fetchFromApi)
+}
+
+func (d *DotNet) scrape() {
 	d.getDoc()
 	if d.doc == nil {
 		return
@@ -188,11 +255,14 @@ func (d *DotNet) FetchAll() {
 }
 
 func (d *DotNet) Upload() {
-	if len(d.versions) > 0 {
-		fPath := filepath.Join(d.cnf.DirPath(), DotNetVersionFileName)
-		if content, err := json.MarshalIndent(d.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			d.uploader.Upload(fPath)
-		}
-	}
+	d.versions = publishVersions(d.cnf, d.uploader, "dotnet", DotNetVersionFileName, d.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (d *DotNet) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, d.cnf, "dotnet", d.FetchAll, &d.versions)
+}
+
+func (d *DotNet) VersionFileName() string {
+	return DotNetVersionFileName
 }
@@ -0,0 +1,243 @@
+//go:build e2e
+
+package versions
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/diff"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+End to end runs, go test -tags e2e ./pkgs/versions: FetchAll and Upload of collectors replay the committed fixtures,
+and publish through the git storage to a throwaway remote, a fresh clone of it is compared with golden files.
+
+	testdata/golden/<collector>/<path in the remote>  files published by a collector
+
+Each collector is pushed to its own branch "e2e-<collector>-<unix time>", deleted afterwards unless kept,
+so a remote can be a local Gitea container or a GitHub repo made for it. Without a remote a bare repo
+in the temp dir is used. Checks that download or send HEAD requests are off, so nothing goes to the network.
+
+Version files are compared by versions, urls and sums, like fixtures, other files byte by byte.
+The manifest has timestamps, it is not compared.
+*/
+
+const (
+	e2eBranchPrefix string = "e2e-"
+	testGoldenDir   string = "testdata/golden"
+)
+
+var (
+	e2eRemote = flag.String("e2e.remote", "", "Throwaway git remote, a bare repo in the temp dir by default.")
+	e2eSSHKey = flag.String("e2e.ssh-key", "", "SSH key for the remote.")
+	e2eUpdate = flag.Bool("e2e.update", false, "Saves the published files as the new golden ones.")
+	e2eKeep   = flag.Bool("e2e.keep", false, "Keeps the temp dir and the branches on the remote.")
+)
+
+// Published files not compared with golden ones.
+var e2eVolatile = []string{confs.ManifestFileName}
+
+func e2eGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = os.Environ()
+	if *e2eSSHKey != "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+upload.GitSSHCommand(*e2eSSHKey))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+}
+
+func TestE2E(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Fatalf("end to end runs need git: %v", err)
+	}
+	names := FixtureCollectors(testFixturesDir)
+	if len(names) == 0 {
+		t.Fatalf("no fixtures in %s", testFixturesDir)
+	}
+	tmpDir := t.TempDir()
+	if *e2eKeep {
+		var err error
+		if tmpDir, err = os.MkdirTemp("", "pxy-e2e-"); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Temp dir: %s", tmpDir)
+	}
+	remote := *e2eRemote
+	if remote == "" {
+		remote = filepath.Join(tmpDir, "remote.git")
+		e2eGit(t, "", "init", "--bare", remote)
+	}
+
+	cnf := newTestConf(t)
+	// checks that would go to the network, and optional outputs.
+	cnf.HeadCheck = 0
+	cnf.CanarySample = 0
+	cnf.ChecksumCompute = 0
+	cnf.ChecksumSample = 0
+	cnf.ExportFormats = nil
+	cnf.Compress = ""
+	cnf.VersionLatest = false
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			runE2E(t, cnf, name, remote, filepath.Join(tmpDir, name))
+		})
+	}
+}
+
+func runE2E(t *testing.T, cnf *confs.CollectorConf, name, remote, tmpDir string) {
+	goldenDir := filepath.Join(testGoldenDir, name)
+	if _, err := os.Stat(goldenDir); err != nil && !*e2eUpdate {
+		t.Fatalf("no golden files in %s, save them with -e2e.update: %v", goldenDir, err)
+	}
+	branch := fmt.Sprintf("%s%s-%d", e2eBranchPrefix, name, time.Now().Unix())
+	st := upload.NewGitStorage(remote, filepath.Join(tmpDir, "repo"))
+	st.Branch = branch
+	st.SSHKey = *e2eSSHKey
+
+	upload.UseStorage(upload.NewContentsStorage(cnf.Repo, st))
+	fetch.SetFixtures(fetch.FixturesReplay, filepath.Join(testFixturesDir, name, FixturePagesDirName))
+	defer func() {
+		fetch.SetFixtures("", "")
+		upload.UseStorage(nil)
+	}()
+	c := NewCollector(name, cnf)
+	err := Isolate(name, "fetch", c.FetchAll)
+	if err == nil {
+		err = Isolate(name, "upload", c.Upload)
+	}
+	if err == nil {
+		// pushes the branch.
+		err = upload.NewUploader(cnf).UploadManifest()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloneDir := filepath.Join(tmpDir, "clone")
+	e2eGit(t, "", "clone", "--depth", "1", "--branch", branch, remote, cloneDir)
+	if *e2eRemote != "" && !*e2eKeep {
+		defer e2eGit(t, cloneDir, "push", "origin", "--delete", branch)
+	}
+
+	if *e2eUpdate {
+		if err := saveGolden(cloneDir, goldenDir); err != nil {
+			t.Fatalf("save golden files: %v", err)
+		}
+		t.Logf("Golden files saved in %s.", goldenDir)
+		return
+	}
+	compareGolden(t, cloneDir, goldenDir)
+}
+
+// Published files of a clone, by slash separated paths, without volatile ones.
+func e2eFiles(dir string) (r []string, err error) {
+	err = filepath.WalkDir(dir, func(fPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, v := range e2eVolatile {
+			if d.Name() == v {
+				return nil
+			}
+		}
+		rel, _ := filepath.Rel(dir, fPath)
+		r = append(r, filepath.ToSlash(rel))
+		return nil
+	})
+	return
+}
+
+func saveGolden(cloneDir, goldenDir string) error {
+	files, err := e2eFiles(cloneDir)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(goldenDir)
+	for _, p := range files {
+		content, err := os.ReadFile(filepath.Join(cloneDir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		if err = utils.WriteFile(filepath.Join(goldenDir, filepath.FromSlash(p)), content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Published files must be the golden ones.
+func compareGolden(t *testing.T, cloneDir, goldenDir string) {
+	t.Helper()
+	want, err := e2eFiles(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 {
+		t.Fatalf("no golden files in %s", goldenDir)
+	}
+	got, err := e2eFiles(cloneDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := map[string]bool{}
+	for _, p := range got {
+		published[p] = true
+	}
+	for _, p := range want {
+		if !published[p] {
+			t.Errorf("%s is not published", p)
+			continue
+		}
+		delete(published, p)
+		wantContent, err := os.ReadFile(filepath.Join(goldenDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotContent, err := os.ReadFile(filepath.Join(cloneDir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(p, VersionFileSuffix) {
+			if !bytes.Equal(wantContent, gotContent) {
+				t.Errorf("%s differs from the golden file", p)
+			}
+			continue
+		}
+		c, err := diff.Versions(strings.TrimSuffix(filepath.Base(p), VersionFileSuffix), wantContent, gotContent)
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+			continue
+		}
+		if !c.Empty() {
+			t.Errorf("%s differs from the golden file: added %v, removed %v, changed %v", p, c.Added, c.Removed, c.Changed)
+		}
+	}
+	for p := range published {
+		t.Errorf("%s is not in the golden files", p)
+	}
+}
@@ -0,0 +1,242 @@
+package versions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Exports of version files for other version managers, written from the same collected data:
+
+	asdf   output of "list-all" of asdf and mise plugins, versions oldest first on one line, "<tool>.list-all.txt".
+	scoop  a Scoop manifest of the newest version with windows files, "<tool>.scoop.json".
+	aqua   an aqua registry snippet, a package of type http with an override per version, os and arch, "<tool>.aqua.yaml".
+
+Formats in ExportFormats of config are published next to each version file, see pxy export for single files.
+Files for the same os and arch are picked by variant(none first) and by archive type(zip, tar.gz and so on first).
+*/
+
+const (
+	ExportAsdf  string = "asdf"
+	ExportScoop string = "scoop"
+	ExportAqua  string = "aqua"
+)
+
+var exportSuffixes = map[string]string{
+	ExportAsdf:  ".list-all.txt",
+	ExportScoop: ".scoop.json",
+	ExportAqua:  ".aqua.yaml",
+}
+
+func ExportFormats() []string {
+	return []string{ExportAsdf, ExportScoop, ExportAqua}
+}
+
+// Name of an export of a version file, "go.scoop.json" for "go.version.json".
+func ExportFileName(fileName, format string) string {
+	return strings.TrimSuffix(fileName, VersionFileSuffix) + exportSuffixes[format]
+}
+
+// Exports versions of a tool in a format.
+func Export(vs Versions, tool, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case ExportAsdf:
+		return exportAsdf(vs), nil
+	case ExportScoop:
+		return exportScoop(vs)
+	case ExportAqua:
+		return exportAqua(vs, tool)
+	}
+	return nil, fmt.Errorf("unknown export format: %q, one of %s", format, strings.Join(ExportFormats(), ", "))
+}
+
+// Writes and uploads the exports in ExportFormats, after the version file.
+func publishExports(cnf *confs.CollectorConf, uploader *upload.Uploader, collector, fileName string, vs Versions) {
+	tool := strings.TrimSuffix(fileName, VersionFileSuffix)
+	for _, format := range cnf.ExportFormats {
+		content, err := Export(vs, tool, format)
+		if err != nil {
+			logs.For(collector).Error("Export %s: %+v", fileName, err)
+			continue
+		}
+		if len(content) == 0 {
+			continue
+		}
+		outPath := cnf.OutputPath(ExportFileName(fileName, format))
+		if err := utils.WriteFile(outPath, content, os.ModePerm); err != nil {
+			logs.For(collector).Error("Write %s failed: %+v", outPath, err)
+			continue
+		}
+		uploader.Upload(outPath)
+	}
+}
+
+// Moving names like "latest" are no versions for other version managers.
+func exportable(vName string, files VFileList) bool {
+	for _, f := range files {
+		if f != nil && f.Url != "" && !isMoving(vName, f) {
+			return true
+		}
+	}
+	return false
+}
+
+var archiveOrder = []string{".zip", ".tar.gz", ".tgz", ".tar.xz", ".7z"}
+
+func archiveRank(u string) int {
+	u = strings.ToLower(u)
+	for i, ext := range archiveOrder {
+		if strings.HasSuffix(u, ext) {
+			return i
+		}
+	}
+	return len(archiveOrder)
+}
+
+// The file of a version for an os and arch, nil when there is none.
+func pickFile(files VFileList, osName, arch string) (r *VFile) {
+	for _, f := range files {
+		if f == nil || f.Url == "" || f.Os != osName || f.Arch != arch {
+			continue
+		}
+		switch {
+		case r == nil:
+			r = f
+		case (f.Variant == "") != (r.Variant == ""):
+			if f.Variant == "" {
+				r = f
+			}
+		case archiveRank(f.Url) < archiveRank(r.Url):
+			r = f
+		}
+	}
+	return
+}
+
+func exportAsdf(vs Versions) []byte {
+	names := vs.Names()
+	r := make([]string, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		if exportable(names[i], vs[names[i]]) {
+			r = append(r, names[i])
+		}
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(r, " ") + "\n")
+}
+
+type scoopArch struct {
+	Url  string `json:"url"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type scoopManifest struct {
+	Version      string                `json:"version"`
+	Architecture map[string]*scoopArch `json:"architecture"`
+}
+
+var scoopArches = map[string]string{"amd64": "64bit", "386": "32bit", "arm64": "arm64"}
+
+// Scoop hashes are sha256 by default, other types are prefixed, like "sha1:...".
+func scoopHash(f *VFile) string {
+	if f.Sum == "" || f.SumStatus == SumMismatch {
+		return ""
+	}
+	sumType := f.SumType
+	if sumType == "" {
+		sumType = utils.SumTypeOf(f.Sum)
+	}
+	switch sumType {
+	case utils.SumSha256:
+		return strings.ToLower(f.Sum)
+	case utils.SumMd5, utils.SumSha1, utils.SumSha512:
+		return sumType + ":" + strings.ToLower(f.Sum)
+	}
+	return ""
+}
+
+func exportScoop(vs Versions) ([]byte, error) {
+	for _, vName := range vs.Names() {
+		if !exportable(vName, vs[vName]) || utils.IsPrerelease(vName) {
+			continue
+		}
+		m := &scoopManifest{Version: vName, Architecture: map[string]*scoopArch{}}
+		for arch, scoopName := range scoopArches {
+			if f := pickFile(vs[vName], "windows", arch); f != nil {
+				m.Architecture[scoopName] = &scoopArch{Url: f.Url, Hash: scoopHash(f)}
+			}
+		}
+		if len(m.Architecture) == 0 {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "    ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(m); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, nil
+}
+
+type aquaOverride struct {
+	Goos   string `yaml:"goos"`
+	Goarch string `yaml:"goarch"`
+	Url    string `yaml:"url"`
+}
+
+type aquaVersion struct {
+	VersionConstraint string          `yaml:"version_constraint"`
+	SupportedEnvs     []string        `yaml:"supported_envs"`
+	Overrides         []*aquaOverride `yaml:"overrides"`
+}
+
+type aquaPackage struct {
+	Type              string         `yaml:"type"`
+	Name              string         `yaml:"name"`
+	VersionConstraint string         `yaml:"version_constraint"`
+	VersionOverrides  []*aquaVersion `yaml:"version_overrides"`
+}
+
+var (
+	aquaOses   = []string{"darwin", "linux", "windows"}
+	aquaArches = []string{"amd64", "arm64"}
+)
+
+func exportAqua(vs Versions, tool string) ([]byte, error) {
+	pkg := &aquaPackage{Type: "http", Name: tool, VersionConstraint: "false"}
+	for _, vName := range vs.Names() {
+		if !exportable(vName, vs[vName]) {
+			continue
+		}
+		v := &aquaVersion{VersionConstraint: fmt.Sprintf("Version == %q", vName)}
+		for _, osName := range aquaOses {
+			for _, arch := range aquaArches {
+				if f := pickFile(vs[vName], osName, arch); f != nil {
+					v.SupportedEnvs = append(v.SupportedEnvs, osName+"/"+arch)
+					v.Overrides = append(v.Overrides, &aquaOverride{Goos: osName, Goarch: arch, Url: f.Url})
+				}
+			}
+		}
+		if len(v.Overrides) > 0 {
+			pkg.VersionOverrides = append(pkg.VersionOverrides, v)
+		}
+	}
+	if len(pkg.VersionOverrides) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(map[string][]*aquaPackage{"packages": {pkg}})
+}
@@ -0,0 +1,87 @@
+package versions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/cache"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/goutils/pkgs/request"
+)
+
+/*
+Official apis for collectors that scrape html.
+
+A collector scrapes its html pages first, and falls back to its api when nothing is found,
+usually after a site redesign. Set "Source": "api" in the options of a collector to skip scraping.
+*/
+
+const (
+	GithubReleasesApiPattern string = "https://api.github.com/repos/%s/releases?per_page=100&page=%d"
+	GithubReleasesApiPages   int    = 3
+)
+
+// Scrapes html, falls back to the api when found() is 0 afterwards.
+func withApiFallback(cnf *confs.CollectorConf, collector string, found func() int, scrape, api func()) {
+	if !strings.EqualFold(cnf.CollectorOptions(collector).Source, confs.CollectorSourceApi) {
+		scrape()
+		if found() > 0 || cnf.Canceled() {
+			return
+		}
+		logs.For(collector).Warning("Nothing scraped, the page may have changed, falling back to the api.")
+	}
+	api()
+	if found() == 0 {
+		logs.For(collector).Error("Nothing found from the api either.")
+	}
+}
+
+// Gets an api url with the settings of fetcher, and decodes the json response into v.
+// GitHub API responses are cached for GithubCacheTtl, anonymous requests are rate limited.
+func getApiJson(cnf *confs.CollectorConf, fetcher *request.Fetcher, apiUrl string, v any) error {
+	github := strings.HasPrefix(apiUrl, "https://api.github.com/")
+	content := ""
+	if github && cache.Get(cache.BucketGithub, apiUrl, &content) {
+		return json.Unmarshal([]byte(content), v)
+	}
+	f := fetch.Clone(fetcher)
+	f.SetUrl(apiUrl)
+	content, code := fetch.GetString(cnf, f)
+	if code != 200 {
+		return fmt.Errorf("get %s failed, status code: %d", apiUrl, code)
+	}
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return err
+	}
+	if github {
+		cache.Set(cache.BucketGithub, apiUrl, content, cnf.GithubCacheTtl())
+	}
+	return nil
+}
+
+/*
+Releases of a github repo from the api, newest first, at most GithubReleasesApiPages pages.
+Requests are authorized by Token when the storage is github, anonymous requests are rate limited.
+*/
+func githubReleaseItems(cnf *confs.CollectorConf, fetcher *request.Fetcher, repo string) (r []*ReleaseItem) {
+	f := fetch.Clone(fetcher)
+	f.Headers = map[string]string{"Accept": "application/vnd.github+json"}
+	if cnf.Type == confs.StorageGithub && cnf.Token != "" {
+		f.Headers["Authorization"] = "Bearer " + cnf.Token
+	}
+	for page := 1; page <= GithubReleasesApiPages; page++ {
+		items := []*ReleaseItem{}
+		if err := getApiJson(cnf, f, fmt.Sprintf(GithubReleasesApiPattern, repo, page), &items); err != nil {
+			logs.Warning("%+v", err)
+			break
+		}
+		r = append(r, items...)
+		if len(items) < 100 {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,18 @@
+package versions
+
+import (
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/upload"
+)
+
+const (
+	DefaultScrapeWorkers int = 8
+)
+
+// Pool for page fetches inside a collector, at most Workers in CollectorOptions at a time.
+func newScrapePool(opts *confs.CollectorOptions) *upload.Pool {
+	if opts.Workers > 0 {
+		return upload.NewPool(opts.Workers)
+	}
+	return upload.NewPool(DefaultScrapeWorkers)
+}
@@ -0,0 +1,201 @@
+package versions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/diff"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Fixture tests of collectors: pages and APIs a collector fetches are recorded once,
+then replayed to check that parsing them still gives the recorded versions,
+so changes of a site's structure are caught before bad data is published.
+
+	<dir>/<collector>/pages/               recorded responses, see fetch.SetFixtures
+	<dir>/<collector>/<file>.version.json  versions parsed from them
+
+Versions are taken before publishing, nothing is merged, checked or uploaded.
+Fixtures of collectors are kept in testdata/fixtures of this package and replayed by go test.
+*/
+
+const (
+	FixturesDirName      string = "fixtures"
+	FixturePagesDirName  string = "pages"
+	fixtureVersionSuffix string = ".version.json"
+)
+
+var (
+	fixtureLock    = &sync.Mutex{}
+	fixtureOutputs map[string]Versions // file name -> versions, nil unless fixtures run.
+)
+
+// Keeps versions for a fixture run, instead of publishing them.
+func captureFixture(fileName string, vs Versions) bool {
+	fixtureLock.Lock()
+	defer fixtureLock.Unlock()
+	if fixtureOutputs == nil {
+		return false
+	}
+	fixtureOutputs[fileName] = vs
+	return true
+}
+
+func runWithFixtures(cnf *confs.CollectorConf, name, mode, pagesDir string) map[string]Versions {
+	fetch.SetFixtures(mode, pagesDir)
+	fixtureLock.Lock()
+	fixtureOutputs = map[string]Versions{}
+	fixtureLock.Unlock()
+	defer func() {
+		fetch.SetFixtures("", "")
+		fixtureLock.Lock()
+		fixtureOutputs = nil
+		fixtureLock.Unlock()
+	}()
+	c := NewCollector(name, cnf)
+	if Isolate(name, "fetch", c.FetchAll) != nil || Isolate(name, "upload", c.Upload) != nil {
+		return nil
+	}
+	fixtureLock.Lock()
+	defer fixtureLock.Unlock()
+	return fixtureOutputs
+}
+
+// Collectors with recorded pages in dir.
+func FixtureCollectors(dir string) (r []string) {
+	for _, name := range CollectorNames() {
+		if info, err := os.Stat(filepath.Join(dir, name, FixturePagesDirName)); err == nil && info.IsDir() {
+			r = append(r, name)
+		}
+	}
+	return
+}
+
+/*
+Runs collectors against their fixtures in dir, returns the collectors that failed.
+record fetches live pages instead, and saves them with the parsed versions as the new fixtures.
+Collectors without fixtures fail in replay, see FixtureCollectors.
+*/
+func RunFixtures(cnf *confs.CollectorConf, dir string, names []string, record bool) (failed []string) {
+	for _, name := range names {
+		log := logs.For(name)
+		if findCollector(name) == nil {
+			log.Error("Unknown collector.")
+			failed = append(failed, name)
+			continue
+		}
+		cDir := filepath.Join(dir, name)
+		pagesDir := filepath.Join(cDir, FixturePagesDirName)
+		if record {
+			os.RemoveAll(cDir)
+			outputs := runWithFixtures(cnf, name, fetch.FixturesRecord, pagesDir)
+			if err := saveFixtureOutputs(cDir, outputs); err != nil {
+				log.Error("Save fixtures failed: %+v", err)
+				failed = append(failed, name)
+				continue
+			}
+			log.Success("Recorded %d version files.", len(outputs))
+			continue
+		}
+		if _, err := os.Stat(pagesDir); err != nil {
+			log.Error("No fixtures in %s, record them with --record.", cDir)
+			failed = append(failed, name)
+			continue
+		}
+		outputs := runWithFixtures(cnf, name, fetch.FixturesReplay, pagesDir)
+		if !compareFixtureOutputs(name, cDir, outputs) {
+			failed = append(failed, name)
+			continue
+		}
+		log.Success("Fixtures passed.")
+	}
+	return
+}
+
+func saveFixtureOutputs(cDir string, outputs map[string]Versions) error {
+	if err := os.MkdirAll(cDir, os.ModePerm); err != nil {
+		return err
+	}
+	for fileName, vs := range outputs {
+		content, err := json.MarshalIndent(vs, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = utils.WriteFile(filepath.Join(cDir, fileName), content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Logs differences between the recorded versions and the parsed ones, returns true when there are none.
+func compareFixtureOutputs(name, cDir string, outputs map[string]Versions) (ok bool) {
+	log := logs.For(name)
+	ok = true
+	expected, _ := filepath.Glob(filepath.Join(cDir, "*"+fixtureVersionSuffix))
+	if len(expected) == 0 {
+		log.Error("No recorded versions in %s.", cDir)
+		return false
+	}
+	seen := map[string]bool{}
+	for _, fPath := range expected {
+		fileName := filepath.Base(fPath)
+		seen[fileName] = true
+		want, err := os.ReadFile(fPath)
+		if err != nil {
+			log.Error("%+v", err)
+			ok = false
+			continue
+		}
+		vs, found := outputs[fileName]
+		if !found || len(vs) == 0 {
+			log.Error("%s: no versions parsed.", fileName)
+			ok = false
+			continue
+		}
+		got, _ := json.Marshal(vs)
+		c, err := diff.Versions(strings.TrimSuffix(fileName, fixtureVersionSuffix), want, got)
+		if err != nil {
+			log.Error("%s: %+v", fileName, err)
+			ok = false
+			continue
+		}
+		if c.Empty() {
+			continue
+		}
+		ok = false
+		logChangelog(log, fileName+" differs from the fixture", c)
+	}
+	for fileName := range outputs {
+		if !seen[fileName] {
+			log.Error("%s is not in the fixtures.", fileName)
+			ok = false
+		}
+	}
+	return
+}
+
+// Logs a changelog of versions under title.
+func logChangelog(log *logs.Logger, title string, c *diff.Changelog) {
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	log.Error("%s: %d versions added, %d removed, %d files changed.",
+		title, len(c.Added), len(c.Removed), len(c.Changed))
+	for _, v := range c.Added {
+		log.Info("+ %s", v)
+	}
+	for _, v := range c.Removed {
+		log.Info("- %s", v)
+	}
+	for _, f := range c.Changed {
+		log.Info("~ %s", f)
+	}
+}
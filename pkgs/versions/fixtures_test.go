@@ -0,0 +1,184 @@
+package versions
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+)
+
+const testFixturesDir = "testdata/fixtures"
+
+/*
+Registered collectors without committed fixtures, their parsing is not tested by go test.
+Recording needs the live sites, drop a name here when its fixtures and golden files are committed.
+*/
+var fixtureGaps = []string{
+	"github", "installers", "flutter", "golang", "gradle", "java", "jdk", "julia",
+	"maven", "nodejs", "php", "python", "kubectl", "dotnet", "scala",
+}
+
+// A config in a throwaway work dir.
+func newTestConf(t *testing.T) *confs.CollectorConf {
+	t.Helper()
+	t.Setenv(confs.WorkDirEnvName, t.TempDir())
+	return confs.NewCollectorConf()
+}
+
+// Copies the committed fixtures of a collector into a temp dir, for tests that change them.
+func copyFixtures(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(testFixturesDir, name)
+	err := filepath.WalkDir(src, func(fPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(testFixturesDir, fPath)
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), os.ModePerm)
+		}
+		content, err := os.ReadFile(fPath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), content, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Replays the committed pages, collectors must still parse them into the recorded versions.
+func TestFixtures(t *testing.T) {
+	names := FixtureCollectors(testFixturesDir)
+	if len(names) == 0 {
+		t.Fatalf("no fixtures in %s", testFixturesDir)
+	}
+	cnf := newTestConf(t)
+	if failed := RunFixtures(cnf, testFixturesDir, names, false); len(failed) > 0 {
+		t.Fatalf("fixtures failed: %v", failed)
+	}
+}
+
+// Every registered collector has fixtures with golden files, or is listed in fixtureGaps.
+func TestFixturesCoverage(t *testing.T) {
+	covered := map[string]bool{}
+	for _, name := range FixtureCollectors(testFixturesDir) {
+		covered[name] = true
+		if _, err := os.Stat(filepath.Join("testdata", "golden", name)); err != nil {
+			t.Errorf("%s has fixtures but no golden files", name)
+		}
+	}
+	gaps := map[string]bool{}
+	for _, name := range fixtureGaps {
+		gaps[name] = true
+		if covered[name] {
+			t.Errorf("%s has fixtures, drop it from fixtureGaps", name)
+		}
+		if findCollector(name) == nil {
+			t.Errorf("%s in fixtureGaps is not a registered collector", name)
+		}
+	}
+	for _, name := range CollectorNames() {
+		if !covered[name] && !gaps[name] {
+			t.Errorf("%s has no fixtures, record them or add it to fixtureGaps", name)
+		}
+	}
+}
+
+// Collectors without pages or without recorded versions test nothing, they fail.
+func TestFixturesMissing(t *testing.T) {
+	cnf := newTestConf(t)
+	dir := t.TempDir()
+	if failed := RunFixtures(cnf, dir, []string{"zig"}, false); len(failed) != 1 {
+		t.Errorf("no fixtures: failed = %v, want [zig]", failed)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "zig", FixturePagesDirName), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if failed := RunFixtures(cnf, dir, []string{"zig"}, false); len(failed) != 1 {
+		t.Errorf("no recorded versions: failed = %v, want [zig]", failed)
+	}
+	if failed := RunFixtures(cnf, dir, []string{"unknown"}, false); len(failed) != 1 {
+		t.Errorf("unknown collector: failed = %v, want [unknown]", failed)
+	}
+}
+
+// Recorded versions the pages do not give any more fail the replay.
+func TestFixturesChanged(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(vs Versions)
+	}{
+		{"version removed", func(vs Versions) { delete(vs, "0.10.1") }},
+		{"version added", func(vs Versions) {
+			vs["0.12.0"] = VFileList{{Url: "https://ziglang.org/download/0.12.0/zig-linux-x86_64-0.12.0.tar.xz", Os: "linux", Arch: "amd64"}}
+		}},
+		{"url changed", func(vs Versions) {
+			vs["0.11.0"][0].Url = "https://ziglang.org/builds/zig-linux-x86_64-0.11.0.tar.xz"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copyFixtures(t, "zig")
+			fPath := filepath.Join(dir, "zig", ZigVersionFileName)
+			content, err := os.ReadFile(fPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vs := Versions{}
+			if err := json.Unmarshal(content, &vs); err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(vs)
+			if content, err = json.Marshal(vs); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(fPath, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cnf := newTestConf(t)
+			if failed := RunFixtures(cnf, dir, []string{"zig"}, false); len(failed) != 1 {
+				t.Errorf("failed = %v, want [zig]", failed)
+			}
+		})
+	}
+}
+
+func TestCompareFixtureOutputs(t *testing.T) {
+	file := func(version string) *VFile {
+		return &VFile{Url: "https://example.com/tool-" + version + "-linux-amd64.tar.gz", Os: "linux", Arch: "amd64"}
+	}
+	recorded := Versions{"1.0.0": {file("1.0.0")}}
+	dir := t.TempDir()
+	if err := saveFixtureOutputs(dir, map[string]Versions{"tool.version.json": recorded}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		outputs map[string]Versions
+		ok      bool
+	}{
+		{"same", map[string]Versions{"tool.version.json": {"1.0.0": {file("1.0.0")}}}, true},
+		{"nothing parsed", map[string]Versions{}, false},
+		{"no versions", map[string]Versions{"tool.version.json": {}}, false},
+		{"version added", map[string]Versions{"tool.version.json": {"1.0.0": {file("1.0.0")}, "1.1.0": {file("1.1.0")}}}, false},
+		{"sum changed", map[string]Versions{"tool.version.json": {"1.0.0": {{Url: file("1.0.0").Url, Os: "linux", Arch: "amd64", Sum: "abc"}}}}, false},
+		{"unrecorded file", map[string]Versions{"tool.version.json": recorded, "other.version.json": recorded}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := compareFixtureOutputs("tool", dir, tt.outputs); ok != tt.ok {
+				t.Errorf("compareFixtureOutputs() = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+	if compareFixtureOutputs("tool", t.TempDir(), map[string]Versions{"tool.version.json": recorded}) {
+		t.Error("compareFixtureOutputs() passed without recorded versions")
+	}
+}
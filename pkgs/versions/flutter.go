@@ -1,18 +1,17 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
-	"os"
-	"path/filepath"
 
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/request"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
@@ -56,11 +55,7 @@ func NewFlutter(cnf *confs.CollectorConf) (f *Flutter) {
 		f.homepage = "https://storage.flutter-io.cn/flutter_infra_release/releases/releases_%s.json"
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := f.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		f.fetcher.Proxy = pxy
+		f.fetcher.Proxy = f.cnf.Proxy()
 	}
 	return
 }
@@ -69,11 +64,11 @@ func (f *Flutter) GetVersions() {
 	platforms := []string{"linux", "macos", "windows"}
 	for _, platform := range platforms {
 		f.fetcher.SetUrl(fmt.Sprintf(f.homepage, platform))
-		if resp := f.fetcher.Get(); resp != nil {
+		if resp, _ := fetch.GetString(f.cnf, f.fetcher); resp != "" {
 			versionList := FVersions{}
-			content, _ := io.ReadAll(resp.RawBody())
+			content := []byte(resp)
 			if err := json.Unmarshal(content, &versionList); err != nil {
-				gprint.PrintError(fmt.Sprintf("Parse content from %s failed.", f.fetcher.Url))
+				logs.Error("Parse content from %s failed.", f.fetcher.Url)
 				continue
 			}
 			if len(versionList.Releases) > 0 {
@@ -87,7 +82,7 @@ func (f *Flutter) GetVersions() {
 					}
 					ver.Sum = rr.Sha256
 					if ver.Sum != "" {
-						ver.SumType = "sha256"
+						ver.SumType = utils.SumTypeOf(ver.Sum)
 					}
 					ver.Url, _ = url.JoinPath(versionList.BaseUrl, rr.Uri)
 					ver.Extra = rr.Stable
@@ -106,11 +101,14 @@ func (f *Flutter) FetchAll() {
 }
 
 func (f *Flutter) Upload() {
-	if len(f.versions) > 0 {
-		fPath := filepath.Join(f.cnf.DirPath(), FlutterVersionFileName)
-		if content, err := json.MarshalIndent(f.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			f.uploader.Upload(fPath)
-		}
-	}
+	f.versions = publishVersions(f.cnf, f.uploader, "flutter", FlutterVersionFileName, f.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (f *Flutter) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, f.cnf, "flutter", f.FetchAll, &f.versions)
+}
+
+func (f *Flutter) VersionFileName() string {
+	return FlutterVersionFileName
 }
@@ -1,13 +1,13 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
 )
@@ -25,6 +25,8 @@ type ReleaseItem struct {
 	Assets     []*Assets `json:"assets"`
 	TagName    string    `json:"tag_name"`
 	PreRelease any       `json:"prerelease"`
+	// like "2024-01-16T20:16:23Z".
+	PublishedAt string `json:"published_at"`
 }
 
 /*
@@ -174,7 +176,7 @@ func (g *GithubRepo) fetchRepo(repo string) {
 				}
 			}
 		} else {
-			fmt.Println(err)
+			logs.Error("%+v", err)
 		}
 	}
 	// os.WriteFile("test.txt", content, os.ModePerm)
@@ -187,21 +189,23 @@ func (g *GithubRepo) FetchAll() {
 		// if repo != "oven-sh/bun" {
 		// 	continue
 		// }
+		if g.cnf.Canceled() {
+			return
+		}
 		rp := repo
-		fmt.Printf("fetching %s ...\n", rp)
+		logs.Debug("fetching %s ...", rp)
 		g.fetchRepo(rp)
 	}
 }
 
 func (g *GithubRepo) Upload() {
 	for name, ver := range g.versions {
-		if len(ver) > 0 {
-			fileName := fmt.Sprintf(GithubVersionFileNamePattern, name)
-			fPath := filepath.Join(g.cnf.DirPath(), fileName)
-			if content, err := json.MarshalIndent(ver, "", "  "); err == nil && content != nil {
-				os.WriteFile(fPath, content, os.ModePerm)
-				g.uploader.Upload(fPath)
-			}
-		}
+		fileName := fmt.Sprintf(GithubVersionFileNamePattern, name)
+		g.versions[name] = publishVersions(g.cnf, g.uploader, "github", fileName, ver)
 	}
 }
+
+// Collects version files without publishing them, keyed by file names, see api.go.
+func (g *GithubRepo) CollectFiles(ctx context.Context) (map[string]Versions, error) {
+	return collectFiles(ctx, g.cnf, "github", g.FetchAll, g.versions, GithubVersionFileNamePattern)
+}
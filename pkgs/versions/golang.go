@@ -1,26 +1,39 @@
 package versions
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
 	GoVersionFileName string = "go.version.json"
+	GoApiUrlPattern   string = "%s?mode=json&include=all"
 )
 
+// https://go.dev/dl/?mode=json&include=all
+type goRelease struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		Os       string `json:"os"`
+		Arch     string `json:"arch"`
+		Sha256   string `json:"sha256"`
+		Size     int64  `json:"size"`
+		Kind     string `json:"kind"`
+	} `json:"files"`
+}
+
 /*
 https://golang.google.cn/dl/
 https://go.dev/dl/
@@ -47,11 +60,7 @@ func NewGolang(cnf *confs.CollectorConf) (g *Golang) {
 		g.homepage = "https://golang.google.cn/dl/"
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := g.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		g.fetcher.Proxy = pxy
+		g.fetcher.Proxy = g.cnf.Proxy()
 	}
 	return
 }
@@ -60,15 +69,15 @@ func (g *Golang) getDoc() {
 	g.parsedUrl, _ = url.Parse(g.homepage)
 	g.fetcher.SetUrl(g.homepage)
 	g.fetcher.Timeout = 30 * time.Second
-	if resp := g.fetcher.Get(); resp != nil {
+	if resp, _ := fetch.GetString(g.cnf, g.fetcher); resp != "" {
 		var err error
-		g.doc, err = goquery.NewDocumentFromReader(resp.RawBody())
+		g.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if g.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", g.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", g.fetcher.Url)
+			return
 		}
 	}
 }
@@ -77,6 +86,9 @@ func (g *Golang) hasUnstableVersions() bool {
 	if g.doc == nil {
 		g.getDoc()
 	}
+	if g.doc == nil {
+		return false
+	}
 	label := g.doc.Find("#unstable")
 	if label == nil {
 		return false
@@ -85,25 +97,22 @@ func (g *Golang) hasUnstableVersions() bool {
 }
 
 func (g *Golang) findPackages(table *goquery.Selection, vTagName string) {
-	sType := strings.TrimSuffix(table.Find("thead").Find("th").Last().Text(), " Checksum")
 	table.Find("tr").Not(".first").Each(func(j int, tr *goquery.Selection) {
 		td := tr.Find("td")
 		href := td.Eq(0).Find("a").AttrOr("href", "")
-		if strings.HasPrefix(href, "/") {
-			// relative paths
-			href = fmt.Sprintf("%s://%s%s", g.parsedUrl.Scheme, g.parsedUrl.Host, href)
-		}
+		// relative paths
+		href = utils.NormalizeUrl(href, g.homepage)
 		if k := strings.ToLower(strings.ToLower(td.Eq(1).Text())); k != "archive" {
 			return
 		}
 
 		ver := &VFile{
-			Url:     href,
-			Arch:    utils.MapArchAndOS(td.Eq(3).Text()),
-			Os:      utils.MapArchAndOS(td.Eq(2).Text()),
-			Sum:     td.Eq(5).Text(),
-			SumType: sType,
+			Url:  href,
+			Arch: utils.MapArchAndOS(td.Eq(3).Text()),
+			Os:   utils.MapArchAndOS(td.Eq(2).Text()),
+			Sum:  strings.TrimSpace(td.Eq(5).Text()),
 		}
+		ver.SumType = utils.SumTypeOf(ver.Sum)
 		if ver.Arch == "bootstrap" && vTagName == "1" {
 			ver.Os = ver.Arch
 		}
@@ -153,21 +162,71 @@ func (g *Golang) GetArchivedVersions() {
 	})
 }
 
-func (g *Golang) FetchAll() {
+func (g *Golang) scrape() {
 	if g.doc == nil {
 		g.getDoc()
 	}
+	if g.doc == nil {
+		return
+	}
 	g.GetStableVersions()
 	g.GetArchivedVersions()
 	g.GetUnstableVersions()
 }
 
-func (g *Golang) Upload() {
-	if len(g.versions) > 0 {
-		fPath := filepath.Join(g.cnf.DirPath(), GoVersionFileName)
-		if content, err := json.MarshalIndent(g.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			g.uploader.Upload(fPath)
+// Archives from the json api of the download page.
+func (g *Golang) fetchFromApi() {
+	releases := []*goRelease{}
+	if err := getApiJson(g.cnf, g.fetcher, fmt.Sprintf(GoApiUrlPattern, g.homepage), &releases); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for _, rel := range releases {
+		vName := strings.TrimPrefix(rel.Version, "go")
+		for _, f := range rel.Files {
+			if f.Kind != "archive" {
+				continue
+			}
+			arch := f.Arch
+			if strings.HasPrefix(arch, "armv6") {
+				arch = "arm"
+			}
+			g.versions[vName] = append(g.versions[vName], &VFile{
+				Url:     g.homepage + f.Filename,
+				Arch:    arch,
+				Os:      f.Os,
+				Sum:     f.Sha256,
+				SumType: utils.SumTypeOf(f.Sha256),
+				Size:    f.Size,
+			})
 		}
 	}
 }
+
+func (g *Golang) FetchAll() {
+	withApiFallback(g.cnf, "golang", func() int { return len(g.versions) }, g.scrape, g.fetchFromApi)
+	g.addDates()
+}
+
+func (g *Golang) addDates() {
+	dates := goReleaseDates(g.cnf, g.fetcher)
+	if len(dates) == 0 {
+		return
+	}
+	for vName := range g.versions {
+		g.versions.setDates(vName, dates[vName], goEolAt(dates, vName))
+	}
+}
+
+func (g *Golang) Upload() {
+	g.versions = publishVersions(g.cnf, g.uploader, "golang", GoVersionFileName, g.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (g *Golang) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, g.cnf, "golang", g.FetchAll, &g.versions)
+}
+
+func (g *Golang) VersionFileName() string {
+	return GoVersionFileName
+}
@@ -1,25 +1,37 @@
 package versions
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
+	"context"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/collector/pkgs/utils"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
 	GradleFileName string = "gradle.version.json"
 	GradleSumUrl   string = "https://gradle.org/release-checksums/"
+	GradleApiUrl   string = "https://services.gradle.org/versions/all"
 )
 
+// https://services.gradle.org/versions/all
+type gradleRelease struct {
+	Version        string `json:"version"`
+	DownloadUrl    string `json:"downloadUrl"`
+	Snapshot       bool   `json:"snapshot"`
+	Nightly        bool   `json:"nightly"`
+	ReleaseNightly bool   `json:"releaseNightly"`
+	Broken         bool   `json:"broken"`
+	RcFor          string `json:"rcFor"`
+	MilestoneFor   string `json:"milestoneFor"`
+}
+
 /*
 https://gradle.org/releases/
 https://gradle.org/release-checksums/
@@ -44,11 +56,7 @@ func NewGradle(cnf *confs.CollectorConf) (g *Gradle) {
 		sha:      map[string]string{},
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := g.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		g.fetcher.Proxy = pxy
+		g.fetcher.Proxy = g.cnf.Proxy()
 	}
 	return
 }
@@ -57,8 +65,8 @@ func (g *Gradle) getDoc() {
 	// get sum info.
 	g.fetcher.SetUrl(GradleSumUrl)
 	g.fetcher.Timeout = 30 * time.Second
-	if resp := g.fetcher.Get(); resp != nil {
-		g.doc, _ = goquery.NewDocumentFromReader(resp.RawBody())
+	if resp, _ := fetch.GetString(g.cnf, g.fetcher); resp != "" {
+		g.doc, _ = goquery.NewDocumentFromReader(strings.NewReader(resp))
 	}
 	if g.doc != nil {
 		g.doc.Find("h3.u-text-with-icon").Each(func(i int, s *goquery.Selection) {
@@ -76,15 +84,15 @@ func (g *Gradle) getDoc() {
 	// get version list info.
 	g.fetcher.SetUrl(g.homepage)
 	g.fetcher.Timeout = 30 * time.Second
-	if resp := g.fetcher.Get(); resp != nil {
+	if resp, _ := fetch.GetString(g.cnf, g.fetcher); resp != "" {
 		var err error
-		g.doc, err = goquery.NewDocumentFromReader(resp.RawBody())
+		g.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if g.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", g.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", g.fetcher.Url)
+			return
 		}
 	}
 }
@@ -116,7 +124,7 @@ func (g *Gradle) GetVersions() {
 		}
 		ver.Sum = strings.TrimSpace(g.getSum(vName))
 		if ver.Sum != "" {
-			ver.SumType = " SHA256"
+			ver.SumType = utils.SumTypeOf(ver.Sum)
 		}
 
 		ver.Arch = "any"
@@ -129,16 +137,51 @@ func (g *Gradle) GetVersions() {
 	})
 }
 
+/*
+Final releases from the versions api, complete distributions like the releases page.
+Sums come from the checksums page when it was parsed, the checksum stage can fill in the others.
+*/
+func (g *Gradle) fetchFromApi() {
+	releases := []*gradleRelease{}
+	if err := getApiJson(g.cnf, g.fetcher, GradleApiUrl, &releases); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for _, rel := range releases {
+		if rel.Snapshot || rel.Nightly || rel.ReleaseNightly || rel.Broken || rel.RcFor != "" || rel.MilestoneFor != "" {
+			continue
+		}
+		if rel.Version == "" || rel.DownloadUrl == "" {
+			continue
+		}
+		ver := &VFile{
+			Url:  strings.Replace(rel.DownloadUrl, "-bin.zip", "-all.zip", 1),
+			Arch: "any",
+			Os:   "any",
+		}
+		for k, v := range g.sha {
+			if strings.ReplaceAll(k, "v", "") == rel.Version {
+				ver.Sum = strings.TrimSpace(v)
+				ver.SumType = utils.SumTypeOf(ver.Sum)
+			}
+		}
+		g.versions[rel.Version] = append(g.versions[rel.Version], ver)
+	}
+}
+
 func (g *Gradle) FetchAll() {
-	g.GetVersions()
+	withApiFallback(g.cnf, "gradle", func() int { return len(g.versions) }, g.GetVersions, g.fetchFromApi)
 }
 
 func (g *Gradle) Upload() {
-	if len(g.versions) > 0 {
-		fPath := filepath.Join(g.cnf.DirPath(), GradleFileName)
-		if content, err := json.MarshalIndent(g.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			g.uploader.Upload(fPath)
-		}
-	}
+	g.versions = publishVersions(g.cnf, g.uploader, "gradle", GradleFileName, g.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (g *Gradle) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, g.cnf, "gradle", g.FetchAll, &g.versions)
+}
+
+func (g *Gradle) VersionFileName() string {
+	return GradleFileName
 }
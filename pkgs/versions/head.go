@@ -0,0 +1,133 @@
+package versions
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/cache"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+// Dead links, the vendor removed the artifact.
+func isDeadCode(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+// Cached result of a HEAD request that found the file.
+type headResult struct {
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"`
+}
+
+type headTarget struct {
+	vName string
+	file  *VFile
+	code  int // 0 when the request failed.
+}
+
+/*
+Sends HEAD requests for files of a version file and records Size and LastModified.
+
+Quarantined files are checked on every run, then up to HeadCheck other files,
+files never checked go first and the rest are picked randomly.
+Files whose links are dead are moved into the quarantine, see deadlinks.go.
+Versions left without files are dropped.
+*/
+func headCheck(cnf *confs.CollectorConf, collector string, vs Versions) Versions {
+	if cnf.HeadCheck <= 0 {
+		return vs
+	}
+	_, span := trace.Start(cnf.Context(), "head_check", "collector", collector)
+	defer span.End()
+	dl := loadDeadLinks(cnf)
+	var quarantined, others []*headTarget
+	for vName, fList := range vs {
+		for _, f := range fList {
+			if f == nil || !strings.HasPrefix(f.Url, "http") {
+				continue
+			}
+			t := &headTarget{vName: vName, file: f}
+			if dl.has(f.Url) {
+				quarantined = append(quarantined, t)
+			} else {
+				others = append(others, t)
+			}
+		}
+	}
+	rand.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].file.Size == 0 && others[j].file.Size != 0
+	})
+	if len(others) > cnf.HeadCheck {
+		others = others[:cnf.HeadCheck]
+	}
+	// dropped files are never checked again.
+	var targets []*headTarget
+	for _, t := range quarantined {
+		if !dl.dropped(t.file.Url) {
+			targets = append(targets, t)
+		}
+	}
+	// quarantined files are always checked, others may have cached results.
+	requests := append([]*headTarget{}, targets...)
+	for _, t := range others {
+		res := &headResult{}
+		if cache.Get(cache.BucketHead, t.file.Url, res) {
+			t.code, t.file.Size, t.file.LastModified = http.StatusOK, res.Size, res.LastModified
+		} else {
+			requests = append(requests, t)
+		}
+	}
+	targets = append(targets, others...)
+	span.Set("files", len(targets), "requests", len(requests))
+
+	pool := newScrapePool(cnf.CollectorOptions(collector))
+	for _, t := range requests {
+		t := t
+		pool.Go(func() {
+			if cnf.Canceled() {
+				return
+			}
+			code, header, err := fetch.Head(cnf, t.file.Url)
+			if err != nil {
+				return
+			}
+			t.code = code
+			if code == http.StatusOK {
+				if size := header.Get("Content-Length"); size != "" {
+					t.file.Size = gconv.Int64(size)
+				}
+				t.file.LastModified = utils.Timestamp(header.Get("Last-Modified"))
+				cache.Set(cache.BucketHead, t.file.Url, &headResult{Size: t.file.Size, LastModified: t.file.LastModified}, cnf.HeadCacheTtl())
+			}
+		})
+	}
+	pool.Wait()
+
+	newlyDead := dl.record(collector, targets)
+	logs.For(collector).Info("HEAD checks: %d files, %d new dead links.", len(targets), len(newlyDead))
+	for _, u := range newlyDead {
+		logs.For(collector).Warning("Dead link quarantined: %s", u)
+	}
+
+	r := Versions{}
+	for vName, fList := range vs {
+		kept := VFileList{}
+		for _, f := range fList {
+			if f == nil || !dl.has(f.Url) {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) > 0 {
+			r[vName] = kept
+		}
+	}
+	return r
+}
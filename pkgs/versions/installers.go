@@ -1,20 +1,24 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/url"
-	"os"
-	"path/filepath"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
-	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/gvcgo/collector/pkgs/cache"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -26,11 +30,10 @@ const (
 Only the latest version for:
 
 1. android sdkmanager
-https://developer.android.com/tools/sdkmanager?hl=zh-cn
+https://developer.android.com/tools/sdkmanager
 
-	download:
-	https://developer.android.google.cn/studio?hl=zh-cn
-	https://developer.android.com/studio?hl=en
+	download(hl= is set to PageLocale):
+	https://developer.android.com/studio
 
 2. cygwin installer
 https://cygwin.com/install.html
@@ -76,75 +79,143 @@ func NewInstaller(cnf *confs.CollectorConf) (i *Installer) {
 		fetcher:  request.NewFetcher(),
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := i.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		i.fetcher.Proxy = pxy
+		i.fetcher.Proxy = i.cnf.Proxy()
 	}
 	return
 }
 
 func (i *Installer) getDoc() {
 	i.fetcher.SetUrl(i.homepage)
-	i.fetcher.Timeout = 30 * time.Second
-	if resp, sCode := i.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(i.cnf, i.fetcher); resp != "" && sCode == 200 {
 		// fmt.Println(resp)
 		var err error
 		i.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if i.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", i.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", i.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Println(sCode)
+		logs.Error("Failed: %s, code: %d", i.homepage, sCode)
 	}
 }
 
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+const (
+	AndroidRepositoryUrl string = "https://dl.google.com/android/repository"
+	// the repository manifests of sdkmanager, newest schema first.
+	AndroidRepositoryXmlPattern string = AndroidRepositoryUrl + "/repository2-%d.xml"
+	AndroidCmdlineToolsPackage  string = "cmdline-tools;latest"
+)
+
+var androidToolsVersionPattern = regexp.MustCompile(`(\d+)`)
+
+// Adds a command line tools zip, like "commandlinetools-win-11076708_latest.zip".
+func (i *Installer) addAndroidTools(fName, sum string) bool {
+	platform := strings.TrimPrefix(fName, "commandlinetools-")
+	vName := androidToolsVersionPattern.FindString(platform)
+	u, _ := url.JoinPath(AndroidRepositoryUrl, fName)
+	ver := &VFile{
+		Url:   u,
+		Arch:  "all",
+		Os:    utils.ParsePlatform(platform),
+		Sum:   sum,
+		Extra: fmt.Sprintf("v%s", vName),
+	}
+	ver.SumType = utils.SumTypeOf(ver.Sum)
+	if ver.Os == "" || vName == "" {
+		return false
+	}
+	name := "sdkmanager"
+	if vlist, ok := i.versions[name]; !ok || vlist == nil {
+		i.versions[name] = Versions{}
+	}
+	i.versions[name][vName] = append(i.versions[name][vName], ver)
+	return true
+}
+
+/*
+Command line tools from the Studio page, with the sdkmanager repository manifest as the fallback.
+Rows of the page are found by their file names, and the platform is parsed from the file name,
+not from the headings or platform column, which are translated in other locales.
+*/
 func (i *Installer) GetAndroidSDKManager() {
-	// https://dl.google.com/android/repository/commandlinetools-win-11076708_latest.zip
-	vPattern := regexp.MustCompile(`(\d+)`)
-	baseUrl := "https://dl.google.com/android/repository"
-	i.homepage = "https://developer.android.com/studio?hl=en"
+	found := func() int { return len(i.versions["sdkmanager"]) }
+	withApiFallback(i.cnf, "installers", found, i.scrapeAndroidTools, i.androidToolsFromRepository)
+}
+
+func (i *Installer) scrapeAndroidTools() {
+	// the page is fetched in PageLocale, see fetch/locale.go.
+	i.homepage = "https://developer.android.com/studio"
 	i.doc = nil
 	i.getDoc()
-	if i.doc != nil {
-		// //table[@class="download"][1]/tbody/tr
-		i.doc.Find("table.download").Eq(1).Find("tr").Each(func(idx int, s *goquery.Selection) {
-			if idx == 0 {
-				return
-			}
-			platform := strings.ToLower(s.Find("td").Eq(0).Text())
-			fName := s.Find("td").Eq(1).Find("button").Text()
-			if platform == "" || fName == "" {
-				return
+	if i.doc == nil {
+		return
+	}
+	tables := i.doc.Find("table.download")
+	rows := 0
+	tables.Find("tr").Each(func(idx int, s *goquery.Selection) {
+		fName := strings.TrimSpace(s.Find("td").Find("button").Text())
+		if !strings.HasPrefix(fName, "commandlinetools-") {
+			return
+		}
+		rows++
+		sha256Str := ""
+		s.Find("td").Each(func(_ int, td *goquery.Selection) {
+			if text := strings.TrimSpace(td.Text()); sha256Pattern.MatchString(text) {
+				sha256Str = text
 			}
-			vName := vPattern.FindString(fName)
-			u, _ := url.JoinPath(baseUrl, fName)
-			sha256Str := s.Find("td").Eq(3).Text()
+		})
+		if !i.addAndroidTools(fName, sha256Str) {
+			logs.For("installers").Warning("sdkmanager: cannot parse the platform or version of %s.", fName)
+		}
+	})
+	if rows == 0 {
+		// zero output of a scraper is a layout change, not an empty release.
+		logs.For("installers").Error("sdkmanager: no command line tools in %d table.download of %s, the page layout may have changed.",
+			tables.Length(), i.homepage)
+	}
+}
 
-			ver := &VFile{}
-			ver.Url = u
-			ver.Arch = "all"
-			ver.Os = utils.ParsePlatform(platform)
-			ver.Sum = sha256Str
-			if ver.Sum != "" {
-				ver.SumType = "sha256"
+type androidRepository struct {
+	Packages []struct {
+		Path     string `xml:"path,attr"`
+		Archives []struct {
+			HostOs   string `xml:"host-os"`
+			Checksum string `xml:"complete>checksum"`
+			Url      string `xml:"complete>url"`
+		} `xml:"archives>archive"`
+	} `xml:"remotePackage"`
+}
+
+// Reads the command line tools from the repository manifest that sdkmanager itself uses, sums are sha1 there.
+func (i *Installer) androidToolsFromRepository() {
+	for _, schema := range []int{3, 2, 1} {
+		fetcher := fetch.Clone(i.fetcher)
+		fetcher.SetUrl(fmt.Sprintf(AndroidRepositoryXmlPattern, schema))
+		content, code := fetch.GetString(i.cnf, fetcher)
+		if code != 200 {
+			continue
+		}
+		repo := &androidRepository{}
+		if err := xml.Unmarshal([]byte(content), repo); err != nil {
+			logs.For("installers").Warning("sdkmanager: parse repository2-%d.xml failed: %+v", schema, err)
+			continue
+		}
+		for _, p := range repo.Packages {
+			if p.Path != AndroidCmdlineToolsPackage {
+				continue
 			}
-			ver.Extra = fmt.Sprintf("v%s", vName)
-			name := "sdkmanager"
-			if vlist, ok := i.versions[name]; !ok || vlist == nil {
-				i.versions[name] = Versions{
-					vName: []*VFile{},
-				}
+			for _, a := range p.Archives {
+				i.addAndroidTools(path.Base(a.Url), strings.TrimSpace(a.Checksum))
 			}
-
-			i.versions[name][vName] = append(i.versions[name][vName], ver)
-			// fmt.Println(ver.Os, ver.Arch, ver.Url, ver.Sum, ver.SumType, ver.Extra)
-		})
+		}
+		if len(i.versions["sdkmanager"]) > 0 {
+			return
+		}
 	}
 }
 
@@ -162,74 +233,161 @@ func (i *Installer) GetCygwinInstaller() {
 	}
 }
 
+const (
+	Msys2Repo       string = "msys2/msys2-installer"
+	Msys2NightlyUrl string = "https://github.com/msys2/msys2-installer/releases/download/nightly-x86_64/msys2-x86_64-latest.exe"
+)
+
+var (
+	// releases are tagged by date, like "2024-01-13", besides "nightly-x86_64".
+	msys2TagPattern   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	msys2AssetPattern = regexp.MustCompile(`^msys2-x86_64-\d{8}\.exe$`)
+)
+
+/*
+Dated releases of the msys2 installer with the .sha256 published next to them, "latest" is the newest one.
+Falls back to the nightly installer when the releases cannot be read.
+*/
 func (i *Installer) GetMsys2Installer() {
-	// https://github.com/msys2/msys2-installer/releases/download/nightly-x86_64/msys2-x86_64-latest.exe
-	ver := &VFile{
-		Url:   "https://github.com/msys2/msys2-installer/releases/download/nightly-x86_64/msys2-x86_64-latest.exe",
+	name := "msys2"
+	i.versions[name] = Versions{}
+	for _, item := range githubReleaseItems(i.cnf, i.fetcher, Msys2Repo) {
+		if !msys2TagPattern.MatchString(item.TagName) {
+			continue
+		}
+		sums := map[string]string{}
+		for _, asset := range item.Assets {
+			if strings.HasSuffix(asset.Name, ".sha256") {
+				sums[strings.TrimSuffix(asset.Name, ".sha256")] = asset.Url
+			}
+		}
+		for _, asset := range item.Assets {
+			fName := asset.Name
+			if !msys2AssetPattern.MatchString(fName) {
+				continue
+			}
+			ver := &VFile{
+				Url:        asset.Url,
+				Arch:       "amd64",
+				Os:         "windows",
+				Extra:      item.TagName,
+				ReleasedAt: utils.Date(item.TagName),
+			}
+			if sumUrl, ok := sums[fName]; ok {
+				ver.Sum, ver.SumType = i.getSum(sumUrl, fName)
+			}
+			i.versions[name][item.TagName] = append(i.versions[name][item.TagName], ver)
+		}
+	}
+	if newest := i.versions[name].Latest(); newest != "" {
+		for _, f := range i.versions[name][newest] {
+			latest := *f
+			latest.Extra = "latest"
+			i.versions[name]["latest"] = append(i.versions[name]["latest"], &latest)
+		}
+		return
+	}
+	logs.Warning("No dated msys2 releases found, using the nightly installer.")
+	i.versions[name]["latest"] = []*VFile{{
+		Url:   Msys2NightlyUrl,
 		Arch:  "amd64",
 		Os:    "windows",
 		Extra: "latest",
-	}
-	name := "msys2"
-	i.versions[name] = Versions{
-		"latest": []*VFile{ver},
-	}
+	}}
 }
 
-func (i *Installer) GetRustInstaller() {
-	name := "rustup"
-	rVersion := "latest"
-	i.versions[name] = Versions{
-		rVersion: []*VFile{},
+// Fetches a checksum file, sums are cached like other sums.
+func (i *Installer) getSum(sumUrl, fileName string) (sum, sumType string) {
+	if cache.Get(cache.BucketSums, sumUrl, &sum) {
+		return sum, utils.SumTypeOf(sum)
 	}
-
-	verDarwinx64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/x86_64-apple-darwin/rustup-init",
-		Arch:  "amd64",
-		Os:    "darwin",
-		Extra: rVersion,
+	fetcher := fetch.Clone(i.fetcher)
+	fetcher.SetUrl(sumUrl)
+	content, code := fetch.GetString(i.cnf, fetcher)
+	if code != 200 {
+		return "", ""
 	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verDarwinx64)
-
-	verDarwinArm64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/aarch64-apple-darwin/rustup-init",
-		Arch:  "arm64",
-		Os:    "darwin",
-		Extra: rVersion,
+	if sum, sumType = utils.FindSum(content, fileName); sum != "" {
+		cache.Set(cache.BucketSums, sumUrl, sum, cache.SumsTtl)
 	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verDarwinArm64)
+	return
+}
 
-	verLinuxx64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/x86_64-unknown-linux-gnu/rustup-init",
-		Arch:  "amd64",
-		Os:    "linux",
-		Extra: rVersion,
-	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verLinuxx64)
+const (
+	RustupReleaseUrl string = "https://static.rust-lang.org/rustup/release-stable.toml"
+	RustupDistUrl    string = "https://static.rust-lang.org/rustup/dist"
+	RustupArchiveUrl string = "https://static.rust-lang.org/rustup/archive"
+)
 
-	verLinuxArm64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/aarch64-unknown-linux-gnu/rustup-init",
-		Arch:  "arm64",
-		Os:    "linux",
-		Extra: rVersion,
-	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verLinuxArm64)
+// Targets of rustup-init.
+var rustupTargets = []struct {
+	target string
+	arch   string
+	os     string
+}{
+	{"x86_64-apple-darwin", "amd64", "darwin"},
+	{"aarch64-apple-darwin", "arm64", "darwin"},
+	{"x86_64-unknown-linux-gnu", "amd64", "linux"},
+	{"aarch64-unknown-linux-gnu", "arm64", "linux"},
+	{"x86_64-pc-windows-msvc", "amd64", "windows"},
+	{"aarch64-pc-windows-msvc", "arm64", "windows"},
+}
 
-	verWinx64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/x86_64-pc-windows-msvc/rustup-init.exe",
-		Arch:  "amd64",
-		Os:    "windows",
-		Extra: rVersion,
+// The current rustup version from the release channel, like "1.27.1", "" when it cannot be read.
+func (i *Installer) rustupVersion() string {
+	fetcher := fetch.Clone(i.fetcher)
+	fetcher.SetUrl(RustupReleaseUrl)
+	content, code := fetch.GetString(i.cnf, fetcher)
+	if code != 200 {
+		logs.Warning("Read rustup release failed, code: %d", code)
+		return ""
 	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verWinx64)
+	release := struct {
+		Version string `toml:"version"`
+	}{}
+	if _, err := toml.Decode(content, &release); err != nil {
+		logs.Warning("Parse rustup release failed: %+v", err)
+		return ""
+	}
+	return strings.TrimSpace(release.Version)
+}
 
-	verWinArm64 := &VFile{
-		Url:   "https://static.rust-lang.org/rustup/dist/aarch64-pc-windows-msvc/rustup-init.exe",
-		Arch:  "arm64",
-		Os:    "windows",
-		Extra: rVersion,
+/*
+rustup-init of the current rustup version, pinned to the archive of the version, with the sha256 published
+next to each binary. "latest" keeps the dist urls, which always serve the current version.
+*/
+func (i *Installer) GetRustInstaller() {
+	name := "rustup"
+	i.versions[name] = Versions{}
+	rVersion := i.rustupVersion()
+	for _, t := range rustupTargets {
+		fName := "rustup-init"
+		if t.os == utils.Windows {
+			fName += ".exe"
+		}
+		latest := &VFile{
+			Url:   fmt.Sprintf("%s/%s/%s", RustupDistUrl, t.target, fName),
+			Arch:  t.arch,
+			Os:    t.os,
+			Extra: "latest",
+		}
+		if rVersion == "" {
+			latest.Sum, latest.SumType = i.getSum(latest.Url+".sha256", fName)
+			i.versions[name]["latest"] = append(i.versions[name]["latest"], latest)
+			continue
+		}
+		pinned := &VFile{
+			Url:   fmt.Sprintf("%s/%s/%s/%s", RustupArchiveUrl, rVersion, t.target, fName),
+			Arch:  t.arch,
+			Os:    t.os,
+			Extra: "v" + rVersion,
+		}
+		// the sum of the pinned binary never changes, so it is the one cached.
+		pinned.Sum, pinned.SumType = i.getSum(pinned.Url+".sha256", fName)
+		latest.Sum, latest.SumType = pinned.Sum, pinned.SumType
+		i.versions[name][rVersion] = append(i.versions[name][rVersion], pinned)
+		i.versions[name]["latest"] = append(i.versions[name]["latest"], latest)
 	}
-	i.versions[name][rVersion] = append(i.versions[name][rVersion], verWinArm64)
 }
 
 type CodePlatform struct {
@@ -238,7 +396,7 @@ type CodePlatform struct {
 }
 
 type CodeItem struct {
-	Url      string        `josn:"url"`
+	Url      string        `json:"url"`
 	Sum      string        `json:"sha256hash"`
 	Version  string        `json:"name"`
 	Build    string        `json:"build"`
@@ -249,41 +407,49 @@ type CodeProducts struct {
 	Products []*CodeItem `json:"products"`
 }
 
-func vscodeAllowed(item *CodeItem) bool {
-	// excludeList := []string{"_cli", ".deb", ".rpm"}
-	excludeList := []string{"_cli", ".tar.gz", "armhf", "armv7hl"}
-	for _, excludeStr := range excludeList {
-		if strings.Contains(item.Url, excludeStr) {
-			return false
-		}
-	}
-	if strings.HasSuffix(item.Url, ".exe") && !strings.Contains(item.Url, "User") {
-		return true
+// Kinds of a VSCode asset by its url, see confs.VSCodeAssets.
+func vscodeKinds(u string) (kinds []string) {
+	switch {
+	case strings.HasSuffix(u, ".exe") && strings.Contains(u, "User"):
+		kinds = append(kinds, confs.VSCodeUser)
+	case strings.HasSuffix(u, ".exe"):
+		kinds = append(kinds, confs.VSCodeSystem)
+	case strings.HasSuffix(u, ".zip") && strings.Contains(u, "darwin"):
+		kinds = append(kinds, confs.VSCodeDarwin)
+	case strings.HasSuffix(u, ".zip"):
+		kinds = append(kinds, confs.VSCodeZip)
+	case strings.HasSuffix(u, ".deb"):
+		kinds = append(kinds, confs.VSCodeDeb)
+	case strings.HasSuffix(u, ".rpm"):
+		kinds = append(kinds, confs.VSCodeRpm)
+	case strings.HasSuffix(u, ".tar.gz"):
+		kinds = append(kinds, confs.VSCodeTarGz)
 	}
-	if strings.HasSuffix(item.Url, ".tar.gz") {
-		return true
+	if strings.Contains(u, "_cli") {
+		kinds = append(kinds, confs.VSCodeCli)
 	}
-	if strings.HasSuffix(item.Url, ".zip") && strings.Contains(item.Url, "darwin") {
-		return true
+	if strings.Contains(u, "armhf") || strings.Contains(u, "armv7hl") {
+		kinds = append(kinds, confs.VSCodeArm32)
 	}
-	if strings.HasSuffix(item.Url, ".deb") || strings.HasSuffix(item.Url, ".rpm") {
-		return true
-	}
-	return false
+	return
+}
+
+func (i *Installer) vscodeAllowed(item *CodeItem) bool {
+	return confs.AllowKinds(i.cnf.VSCodeAssetKinds(), vscodeKinds(item.Url))
 }
 
 func (i *Installer) GetVSCode() {
 	// https://code.visualstudio.com/sha?build=stable
 	i.fetcher.SetUrl("https://code.visualstudio.com/sha?build=stable")
 	name := "vscode"
-	content, _ := i.fetcher.GetString()
+	content, _ := fetch.GetString(i.cnf, i.fetcher)
 	i.versions[name] = Versions{}
 
 	if content != "" {
 		products := &CodeProducts{}
 		if err := json.Unmarshal([]byte(content), products); err == nil {
 			for _, item := range products.Products {
-				if vscodeAllowed(item) {
+				if i.vscodeAllowed(item) {
 					ver := &VFile{}
 					ver.Url = item.Url
 					ver.Arch = utils.ParseArch(item.Url)
@@ -300,7 +466,7 @@ func (i *Installer) GetVSCode() {
 					ver.Os = utils.ParsePlatform(item.Platform.PrettyName)
 					ver.Sum = item.Sum
 					if ver.Sum != "" {
-						ver.SumType = "sha256"
+						ver.SumType = utils.SumTypeOf(ver.Sum)
 					}
 					ver.Extra = fmt.Sprintf("v%s", item.Version)
 					if len(i.versions[name]) == 0 {
@@ -329,6 +495,14 @@ func filterMinicondaByFName(fname string) bool {
 	return r
 }
 
+// Versioned installers, like "Miniconda3-py311_23.11.0-2-Linux-x86_64.sh" or "Miniconda3-py39_4.12.0-Linux-x86_64.sh".
+var minicondaPattern = regexp.MustCompile(`^Miniconda3-py(\d+)_([\d.]+)(?:-\d+)?-(.+)$`)
+
+/*
+Collects the "latest" installers, under the version they point to. With MinicondaDepth in config,
+installers of the newest MinicondaDepth releases per python version are collected as well, Extra is their
+python version, like "py311".
+*/
 func (i *Installer) GetMiniconda() {
 	// https://repo.anaconda.com/miniconda/
 	i.homepage = "https://repo.anaconda.com/miniconda/"
@@ -342,6 +516,9 @@ func (i *Installer) GetMiniconda() {
 		)
 		name := "miniconda"
 		i.versions[name] = Versions{}
+		// python version -> release -> installers.
+		history := map[string]map[string][]*VFile{}
+		seen := map[string]bool{}
 		i.doc.Find("table").Find("tr").Each(func(ii int, s *goquery.Selection) {
 			u := s.Find("td").Eq(0).Find("a").AttrOr("href", "")
 			if u == "" {
@@ -358,16 +535,14 @@ func (i *Installer) GetMiniconda() {
 
 			if strings.Contains(fName, "latest") {
 				ver := &VFile{}
-				if !strings.HasPrefix(u, "http") {
-					u, _ = url.JoinPath(i.homepage, u)
-				}
+				u = utils.NormalizeUrl(u, i.homepage)
 				ver.Url = u
 				ver.Arch = utils.ParseArch(fName)
 				ver.Os = utils.ParsePlatform(fName)
 				ver.Sum = sha256Str
 				if ver.Sum != "" {
 					shaStr = shaStr + ";" + sha256Str
-					ver.SumType = "sha256"
+					ver.SumType = utils.SumTypeOf(ver.Sum)
 				}
 				ver.Extra = "latest"
 				if len(i.versions[name]) == 0 {
@@ -378,39 +553,75 @@ func (i *Installer) GetMiniconda() {
 				if sha256Str != "" && strings.Contains(shaStr, sha256Str) && vName == "" {
 					vName = VersionPattern.FindString(fName)
 				}
+				m := minicondaPattern.FindStringSubmatch(fName)
+				if i.cnf.MinicondaDepth <= 0 || m == nil {
+					return
+				}
+				// builds of a release are listed newest first, the newest one is kept.
+				py, release := "py"+m[1], m[2]
+				key := py + "_" + release + "-" + m[3]
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+				u = utils.NormalizeUrl(u, i.homepage)
+				ver := &VFile{
+					Url:   u,
+					Arch:  utils.ParseArch(fName),
+					Os:    utils.ParsePlatform(fName),
+					Sum:   strings.TrimSpace(sha256Str),
+					Extra: py,
+				}
+				ver.SumType = utils.SumTypeOf(ver.Sum)
+				if history[py] == nil {
+					history[py] = map[string][]*VFile{}
+				}
+				history[py][release] = append(history[py][release], ver)
 			}
 		})
 		if vName != "" {
 			i.versions[name][vName] = i.versions[name]["latest"]
 			delete(i.versions[name], "latest")
 		}
+		for _, releases := range history {
+			names := make([]string, 0, len(releases))
+			for release := range releases {
+				names = append(names, release)
+			}
+			sort.Slice(names, func(a, b int) bool { return utils.CompareVersion(names[a], names[b]) > 0 })
+			for j, release := range names {
+				if j >= i.cnf.MinicondaDepth {
+					break
+				}
+				i.versions[name][release] = append(i.versions[name][release], releases[release]...)
+			}
+		}
 	}
 }
 
 func (i *Installer) FetchAll() {
-	fmt.Println("android sdkmanager...")
+	logs.Debug("android sdkmanager...")
 	i.GetAndroidSDKManager()
-	fmt.Println("cygwin installer...")
+	logs.Debug("cygwin installer...")
 	i.GetCygwinInstaller()
-	fmt.Println("msys2 installer...")
+	logs.Debug("msys2 installer...")
 	i.GetMsys2Installer()
-	fmt.Println("rust installer...")
+	logs.Debug("rust installer...")
 	i.GetRustInstaller()
-	fmt.Println("vscode...")
+	logs.Debug("vscode...")
 	i.GetVSCode()
-	fmt.Println("miniconda...")
+	logs.Debug("miniconda...")
 	i.GetMiniconda()
 }
 
 func (i *Installer) Upload() {
 	for name, versions := range i.versions {
-		if len(versions) == 0 {
-			continue
-		}
-		fPath := filepath.Join(i.cnf.DirPath(), fmt.Sprintf(InstallerVersionFileNamePattern, name))
-		if content, err := json.MarshalIndent(versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			i.uploader.Upload(fPath)
-		}
+		fileName := fmt.Sprintf(InstallerVersionFileNamePattern, name)
+		i.versions[name] = publishVersions(i.cnf, i.uploader, "installers", fileName, versions)
 	}
 }
+
+// Collects version files without publishing them, keyed by file names, see api.go.
+func (i *Installer) CollectFiles(ctx context.Context) (map[string]Versions, error) {
+	return collectFiles(ctx, i.cnf, "installers", i.FetchAll, i.versions, InstallerVersionFileNamePattern)
+}
@@ -0,0 +1,34 @@
+package versions
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+)
+
+/*
+Runs a step of a collector, like FetchAll or Upload.
+A panic or a confs.Exit in it fails the collector and is returned as an error,
+the other collectors of the run go on. Goroutines started by the step are not covered.
+*/
+func Isolate(name, step string, fn func()) (err error) {
+	unguard := confs.GuardExit()
+	defer unguard()
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if e, ok := r.(*confs.ExitPanic); ok {
+			err = fmt.Errorf("%s exited with code %d", step, e.Code)
+		} else {
+			err = fmt.Errorf("%s panicked: %v", step, r)
+			logs.For(name).Debug("%s", debug.Stack())
+		}
+		logs.For(name).Error("%v", err)
+	}()
+	fn()
+	return
+}
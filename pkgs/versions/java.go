@@ -1,17 +1,17 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -125,6 +125,7 @@ type JDK struct {
 	versions Versions
 	fetcher  *request.Fetcher
 	homepage string
+	lock     *sync.Mutex
 }
 
 func NewJDK(cnf *confs.CollectorConf) (j *JDK) {
@@ -134,13 +135,10 @@ func NewJDK(cnf *confs.CollectorConf) (j *JDK) {
 		fetcher:  request.NewFetcher(),
 		homepage: AdoptiumURL,
 		uploader: upload.NewUploader(cnf),
+		lock:     &sync.Mutex{},
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := j.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		j.fetcher.Proxy = pxy
+		j.fetcher.Proxy = j.cnf.Proxy()
 	}
 	return
 }
@@ -151,62 +149,75 @@ func (j *JDK) FetchAll() {
 	versionList := JdkAvailableVersions{
 		Releases: []int{},
 	}
-	if resp := j.fetcher.Get(); resp != nil {
-		content, _ := io.ReadAll(resp.RawBody())
+	if resp, _ := fetch.GetString(j.cnf, j.fetcher); resp != "" {
+		content := []byte(resp)
 		if err := json.Unmarshal(content, &versionList); err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse content from %s failed.", j.fetcher.Url))
+			logs.Error("Parse content from %s failed.", j.fetcher.Url)
 			return
 		}
 	}
 
-OUTTER:
+	// releases are fetched concurrently.
+	pool := newScrapePool(j.cnf.CollectorOptions("jdk"))
 	for _, vInt := range versionList.Releases {
-		vName := fmt.Sprintf("%d", vInt)
-		u := fmt.Sprintf(AdoptiumAssetsURL, vInt)
-		j.fetcher.SetUrl(u)
-
-		vList := []*JdkItem{}
-		if resp := j.fetcher.Get(); resp != nil {
-			content, _ := io.ReadAll(resp.RawBody())
-			if err := json.Unmarshal(content, &vList); err != nil {
-				gprint.PrintError(fmt.Sprintf("Parse content from %s failed.", j.fetcher.Url))
-				continue OUTTER
-			}
+		vInt := vInt
+		pool.Go(func() { j.fetchRelease(vInt) })
+	}
+	pool.Wait()
+}
+
+func (j *JDK) fetchRelease(vInt int) {
+	vName := fmt.Sprintf("%d", vInt)
+	fetcher := fetch.Clone(j.fetcher)
+	fetcher.SetUrl(fmt.Sprintf(AdoptiumAssetsURL, vInt))
+
+	vList := []*JdkItem{}
+	if resp, _ := fetch.GetString(j.cnf, fetcher); resp != "" {
+		content := []byte(resp)
+		if err := json.Unmarshal(content, &vList); err != nil {
+			logs.Error("Parse content from %s failed.", fetcher.Url)
+			return
+		}
+	}
+	files := []*VFile{}
+	for _, item := range vList {
+		if item.Binary == nil || item.Binary.ImageType != "jdk" || item.Binary.Package == nil {
+			continue
+		}
+		if item.Binary.Os == "alpine-linux" || item.Binary.CLib == "musl" {
+			continue
 		}
-	INNER:
-		for _, item := range vList {
-			if item.Binary == nil || item.Binary.ImageType != "jdk" || item.Binary.Package == nil {
-				continue INNER
-			}
-			if item.Binary.Os == "alpine-linux" || item.Binary.CLib == "musl" {
-				continue INNER
-			}
-			ver := &VFile{}
-			ver.Url = item.Binary.Package.Url
-			ver.Sum = item.Binary.Package.Checksum
-			if ver.Sum != "" {
-				ver.SumType = "sha256"
-			}
-			ver.Arch = utils.ParseArch(item.Binary.Arch)
-			ver.Os = utils.ParsePlatform(item.Binary.Os)
-			if ver.Arch == "" || ver.Os == "" {
-				continue INNER
-			}
-			ver.Extra = fmt.Sprintf("%s$%s", item.ReleaseName, item.Vendor)
-			if vl, ok := j.versions[vName]; !ok || vl == nil {
-				j.versions[vName] = []*VFile{}
-			}
-			j.versions[vName] = append(j.versions[vName], ver)
+		ver := &VFile{}
+		ver.Url = item.Binary.Package.Url
+		ver.Sum = item.Binary.Package.Checksum
+		if ver.Sum != "" {
+			ver.SumType = utils.SumTypeOf(ver.Sum)
 		}
+		ver.Arch = utils.ParseArch(item.Binary.Arch)
+		ver.Os = utils.ParsePlatform(item.Binary.Os)
+		if ver.Arch == "" || ver.Os == "" {
+			continue
+		}
+		ver.Extra = fmt.Sprintf("%s$%s", item.ReleaseName, item.Vendor)
+		files = append(files, ver)
+	}
+	if len(files) == 0 {
+		return
 	}
+	j.lock.Lock()
+	j.versions[vName] = append(j.versions[vName], files...)
+	j.lock.Unlock()
 }
 
 func (j *JDK) Upload() {
-	if len(j.versions) > 0 {
-		fPath := filepath.Join(j.cnf.DirPath(), JavaVersionFileName)
-		if content, err := json.MarshalIndent(j.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			j.uploader.Upload(fPath)
-		}
-	}
+	j.versions = publishVersions(j.cnf, j.uploader, "jdk", JavaVersionFileName, j.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (j *JDK) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, j.cnf, "jdk", j.FetchAll, &j.versions)
+}
+
+func (j *JDK) VersionFileName() string {
+	return JavaVersionFileName
 }
@@ -1,15 +1,14 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
 )
@@ -106,6 +105,7 @@ func (a *AdoptiumJDK) fetchRepo(repo string) {
 					}
 					ver := &VFile{}
 					ver.Url = asset.Url
+					ver.ReleasedAt = utils.Date(item.PublishedAt)
 					if filterGithubByUrl(asset.Url) {
 						ver.Arch = utils.ParseArch(asset.Url)
 						ver.Os = utils.ParsePlatform(asset.Url)
@@ -122,7 +122,7 @@ func (a *AdoptiumJDK) fetchRepo(repo string) {
 				}
 			}
 		} else {
-			fmt.Println(err)
+			logs.Error("%+v", err)
 		}
 	}
 	// os.WriteFile("test.txt", content, os.ModePerm)
@@ -131,17 +131,23 @@ func (a *AdoptiumJDK) fetchRepo(repo string) {
 func (a *AdoptiumJDK) FetchAll() {
 	repoList := a.GetRepoList()
 	for _, repo := range repoList {
-		fmt.Printf("fetching %s...\n", repo)
+		if a.cnf.Canceled() {
+			return
+		}
+		logs.Debug("fetching %s...", repo)
 		a.fetchRepo(repo)
 	}
 }
 
 func (a *AdoptiumJDK) Upload() {
-	if len(a.versions) > 0 {
-		fPath := filepath.Join(a.cnf.DirPath(), JavaVersionFileName)
-		if content, err := json.MarshalIndent(a.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			a.uploader.Upload(fPath)
-		}
-	}
+	a.versions = publishVersions(a.cnf, a.uploader, "java", JavaVersionFileName, a.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (a *AdoptiumJDK) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, a.cnf, "java", a.FetchAll, &a.versions)
+}
+
+func (a *AdoptiumJDK) VersionFileName() string {
+	return JavaVersionFileName
 }
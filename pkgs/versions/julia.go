@@ -1,19 +1,17 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -57,11 +55,7 @@ func NewJulia(cnf *confs.CollectorConf) (j *Julia) {
 		homepage: "https://julialang-s3.julialang.org/bin/versions.json",
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := j.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		j.fetcher.Proxy = pxy
+		j.fetcher.Proxy = j.cnf.Proxy()
 	}
 	if UseCNSource() {
 		j.homepage = "https://mirrors.tuna.tsinghua.edu.cn/julia-releases/bin/versions.json"
@@ -89,10 +83,10 @@ func (j *Julia) GetVersions() {
 	j.fetcher.SetUrl(j.homepage)
 	j.fetcher.Timeout = 180 * time.Second
 	versionList := &JVersionList{}
-	if resp := j.fetcher.Get(); resp != nil {
-		content, _ := io.ReadAll(resp.RawBody())
+	if resp, _ := fetch.GetString(j.cnf, j.fetcher); resp != "" {
+		content := []byte(resp)
 		if err := json.Unmarshal(content, &versionList); err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse content from %s failed.", j.fetcher.Url))
+			logs.Error("Parse content from %s failed.", j.fetcher.Url)
 			return
 		}
 	}
@@ -120,7 +114,7 @@ func (j *Julia) GetVersions() {
 				ver.Os = platform
 				ver.Sum = jFile.Sum
 				if ver.Sum != "" {
-					ver.SumType = "sha256"
+					ver.SumType = utils.SumTypeOf(ver.Sum)
 				}
 				ver.Extra = extraStr
 				if vlist, ok := j.versions[vName]; !ok || vlist == nil {
@@ -137,11 +131,14 @@ func (j *Julia) FetchAll() {
 }
 
 func (j *Julia) Upload() {
-	if len(j.versions) > 0 {
-		fPath := filepath.Join(j.cnf.DirPath(), JuliaVersionFileName)
-		if content, err := json.MarshalIndent(j.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			j.uploader.Upload(fPath)
-		}
-	}
+	j.versions = publishVersions(j.cnf, j.uploader, "julia", JuliaVersionFileName, j.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (j *Julia) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, j.cnf, "julia", j.FetchAll, &j.versions)
+}
+
+func (j *Julia) VersionFileName() string {
+	return JuliaVersionFileName
 }
@@ -1,18 +1,21 @@
 package versions
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/cache"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/collector/pkgs/utils"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -20,6 +23,7 @@ const (
 	KubectlVersionFileName string = "kubectl.version.json"
 	KubectlURL             string = "https://kubernetes.io/releases/patch-releases/"
 	KubectlLatestURL       string = "https://dl.k8s.io/release/stable.txt"
+	KubectlRepo            string = "kubernetes/kubernetes" // releases api fallback.
 )
 
 /*
@@ -55,6 +59,7 @@ type Kubectl struct {
 	versions Versions
 	fetcher  *request.Fetcher
 	doc      *goquery.Document
+	lock     *sync.Mutex
 }
 
 func NewKubectl(cnf *confs.CollectorConf) (k *Kubectl) {
@@ -63,6 +68,7 @@ func NewKubectl(cnf *confs.CollectorConf) (k *Kubectl) {
 		uploader: upload.NewUploader(cnf),
 		versions: make(Versions),
 		fetcher:  request.NewFetcher(),
+		lock:     &sync.Mutex{},
 	}
 	k.fetcher.Timeout = 5 * time.Second
 	return
@@ -70,15 +76,15 @@ func NewKubectl(cnf *confs.CollectorConf) (k *Kubectl) {
 
 func (k *Kubectl) GetVersions() (r []string) {
 	k.fetcher.SetUrl(KubectlURL)
-	if resp := k.fetcher.Get(); resp != nil {
+	if resp, _ := fetch.GetString(k.cnf, k.fetcher); resp != "" {
 		var err error
-		k.doc, err = goquery.NewDocumentFromReader(resp.RawBody())
+		k.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if k.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", k.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", k.fetcher.Url)
+			return
 		}
 
 		k.doc.Find("tr").Find("td").Each(func(_ int, s *goquery.Selection) {
@@ -88,28 +94,48 @@ func (k *Kubectl) GetVersions() (r []string) {
 			}
 		})
 	}
+	return
+}
 
-	k.fetcher.SetUrl(KubectlLatestURL)
-	s, _ := k.fetcher.GetString()
-	latestVersion := versionRegexp.FindString(s)
-	if latestVersion != "" {
-		r = append(r, latestVersion)
+// Releases of kubernetes from the github api.
+func (k *Kubectl) getApiVersions() (r []string) {
+	for _, item := range githubReleaseItems(k.cnf, k.fetcher, KubectlRepo) {
+		if gconv.Bool(item.PreRelease) {
+			continue
+		}
+		if vStr := versionRegexp.FindString(item.TagName); vStr != "" {
+			r = append(r, vStr)
+		}
 	}
 	return
 }
 
+func (k *Kubectl) getLatestVersion() string {
+	k.fetcher.SetUrl(KubectlLatestURL)
+	s, _ := fetch.GetString(k.cnf, k.fetcher)
+	return versionRegexp.FindString(s)
+}
+
 func (k *Kubectl) fetchOne(vStr, archStr, osStr string) {
 	sha256Url := fmt.Sprintf(KubectlSha256UrlPattern, vStr, osStr, archStr)
 	if osStr == "windows" {
 		sha256Url = fmt.Sprintf(KubectlExeSha256UrlPattern, vStr, osStr, archStr)
 	}
-	k.fetcher.SetUrl(sha256Url)
-	sha256, _ := k.fetcher.GetString()
-	if strings.Contains(sha256, "NoSuchKey") {
-		return
+	sha256 := ""
+	if !cache.Get(cache.BucketSums, sha256Url, &sha256) {
+		fetcher := fetch.Clone(k.fetcher)
+		fetcher.SetUrl(sha256Url)
+		content, code := fetch.GetString(k.cnf, fetcher)
+		if strings.Contains(content, "NoSuchKey") {
+			return
+		}
+		// the .sha256 files hold a bare sum, some releases add the file name.
+		sha256, _ = utils.FindSum(content, strings.TrimSuffix(sha256Url, ".sha256"))
+		if code == 200 && sha256 != "" {
+			cache.Set(cache.BucketSums, sha256Url, sha256, cache.SumsTtl)
+		}
 	}
-	sha256 = strings.TrimSpace(sha256)
-	fmt.Println(vStr, archStr, osStr, sha256)
+	logs.Debug("%s %s %s %s", vStr, archStr, osStr, sha256)
 
 	u := fmt.Sprintf(KubectlDownloadUrlPattern, vStr, osStr, archStr)
 	if osStr == "windows" {
@@ -120,8 +146,10 @@ func (k *Kubectl) fetchOne(vStr, archStr, osStr string) {
 		Arch:    archStr,
 		Os:      osStr,
 		Sum:     sha256,
-		SumType: "sha256",
+		SumType: utils.SumTypeOf(sha256),
 	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
 	if vfiles, ok := k.versions[vStr]; !ok || vfiles == nil {
 		k.versions[vStr] = []*VFile{}
 	}
@@ -136,20 +164,39 @@ func (k *Kubectl) FetchAll() {
 		"linux/arm64",
 		"windows/amd64",
 	}
-	for _, vStr := range k.GetVersions() {
+	// sums are fetched concurrently.
+	var vList []string
+	withApiFallback(k.cnf, "kubectl", func() int { return len(vList) },
+		func() { vList = k.GetVersions() },
+		func() { vList = k.getApiVersions() },
+	)
+	vList = append(vList, k.getLatestVersion())
+	seen := map[string]bool{"": true}
+
+	pool := newScrapePool(k.cnf.CollectorOptions("kubectl"))
+	for _, vStr := range vList {
+		if seen[vStr] {
+			continue
+		}
+		seen[vStr] = true
 		for _, archOs := range archOsList {
 			sList := strings.Split(archOs, "/")
-			k.fetchOne(vStr, sList[1], sList[0])
+			vStr := vStr
+			pool.Go(func() { k.fetchOne(vStr, sList[1], sList[0]) })
 		}
 	}
+	pool.Wait()
 }
 
 func (k *Kubectl) Upload() {
-	if len(k.versions) > 0 {
-		fPath := filepath.Join(k.cnf.DirPath(), KubectlVersionFileName)
-		if content, err := json.MarshalIndent(k.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			k.uploader.Upload(fPath)
-		}
-	}
+	k.versions = publishVersions(k.cnf, k.uploader, "kubectl", KubectlVersionFileName, k.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (k *Kubectl) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, k.cnf, "kubectl", k.FetchAll, &k.versions)
+}
+
+func (k *Kubectl) VersionFileName() string {
+	return KubectlVersionFileName
 }
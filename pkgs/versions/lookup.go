@@ -0,0 +1,123 @@
+package versions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/upload"
+)
+
+/*
+Queries of collected version files, for pxy list and pxy search.
+
+A tool is the name of a version file without ".version.json", like "go" or "nodejs",
+a unique prefix also works: "node" finds "nodejs". Files are read from the work dir,
+or from the storage with remote.
+*/
+
+// Reading a version file from the storage failed, the storage may be unreachable.
+var ErrReadPublished = errors.New("read published version file failed")
+
+type Query struct {
+	Tool    string
+	Os      string
+	Arch    string
+	Version string // prefix of version names, like "1.22".
+	Remote  bool
+}
+
+type Match struct {
+	Version string `json:"version"`
+	*VFile
+}
+
+// Resolves a tool name to its version file name by the files in the work dir.
+func resolveVersionFile(cnf *confs.CollectorConf, tool string) (string, error) {
+	tool = strings.ToLower(strings.TrimSpace(tool))
+	if tool == "" {
+		return "", fmt.Errorf("no tool given")
+	}
+	matches, _ := filepath.Glob(filepath.Join(cnf.DirPath(), "*"+VersionFileSuffix))
+	candidates := []string{}
+	for _, fPath := range matches {
+		name := strings.TrimSuffix(filepath.Base(fPath), VersionFileSuffix)
+		if name == tool {
+			return filepath.Base(fPath), nil
+		}
+		if strings.HasPrefix(name, tool) {
+			candidates = append(candidates, name)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		// remote files may not be in the work dir.
+		return tool + VersionFileSuffix, nil
+	case 1:
+		return candidates[0] + VersionFileSuffix, nil
+	default:
+		sort.Strings(candidates)
+		return "", fmt.Errorf("%s is ambiguous: %s", tool, strings.Join(candidates, ", "))
+	}
+}
+
+// Loads the versions of a tool.
+func LoadVersions(cnf *confs.CollectorConf, tool string, remote bool) (Versions, error) {
+	fileName, err := resolveVersionFile(cnf, tool)
+	if err != nil {
+		return nil, err
+	}
+	fPath := filepath.Join(cnf.DirPath(), fileName)
+	var content []byte
+	if remote {
+		content, err = upload.NewUploader(cnf).Published(fPath)
+	} else {
+		content, err = os.ReadFile(fPath)
+	}
+	if os.IsNotExist(err) || err == upload.ErrNotFound {
+		return nil, fmt.Errorf("no versions of %s", tool)
+	}
+	if err != nil && remote {
+		return nil, fmt.Errorf("%w: %w", ErrReadPublished, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	vs := Versions{}
+	if err = json.Unmarshal(content, &vs); err != nil {
+		return nil, fmt.Errorf("invalid version file %s: %w", fileName, err)
+	}
+	return vs, nil
+}
+
+// Files matching the query, newest versions first.
+func Search(cnf *confs.CollectorConf, q *Query) ([]*Match, error) {
+	vs, err := LoadVersions(cnf, q.Tool, q.Remote)
+	if err != nil {
+		return nil, err
+	}
+	r := []*Match{}
+	for _, vName := range vs.Names() {
+		if q.Version != "" && !strings.HasPrefix(vName, q.Version) {
+			continue
+		}
+		for _, f := range vs[vName] {
+			if f == nil {
+				continue
+			}
+			if q.Os != "" && !strings.EqualFold(f.Os, q.Os) {
+				continue
+			}
+			if q.Arch != "" && !strings.EqualFold(f.Arch, q.Arch) {
+				continue
+			}
+			r = append(r, &Match{Version: vName, VFile: f})
+		}
+	}
+	return r, nil
+}
@@ -1,25 +1,34 @@
 package versions
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/xml"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/gvcgo/goutils/pkgs/request"
+	"github.com/gvcgo/collector/pkgs/cache"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
 	MavenVersionFilename string = "maven.version.json"
 	MavenBinUrlPattern   string = "%s%s/binaries/apache-maven-%s-bin.tar.gz"
 	MavenSumUrlPattern   string = "%s%s/binaries/apache-maven-%s-bin.tar.gz.sha512"
-	MavenSumType         string = "sha512"
+	// maven central, the api fallback.
+	MavenCentralUrl      string = "https://repo.maven.apache.org/maven2/org/apache/maven/apache-maven/"
+	MavenCentralMetadata string = MavenCentralUrl + "maven-metadata.xml"
 )
 
+type mavenMetadata struct {
+	Versions []string `xml:"versioning>versions>version"`
+}
+
 /*
 maven-1, maven-2;
 https://dlcdn.apache.org/maven/
@@ -44,26 +53,23 @@ func NewMaven(cnf *confs.CollectorConf) (m *Maven) {
 		fetcher:  request.NewFetcher(),
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := m.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		m.fetcher.Proxy = pxy
+		m.fetcher.Proxy = m.cnf.Proxy()
 	}
 	return
 }
 
 func (m *Maven) getDoc() {
 	m.fetcher.Url = m.homepage
-	if resp := m.fetcher.Get(); resp != nil {
-		m.doc, _ = goquery.NewDocumentFromReader(resp.RawBody())
+	if resp, _ := fetch.GetString(m.cnf, m.fetcher); resp != "" {
+		m.doc, _ = goquery.NewDocumentFromReader(strings.NewReader(resp))
 	}
 }
 
-func (m *Maven) getSum(sumUrl string) string {
+// The .sha512 files hold "<sum>  <name>" or a bare sum.
+func (m *Maven) getSum(sumUrl string) (sum, sumType string) {
 	m.fetcher.SetUrl(sumUrl)
-	r, _ := m.fetcher.GetString()
-	return r
+	r, _ := fetch.GetString(m.cnf, m.fetcher)
+	return utils.FindSum(r, strings.TrimSuffix(sumUrl, ".sha512"))
 }
 
 func (m *Maven) GetVersions() {
@@ -87,15 +93,12 @@ func (m *Maven) GetVersions() {
 						vName,
 						vName,
 					)
-					ver.Sum = m.getSum(fmt.Sprintf(
+					ver.Sum, ver.SumType = m.getSum(fmt.Sprintf(
 						MavenSumUrlPattern,
 						u,
 						vName,
 						vName,
 					))
-					if ver.Sum != "" {
-						ver.SumType = MavenSumType
-					}
 					if vlist, ok := m.versions[vName]; !ok || vlist == nil {
 						m.versions[vName] = []*VFile{}
 					}
@@ -108,19 +111,53 @@ func (m *Maven) GetVersions() {
 	}
 }
 
-func (m *Maven) FetchAll() {
-	if m.doc == nil {
-		m.getDoc()
+// Maven 3 and 4 from maven central, which hosts the same binaries and sums.
+func (m *Maven) fetchFromApi() {
+	f := fetch.Clone(m.fetcher)
+	f.SetUrl(MavenCentralMetadata)
+	content, code := fetch.GetString(m.cnf, f)
+	meta := &mavenMetadata{}
+	if code != 200 || xml.Unmarshal([]byte(content), meta) != nil {
+		logs.Error("Get %s failed, status code: %d", MavenCentralMetadata, code)
+		return
+	}
+	for _, vName := range meta.Versions {
+		if !strings.HasPrefix(vName, "3.") && !strings.HasPrefix(vName, "4.") {
+			continue
+		}
+		ver := &VFile{
+			Url:  fmt.Sprintf("%s%s/apache-maven-%s-bin.tar.gz", MavenCentralUrl, vName, vName),
+			Arch: "any",
+			Os:   "any",
+		}
+		sumUrl := ver.Url + ".sha512"
+		if cache.Get(cache.BucketSums, sumUrl, &ver.Sum) {
+			ver.SumType = utils.SumTypeOf(ver.Sum)
+		} else {
+			f.SetUrl(sumUrl)
+			if content, code := fetch.GetString(m.cnf, f); code == 200 {
+				if ver.Sum, ver.SumType = utils.FindSum(content, ver.Url); ver.Sum != "" {
+					cache.Set(cache.BucketSums, sumUrl, ver.Sum, cache.SumsTtl)
+				}
+			}
+		}
+		m.versions[vName] = append(m.versions[vName], ver)
 	}
-	m.GetVersions()
+}
+
+func (m *Maven) FetchAll() {
+	withApiFallback(m.cnf, "maven", func() int { return len(m.versions) }, m.GetVersions, m.fetchFromApi)
 }
 
 func (m *Maven) Upload() {
-	if len(m.versions) > 0 {
-		fPath := filepath.Join(m.cnf.DirPath(), MavenVersionFilename)
-		if content, err := json.MarshalIndent(m.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			m.uploader.Upload(fPath)
-		}
-	}
+	m.versions = publishVersions(m.cnf, m.uploader, "maven", MavenVersionFilename, m.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (m *Maven) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, m.cnf, "maven", m.FetchAll, &m.versions)
+}
+
+func (m *Maven) VersionFileName() string {
+	return MavenVersionFilename
 }
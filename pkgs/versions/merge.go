@@ -0,0 +1,191 @@
+package versions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/metrics"
+	"github.com/gvcgo/collector/pkgs/notify"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Merges freshly collected versions into the published ones.
+Fresh files replace the published files of the same version,
+versions the source site no longer lists are kept.
+Results of checks on a published file are kept for the fresh file with the same url.
+*/
+func MergeVersions(published, fresh Versions) Versions {
+	r := Versions{}
+	checked := map[string]*VFile{}
+	for vName, files := range published {
+		r[vName] = files
+		for _, f := range files {
+			if f != nil && f.Url != "" {
+				checked[f.Url] = f
+			}
+		}
+	}
+	for vName, files := range fresh {
+		for _, f := range files {
+			if f == nil {
+				continue
+			}
+			if p, ok := checked[f.Url]; ok {
+				f.inherit(p)
+			}
+		}
+		r[vName] = files
+	}
+	return r
+}
+
+/*
+Publishes a version file: merges vs into the published copy, normalizes files, applies collector options,
+checks links, new versions(see canary.go) and sums, then saves and uploads it, dry runs save it into the dry-run dir. Upload checks the file against upload.VersionFileSchema. Returns the published versions.
+
+Nothing is published when the published copy exists but can not be read or parsed,
+so that a network error or a broken copy never drops versions. Fixture runs keep vs, see RunFixtures.
+*/
+func publishVersions(cnf *confs.CollectorConf, uploader *upload.Uploader, collector, fileName string, vs Versions) Versions {
+	if captureFixture(fileName, vs) {
+		return vs
+	}
+	metrics.CollectorVersions.Set(float64(len(vs)), collector, fileName)
+	notify.Current().AddCollectorFile(collector, fileName, len(vs))
+	if len(vs) == 0 {
+		metrics.CollectorSuccess.Set(0, collector)
+		return vs
+	}
+	opts := cnf.CollectorOptions(collector)
+	fPath := filepath.Join(cnf.DirPath(), fileName)
+	published := Versions{}
+	if opts.MergeWithPublished() {
+		content, err := uploader.Published(fPath)
+		switch {
+		case errors.Is(err, upload.ErrNotFound):
+		case err != nil:
+			logs.For(collector).Error("Read published %s failed, skipped: %+v", fileName, err)
+			metrics.CollectorSuccess.Set(0, collector)
+			notify.Current().FailCollector(collector, "cannot read published "+fileName)
+			return nil
+		default:
+			if err := json.Unmarshal(content, &published); err != nil {
+				logs.For(collector).Error("Published %s is broken, skipped, fix it or set Merge to false: %+v", fileName, err)
+				metrics.CollectorSuccess.Set(0, collector)
+				notify.Current().FailCollector(collector, "cannot parse published "+fileName)
+				return nil
+			}
+			vs = MergeVersions(published, vs)
+		}
+	}
+	for _, files := range vs {
+		for _, f := range files {
+			if f != nil {
+				f.Normalize()
+			}
+		}
+	}
+	vs.upgradeHttps()
+	vs = FilterVersions(opts, vs)
+	if len(vs) == 0 {
+		return vs
+	}
+	vs = headCheck(cnf, collector, vs)
+	if len(vs) == 0 {
+		return vs
+	}
+	vs = canaryCheck(cnf, collector, vs, published)
+	if len(vs) == 0 {
+		return vs
+	}
+	checkSignatures(cnf, collector, fileName, vs)
+	checkSums(cnf, collector, vs)
+	if !checkConflicts(cnf, collector, fileName, vs, published) {
+		confs.Fail(confs.FailGate)
+		metrics.CollectorSuccess.Set(0, collector)
+		notify.Current().FailCollector(collector, fileName+" blocked by conflicts")
+		return vs
+	}
+	latest := ""
+	if cnf.VersionLatest {
+		latest = vs.Latest()
+	}
+	content, err := vs.marshal(latest)
+	if err != nil {
+		logs.Error("%+v", err)
+		return vs
+	}
+	buf := &bytes.Buffer{}
+	if json.Indent(buf, content, "", "  ") == nil {
+		outPath := cnf.OutputPath(fileName)
+		if err := utils.WriteFileWithBackup(outPath, buf.Bytes(), os.ModePerm); err != nil {
+			logs.For(collector).Error("Write %s failed: %+v", fileName, err)
+			return vs
+		}
+		uploader.Upload(outPath)
+		publishExports(cnf, uploader, collector, fileName, vs)
+	}
+	return vs
+}
+
+/*
+Uploads a version file kept in the work dir by pxy fetch --local.
+fetch --local merges against the local copy only, so the file is merged with the published copy here,
+versions published by other runs since are kept. The file and its exports are written again before they are uploaded.
+Nothing is uploaded when the published copy can not be read or parsed, returns false then.
+*/
+func UploadLocalFile(cnf *confs.CollectorConf, uploader *upload.Uploader, fPath string) bool {
+	fileName := filepath.Base(fPath)
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		logs.Error("Read %s failed: %+v", fileName, err)
+		return false
+	}
+	vs := Versions{}
+	if err := json.Unmarshal(content, &vs); err != nil {
+		logs.Error("%s is broken, not uploaded: %+v", fileName, err)
+		return false
+	}
+	published := Versions{}
+	content, err = uploader.Published(fPath)
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+	case err != nil:
+		logs.Error("Read published %s failed, not uploaded: %+v", fileName, err)
+		return false
+	default:
+		if err := json.Unmarshal(content, &published); err != nil {
+			logs.Error("Published %s is broken, not uploaded: %+v", fileName, err)
+			return false
+		}
+		vs = MergeVersions(published, vs)
+	}
+	latest := ""
+	if cnf.VersionLatest {
+		latest = vs.Latest()
+	}
+	content, err = vs.marshal(latest)
+	if err != nil {
+		logs.Error("%+v", err)
+		return false
+	}
+	buf := &bytes.Buffer{}
+	if err := json.Indent(buf, content, "", "  "); err != nil {
+		logs.Error("%+v", err)
+		return false
+	}
+	if err := utils.WriteFileWithBackup(fPath, buf.Bytes(), os.ModePerm); err != nil {
+		logs.Error("Write %s failed: %+v", fileName, err)
+		return false
+	}
+	uploader.Upload(fPath)
+	publishExports(cnf, uploader, "", fileName, vs)
+	return true
+}
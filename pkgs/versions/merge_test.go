@@ -0,0 +1,57 @@
+package versions
+
+import "testing"
+
+func TestMergeVersions(t *testing.T) {
+	url := func(version string) string {
+		return "https://example.com/tool-" + version + "-linux-amd64.tar.gz"
+	}
+	published := Versions{
+		"1.0.0": {{Url: url("1.0.0"), Os: "linux", Arch: "amd64", Sum: "aaa", SumType: "sha256", SumStatus: SumVerified, SigVerified: true}},
+		"1.1.0": {{Url: url("1.1.0"), Os: "linux", Arch: "amd64", Sum: "bbb", SumType: "sha256", SumStatus: SumComputed, Size: 10, LastModified: "2024-01-01T00:00:00Z"}},
+		"1.2.0": {
+			{Url: url("1.2.0"), Os: "linux", Arch: "amd64", Sum: "ccc", SumType: "sha256", SumStatus: SumVerified, SigVerified: true, ReleasedAt: "2024-02-01"},
+			{Url: url("1.2.0") + ".zip", Sum: "fff", SumStatus: SumVerified, SigVerified: true},
+		},
+	}
+	fresh := Versions{
+		// a computed sum is kept, checks are kept while the sum does not change, a changed sum drops them.
+		"1.1.0": {{Url: url("1.1.0"), Os: "linux", Arch: "amd64"}},
+		"1.2.0": {
+			{Url: url("1.2.0"), Os: "linux", Arch: "amd64", Sum: "CCC", SumType: "sha256"},
+			{Url: url("1.2.0") + ".zip", Sum: "eee"},
+		},
+		// a new url of the version, nothing is inherited.
+		"1.3.0": {{Url: url("1.3.0"), Os: "linux", Arch: "amd64", Sum: "ddd", SumType: "sha256"}},
+	}
+
+	r := MergeVersions(published, fresh)
+	if len(r) != 4 {
+		t.Fatalf("merged %d versions, want 4: %v", len(r), r.Names())
+	}
+	// 1.0.0 is no longer listed by the site, it is kept.
+	if f := r["1.0.0"][0]; f.Url != url("1.0.0") || f.SumStatus != SumVerified || !f.SigVerified {
+		t.Errorf("pruned version = %+v", f)
+	}
+	tests := []struct {
+		name string
+		got  *VFile
+		want VFile
+	}{
+		{"computed sum", r["1.1.0"][0], VFile{
+			Url: url("1.1.0"), Os: "linux", Arch: "amd64", Sum: "bbb", SumType: "sha256", SumStatus: SumComputed,
+			Size: 10, LastModified: "2024-01-01T00:00:00Z",
+		}},
+		{"same sum", r["1.2.0"][0], VFile{
+			Url: url("1.2.0"), Os: "linux", Arch: "amd64", Sum: "CCC", SumType: "sha256", SumStatus: SumVerified,
+			SigVerified: true, ReleasedAt: "2024-02-01",
+		}},
+		{"changed sum", r["1.2.0"][1], VFile{Url: url("1.2.0") + ".zip", Sum: "eee"}},
+		{"new url", r["1.3.0"][0], VFile{Url: url("1.3.0"), Os: "linux", Arch: "amd64", Sum: "ddd", SumType: "sha256"}},
+	}
+	for _, tt := range tests {
+		if *tt.got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *tt.got, tt.want)
+		}
+	}
+}
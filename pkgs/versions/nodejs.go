@@ -1,20 +1,20 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -41,6 +41,8 @@ type Nodejs struct {
 	fetcher  *request.Fetcher
 	homepage string
 	itemList []*Item
+	schedule map[string]string // end dates of release lines, see dates.go.
+	lock     *sync.Mutex
 }
 
 func NewNodejs(cnf *confs.CollectorConf) (n *Nodejs) {
@@ -51,6 +53,7 @@ func NewNodejs(cnf *confs.CollectorConf) (n *Nodejs) {
 		fetcher:  request.NewFetcher(),
 		homepage: "https://nodejs.org/dist/index.json",
 		itemList: []*Item{},
+		lock:     &sync.Mutex{},
 	}
 	return
 }
@@ -73,63 +76,65 @@ func filterVersion(vItem *Item) bool {
 }
 
 func (n *Nodejs) getVersion(vItem *Item) {
-	n.fetcher.SetUrl(fmt.Sprintf(NodeSumUrlPattern, vItem.Version))
-	n.fetcher.Timeout = 30 * time.Second
-	content, _ := n.fetcher.GetString()
+	fetcher := fetch.Clone(n.fetcher)
+	fetcher.SetUrl(fmt.Sprintf(NodeSumUrlPattern, vItem.Version))
+	fetcher.Timeout = 30 * time.Second
+	content, _ := fetch.GetString(n.cnf, fetcher)
 	// os.WriteFile("test.txt", []byte(content), os.ModePerm)
 
-	for _, line := range strings.Split(content, "\n") {
-		if strings.Contains(line, "/node_pdb.zip") {
+	for _, entry := range utils.ParseSums(content, utils.SumFormatLines) {
+		fName := entry.Name
+		if strings.Contains(fName, "/node_pdb.zip") {
 			continue
 		}
-		if strings.Contains(line, ".tar.gz") || strings.Contains(line, ".zip") {
-			uList := strings.Split(strings.TrimSpace(line), " ")
-			if len(uList) >= 2 {
-				fName := strings.TrimSpace(uList[len(uList)-1])
-				archStr := utils.ParseArch(fName)
-				osStr := utils.ParsePlatform(fName)
-				if archStr != "" && osStr != "" {
-					ver := &VFile{}
-					ver.Sum = strings.TrimSpace(uList[0])
-					ver.SumType = "sha256"
-					ver.Url = fmt.Sprintf(
-						"%s/%s/%s",
-						NodeDownloadUrl,
-						vItem.Version,
-						fName,
-					)
-					ver.Arch = archStr
-					ver.Os = osStr
-					vName := strings.TrimPrefix(vItem.Version, "v")
-					if vlist, ok := n.versions[vName]; !ok || vlist == nil {
-						n.versions[vName] = []*VFile{}
-					}
-					if gconv.Bool(vItem.LTS) {
-						ver.Extra = "LTS"
-					}
-					n.versions[vName] = append(n.versions[vName], ver)
-				}
-			}
+		if !strings.Contains(fName, ".tar.gz") && !strings.Contains(fName, ".zip") {
+			continue
+		}
+		archStr := utils.ParseArch(fName)
+		osStr := utils.ParsePlatform(fName)
+		if archStr == "" || osStr == "" {
+			continue
 		}
+		ver := &VFile{
+			Url:     fmt.Sprintf("%s/%s/%s", NodeDownloadUrl, vItem.Version, fName),
+			Arch:    archStr,
+			Os:      osStr,
+			Sum:     entry.Sum,
+			SumType: entry.Type,
+		}
+		vName := strings.TrimPrefix(vItem.Version, "v")
+		ver.ReleasedAt = utils.Date(vItem.Date)
+		ver.EolAt = n.schedule[nodeLine(vName)]
+		if gconv.Bool(vItem.LTS) {
+			ver.Extra = "LTS"
+		}
+		n.lock.Lock()
+		n.versions[vName] = append(n.versions[vName], ver)
+		n.lock.Unlock()
 	}
 }
 
 func (n *Nodejs) GetVersions() {
 	n.fetcher.SetUrl(n.homepage)
 	n.fetcher.Timeout = 180 * time.Second
-	if resp := n.fetcher.Get(); resp != nil {
-		content, _ := io.ReadAll(resp.RawBody())
+	if resp, _ := fetch.GetString(n.cnf, n.fetcher); resp != "" {
+		content := []byte(resp)
 		if err := json.Unmarshal(content, &n.itemList); err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse content from %s failed.", n.fetcher.Url))
+			logs.Error("Parse content from %s failed.", n.fetcher.Url)
 			return
 		}
 	}
+	n.schedule = nodeSchedule(n.cnf, n.fetcher)
+	// sums of versions are fetched concurrently.
+	pool := newScrapePool(n.cnf.CollectorOptions("nodejs"))
 	for _, item := range n.itemList {
 		if !filterVersion(item) {
 			continue
 		}
-		n.getVersion(item)
+		item := item
+		pool.Go(func() { n.getVersion(item) })
 	}
+	pool.Wait()
 }
 
 func (n *Nodejs) FetchAll() {
@@ -137,11 +142,14 @@ func (n *Nodejs) FetchAll() {
 }
 
 func (n *Nodejs) Upload() {
-	if len(n.versions) > 0 {
-		fPath := filepath.Join(n.cnf.DirPath(), NodeVersionFileName)
-		if content, err := json.MarshalIndent(n.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			n.uploader.Upload(fPath)
-		}
-	}
+	n.versions = publishVersions(n.cnf, n.uploader, "nodejs", NodeVersionFileName, n.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (n *Nodejs) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, n.cnf, "nodejs", n.FetchAll, &n.versions)
+}
+
+func (n *Nodejs) VersionFileName() string {
+	return NodeVersionFileName
 }
@@ -1,11 +1,9 @@
 package versions
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/url"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -13,15 +11,21 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/gvcgo/collector/pkgs/utils"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
-	PhpVersionFileName string = "php.version.json"
+	PhpVersionFileName    string = "php.version.json"
+	PhpReleasesApiPattern string = "https://www.php.net/releases/index.php?json&version=%d&max=1000"
 )
 
+// Major versions for the releases api.
+var PhpApiMajors = []int{7, 8}
+
 /*
 Windows: https://windows.php.net/download/
 https://windows.php.net/downloads/releases/archives/
@@ -49,11 +53,7 @@ func NewPhP(cnf *confs.CollectorConf) (p *PhP) {
 		urlFilter: map[string]struct{}{},
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := p.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		p.fetcher.Proxy = pxy
+		p.fetcher.Proxy = p.cnf.Proxy()
 	}
 	return
 }
@@ -61,19 +61,19 @@ func NewPhP(cnf *confs.CollectorConf) (p *PhP) {
 func (p *PhP) getDoc() {
 	p.fetcher.SetUrl(p.homepage)
 	p.fetcher.Timeout = 30 * time.Second
-	if resp, sCode := p.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(p.cnf, p.fetcher); resp != "" && sCode == 200 {
 		// fmt.Println(resp)
 		var err error
 		p.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if p.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", p.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", p.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Println(sCode)
+		logs.Error("Failed: %s, code: %d", p.homepage, sCode)
 	}
 }
 
@@ -199,17 +199,71 @@ func (p *PhP) GetUnixVersions() {
 	}
 }
 
+// Source tarballs from the releases api, there is no api for windows builds.
+func (p *PhP) getUnixVersionsFromApi() {
+	for _, major := range PhpApiMajors {
+		releases := map[string]struct {
+			Source []struct {
+				Filename string `json:"filename"`
+				Sha256   string `json:"sha256"`
+			} `json:"source"`
+		}{}
+		if err := getApiJson(p.cnf, p.fetcher, fmt.Sprintf(PhpReleasesApiPattern, major), &releases); err != nil {
+			logs.Error("%+v", err)
+			continue
+		}
+		for vName, r := range releases {
+			if !filterPhPVersion(vName) {
+				continue
+			}
+			for _, src := range r.Source {
+				if !strings.HasSuffix(src.Filename, ".tar.gz") {
+					continue
+				}
+				u, _ := url.JoinPath("https://www.php.net/distributions", src.Filename)
+				if _, ok := p.urlFilter[u]; ok {
+					continue
+				}
+				p.versions[vName] = append(p.versions[vName], &VFile{
+					Url:     u,
+					Sum:     src.Sha256,
+					SumType: utils.SumTypeOf(src.Sha256),
+					Os:      "linux",
+					Arch:    "all",
+					Extra:   "src",
+				})
+				p.urlFilter[u] = struct{}{}
+			}
+		}
+	}
+}
+
+// Number of source tarballs found.
+func (p *PhP) unixFound() (n int) {
+	for _, vlist := range p.versions {
+		for _, ver := range vlist {
+			if ver.Extra == "src" {
+				n++
+			}
+		}
+	}
+	return
+}
+
 func (p *PhP) FetchAll() {
 	p.GetWindowsVersions()
-	p.GetUnixVersions()
+	withApiFallback(p.cnf, "php", p.unixFound, p.GetUnixVersions, p.getUnixVersionsFromApi)
 }
 
 func (p *PhP) Upload() {
-	if len(p.versions) > 0 {
-		fPath := filepath.Join(p.cnf.DirPath(), PhpVersionFileName)
-		if content, err := json.MarshalIndent(p.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			p.uploader.Upload(fPath)
-		}
-	}
+	p.versions = publishVersions(p.cnf, p.uploader, "php", PhpVersionFileName, p.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (p *PhP) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, p.cnf, "php", p.FetchAll, &p.versions)
+}
+
+func (p *PhP) VersionFileName() string {
+	return PhpVersionFileName
 }
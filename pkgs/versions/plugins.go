@@ -0,0 +1,369 @@
+package versions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
+)
+
+/*
+Collector plugins in PluginsDir: WebAssembly modules(.wasm) run sandboxed, see wasmplugins.go,
+native executables written in any language only run when NativePlugins is true.
+
+Native plugins are trusted like pxy itself: they run with its user, files, network and env, secrets included.
+WebAssembly plugins are not trusted, they reach nothing but the host api below.
+
+A plugin is started for each run with PXY_PLUGIN_API in its env, and talks to the host
+by json lines: requests on its stdout, responses on its stdin, logs go to stderr.
+
+	-> {"id": 1, "method": "hello", "params": {"api_version": 1}}
+	<- {"id": 1, "result": {"api_version": 1, "collector": "mytool"}}
+	-> {"id": 2, "method": "fetch", "params": {"url": "https://example.com/releases.json"}}
+	<- {"id": 2, "result": {"code": 200, "content": "..."}}
+	-> {"id": 3, "method": "parse", "params": {"name": "mytool-1.2.0-linux-x64.tar.gz"}}
+	<- {"id": 3, "result": {"version": "1.2.0", "os": "linux", "arch": "amd64"}}
+	-> {"id": 4, "method": "add", "params": {"version": "1.2.0", "files": [{"url": "...", "os": "linux", "arch": "amd64"}]}}
+	<- {"id": 4, "result": {"files": 1}}
+	-> {"id": 5, "method": "log", "params": {"level": "warning", "message": "..."}}
+
+hello must come first. fetch follows the fetch policies of the host, see checkPluginUrl for the urls allowed,
+Authorization, Cookie and Host headers of plugins are dropped. parse uses the platform utils,
+add is the version sink, files take the fields of version files, results of checks like sig_verified are dropped.
+The plugin exits with 0 when done, results of a failed plugin are discarded.
+*/
+
+const (
+	PluginApiVersion int    = 1
+	PluginApiEnvName string = "PXY_PLUGIN_API"
+	PluginTimeout           = 10 * time.Minute
+	PluginMaxMessage int    = 16 << 20
+)
+
+type pluginRequest struct {
+	Id     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type pluginResponse struct {
+	Id     int64  `json:"id"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func isWasmPlugin(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), PluginWasmExt)
+}
+
+func isNativePlugin(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+/*
+Registers collectors for plugins in PluginsDir, named by their file names without extensions.
+Plugins named like other collectors are skipped with an error,
+native plugins are skipped with a warning unless NativePlugins is true.
+*/
+func LoadPlugins(cnf *confs.CollectorConf) (names []string) {
+	kept := collectors[:0]
+	for _, e := range collectors {
+		if e.plugin == "" {
+			kept = append(kept, e)
+		}
+	}
+	collectors = kept
+
+	entries, err := os.ReadDir(cnf.PluginsPath())
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		fPath := filepath.Join(cnf.PluginsPath(), e.Name())
+		if !isWasmPlugin(e.Name()) {
+			if !isNativePlugin(info) {
+				continue
+			}
+			if !cnf.NativePlugins {
+				logs.Warning("%s: native plugins run unsandboxed with the rights of pxy, skipped. Set NativePlugins to trust them.", fPath)
+				continue
+			}
+		}
+		name := strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		if !ruleNamePattern.MatchString(name) {
+			logs.Error("%s: invalid plugin name %q, use lowercase letters, digits, - and _", fPath, name)
+			continue
+		}
+		if findCollector(name) != nil {
+			logs.Error("%s: collector %s already exists.", fPath, name)
+			continue
+		}
+		Register(name, true, func(c *confs.CollectorConf) Collector {
+			return NewPluginCollector(c, name, fPath)
+		})
+		collectors[len(collectors)-1].plugin = fPath
+		names = append(names, name)
+	}
+	return
+}
+
+type PluginCollector struct {
+	cnf      *confs.CollectorConf
+	uploader *upload.Uploader
+	versions Versions
+	fetcher  *request.Fetcher
+	name     string
+	path     string
+	hello    bool
+}
+
+func NewPluginCollector(cnf *confs.CollectorConf, name, path string) (p *PluginCollector) {
+	p = &PluginCollector{
+		cnf:      cnf,
+		uploader: upload.NewUploader(cnf),
+		versions: Versions{},
+		fetcher:  request.NewFetcher(),
+		name:     name,
+		path:     path,
+	}
+	if confs.EnableProxyOrNot() {
+		p.fetcher.Proxy = p.cnf.Proxy()
+	}
+	return
+}
+
+func (p *PluginCollector) FetchAll() {
+	ctx, cancel := context.WithTimeout(p.cnf.Context(), PluginTimeout)
+	defer cancel()
+	run := p.runNative
+	if isWasmPlugin(p.path) {
+		run = p.runWasm
+	}
+	if err := run(ctx); err != nil {
+		logs.For(p.name).Error("Plugin failed, its results are discarded: %+v", err)
+		p.versions = Versions{}
+	}
+}
+
+func (p *PluginCollector) runNative(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Env = append(os.Environ(), PluginApiEnvName+"="+strconv.Itoa(PluginApiVersion))
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("start plugin %s: %w", p.path, err)
+	}
+	err = p.serve(stdin, stdout)
+	stdin.Close()
+	if err != nil {
+		cancel()
+	}
+	if waitErr := cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	return err
+}
+
+// Answers requests of a plugin until it closes its stdout.
+func (p *PluginCollector) serve(stdin io.Writer, stdout io.Reader) error {
+	enc := json.NewEncoder(stdin)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), PluginMaxMessage)
+	for scanner.Scan() {
+		req := &pluginRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			return fmt.Errorf("invalid message from the plugin: %w", err)
+		}
+		resp := &pluginResponse{Id: req.Id}
+		if result, err := p.handle(req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Result = result
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (p *PluginCollector) handle(req *pluginRequest) (result any, err error) {
+	if req.Method != "hello" && !p.hello {
+		return nil, fmt.Errorf("hello first")
+	}
+	switch req.Method {
+	case "hello":
+		params := struct {
+			ApiVersion int `json:"api_version"`
+		}{}
+		if err = json.Unmarshal(req.Params, &params); err != nil {
+			return
+		}
+		if params.ApiVersion != PluginApiVersion {
+			return nil, fmt.Errorf("unsupported api version %d, the host supports %d", params.ApiVersion, PluginApiVersion)
+		}
+		p.hello = true
+		return map[string]any{"api_version": PluginApiVersion, "collector": p.name}, nil
+	case "fetch":
+		params := struct {
+			Url     string            `json:"url"`
+			Headers map[string]string `json:"headers"`
+		}{}
+		if err = json.Unmarshal(req.Params, &params); err != nil {
+			return
+		}
+		u, err := url.Parse(params.Url)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkPluginUrl(p.cnf.Context(), u); err != nil {
+			return nil, err
+		}
+		f := fetch.Clone(p.fetcher)
+		f.Headers = pluginHeaders(params.Headers)
+		f.SetUrl(u.String())
+		content, code := fetch.GetStringChecked(p.cnf, f, checkPluginUrl)
+		return map[string]any{"code": code, "content": content}, nil
+	case "parse":
+		params := struct {
+			Name string `json:"name"`
+		}{}
+		if err = json.Unmarshal(req.Params, &params); err != nil {
+			return
+		}
+		return map[string]string{
+			"version": VersionPattern.FindString(params.Name),
+			"os":      utils.ParsePlatform(params.Name),
+			"arch":    utils.ParseArch(params.Name),
+		}, nil
+	case "add":
+		params := struct {
+			Version string   `json:"version"`
+			Files   []*VFile `json:"files"`
+		}{}
+		if err = json.Unmarshal(req.Params, &params); err != nil {
+			return
+		}
+		if params.Version == "" {
+			return nil, fmt.Errorf("version is required")
+		}
+		for _, f := range params.Files {
+			if f == nil || (f.Url == "" && f.Extra == "") {
+				return nil, fmt.Errorf("files need an url or an extra")
+			}
+			// results of checks are the host's, see checksum.go, head.go and signature.go.
+			f.SigVerified, f.SumStatus, f.Size, f.LastModified = false, "", 0, ""
+		}
+		p.versions[params.Version] = append(p.versions[params.Version], params.Files...)
+		return map[string]int{"files": len(p.versions[params.Version])}, nil
+	case "log":
+		params := struct {
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		}{}
+		if err = json.Unmarshal(req.Params, &params); err != nil {
+			return
+		}
+		switch params.Level {
+		case "error":
+			logs.For(p.name).Error("%s", params.Message)
+		case "warning":
+			logs.For(p.name).Warning("%s", params.Message)
+		default:
+			logs.For(p.name).Info("%s", params.Message)
+		}
+		return map[string]any{}, nil
+	default:
+		return nil, fmt.Errorf("unknown method %q", req.Method)
+	}
+}
+
+// Headers a plugin can not set, credentials of the host and the target are the host's.
+var pluginDeniedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Host"}
+
+func pluginHeaders(headers map[string]string) map[string]string {
+	r := map[string]string{}
+	for k, v := range headers {
+		k = http.CanonicalHeaderKey(k)
+		if !slices.Contains(pluginDeniedHeaders, k) {
+			r[k] = v
+		}
+	}
+	return r
+}
+
+/*
+Plugins only fetch public http(s) urls, also by redirects: hosts resolving to loopback, private
+or link-local addresses, like cloud metadata endpoints, are rejected.
+*/
+func checkPluginUrl(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("no host in %q", u.String())
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		ip := addr.IP
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+			return fmt.Errorf("%s resolves to the non-public address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+func (p *PluginCollector) Upload() {
+	p.versions = publishVersions(p.cnf, p.uploader, p.name, p.name+".version.json", p.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (p *PluginCollector) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, p.cnf, p.name, p.FetchAll, &p.versions)
+}
+
+func (p *PluginCollector) VersionFileName() string {
+	return p.name + VersionFileSuffix
+}
@@ -0,0 +1,187 @@
+package versions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Plays a plugin against serve, requests go out as written, responses come back in order.
+func TestPluginServe(t *testing.T) {
+	p := NewPluginCollector(newTestConf(t), "mytool", "mytool.wasm")
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.serve(stdinW, stdoutR)
+		stdinW.Close()
+	}()
+	responses := bufio.NewScanner(stdinR)
+	call := func(req string) map[string]any {
+		t.Helper()
+		if _, err := io.WriteString(stdoutW, req+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if !responses.Scan() {
+			t.Fatalf("no response to %s", req)
+		}
+		resp := map[string]any{}
+		if err := json.Unmarshal(responses.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := call(`{"id": 1, "method": "parse", "params": {"name": "mytool-1.2.0-linux-x64.tar.gz"}}`); resp["error"] != "hello first" {
+		t.Errorf("parse before hello: %v", resp)
+	}
+	if resp := call(`{"id": 2, "method": "hello", "params": {"api_version": 2}}`); resp["error"] == nil {
+		t.Errorf("unsupported api version: %v", resp)
+	}
+	if resp := call(`{"id": 3, "method": "hello", "params": {"api_version": 1}}`); resp["error"] != nil || resp["id"] != float64(3) {
+		t.Errorf("hello: %v", resp)
+	}
+	resp := call(`{"id": 4, "method": "parse", "params": {"name": "mytool-1.2.0-linux-x64.tar.gz"}}`)
+	if result, _ := resp["result"].(map[string]any); result["version"] != "1.2.0" || result["os"] != "linux" || result["arch"] != "amd64" {
+		t.Errorf("parse: %v", resp)
+	}
+	if resp := call(`{"id": 5, "method": "add", "params": {"version": "1.2.0", "files": [{"os": "linux"}]}}`); resp["error"] == nil {
+		t.Errorf("add without url: %v", resp)
+	}
+	// results of checks are not taken from plugins.
+	if resp := call(`{"id": 6, "method": "add", "params": {"version": "1.2.0", "files": [{"url": "https://example.com/mytool-1.2.0-linux-x64.tar.gz", "os": "linux", "arch": "amd64", "sig_verified": true, "sum_status": "verified", "size": 1024, "last_modified": "2024-01-01T00:00:00Z"}]}}`); resp["error"] != nil {
+		t.Errorf("add: %v", resp)
+	}
+	if resp := call(`{"id": 7, "method": "exec", "params": {}}`); resp["error"] == nil {
+		t.Errorf("unknown method: %v", resp)
+	}
+	stdoutW.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	files := p.versions["1.2.0"]
+	if len(files) != 1 || files[0].Arch != "amd64" {
+		t.Fatalf("versions = %v", p.versions)
+	}
+	if f := files[0]; f.SigVerified || f.SumStatus != "" || f.Size != 0 || f.LastModified != "" {
+		t.Errorf("check results of the plugin are kept: %+v", f)
+	}
+}
+
+func TestCheckPluginUrl(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://1.1.1.1/releases.json", true},
+		{"http://8.8.8.8:8080/", true},
+		{"file:///etc/passwd", false},
+		{"ftp://1.1.1.1/", false},
+		{"https:///releases.json", false},
+		{"http://127.0.0.1:8080/", false},
+		{"http://localhost/", false},
+		{"http://[::1]/", false},
+		{"http://10.0.0.1/", false},
+		{"http://192.168.1.1/", false},
+		{"http://172.16.0.1/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[fe80::1]/", false},
+		{"http://0.0.0.0/", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkPluginUrl(context.Background(), u); (err == nil) != tt.ok {
+			t.Errorf("checkPluginUrl(%s) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestPluginHeaders(t *testing.T) {
+	got := pluginHeaders(map[string]string{
+		"accept":              "application/json",
+		"authorization":       "token x",
+		"Proxy-Authorization": "Basic x",
+		"COOKIE":              "session=1",
+		"host":                "metadata.google.internal",
+	})
+	if len(got) != 1 || got["Accept"] != "application/json" {
+		t.Errorf("pluginHeaders() = %v", got)
+	}
+}
+
+// Builds testdata/plugins/probe and runs it in the sandbox, it must reach nothing.
+func TestWasmPlugin(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is needed to build the plugin")
+	}
+	wasmPath := filepath.Join(t.TempDir(), "probe"+PluginWasmExt)
+	build := exec.Command(goBin, "build", "-o", wasmPath, "main.go")
+	build.Dir = filepath.Join("testdata", "plugins", "probe")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build probe: %v\n%s", err, out)
+	}
+	p := NewPluginCollector(newTestConf(t), "probe", wasmPath)
+	p.FetchAll()
+	files := p.versions["1.0.0"]
+	if len(files) != 1 {
+		t.Fatalf("versions = %v", p.versions)
+	}
+	if want := "denied,denied,denied,denied"; files[0].Extra != want {
+		t.Errorf("probes = %q, want %q", files[0].Extra, want)
+	}
+	if files[0].SigVerified || files[0].SumStatus != "" {
+		t.Errorf("check results of the plugin are kept: %+v", files[0])
+	}
+}
+
+func TestPluginServeInvalidMessage(t *testing.T) {
+	p := NewPluginCollector(newTestConf(t), "mytool", "mytool.wasm")
+	if err := p.serve(io.Discard, strings.NewReader("not json\n")); err == nil {
+		t.Error("serve() = nil for an invalid message")
+	}
+}
+
+// Native executables are trusted like pxy itself, they are only loaded when NativePlugins is true.
+func TestLoadPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("native plugins are .exe files on windows")
+	}
+	cnf := newTestConf(t)
+	cnf.PluginsDir = t.TempDir()
+	files := map[string]os.FileMode{
+		"sandboxed.wasm": 0o644,
+		"native":         0o755,
+		"readme.txt":     0o644,
+		"Bad Name.wasm":  0o644,
+	}
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(cnf.PluginsDir, name), []byte{}, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		cnf.PluginsDir = t.TempDir()
+		LoadPlugins(cnf)
+	}()
+
+	if names := LoadPlugins(cnf); len(names) != 1 || names[0] != "sandboxed" {
+		t.Errorf("LoadPlugins() = %v, want [sandboxed]", names)
+	}
+	cnf.NativePlugins = true
+	if names := LoadPlugins(cnf); len(names) != 2 || names[0] != "native" || names[1] != "sandboxed" {
+		t.Errorf("LoadPlugins() with NativePlugins = %v, want [native sandboxed]", names)
+	}
+}
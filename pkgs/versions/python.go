@@ -1,22 +1,21 @@
 package versions
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
+	"context"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
 	PythonVersionFileName string = "python.version.json"
+	PythonApiUrl          string = "https://api.anaconda.org/package/conda-forge/python"
 )
 
 /*
@@ -42,11 +41,7 @@ func NewPython(cnf *confs.CollectorConf) (p *Python) {
 		homepage: "https://anaconda.org/conda-forge/python/files",
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := p.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		p.fetcher.Proxy = pxy
+		p.fetcher.Proxy = p.cnf.Proxy()
 	}
 	return
 }
@@ -54,23 +49,45 @@ func NewPython(cnf *confs.CollectorConf) (p *Python) {
 func (p *Python) getDoc() {
 	p.fetcher.SetUrl(p.homepage)
 	p.fetcher.Timeout = 180 * time.Second
-	if resp, sCode := p.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(p.cnf, p.fetcher); resp != "" && sCode == 200 {
 		// fmt.Println(resp)
 		var err error
 		p.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if p.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", p.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", p.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Printf("Failed: %s, code: %d", p.homepage, sCode)
+		logs.Error("Failed: %s, code: %d", p.homepage, sCode)
+	}
+}
+
+// Versions from the anaconda api.
+func (p *Python) fetchFromApi() {
+	pkg := struct {
+		Versions []string `json:"versions"`
+	}{}
+	if err := getApiJson(p.cnf, p.fetcher, PythonApiUrl, &pkg); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for _, vName := range pkg.Versions {
+		p.versions[vName] = []*VFile{
+			{
+				Extra: "please use conda to install.",
+			},
+		}
 	}
 }
 
 func (p *Python) FetchAll() {
+	withApiFallback(p.cnf, "python", func() int { return len(p.versions) }, p.scrape, p.fetchFromApi)
+}
+
+func (p *Python) scrape() {
 	p.getDoc()
 
 	if p.doc != nil {
@@ -92,11 +109,14 @@ func (p *Python) FetchAll() {
 }
 
 func (p *Python) Upload() {
-	if len(p.versions) > 0 {
-		fPath := filepath.Join(p.cnf.DirPath(), PythonVersionFileName)
-		if content, err := json.MarshalIndent(p.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			p.uploader.Upload(fPath)
-		}
-	}
+	p.versions = publishVersions(p.cnf, p.uploader, "python", PythonVersionFileName, p.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (p *Python) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, p.cnf, "python", p.FetchAll, &p.versions)
+}
+
+func (p *Python) VersionFileName() string {
+	return PythonVersionFileName
 }
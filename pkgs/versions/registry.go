@@ -0,0 +1,181 @@
+package versions
+
+import (
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+type Collector interface {
+	FetchAll()
+	Upload()
+}
+
+type collectorEntry struct {
+	name      string
+	defaultOn bool
+	newer     func(*confs.CollectorConf) Collector
+	rule      string // path of the rule file for declarative collectors.
+	plugin    string // path of the executable for plugins.
+}
+
+var collectors = []*collectorEntry{}
+
+/*
+Registers a version collector, collectors run in the order of registration.
+Collectors with defaultOn=false only run when enabled in the Collectors section of config.json.
+*/
+func Register(name string, defaultOn bool, newer func(*confs.CollectorConf) Collector) {
+	collectors = append(collectors, &collectorEntry{name: name, defaultOn: defaultOn, newer: newer})
+}
+
+func init() {
+	Register("github", true, func(c *confs.CollectorConf) Collector { return NewGithubRepo(c) })
+	Register("installers", true, func(c *confs.CollectorConf) Collector { return NewInstaller(c) })
+	Register("flutter", true, func(c *confs.CollectorConf) Collector { return NewFlutter(c) })
+	Register("golang", true, func(c *confs.CollectorConf) Collector { return NewGolang(c) })
+	Register("gradle", true, func(c *confs.CollectorConf) Collector { return NewGradle(c) })
+	Register("java", true, func(c *confs.CollectorConf) Collector { return NewAdoptiumJDK(c) }) // full list.
+	Register("jdk", false, func(c *confs.CollectorConf) Collector { return NewJDK(c) })
+	Register("julia", true, func(c *confs.CollectorConf) Collector { return NewJulia(c) })
+	Register("maven", true, func(c *confs.CollectorConf) Collector { return NewMaven(c) })
+	Register("nodejs", true, func(c *confs.CollectorConf) Collector { return NewNodejs(c) })
+	Register("php", false, func(c *confs.CollectorConf) Collector { return NewPhP(c) }) // see github.
+	Register("python", true, func(c *confs.CollectorConf) Collector { return NewPython(c) })
+	Register("zig", true, func(c *confs.CollectorConf) Collector { return NewZig(c) })
+	Register("kubectl", true, func(c *confs.CollectorConf) Collector { return NewKubectl(c) })
+	Register("dotnet", false, func(c *confs.CollectorConf) Collector { return NewDotNet(c) })
+	Register("scala", false, func(c *confs.CollectorConf) Collector { return NewScala(c) })
+}
+
+// Names of all registered collectors.
+func CollectorNames() (r []string) {
+	for _, e := range collectors {
+		r = append(r, e.name)
+	}
+	return
+}
+
+func findCollector(name string) *collectorEntry {
+	for _, e := range collectors {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Names of collectors enabled by config.
+func EnabledCollectors(cnf *confs.CollectorConf) (r []string) {
+	for _, name := range cnf.CollectorOptionNames() {
+		if findCollector(name) == nil {
+			logs.Warning("Unknown collector in config: %s", name)
+		}
+	}
+	for _, e := range collectors {
+		if cnf.CollectorOptions(e.name).IsEnabled(e.defaultOn) {
+			r = append(r, e.name)
+		}
+	}
+	return
+}
+
+func IsCollectorEnabled(cnf *confs.CollectorConf, name string) bool {
+	e := findCollector(name)
+	return e != nil && cnf.CollectorOptions(name).IsEnabled(e.defaultOn)
+}
+
+func NewCollector(name string, cnf *confs.CollectorConf) Collector {
+	if e := findCollector(name); e != nil {
+		return e.newer(cnf)
+	}
+	return nil
+}
+
+/*
+Applies collector options: channels, asset filters, depth policies and depth.
+Versions without any allowed asset are dropped.
+*/
+func FilterVersions(opts *confs.CollectorOptions, vs Versions) Versions {
+	if len(opts.Channels) == 0 && len(opts.AssetFilters) == 0 && opts.Depth <= 0 && !hasDepthPolicy(opts) {
+		return vs
+	}
+	r := Versions{}
+	for vName, files := range vs {
+		if !opts.AllowVersion(vName) {
+			continue
+		}
+		kept := VFileList{}
+		for _, f := range files {
+			if opts.AllowAsset(f.Url) {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) > 0 {
+			r[vName] = kept
+		}
+	}
+	r = applyDepthPolicies(opts, r)
+	if opts.Depth > 0 && len(r) > opts.Depth {
+		for _, vName := range r.Names()[opts.Depth:] {
+			delete(r, vName)
+		}
+	}
+	return r
+}
+
+func hasDepthPolicy(opts *confs.CollectorOptions) bool {
+	p := strings.ToLower(opts.Prereleases)
+	return opts.Majors > 0 || opts.Minors > 0 || opts.PatchesPerMinor > 0 || (p != "" && p != confs.PrereleasesAll)
+}
+
+// Keeps versions of the newest lines, and the newest versions of each line when perLine > 0.
+func keepLines(vs Versions, numbers, lines, perLine int) {
+	seen := map[string]int{}
+	for _, vName := range vs.Names() {
+		line := utils.VersionLine(vName, numbers)
+		if _, ok := seen[line]; !ok && lines > 0 && len(seen) >= lines {
+			delete(vs, vName)
+			continue
+		}
+		seen[line]++
+		if perLine > 0 && seen[line] > perLine {
+			delete(vs, vName)
+		}
+	}
+}
+
+/*
+Applies Prereleases, Majors, Minors and PatchesPerMinor in this order.
+Versions are ordered by utils.CompareVersion, a major line is the first number of a version,
+a minor line the first two numbers.
+*/
+func applyDepthPolicies(opts *confs.CollectorOptions, vs Versions) Versions {
+	switch strings.ToLower(opts.Prereleases) {
+	case confs.PrereleasesNone:
+		for vName := range vs {
+			if utils.IsPrerelease(vName) {
+				delete(vs, vName)
+			}
+		}
+	case confs.PrereleasesLatest:
+		latest := vs.Latest()
+		if latest == "" || utils.IsPrerelease(latest) {
+			break // no releases.
+		}
+		for vName := range vs {
+			if utils.IsPrerelease(vName) && utils.CompareVersion(vName, latest) < 0 {
+				delete(vs, vName)
+			}
+		}
+	}
+	if opts.Majors > 0 {
+		keepLines(vs, 1, opts.Majors, 0)
+	}
+	if opts.Minors > 0 || opts.PatchesPerMinor > 0 {
+		keepLines(vs, 2, opts.Minors, opts.PatchesPerMinor)
+	}
+	return vs
+}
@@ -0,0 +1,537 @@
+package versions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/rate"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Declarative collectors, defined by rule files in RulesDir,
+so that simple collectors can be added or fixed without touching Go code.
+
+Example rules/neovim.yaml:
+
+	name: neovim
+	url: https://github.com/neovim/neovim/releases/expanded_assets/stable
+	selector: a
+	include: [".tar.gz", ".zip"]
+	exclude: ["sha256sum"]
+	version: 'v(\d+\.\d+\.\d+)'
+	os: {macos: darwin, linux: linux, win64: windows}
+	arch: {x86_64: amd64, arm64: arm64}
+
+Json apis set format: json, items is a path to the files like "releases.*.files.*",
+"*" walks lists and maps. url_path, version_path and sum_path are paths in an item.
+*/
+type Rule struct {
+	Name    string `yaml:"name,omitempty"` // name of the rule file by default, the version file is <name>.version.json.
+	Enabled *bool  `yaml:"enabled,omitempty"`
+	Url     string `yaml:"url,omitempty"`
+	Format  string `yaml:"format,omitempty"` // "html" by default, or "json".
+	// html
+	Selector string `yaml:"selector,omitempty"` // css selector of links, "a" by default.
+	Attr     string `yaml:"attr,omitempty"`     // attribute of links, "href" by default.
+	BaseUrl  string `yaml:"base_url,omitempty"` // relative links are resolved against it, url by default.
+	// json
+	Items       string `yaml:"items,omitempty"` // "*" by default.
+	UrlPath     string `yaml:"url_path,omitempty"`
+	VersionPath string `yaml:"version_path,omitempty"`
+	SumPath     string `yaml:"sum_path,omitempty"`
+	// files
+	Version string            `yaml:"version,omitempty"` // regexp on links, the first group or the match is the version.
+	Include []string          `yaml:"include,omitempty"` // links must contain one of them.
+	Exclude []string          `yaml:"exclude,omitempty"`
+	Os      map[string]string `yaml:"os,omitempty"`       // part of link -> os, utils.ParsePlatform when nothing matches.
+	Arch    map[string]string `yaml:"arch,omitempty"`     // part of link -> arch, utils.ParseArch when nothing matches.
+	SumType string            `yaml:"sum_type,omitempty"` // detected from the sums when empty.
+	Extra   string            `yaml:"extra,omitempty"`
+	// checksum files for files without a sum, like "{url}.sha256" or "{dir}/checksums.txt", see sigUrl.
+	Sums       string `yaml:"sums,omitempty"`
+	SumsFormat string `yaml:"sums_format,omitempty"` // a registered parser, like "lines" or "json", any by default.
+
+	versionPattern *regexp.Regexp
+}
+
+const (
+	RuleFormatHtml    string = "html"
+	RuleFormatJson    string = "json"
+	RulesPollInterval        = 2 * time.Second
+)
+
+var ruleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func (r *Rule) validate() (err error) {
+	if !ruleNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("invalid name %q, use lowercase letters, digits, - and _", r.Name)
+	}
+	if u, err := url.Parse(r.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid url %q", r.Url)
+	}
+	r.Format = strings.ToLower(r.Format)
+	switch r.Format {
+	case "":
+		r.Format = RuleFormatHtml
+	case RuleFormatHtml:
+	case RuleFormatJson:
+		if r.UrlPath == "" {
+			return fmt.Errorf("url_path is required for json rules")
+		}
+	default:
+		return fmt.Errorf("unknown format %q", r.Format)
+	}
+	if r.SumsFormat != "" && !slices.Contains(utils.SumParsers(), r.SumsFormat) {
+		return fmt.Errorf("unknown sums_format %q, one of %s", r.SumsFormat, strings.Join(utils.SumParsers(), ", "))
+	}
+	r.versionPattern = VersionPattern
+	if r.Version != "" {
+		if r.versionPattern, err = regexp.Compile(r.Version); err != nil {
+			return fmt.Errorf("invalid version regexp: %w", err)
+		}
+	}
+	return nil
+}
+
+func isRuleFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// Rule files are yaml, json works as well.
+func loadRule(fPath string) (r *Rule, err error) {
+	content, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, err
+	}
+	r = &Rule{}
+	if err = yaml.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", fPath, err)
+	}
+	if r.Name == "" {
+		base := filepath.Base(fPath)
+		r.Name = strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+	if err = r.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fPath, err)
+	}
+	return
+}
+
+// Rule files in RulesDir with their mod times.
+func ruleFiles(cnf *confs.CollectorConf) (r map[string]time.Time) {
+	r = map[string]time.Time{}
+	entries, err := os.ReadDir(cnf.RulesPath())
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isRuleFile(e.Name()) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			r[filepath.Join(cnf.RulesPath(), e.Name())] = info.ModTime()
+		}
+	}
+	return
+}
+
+/*
+Registers collectors for rule files in RulesDir, replacing those of an earlier load.
+Invalid rules and rules named like built-in collectors are skipped with an error.
+*/
+func LoadRules(cnf *confs.CollectorConf) (names []string) {
+	kept := collectors[:0]
+	for _, e := range collectors {
+		if e.rule == "" {
+			kept = append(kept, e)
+		}
+	}
+	collectors = kept
+
+	files := ruleFiles(cnf)
+	paths := make([]string, 0, len(files))
+	for fPath := range files {
+		paths = append(paths, fPath)
+	}
+	sort.Strings(paths)
+	for _, fPath := range paths {
+		rule, err := loadRule(fPath)
+		if err != nil {
+			logs.Error("%+v", err)
+			continue
+		}
+		if e := findCollector(rule.Name); e != nil {
+			logs.Error("%s: collector %s already exists.", fPath, rule.Name)
+			continue
+		}
+		fPath, modTime := fPath, files[fPath]
+		Register(rule.Name, rule.Enabled == nil || *rule.Enabled, func(c *confs.CollectorConf) Collector {
+			return NewRuleCollector(c, fPath, rule, modTime)
+		})
+		collectors[len(collectors)-1].rule = fPath
+		names = append(names, rule.Name)
+	}
+	return
+}
+
+/*
+Polls RulesDir until the run is canceled, reloads rules when files change,
+and calls onChange with the names of added or changed rules.
+*/
+func WatchRules(cnf *confs.CollectorConf, onChange func(names []string)) {
+	last := ruleFiles(cnf)
+	for rate.SleepContext(cnf.Context(), RulesPollInterval) == nil {
+		files := ruleFiles(cnf)
+		changed := map[string]bool{}
+		for fPath, modTime := range files {
+			if t, ok := last[fPath]; !ok || !t.Equal(modTime) {
+				changed[fPath] = true
+			}
+		}
+		removed := false
+		for fPath := range last {
+			if _, ok := files[fPath]; !ok {
+				removed = true
+				logs.Info("Rule file %s is removed.", fPath)
+			}
+		}
+		last = files
+		if len(changed) == 0 && !removed {
+			continue
+		}
+		LoadRules(cnf)
+		names := []string{}
+		for _, e := range collectors {
+			if changed[e.rule] {
+				names = append(names, e.name)
+			}
+		}
+		onChange(names)
+	}
+}
+
+// Fetches rules without uploading, to try rule files.
+func TryRules(cnf *confs.CollectorConf, names []string) {
+	for _, name := range names {
+		c, ok := NewCollector(name, cnf).(*RuleCollector)
+		if !ok {
+			continue
+		}
+		c.FetchAll()
+		vNames := c.versions.Names()
+		files := 0
+		for _, vName := range vNames {
+			files += len(c.versions[vName])
+		}
+		if len(vNames) > 5 {
+			vNames = vNames[:5]
+		}
+		logs.For(name).Info("%d versions, %d files, newest: %s", len(c.versions), files, strings.Join(vNames, ", "))
+	}
+}
+
+/*
+Collector of a rule file.
+The rule file is read again before fetching when it has changed since it was loaded.
+*/
+type RuleCollector struct {
+	cnf      *confs.CollectorConf
+	uploader *upload.Uploader
+	versions Versions
+	fetcher  *request.Fetcher
+	rulePath string
+	rule     *Rule
+	modTime  time.Time
+	urls     map[string]struct{}
+}
+
+func NewRuleCollector(cnf *confs.CollectorConf, rulePath string, rule *Rule, modTime time.Time) (c *RuleCollector) {
+	c = &RuleCollector{
+		cnf:      cnf,
+		uploader: upload.NewUploader(cnf),
+		versions: Versions{},
+		fetcher:  request.NewFetcher(),
+		rulePath: rulePath,
+		rule:     rule,
+		modTime:  modTime,
+		urls:     map[string]struct{}{},
+	}
+	if confs.EnableProxyOrNot() {
+		c.fetcher.Proxy = c.cnf.Proxy()
+	}
+	return
+}
+
+// Reloads a changed rule file, the loaded rule is kept when the new one is invalid.
+func (c *RuleCollector) reload() {
+	info, err := os.Stat(c.rulePath)
+	if err != nil || info.ModTime().Equal(c.modTime) {
+		return
+	}
+	rule, err := loadRule(c.rulePath)
+	if err != nil {
+		logs.Error("%+v, the loaded rule is used.", err)
+		return
+	}
+	if rule.Name != c.rule.Name {
+		logs.Warning("%s: name %s takes effect on the next run.", c.rulePath, rule.Name)
+		rule.Name = c.rule.Name
+	}
+	c.rule, c.modTime = rule, info.ModTime()
+}
+
+func (c *RuleCollector) FetchAll() {
+	c.reload()
+	c.fetcher.SetUrl(c.rule.Url)
+	c.fetcher.Timeout = 60 * time.Second
+	content, code := fetch.GetString(c.cnf, c.fetcher)
+	if code != 200 {
+		logs.For(c.rule.Name).Error("Fetch %s failed, status code: %d", c.rule.Url, code)
+		return
+	}
+	if c.rule.Format == RuleFormatJson {
+		c.parseJson(content)
+	} else {
+		c.parseHtml(content)
+	}
+	c.fillSums()
+}
+
+// Reads sums of files without one from the checksum files of Sums, each checksum file is fetched once.
+func (c *RuleCollector) fillSums() {
+	if c.rule.Sums == "" {
+		return
+	}
+	contents := map[string]string{}
+	for vName, files := range c.versions {
+		for _, f := range files {
+			if f.Sum != "" || c.cnf.Canceled() {
+				continue
+			}
+			sumsUrl := sigUrl(c.rule.Sums, f, vName, "")
+			content, ok := contents[sumsUrl]
+			if !ok {
+				fetcher := fetch.Clone(c.fetcher)
+				fetcher.SetUrl(sumsUrl)
+				if r, code := fetch.GetString(c.cnf, fetcher); code == 200 {
+					content = r
+				} else {
+					logs.For(c.rule.Name).Warning("Fetch %s failed, status code: %d", sumsUrl, code)
+				}
+				contents[sumsUrl] = content
+			}
+			if sum, _ := utils.SumOf(utils.ParseSums(content, c.rule.SumsFormat), f.Url); sum != "" {
+				f.Sum, f.SumType = sum, sumTypeOr(c.rule.SumType, sum)
+			}
+		}
+	}
+}
+
+func (c *RuleCollector) parseHtml(content string) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		logs.Error("Parse page errored: %+v", err)
+		return
+	}
+	selector, attr := c.rule.Selector, c.rule.Attr
+	if selector == "" {
+		selector = "a"
+	}
+	if attr == "" {
+		attr = "href"
+	}
+	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		link := s.AttrOr(attr, "")
+		vName := c.findVersion(link)
+		if vName == "" {
+			vName = c.findVersion(strings.TrimSpace(s.Text()))
+		}
+		c.addFile(link, vName, "")
+	})
+}
+
+func (c *RuleCollector) parseJson(content string) {
+	var data any
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		logs.Error("Parse json errored: %+v", err)
+		return
+	}
+	items := c.rule.Items
+	if items == "" {
+		items = "*"
+	}
+	for _, item := range jsonPath(data, items) {
+		link := jsonString(item, c.rule.UrlPath)
+		vName := c.findVersion(link)
+		if c.rule.VersionPath != "" {
+			vName = jsonString(item, c.rule.VersionPath)
+		}
+		sum := ""
+		if c.rule.SumPath != "" {
+			sum = jsonString(item, c.rule.SumPath)
+		}
+		c.addFile(link, vName, sum)
+	}
+}
+
+func (c *RuleCollector) findVersion(s string) string {
+	m := c.rule.versionPattern.FindStringSubmatch(s)
+	switch {
+	case len(m) > 1:
+		return m[1]
+	case len(m) == 1:
+		return m[0]
+	default:
+		return ""
+	}
+}
+
+// Matches keys of m in s, longer keys first, parse is used when nothing matches.
+func mapByPart(m map[string]string, s string, parse func(string) string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	lower := strings.ToLower(s)
+	for _, k := range keys {
+		if strings.Contains(lower, strings.ToLower(k)) {
+			return m[k]
+		}
+	}
+	return parse(s)
+}
+
+func (c *RuleCollector) addFile(link, vName, sum string) {
+	if link == "" || vName == "" {
+		return
+	}
+	if len(c.rule.Include) > 0 && !containsAny(link, c.rule.Include) {
+		return
+	}
+	if containsAny(link, c.rule.Exclude) {
+		return
+	}
+	base := c.rule.BaseUrl
+	if base == "" {
+		base = c.rule.Url
+	}
+	if b, err := url.Parse(base); err == nil {
+		if u, err := b.Parse(link); err == nil {
+			link = u.String()
+		}
+	}
+	if _, ok := c.urls[link]; ok {
+		return
+	}
+	c.urls[link] = struct{}{}
+	fName := link
+	if u, err := url.Parse(link); err == nil {
+		fName = filepath.Base(u.Path)
+	}
+	c.versions[vName] = append(c.versions[vName], &VFile{
+		Url:     link,
+		Arch:    mapByPart(c.rule.Arch, fName, utils.ParseArch),
+		Os:      mapByPart(c.rule.Os, fName, utils.ParsePlatform),
+		Sum:     sum,
+		SumType: sumTypeOr(c.rule.SumType, sum),
+		Extra:   c.rule.Extra,
+	})
+}
+
+func (c *RuleCollector) Upload() {
+	c.versions = publishVersions(c.cnf, c.uploader, c.rule.Name, c.rule.Name+".version.json", c.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (c *RuleCollector) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, c.cnf, c.rule.Name, c.FetchAll, &c.versions)
+}
+
+func (c *RuleCollector) VersionFileName() string {
+	return c.rule.Name + VersionFileSuffix
+}
+
+func containsAny(s string, parts []string) bool {
+	for _, p := range parts {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values at a dotted path, "*" walks all items of a list or a map.
+func jsonPath(v any, path string) (r []any) {
+	if path == "" {
+		return []any{v}
+	}
+	key, rest, _ := strings.Cut(path, ".")
+	next := []any{}
+	switch vv := v.(type) {
+	case map[string]any:
+		if key == "*" {
+			for _, k := range sortedKeys(vv) {
+				next = append(next, vv[k])
+			}
+		} else if x, ok := vv[key]; ok {
+			next = append(next, x)
+		}
+	case []any:
+		if key == "*" {
+			next = vv
+		} else if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(vv) {
+			next = append(next, vv[i])
+		}
+	}
+	for _, x := range next {
+		r = append(r, jsonPath(x, rest)...)
+	}
+	return
+}
+
+func sortedKeys(m map[string]any) (r []string) {
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return
+}
+
+func jsonString(v any, path string) string {
+	if vs := jsonPath(v, path); len(vs) > 0 && vs[0] != nil {
+		return gconv.String(vs[0])
+	}
+	return ""
+}
+
+func sumTypeOr(sumType, sum string) string {
+	if sumType != "" || sum == "" {
+		return sumType
+	}
+	return utils.SumTypeOf(sum)
+}
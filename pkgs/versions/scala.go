@@ -1,17 +1,16 @@
 package versions
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
+	"context"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/request"
 )
 
@@ -19,6 +18,9 @@ const (
 	ScalaVersionFileName string = "scala.version.json"
 )
 
+// Releases api fallback.
+var ScalaRepos = []string{"scala/scala3", "scala/scala"}
+
 /*
 Scala versions.
 
@@ -42,11 +44,7 @@ func NewScala(cnf *confs.CollectorConf) (s *Scala) {
 		homepage: "https://www.scala-lang.org/download/all.html",
 	}
 	if confs.EnableProxyOrNot() {
-		pxy := s.cnf.ProxyURI
-		if pxy == "" {
-			pxy = confs.DefaultProxy
-		}
-		s.fetcher.Proxy = pxy
+		s.fetcher.Proxy = s.cnf.Proxy()
 	}
 	return
 }
@@ -54,23 +52,44 @@ func NewScala(cnf *confs.CollectorConf) (s *Scala) {
 func (s *Scala) getDoc() {
 	s.fetcher.SetUrl(s.homepage)
 	s.fetcher.Timeout = 180 * time.Second
-	if resp, sCode := s.fetcher.GetString(); resp != "" && sCode == 200 {
+	if resp, sCode := fetch.GetString(s.cnf, s.fetcher); resp != "" && sCode == 200 {
 		// fmt.Println(resp)
 		var err error
 		s.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if s.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", s.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", s.fetcher.Url)
+			return
 		}
 	} else {
-		fmt.Printf("Failed: %s, code: %d", s.homepage, sCode)
+		logs.Error("Failed: %s, code: %d", s.homepage, sCode)
+	}
+}
+
+// Releases of scala 3 and scala 2 from the github api.
+func (s *Scala) fetchFromApi() {
+	for _, repo := range ScalaRepos {
+		for _, item := range githubReleaseItems(s.cnf, s.fetcher, repo) {
+			vName := strings.TrimPrefix(item.TagName, "v")
+			if gconv.Bool(item.PreRelease) || vName == "" {
+				continue
+			}
+			s.versions[vName] = []*VFile{
+				{
+					Extra: "please use coursier to install.",
+				},
+			}
+		}
 	}
 }
 
 func (s *Scala) FetchAll() {
+	withApiFallback(s.cnf, "scala", func() int { return len(s.versions) }, s.scrape, s.fetchFromApi)
+}
+
+func (s *Scala) scrape() {
 	s.getDoc()
 	if s.doc != nil {
 		s.doc.Find("div.download-elem").Find("a").Each(func(_ int, ss *goquery.Selection) {
@@ -88,11 +107,14 @@ func (s *Scala) FetchAll() {
 }
 
 func (s *Scala) Upload() {
-	if len(s.versions) > 0 {
-		fPath := filepath.Join(s.cnf.DirPath(), ScalaVersionFileName)
-		if content, err := json.MarshalIndent(s.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			s.uploader.Upload(fPath)
-		}
-	}
+	s.versions = publishVersions(s.cnf, s.uploader, "scala", ScalaVersionFileName, s.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (s *Scala) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, s.cnf, "scala", s.FetchAll, &s.versions)
+}
+
+func (s *Scala) VersionFileName() string {
+	return ScalaVersionFileName
 }
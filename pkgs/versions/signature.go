@@ -0,0 +1,225 @@
+package versions
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/signature"
+	"github.com/gvcgo/collector/pkgs/trace"
+	"github.com/gvcgo/collector/pkgs/utils"
+)
+
+/*
+Signature checks by the pinned keys of Signatures in config, before checksums are checked:
+
+ 1. with Sums, the checksum file of each version is verified, sums of files are taken from it, sums disagreeing
+    with it are replaced;
+ 2. otherwise up to ChecksumSample artifacts(1 by default) are verified themselves, their sums are checked on the way.
+
+Files with a broken signature lose their sums, they are not trusted. SigVerified is kept across runs
+by MergeVersions while the sum stays the same, so verified files are skipped.
+*/
+
+// Signatures, certificates and checksum files larger than it are refused.
+const SigMaxSize int64 = 1 << 20
+
+var sigSuffixes = map[string]string{
+	signature.TypeGpg:      ".asc",
+	signature.TypeMinisign: ".minisig",
+	signature.TypeCosign:   ".sig",
+}
+
+// Expands {url}, {dir}, {name}, {version} and {sums} in a url of SignatureConf.
+func sigUrl(pattern string, f *VFile, vName, sums string) string {
+	dir, name := f.Url, f.Url
+	if i := strings.LastIndex(f.Url, "/"); i >= 0 {
+		dir, name = f.Url[:i], f.Url[i+1:]
+	}
+	return strings.NewReplacer(
+		"{url}", f.Url,
+		"{dir}", dir,
+		"{name}", name,
+		"{version}", strings.TrimPrefix(vName, "v"),
+		"{sums}", sums,
+	).Replace(pattern)
+}
+
+func fetchSmall(cnf *confs.CollectorConf, rawUrl string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if _, err := fetch.Stream(cnf, rawUrl, buf, SigMaxSize); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Signature and certificate of a signed url.
+func fetchSig(cnf *confs.CollectorConf, s *confs.SignatureConf, f *VFile, vName, signed string) (sig, cert []byte, err error) {
+	pattern := s.Sig
+	if pattern == "" {
+		pattern = signed + sigSuffixes[s.Type]
+	}
+	if sig, err = fetchSmall(cnf, sigUrl(pattern, f, vName, signed)); err != nil {
+		return
+	}
+	if s.Cert != "" {
+		cert, err = fetchSmall(cnf, sigUrl(s.Cert, f, vName, signed))
+	}
+	return
+}
+
+func checkSignatures(cnf *confs.CollectorConf, collector, fileName string, vs Versions) {
+	s := cnf.SignatureOf(collector, fileName)
+	if s == nil {
+		return
+	}
+	key, err := signature.LoadKey(s.Type, cnf.SignatureKeyPath(s))
+	if err != nil {
+		logs.For(collector).Error("Load signature key %s failed: %+v", s.Key, err)
+		return
+	}
+	_, span := trace.Start(cnf.Context(), "signatures", "collector", collector)
+	defer span.End()
+	var verified, broken int
+	if s.Sums != "" {
+		verified, broken = verifySums(cnf, collector, s, key, vs)
+	} else {
+		verified, broken = verifyArtifacts(cnf, collector, s, key, vs)
+	}
+	if verified+broken > 0 {
+		logs.For(collector).Info("Signatures: %d verified, %d broken.", verified, broken)
+		span.Set("verified", verified, "broken", broken)
+	}
+}
+
+type signedSums struct {
+	content string
+	err     error
+}
+
+func verifySums(cnf *confs.CollectorConf, collector string, s *confs.SignatureConf, key *signature.Key, vs Versions) (verified, broken int) {
+	checked := map[string]*signedSums{}
+	for vName, files := range vs {
+		for _, f := range files {
+			if f == nil || f.Url == "" || f.SigVerified || cnf.Canceled() {
+				continue
+			}
+			sumsUrl := sigUrl(s.Sums, f, vName, "")
+			sums, ok := checked[sumsUrl]
+			if !ok {
+				sums = &signedSums{}
+				checked[sumsUrl] = sums
+				content, err := fetchSmall(cnf, sumsUrl)
+				if err == nil {
+					var sig, cert []byte
+					if sig, cert, err = fetchSig(cnf, s, f, vName, sumsUrl); err == nil {
+						err = key.Verify(bytes.NewReader(content), sig, cert, s.Identity)
+					}
+				}
+				sums.content, sums.err = string(content), err
+				switch {
+				case errors.Is(err, signature.ErrInvalid):
+					logs.For(collector).Error("Signature of %s is broken: %+v", sumsUrl, err)
+				case err != nil:
+					logs.For(collector).Warning("Verify signature of %s failed: %+v", sumsUrl, err)
+				}
+			}
+			if errors.Is(sums.err, signature.ErrInvalid) {
+				f.Sum, f.SumType, f.SumStatus = "", "", ""
+				broken++
+				continue
+			}
+			if sums.err != nil {
+				continue
+			}
+			sum, sumType := utils.FindSum(sums.content, f.Url)
+			if sum == "" {
+				continue
+			}
+			if f.Sum != "" && !strings.EqualFold(f.Sum, sum) {
+				logs.For(collector).Warning("Sum of %s differs from the signed %s, replaced.", f.Url, sumsUrl)
+				f.SumStatus = ""
+			}
+			f.Sum, f.SumType, f.SigVerified = sum, sumType, true
+			verified++
+		}
+	}
+	return
+}
+
+func verifyArtifacts(cnf *confs.CollectorConf, collector string, s *confs.SignatureConf, key *signature.Key, vs Versions) (verified, broken int) {
+	type candidate struct {
+		vName string
+		f     *VFile
+	}
+	var candidates []*candidate
+	for vName, files := range vs {
+		for _, f := range files {
+			if f != nil && f.Url != "" && !f.SigVerified {
+				candidates = append(candidates, &candidate{vName: vName, f: f})
+			}
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	sample := cnf.ChecksumSample
+	if sample <= 0 {
+		sample = 1
+	}
+	maxSize := cnf.ChecksumMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultChecksumMaxSize
+	}
+	for i := 0; i < len(candidates) && i < sample && !cnf.Canceled(); i++ {
+		f, vName := candidates[i].f, candidates[i].vName
+		sig, cert, err := fetchSig(cnf, s, f, vName, f.Url)
+		if err != nil {
+			logs.For(collector).Warning("Fetch signature of %s failed: %+v", f.Url, err)
+			continue
+		}
+		// the artifact is streamed into the verifier and hashed on the way, it is never saved.
+		h := newHash(f.SumType)
+		pr, pw := io.Pipe()
+		streamed := make(chan error, 1)
+		go func() {
+			var w io.Writer = pw
+			if h != nil {
+				w = io.MultiWriter(pw, h)
+			}
+			_, err := fetch.Stream(cnf, f.Url, w, maxSize)
+			pw.CloseWithError(err)
+			streamed <- err
+		}()
+		err = key.Verify(pr, sig, cert, s.Identity)
+		pr.Close()
+		// a closed pipe means the verifier stopped early, by a broken signature.
+		if sErr := <-streamed; sErr != nil && !errors.Is(sErr, io.ErrClosedPipe) {
+			logs.For(collector).Warning("Verify signature of %s failed: %+v", f.Url, sErr)
+			continue
+		}
+		if err != nil {
+			logs.For(collector).Error("Signature of %s is broken: %+v", f.Url, err)
+			f.Sum, f.SumType, f.SumStatus = "", "", ""
+			broken++
+			continue
+		}
+		f.SigVerified = true
+		verified++
+		if h != nil && f.Sum != "" {
+			// the hash is of the artifact whose signature was just verified, it wins over the published sum.
+			if sum := hex.EncodeToString(h.Sum(nil)); strings.EqualFold(sum, f.Sum) {
+				f.SumStatus = SumVerified
+			} else {
+				logs.For(collector).Error("Checksum mismatch: %s, published %s %s, replaced by the sum of the signed artifact.", f.Url, f.SumType, f.Sum)
+				f.Sum, f.SumStatus = sum, SumComputed
+			}
+		}
+	}
+	return
+}
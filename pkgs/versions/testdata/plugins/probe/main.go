@@ -0,0 +1,62 @@
+// A wasm plugin for TestWasmPlugin, it probes what the sandbox lets through:
+// GOOS=wasip1 GOARCH=wasm go build -o probe.wasm main.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	responses = bufio.NewScanner(os.Stdin)
+	id        = 0
+)
+
+func call(method string, params any) (result map[string]any, errMsg string) {
+	id++
+	content, _ := json.Marshal(map[string]any{"id": id, "method": method, "params": params})
+	fmt.Println(string(content))
+	if !responses.Scan() {
+		os.Exit(2)
+	}
+	resp := struct {
+		Result map[string]any `json:"result"`
+		Error  string         `json:"error"`
+	}{}
+	json.Unmarshal(responses.Bytes(), &resp)
+	return resp.Result, resp.Error
+}
+
+func main() {
+	if _, errMsg := call("hello", map[string]any{"api_version": 1}); errMsg != "" {
+		os.Exit(1)
+	}
+	// every probe should be denied.
+	var probes []string
+	for _, u := range []string{"http://127.0.0.1:1/", "http://169.254.169.254/latest/meta-data/", "file:///etc/passwd"} {
+		if _, errMsg := call("fetch", map[string]any{"url": u}); errMsg != "" {
+			probes = append(probes, "denied")
+		} else {
+			probes = append(probes, "fetched "+u)
+		}
+	}
+	if _, err := os.ReadFile("/etc/passwd"); err != nil {
+		probes = append(probes, "denied")
+	} else {
+		probes = append(probes, "read /etc/passwd")
+	}
+	file := map[string]any{
+		"url":          "https://example.com/probe-1.0.0-linux-amd64.tar.gz",
+		"os":           "linux",
+		"arch":         "amd64",
+		"extra":        strings.Join(probes, ","),
+		"sig_verified": true,
+		"sum_status":   "verified",
+	}
+	if _, errMsg := call("add", map[string]any{"version": "1.0.0", "files": []any{file}}); errMsg != "" {
+		os.Exit(1)
+	}
+}
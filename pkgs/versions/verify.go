@@ -0,0 +1,146 @@
+package versions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
+	"github.com/gvcgo/collector/pkgs/upload"
+)
+
+/*
+Verification of a published repo, for maintainers and for users debugging failed installs of gvc.
+
+Version files listed in the published manifest are fetched from the storage(the work dir without one),
+every version is checked against upload.VersionFileSchema, and HEAD requests are sent to up to sample
+randomly picked urls. Only broken things are reported: invalid files, invalid versions, and urls
+that answer errors. Urls that can not be reached are reported too, they may work from elsewhere.
+*/
+
+type Broken struct {
+	File    string `json:"file"`
+	Version string `json:"version,omitempty"`
+	Url     string `json:"url,omitempty"`
+	Problem string `json:"problem"`
+}
+
+type VerifyReport struct {
+	Files    int       `json:"files"`
+	Versions int       `json:"versions"`
+	Checked  int       `json:"checked"` // urls sent HEAD requests.
+	Broken   []*Broken `json:"broken"`
+}
+
+// Version files to verify, from the published manifest, or from the work dir.
+func publishedVersionFiles(cnf *confs.CollectorConf, up *upload.Uploader) (r []string) {
+	if content, err := up.Published(cnf.ManifestPath()); err == nil {
+		m := &upload.Manifest{}
+		if err := json.Unmarshal(content, m); err == nil {
+			for name := range m.Files {
+				if strings.HasSuffix(name, VersionFileSuffix) {
+					r = append(r, name)
+				}
+			}
+		}
+	}
+	if len(r) == 0 {
+		matches, _ := filepath.Glob(filepath.Join(cnf.DirPath(), "*"+VersionFileSuffix))
+		for _, fPath := range matches {
+			r = append(r, filepath.Base(fPath))
+		}
+	}
+	sort.Strings(r)
+	return
+}
+
+// Verifies published version files, all files when names are empty, like "go" or "nodejs.version.json".
+func Verify(cnf *confs.CollectorConf, names []string, sample int) *VerifyReport {
+	up := upload.NewUploader(cnf)
+	report := &VerifyReport{Broken: []*Broken{}}
+	files := publishedVersionFiles(cnf, up)
+	if len(names) > 0 {
+		files = nil
+		for _, name := range names {
+			fileName, err := resolveVersionFile(cnf, strings.TrimSuffix(name, VersionFileSuffix))
+			if err != nil {
+				report.Broken = append(report.Broken, &Broken{File: name, Problem: err.Error()})
+				continue
+			}
+			files = append(files, fileName)
+		}
+	}
+	type target struct {
+		file, vName, url string
+	}
+	targets := []*target{}
+	for _, fileName := range files {
+		content, err := up.Published(filepath.Join(cnf.DirPath(), fileName))
+		if err != nil {
+			report.Broken = append(report.Broken, &Broken{File: fileName, Problem: err.Error()})
+			continue
+		}
+		report.Files++
+		var raw map[string]any
+		if err := json.Unmarshal(content, &raw); err != nil {
+			report.Broken = append(report.Broken, &Broken{File: fileName, Problem: fmt.Sprintf("invalid json: %v", err)})
+			continue
+		}
+		if latest, ok := raw[upload.VersionLatestKey].(string); ok {
+			if _, found := raw[latest]; !found {
+				report.Broken = append(report.Broken, &Broken{File: fileName, Problem: fmt.Sprintf("latest %s is not a version", latest)})
+			}
+		}
+		for vName, v := range raw {
+			if _, ok := v.(string); ok && vName == upload.VersionLatestKey {
+				continue
+			}
+			report.Versions++
+			if err := upload.VersionFileSchema.AdditionalProperties.Validate(v, "$."+vName); err != nil {
+				report.Broken = append(report.Broken, &Broken{File: fileName, Version: vName, Problem: err.Error()})
+				continue
+			}
+			for _, item := range v.([]any) {
+				u, _ := item.(map[string]any)["url"].(string)
+				if u == "" {
+					u, _ = item.(map[string]any)["Url"].(string)
+				}
+				if strings.HasPrefix(u, "http") {
+					targets = append(targets, &target{file: fileName, vName: vName, url: u})
+				}
+			}
+		}
+	}
+
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	for i := 0; i < len(targets) && i < sample && !cnf.Canceled(); i++ {
+		t := targets[i]
+		report.Checked++
+		code, _, err := fetch.Head(cnf, t.url)
+		switch {
+		case err != nil:
+			report.Broken = append(report.Broken, &Broken{File: t.file, Version: t.vName, Url: t.url, Problem: fmt.Sprintf("unreachable: %v", err)})
+		case code >= 400:
+			problem := fmt.Sprintf("http %d", code)
+			if isDeadCode(code) {
+				problem += ", dead link"
+			}
+			report.Broken = append(report.Broken, &Broken{File: t.file, Version: t.vName, Url: t.url, Problem: problem})
+		default:
+			logs.Debug("%s: %d", t.url, code)
+		}
+	}
+	sort.SliceStable(report.Broken, func(i, j int) bool {
+		a, b := report.Broken[i], report.Broken[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Version < b.Version
+	})
+	return report
+}
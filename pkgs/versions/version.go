@@ -4,10 +4,19 @@ package versions
 collect version info for apps.
 */
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/collector/pkgs/upload"
+	"github.com/gvcgo/collector/pkgs/utils"
 )
 
 const (
@@ -31,18 +40,211 @@ func UseCNSource() bool {
 	return gconv.Bool(os.Getenv(UseCNSourceEnv))
 }
 
+/*
+A downloadable file of a version. Json keys were the Go field names before, "Url", "SumType" and so on,
+as the old tags like `json,koanf:"url"` were ignored by encoding/json. Both the new and the old keys are
+written for one release cycle so that gvc clients reading the old keys keep working, see MarshalJSON.
+*/
 type VFile struct {
-	Url     string `json,koanf:"url"`
-	Arch    string `json,koanf:"arch"`
-	Os      string `json,koanf:"os"`
-	Sum     string `json,koanf:"sum"`
-	SumType string `json,koanf:"sum_type"`
-	Extra   string `json,koanf:"extra"`
+	Url     string `json:"url" koanf:"url"`
+	Arch    string `json:"arch" koanf:"arch"`
+	Os      string `json:"os" koanf:"os"`
+	Sum     string `json:"sum" koanf:"sum"`
+	SumType string `json:"sum_type" koanf:"sum_type"`
+	Extra   string `json:"extra" koanf:"extra"`
+	// Build variant for the same os and arch, like "musl" or "msvc", see utils.ParseVariant.
+	Variant string `json:"variant" koanf:"variant"`
+	// "computed", "verified" or "mismatch" after a checksum check, see checksum.go.
+	SumStatus string `json:"sum_status" koanf:"sum_status"`
+	// The sum or the artifact is signed by a pinned key of the upstream, see signature.go.
+	SigVerified bool `json:"sig_verified" koanf:"sig_verified"`
+	// From HEAD requests, see head.go.
+	Size         int64  `json:"size" koanf:"size"` // Content-Length in bytes, 0 when unknown.
+	LastModified string `json:"last_modified" koanf:"last_modified"`
+	// Dates like "2024-02-06" where the upstream publishes them, see dates.go. EolAt may be in the future.
+	ReleasedAt string `json:"released_at,omitempty" koanf:"released_at"`
+	EolAt      string `json:"eol_at,omitempty" koanf:"eol_at"`
+}
+
+// VFile without methods, for MarshalJSON and UnmarshalJSON.
+type vFile VFile
+
+// The old keys of VFile, dropped in the next release. Fields added since have the new keys only.
+type legacyVFile struct {
+	Url     string
+	Arch    string
+	Os      string
+	Sum     string
+	SumType string
+	Extra   string
+}
+
+func (v VFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*vFile
+		*legacyVFile
+	}{vFile: (*vFile)(&v), legacyVFile: &legacyVFile{
+		Url:     v.Url,
+		Arch:    v.Arch,
+		Os:      v.Os,
+		Sum:     v.Sum,
+		SumType: v.SumType,
+		Extra:   v.Extra,
+	}})
+}
+
+/*
+Reads the new keys and the old ones, published files and snapshots of older releases only have the old keys.
+Keys are matched case insensitively, so only keys differing by more than case are looked up again.
+*/
+func (v *VFile) UnmarshalJSON(content []byte) error {
+	if err := json.Unmarshal(content, (*vFile)(v)); err != nil {
+		return err
+	}
+	legacy := &legacyVFile{}
+	if err := json.Unmarshal(content, legacy); err != nil {
+		return err
+	}
+	if v.SumType == "" {
+		v.SumType = legacy.SumType
+	}
+	return nil
+}
+
+/*
+Normalizes the url by utils.NormalizeUrl, lower cases Os, Arch, SumType and Variant, see upload.VersionFileSchema.
+SumType is detected from the sum when collectors did not set it, see utils.SumTypeOf.
+Variant is parsed from the file name in the url when collectors did not set it, hosts like static.rust-lang.org and dirs like /static/ are left out.
+LastModified becomes an RFC3339 timestamp in UTC, ReleasedAt and EolAt dates in UTC, see utils.ParseTime.
+*/
+func (v *VFile) Normalize() {
+	v.Url = utils.NormalizeUrl(v.Url, "")
+	v.Os = strings.ToLower(strings.TrimSpace(v.Os))
+	v.Arch = strings.ToLower(strings.TrimSpace(v.Arch))
+	v.SumType = strings.ToLower(strings.TrimSpace(v.SumType))
+	if v.Sum = strings.TrimSpace(v.Sum); v.SumType == "" && v.Sum != "" {
+		v.SumType = utils.SumTypeOf(v.Sum)
+	}
+	// files published before carry Last-Modified headers as they were sent.
+	if t := utils.Timestamp(v.LastModified); t != "" {
+		v.LastModified = t
+	}
+	v.ReleasedAt, v.EolAt = utils.Date(v.ReleasedAt), utils.Date(v.EolAt)
+	v.Variant = strings.ToLower(strings.TrimSpace(v.Variant))
+	if v.Variant == "" && v.Url != "" {
+		if u, err := url.Parse(v.Url); err == nil {
+			v.Variant = utils.ParseVariant(path.Base(u.Path), v.Os)
+		}
+	}
 }
 
 type VFileList []*VFile
 
+// Upgrades http urls to https for hosts that serve other files of vs over https.
+func (vs Versions) upgradeHttps() {
+	httpsHosts := map[string]bool{}
+	for _, files := range vs {
+		for _, f := range files {
+			if f == nil {
+				continue
+			}
+			if u, err := url.Parse(f.Url); err == nil && u.Scheme == "https" {
+				httpsHosts[strings.ToLower(u.Host)] = true
+			}
+		}
+	}
+	for _, files := range vs {
+		for _, f := range files {
+			if f != nil {
+				f.Url = utils.UpgradeHttps(f.Url, httpsHosts)
+			}
+		}
+	}
+}
+
 type Versions map[string]VFileList
 
+// Version names, newest first.
+func (vs Versions) Names() []string {
+	names := make([]string, 0, len(vs))
+	for vName := range vs {
+		names = append(names, vName)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return utils.CompareVersion(names[i], names[j]) > 0
+	})
+	return names
+}
+
+// The newest release, or the newest pre-release when there are no releases.
+func (vs Versions) Latest() string {
+	names := vs.Names()
+	for _, vName := range names {
+		if !utils.IsPrerelease(vName) {
+			return vName
+		}
+	}
+	if len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// Writes versions newest first instead of alphabetically.
+func (vs Versions) MarshalJSON() ([]byte, error) {
+	return vs.marshal("")
+}
+
+/*
+With a "latest" pointer first when latest is not empty.
+Some files have a version named "latest"(installers, msys2, rustup), the pointer is left out of them.
+*/
+func (vs Versions) marshal(latest string) ([]byte, error) {
+	if _, ok := vs[upload.VersionLatestKey]; ok {
+		latest = ""
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	if latest != "" {
+		fmt.Fprintf(buf, "%q:%q", upload.VersionLatestKey, latest)
+	}
+	for i, vName := range vs.Names() {
+		if i > 0 || latest != "" {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(vName)
+		files, err := json.Marshal(vs[vName])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(files)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Skips the "latest" pointer.
+func (vs *Versions) UnmarshalJSON(content []byte) error {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return err
+	}
+	r := Versions{}
+	for vName, value := range raw {
+		if vName == upload.VersionLatestKey && bytes.HasPrefix(bytes.TrimSpace(value), []byte(`"`)) {
+			continue
+		}
+		files := VFileList{}
+		if err := json.Unmarshal(value, &files); err != nil {
+			return err
+		}
+		r[vName] = files
+	}
+	*vs = r
+	return nil
+}
+
 type IFetcher interface {
 }
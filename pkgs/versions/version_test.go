@@ -0,0 +1,106 @@
+package versions
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Only the six original fields are written with their old keys as well.
+func TestVFileMarshalJSON(t *testing.T) {
+	v := VFile{
+		Url: "https://example.com/tool.tar.gz", Arch: "amd64", Os: "linux", Sum: "abc", SumType: "sha256",
+		Extra: "x", Variant: "musl", SumStatus: "verified", SigVerified: true, Size: 1, LastModified: "2024-01-01T00:00:00Z",
+	}
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]any{}
+	if err = json.Unmarshal(content, &keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		"url", "arch", "os", "sum", "sum_type", "extra", "variant", "sum_status", "sig_verified", "size", "last_modified",
+		"Url", "Arch", "Os", "Sum", "SumType", "Extra",
+	} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("key %q missing", key)
+		}
+	}
+	for _, key := range []string{"Variant", "SumStatus", "SigVerified", "Size", "LastModified", "ReleasedAt", "EolAt"} {
+		if _, ok := keys[key]; ok {
+			t.Errorf("old key %q written", key)
+		}
+	}
+	got := VFile{}
+	if err = json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != v {
+		t.Errorf("round trip = %+v, want %+v", got, v)
+	}
+}
+
+func TestVFileUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    VFile
+	}{
+		{"new keys", `{"url": "u", "sum_type": "sha1", "sum_status": "computed"}`, VFile{Url: "u", SumType: "sha1", SumStatus: "computed"}},
+		{"old keys", `{"Url": "u", "Os": "linux", "SumType": "md5"}`, VFile{Url: "u", Os: "linux", SumType: "md5"}},
+		{"new keys first", `{"sum_type": "sha256", "SumType": "md5"}`, VFile{SumType: "sha256"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VFile{}
+			if err := json.Unmarshal([]byte(tt.content), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionsMarshal(t *testing.T) {
+	files := VFileList{{Url: "u"}}
+	tests := []struct {
+		name   string
+		vs     Versions
+		latest string
+		want   string
+	}{
+		{"no pointer", Versions{"1.0.0": files, "1.1.0": files}, "", `{"1.1.0":[` + vFileJSON(t) + `],"1.0.0":[` + vFileJSON(t) + `]}`},
+		{"pointer", Versions{"1.0.0": files, "1.1.0": files}, "1.1.0", `{"latest":"1.1.0","1.1.0":[` + vFileJSON(t) + `],"1.0.0":[` + vFileJSON(t) + `]}`},
+		{"latest version", Versions{"latest": files}, "latest", `{"latest":[` + vFileJSON(t) + `]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := tt.vs.marshal(tt.latest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("marshal(%q) = %s, want %s", tt.latest, content, tt.want)
+			}
+			got := Versions{}
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.vs) {
+				t.Errorf("round trip = %v, want %v", got, tt.vs)
+			}
+		})
+	}
+}
+
+func vFileJSON(t *testing.T) string {
+	t.Helper()
+	content, err := json.Marshal(VFile{Url: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
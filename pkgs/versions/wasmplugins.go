@@ -0,0 +1,81 @@
+package versions
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+/*
+Sandboxed plugins, WebAssembly modules for WASI preview 1, like those of GOOS=wasip1 GOARCH=wasm go build,
+run by wazero in the process of pxy. They speak the json lines of native plugins over stdin and stdout,
+and get nothing else from the host: no files, no sockets, no env besides PXY_PLUGIN_API,
+and at most PluginMemoryLimit pages of memory. Pages are fetched by the fetch method of the host api,
+so fetch policies and proxies apply. The module is closed when PluginTimeout is over.
+*/
+
+const (
+	PluginWasmExt     string = ".wasm"
+	PluginMemoryLimit uint32 = 4096 // pages of 64KiB, 256MiB.
+)
+
+func (p *PluginCollector) runWasm(ctx context.Context) error {
+	code, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(PluginMemoryLimit).
+		WithCloseOnContextDone(true))
+	defer r.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	compiled, err := r.CompileModule(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	config := wazero.NewModuleConfig().
+		WithName(p.name).
+		WithArgs(p.name).
+		WithEnv(PluginApiEnvName, strconv.Itoa(PluginApiVersion)).
+		WithStdin(stdinR).
+		WithStdout(stdoutW).
+		WithStderr(os.Stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	done := make(chan error, 1)
+	go func() {
+		// _start runs until the module exits.
+		_, err := r.InstantiateModule(ctx, compiled, config)
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+			err = nil
+		}
+		stdinR.Close()
+		stdoutW.Close()
+		done <- err
+	}()
+	err = p.serve(stdinW, stdoutR)
+	stdinW.Close()
+	if err != nil {
+		// a module blocked on writing its stdout is closed.
+		stdoutR.Close()
+		cancel()
+	}
+	if runErr := <-done; err == nil {
+		err = runErr
+	}
+	return err
+}
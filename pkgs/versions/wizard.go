@@ -0,0 +1,192 @@
+package versions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gvcgo/collector/pkgs/confs"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Wizard of pxy rules new, writes a rule file step by step:
+the page or github repo, include and exclude filters, the version regexp,
+and os/arch mappings for files that are not recognized, the rule is tried after each step.
+*/
+
+const wizardSamples int = 12
+
+var githubRepoPattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+type wizard struct {
+	cnf  *confs.CollectorConf
+	in   *bufio.Scanner
+	out  io.Writer
+	rule *Rule
+}
+
+// Asks a question, def is returned for empty answers.
+func (w *wizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	if !w.in.Scan() {
+		return def
+	}
+	if answer := strings.TrimSpace(w.in.Text()); answer != "" {
+		return answer
+	}
+	return def
+}
+
+func splitList(s string) (r []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			r = append(r, item)
+		}
+	}
+	return
+}
+
+// Tries the rule, and prints the newest files with their os and arch.
+func (w *wizard) try() (vs Versions, unknown []*VFile) {
+	if err := w.rule.validate(); err != nil {
+		fmt.Fprintf(w.out, "Invalid rule: %v\n", err)
+		return
+	}
+	c := NewRuleCollector(w.cnf, "", w.rule, time.Time{})
+	c.FetchAll()
+	vs = c.versions
+	shown := 0
+	fmt.Fprintf(w.out, "\n%d versions found, newest files:\n", len(vs))
+	for _, vName := range vs.Names() {
+		for _, f := range vs[vName] {
+			if f.Os == "" || f.Arch == "" {
+				unknown = append(unknown, f)
+			}
+			if shown < wizardSamples {
+				shown++
+				fmt.Fprintf(w.out, "  %-12s %-8s %-8s %s\n", vName, orUnknown(f.Os), orUnknown(f.Arch), fileNameOf(f.Url))
+			}
+		}
+	}
+	fmt.Fprintf(w.out, "%d files without os or arch.\n\n", len(unknown))
+	return
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
+
+func fileNameOf(link string) string {
+	if u, err := url.Parse(link); err == nil {
+		return filepath.Base(u.Path)
+	}
+	return link
+}
+
+// Asks for "part=value" mappings until an empty answer.
+func (w *wizard) askMapping(kind string, m map[string]string) {
+	for {
+		answer := w.ask(fmt.Sprintf("Map a part of file names to %s, like x86_64=amd64 (empty to finish)", kind), "")
+		if answer == "" {
+			return
+		}
+		part, value, ok := strings.Cut(answer, "=")
+		if !ok || strings.TrimSpace(part) == "" {
+			fmt.Fprintln(w.out, "Use part=value.")
+			continue
+		}
+		m[strings.TrimSpace(part)] = strings.TrimSpace(value)
+	}
+}
+
+/*
+Walks through a new rule, reading answers from in, and writes it into RulesDir.
+Returns the path of the rule file.
+*/
+func RuleWizard(cnf *confs.CollectorConf, name string, in io.Reader, out io.Writer) (fPath string, err error) {
+	w := &wizard{cnf: cnf, in: bufio.NewScanner(in), out: out, rule: &Rule{Os: map[string]string{}, Arch: map[string]string{}}}
+	for {
+		w.rule.Name = strings.ToLower(w.ask("Name of the collector, the version file is <name>.version.json", name))
+		if ruleNamePattern.MatchString(w.rule.Name) && findCollector(w.rule.Name) == nil {
+			break
+		}
+		fmt.Fprintln(out, "Use lowercase letters, digits, - and _, and a name not taken by other collectors.")
+		name = ""
+	}
+	source := w.ask("Github repo like owner/repo, or the url of a download page", "")
+	if githubRepoPattern.MatchString(source) {
+		w.rule.Url = fmt.Sprintf("https://api.github.com/repos/%s/releases", source)
+		w.rule.Format = RuleFormatJson
+		w.rule.Items = "*.assets.*"
+		w.rule.UrlPath = "browser_download_url"
+	} else {
+		w.rule.Url = source
+		w.rule.Selector = w.ask("Css selector of links", "a")
+	}
+	w.try()
+
+	w.rule.Include = splitList(w.ask("Links must contain one of, comma separated, like .tar.gz,.zip", strings.Join(w.rule.Include, ",")))
+	w.rule.Exclude = splitList(w.ask("Links must contain none of, comma separated, like sha256,.sig", strings.Join(w.rule.Exclude, ",")))
+	for {
+		w.rule.Version = w.ask("Regexp of versions in links, the first group is the version", VersionPattern.String())
+		if _, err := regexp.Compile(w.rule.Version); err == nil {
+			break
+		}
+		fmt.Fprintln(out, "Invalid regexp.")
+	}
+	if w.rule.Version == VersionPattern.String() {
+		w.rule.Version = ""
+	}
+	_, unknown := w.try()
+
+	for len(unknown) > 0 {
+		names := []string{}
+		for i, f := range unknown {
+			if i >= wizardSamples {
+				break
+			}
+			names = append(names, fileNameOf(f.Url))
+		}
+		sort.Strings(names)
+		fmt.Fprintf(out, "Not recognized:\n  %s\n", strings.Join(names, "\n  "))
+		w.askMapping("an os(linux, darwin, windows)", w.rule.Os)
+		w.askMapping("an arch(amd64, arm64, 386)", w.rule.Arch)
+		_, unknown = w.try()
+		if len(unknown) > 0 && w.ask("Map more? y/n", "n") != "y" {
+			break
+		}
+	}
+	if len(w.rule.Os) == 0 {
+		w.rule.Os = nil
+	}
+	if len(w.rule.Arch) == 0 {
+		w.rule.Arch = nil
+	}
+	content, err := yaml.Marshal(w.rule)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(cnf.RulesPath(), os.ModePerm); err != nil {
+		return "", err
+	}
+	fPath = filepath.Join(cnf.RulesPath(), w.rule.Name+".yaml")
+	if _, err := os.Stat(fPath); err == nil && w.ask(fPath+" exists, overwrite? y/n", "n") != "y" {
+		return "", fmt.Errorf("%s exists", fPath)
+	}
+	return fPath, os.WriteFile(fPath, content, os.ModePerm)
+}
@@ -1,26 +1,34 @@
 package versions
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
-	"github.com/gvcgo/goutils/pkgs/request"
+	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/collector/pkgs/confs"
+	"github.com/gvcgo/collector/pkgs/fetch"
+	"github.com/gvcgo/collector/pkgs/logs"
 	"github.com/gvcgo/collector/pkgs/upload"
 	"github.com/gvcgo/collector/pkgs/utils"
+	"github.com/gvcgo/goutils/pkgs/request"
 )
 
 const (
 	ZigVersionFileName string = "zig.version.json"
+	ZigApiUrl          string = "https://ziglang.org/download/index.json"
 )
 
+// A target in https://ziglang.org/download/index.json, like "x86_64-linux".
+type zigTarget struct {
+	Tarball string `json:"tarball"`
+	Shasum  string `json:"shasum"`
+	Size    string `json:"size"`
+}
+
 /*
 https://ziglang.org/download/
 */
@@ -49,15 +57,15 @@ func NewZig(cnf *confs.CollectorConf) (z *Zig) {
 func (z *Zig) getDoc() {
 	z.fetcher.SetUrl(z.homepage)
 	z.fetcher.Timeout = 60 * time.Second
-	if resp := z.fetcher.Get(); resp != nil {
+	if resp, _ := fetch.GetString(z.cnf, z.fetcher); resp != "" {
 		var err error
-		z.doc, err = goquery.NewDocumentFromReader(resp.RawBody())
+		z.doc, err = goquery.NewDocumentFromReader(strings.NewReader(resp))
 		if err != nil {
-			gprint.PrintError(fmt.Sprintf("Parse page errored: %+v", err))
+			logs.Error("Parse page errored: %+v", err)
 		}
 		if z.doc == nil {
-			gprint.PrintError(fmt.Sprintf("Cannot parse html for %s", z.fetcher.Url))
-			os.Exit(1)
+			logs.Error("Cannot parse html for %s", z.fetcher.Url)
+			return
 		}
 	}
 }
@@ -100,16 +108,54 @@ func (z *Zig) GetVersions() {
 	}
 }
 
+// Tarballs from the json index of the download page.
+func (z *Zig) fetchFromApi() {
+	index := map[string]map[string]json.RawMessage{}
+	if err := getApiJson(z.cnf, z.fetcher, ZigApiUrl, &index); err != nil {
+		logs.Error("%+v", err)
+		return
+	}
+	for vName, targets := range index {
+		for target, raw := range targets {
+			archStr, osStr, ok := strings.Cut(target, "-")
+			if !ok {
+				continue // date, docs, notes...
+			}
+			t := &zigTarget{}
+			if json.Unmarshal(raw, t) != nil || t.Tarball == "" {
+				continue
+			}
+			ver := &VFile{
+				Url:  t.Tarball,
+				Arch: utils.ParseArch(archStr),
+				Os:   utils.ParsePlatform(osStr),
+				Sum:  t.Shasum,
+				Size: gconv.Int64(t.Size),
+			}
+			if ver.Arch == "" || ver.Os == "" {
+				continue
+			}
+			if ver.Sum != "" {
+				ver.SumType = utils.SumTypeOf(ver.Sum)
+			}
+			z.versions[vName] = append(z.versions[vName], ver)
+		}
+	}
+}
+
 func (z *Zig) FetchAll() {
-	z.GetVersions()
+	withApiFallback(z.cnf, "zig", func() int { return len(z.versions) }, z.GetVersions, z.fetchFromApi)
 }
 
 func (z *Zig) Upload() {
-	if len(z.versions) > 0 {
-		fPath := filepath.Join(z.cnf.DirPath(), ZigVersionFileName)
-		if content, err := json.MarshalIndent(z.versions, "", "  "); err == nil && content != nil {
-			os.WriteFile(fPath, content, os.ModePerm)
-			z.uploader.Upload(fPath)
-		}
-	}
+	z.versions = publishVersions(z.cnf, z.uploader, "zig", ZigVersionFileName, z.versions)
+}
+
+// Collects versions without publishing them, see api.go.
+func (z *Zig) Collect(ctx context.Context) (Versions, error) {
+	return collectVersions(ctx, z.cnf, "zig", z.FetchAll, &z.versions)
+}
+
+func (z *Zig) VersionFileName() string {
+	return ZigVersionFileName
 }